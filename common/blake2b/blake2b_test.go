@@ -0,0 +1,45 @@
+package blake2b
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// Tests a single compression of the padded "abc" block yields the BLAKE2b-512 digest from RFC 7693
+func TestF(t *testing.T) {
+	h := iv
+	h[0] ^= 0x01010040 // digest length 64 bytes, no key, fanout and depth 1
+	var m [16]uint64
+	m[0] = 0x636261
+	F(&h, m, [2]uint64{3, 0}, true, 12)
+
+	digest := make([]byte, 64)
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint64(digest[i*8:], h[i])
+	}
+	expected := "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"
+	if hex.EncodeToString(digest) != expected {
+		t.Errorf("Expected %v, got %v", expected, hex.EncodeToString(digest))
+	}
+}
+
+// Tests zero rounds only fold the iv, the counter and the final flag into the state
+func TestFZeroRounds(t *testing.T) {
+	var h [8]uint64
+	F(&h, [16]uint64{}, [2]uint64{1, 2}, true, 0)
+	for i := 0; i < 8; i++ {
+		expected := iv[i]
+		switch i {
+		case 4:
+			expected ^= 1
+		case 5:
+			expected ^= 2
+		case 6:
+			expected = ^expected
+		}
+		if h[i] != expected {
+			t.Errorf("word %d: expected %x, got %x", i, expected, h[i])
+		}
+	}
+}
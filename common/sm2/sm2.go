@@ -0,0 +1,174 @@
+// Package sm2 implements the verification and the public key recovery of the SM2 digital
+// signature algorithm defined in GB/T 32918-2016, using the recommended 256-bit curve.
+package sm2
+
+import (
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"github.com/DSiSc/evm-NG/common/sm3"
+	"math/big"
+	"sync"
+)
+
+// DefaultUserId the default user identity used to compute Z, as recommended by GM/T 0009-2012
+var DefaultUserId = []byte("1234567812345678")
+
+var (
+	InvalidSignatureError  = errors.New("invalid sm2 signature")
+	InvalidRecoveryIdError = errors.New("invalid sm2 recovery id")
+	InvalidPublicKeyError  = errors.New("invalid sm2 public key")
+	InvalidUserIdError     = errors.New("sm2 user id is too long")
+)
+
+var (
+	initOnce sync.Once
+	sm2P256  *elliptic.CurveParams
+	sm2A     *big.Int
+)
+
+func initP256Sm2() {
+	sm2P256 = &elliptic.CurveParams{Name: "SM2-P-256"}
+	sm2P256.P, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00000000FFFFFFFFFFFFFFFF", 16)
+	sm2P256.N, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF7203DF6B21C6052B53BBF40939D54123", 16)
+	sm2P256.B, _ = new(big.Int).SetString("28E9FA9E9D9F5E344D5A9E4BCF6509A7F39789F515AB8F92DDBCBD414D940E93", 16)
+	sm2P256.Gx, _ = new(big.Int).SetString("32C4AE2C1F1981195F9904466A39C9948FE30BBFF2660BE1715A4589334C74C7", 16)
+	sm2P256.Gy, _ = new(big.Int).SetString("BC3736A2F4F6779C59BDCEE36B692153D0A9877CC62A474002DF32E52139F0A0", 16)
+	sm2P256.BitSize = 256
+	// a = p - 3, which is assumed by the generic curve arithmetic
+	sm2A = new(big.Int).Sub(sm2P256.P, big.NewInt(3))
+}
+
+// P256Sm2 returns the recommended curve of SM2.
+func P256Sm2() *elliptic.CurveParams {
+	initOnce.Do(initP256Sm2)
+	return sm2P256
+}
+
+// ZA returns the hash of the user identity and the public key, which is prepended to the
+// message to compute the digest being signed.
+func ZA(x, y *big.Int, uid []byte) ([]byte, error) {
+	curve := P256Sm2()
+	if len(uid) >= 8192 {
+		return nil, InvalidUserIdError
+	}
+	var entl [2]byte
+	binary.BigEndian.PutUint16(entl[:], uint16(len(uid)*8))
+	h := sm3.New()
+	h.Write(entl[:])
+	h.Write(uid)
+	for _, v := range []*big.Int{sm2A, curve.B, curve.Gx, curve.Gy, x, y} {
+		h.Write(toBytes32(v))
+	}
+	return h.Sum(nil), nil
+}
+
+// Digest returns the digest e = SM3(ZA || msg) being signed by the public key.
+func Digest(x, y *big.Int, uid, msg []byte) ([]byte, error) {
+	za, err := ZA(x, y, uid)
+	if err != nil {
+		return nil, err
+	}
+	h := sm3.New()
+	h.Write(za)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify reports whether (r, s) is the valid signature of the digest e by the public key.
+func Verify(x, y *big.Int, e []byte, r, s *big.Int) bool {
+	curve := P256Sm2()
+	if x == nil || y == nil || !curve.IsOnCurve(x, y) {
+		return false
+	}
+	if !inRange(r) || !inRange(s) {
+		return false
+	}
+	t := new(big.Int).Add(r, s)
+	t.Mod(t, curve.N)
+	if t.Sign() == 0 {
+		return false
+	}
+	x1, y1 := curve.ScalarBaseMult(toBytes32(s))
+	x2, y2 := curve.ScalarMult(x, y, toBytes32(t))
+	x1, _ = curve.Add(x1, y1, x2, y2)
+
+	rr := new(big.Int).SetBytes(e)
+	rr.Add(rr, x1)
+	rr.Mod(rr, curve.N)
+	return rr.Cmp(r) == 0
+}
+
+// RecoverPubkey returns the public key signing the digest e with the signature (r, s), v is the
+// parity of the y coordinate of the random point kG. The digest depends on ZA of the signer, so
+// the recovered key is only trusted once e is recomputed with ZA of the recovered key.
+func RecoverPubkey(e []byte, r, s *big.Int, v byte) (*big.Int, *big.Int, error) {
+	curve := P256Sm2()
+	if v > 1 {
+		return nil, nil, InvalidRecoveryIdError
+	}
+	if !inRange(r) || !inRange(s) {
+		return nil, nil, InvalidSignatureError
+	}
+	// r = (e + x1) mod n, so x1 = (r - e) mod n
+	x1 := new(big.Int).SetBytes(e)
+	x1.Sub(r, x1)
+	x1.Mod(x1, curve.N)
+	y1 := decompressY(x1, v)
+	if y1 == nil {
+		return nil, nil, InvalidSignatureError
+	}
+	// s = (1 + d)^-1 * (k - r * d), so P = (s + r)^-1 * (kG - sG)
+	t := new(big.Int).Add(s, r)
+	t.Mod(t, curve.N)
+	if t.Sign() == 0 {
+		return nil, nil, InvalidSignatureError
+	}
+	sx, sy := curve.ScalarBaseMult(toBytes32(s))
+	// -sG = (sx, p - sy)
+	sy.Sub(curve.P, sy)
+	qx, qy := curve.Add(x1, y1, sx, sy)
+	tInv := new(big.Int).ModInverse(t, curve.N)
+	px, py := curve.ScalarMult(qx, qy, toBytes32(tInv))
+	if px.Sign() == 0 && py.Sign() == 0 {
+		return nil, nil, InvalidPublicKeyError
+	}
+	return px, py, nil
+}
+
+// return whether 1 <= v < n
+func inRange(v *big.Int) bool {
+	return v != nil && v.Sign() > 0 && v.Cmp(P256Sm2().N) < 0
+}
+
+// return y of the point with the coordinate x and the parity of y, nil if x is not on the curve
+func decompressY(x *big.Int, parity byte) *big.Int {
+	curve := P256Sm2()
+	if x.Cmp(curve.P) >= 0 {
+		return nil
+	}
+	// y^2 = x^3 - 3x + b
+	y2 := new(big.Int).Mul(x, x)
+	y2.Mul(y2, x)
+	threeX := new(big.Int).Lsh(x, 1)
+	threeX.Add(threeX, x)
+	y2.Sub(y2, threeX)
+	y2.Add(y2, curve.B)
+	y2.Mod(y2, curve.P)
+	y := new(big.Int).ModSqrt(y2, curve.P)
+	if y == nil {
+		return nil
+	}
+	if byte(y.Bit(0)) != parity {
+		y.Sub(curve.P, y)
+	}
+	return y
+}
+
+// return v as the 32 bytes big endian integer
+func toBytes32(v *big.Int) []byte {
+	out := make([]byte, 32)
+	b := v.Bytes()
+	copy(out[32-len(b):], b)
+	return out
+}
@@ -0,0 +1,117 @@
+package sm2
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// the signature example with the recommended curve in GB/T 32918
+var (
+	testPrivateKey = fromHex("3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8")
+	testPublicX    = fromHex("09F9DF311E5421A150DD7D161E4BC5C672179FAD1833FC076BB08FF356F35020")
+	testPublicY    = fromHex("CCEA490CE26775A52DC6EA718CC1AA600AED05FBF35E084A6632F6072DA9AD13")
+	testMessage    = []byte("message digest")
+	testK          = fromHex("59276E27D506861A16680F3AD9C02DCCEF3CC1FA3CDBE4CE6D54B80DEAC1BC21")
+	testR          = fromHex("F5A03B0648D2C4630EEAC513E1BB81A15944DA3827D5B74143AC7EACEEE720B3")
+	testS          = fromHex("B1B6AA29DF212FD8763182BC0D421CA1BB9038FD1F7F42D4840B69C485BBC1AA")
+)
+
+func fromHex(s string) *big.Int {
+	v, _ := new(big.Int).SetString(s, 16)
+	return v
+}
+
+// sign the digest e with the private key d and the random k, return the signature and the recovery id
+func sign(d, k *big.Int, e []byte) (*big.Int, *big.Int, byte) {
+	curve := P256Sm2()
+	x1, y1 := curve.ScalarBaseMult(toBytes32(k))
+	r := new(big.Int).SetBytes(e)
+	r.Add(r, x1)
+	r.Mod(r, curve.N)
+	s := new(big.Int).Mul(r, d)
+	s.Sub(k, s)
+	dInv := new(big.Int).Add(d, big.NewInt(1))
+	dInv.ModInverse(dInv, curve.N)
+	s.Mul(s, dInv)
+	s.Mod(s, curve.N)
+	return r, s, byte(y1.Bit(0))
+}
+
+func TestP256Sm2(t *testing.T) {
+	curve := P256Sm2()
+	if !curve.IsOnCurve(curve.Gx, curve.Gy) {
+		t.Fatal("expected the base point on the curve")
+	}
+	x, y := curve.ScalarBaseMult(toBytes32(testPrivateKey))
+	if x.Cmp(testPublicX) != 0 || y.Cmp(testPublicY) != 0 {
+		t.Errorf("expected public key (%x, %x), got (%x, %x)", testPublicX, testPublicY, x, y)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	za, err := ZA(testPublicX, testPublicY, DefaultUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(za) != "b2e14c5c79c6df5b85f4fe7ed8db7a262b9da7e07ccb0ea9f4747b8ccda8a4f3" {
+		t.Errorf("unexpected ZA %x", za)
+	}
+	e, err := Digest(testPublicX, testPublicY, DefaultUserId, testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(e) != "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" {
+		t.Errorf("unexpected digest %x", e)
+	}
+	if _, err = ZA(testPublicX, testPublicY, make([]byte, 8192)); err != InvalidUserIdError {
+		t.Errorf("expected error %v, got %v", InvalidUserIdError, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	e, _ := Digest(testPublicX, testPublicY, DefaultUserId, testMessage)
+	r, s, _ := sign(testPrivateKey, testK, e)
+	if r.Cmp(testR) != 0 || s.Cmp(testS) != 0 {
+		t.Fatalf("expected signature (%x, %x), got (%x, %x)", testR, testS, r, s)
+	}
+	if !Verify(testPublicX, testPublicY, e, testR, testS) {
+		t.Error("expected the signature to be valid")
+	}
+
+	tampered := append([]byte{}, e...)
+	tampered[0] ^= 1
+	if Verify(testPublicX, testPublicY, tampered, testR, testS) {
+		t.Error("expected the signature of another digest to be invalid")
+	}
+	if Verify(testPublicX, testPublicY, e, testR, new(big.Int).Add(testS, big.NewInt(1))) {
+		t.Error("expected the tampered signature to be invalid")
+	}
+	if Verify(testPublicX, testPublicY, e, testR, new(big.Int)) || Verify(testPublicX, testPublicY, e, P256Sm2().N, testS) {
+		t.Error("expected the signature out of range to be invalid")
+	}
+	if Verify(testPublicX, new(big.Int).Add(testPublicY, big.NewInt(1)), e, testR, testS) {
+		t.Error("expected the public key off the curve to be invalid")
+	}
+}
+
+func TestRecoverPubkey(t *testing.T) {
+	e, _ := Digest(testPublicX, testPublicY, DefaultUserId, testMessage)
+	_, _, v := sign(testPrivateKey, testK, e)
+	x, y, err := RecoverPubkey(e, testR, testS, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Cmp(testPublicX) != 0 || y.Cmp(testPublicY) != 0 {
+		t.Errorf("expected public key (%x, %x), got (%x, %x)", testPublicX, testPublicY, x, y)
+	}
+	if x, y, err = RecoverPubkey(e, testR, testS, v^1); err == nil && x.Cmp(testPublicX) == 0 && y.Cmp(testPublicY) == 0 {
+		t.Error("expected the other recovery id to recover another public key")
+	}
+	if _, _, err = RecoverPubkey(e, testR, testS, 2); err != InvalidRecoveryIdError {
+		t.Errorf("expected error %v, got %v", InvalidRecoveryIdError, err)
+	}
+	if _, _, err = RecoverPubkey(e, new(big.Int), testS, v); err != InvalidSignatureError {
+		t.Errorf("expected error %v, got %v", InvalidSignatureError, err)
+	}
+}
@@ -0,0 +1,44 @@
+package sm3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// the examples in the appendix A of GB/T 32905-2016
+var sm3Tests = []struct {
+	input, expected string
+}{
+	{"abc", "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"},
+	{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd", "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"},
+}
+
+func TestSum(t *testing.T) {
+	for _, test := range sm3Tests {
+		sum := Sum([]byte(test.input))
+		if hex.EncodeToString(sum[:]) != test.expected {
+			t.Errorf("%s: expected %s, got %x", test.input, test.expected, sum)
+		}
+	}
+}
+
+// Tests the checksum is not affected by how the data is split into writes
+func TestWrite(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 30)
+	expected := Sum(data)
+	for split := 0; split <= len(data); split += 7 {
+		h := New()
+		h.Write(data[:split])
+		h.Write(data[split:])
+		if sum := h.Sum(nil); !bytes.Equal(sum, expected[:]) {
+			t.Errorf("split %d: expected %x, got %x", split, expected, sum)
+		}
+	}
+	h := New()
+	h.Write(data)
+	first := h.Sum(nil)
+	if second := h.Sum(nil); !bytes.Equal(first, second) {
+		t.Errorf("expected Sum not to change the state")
+	}
+}
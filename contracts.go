@@ -17,13 +17,21 @@
 package evm
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/crypto-suite/crypto/bn256"
 	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/common/blake2b"
+	"github.com/DSiSc/evm-NG/common/bls12381"
 	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/common/sm2"
+	"github.com/DSiSc/evm-NG/common/sm3"
 	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/util"
 	"golang.org/x/crypto/ripemd160"
@@ -34,8 +42,8 @@ import (
 // requires a deterministic gas count based on the input size of the Run method of the
 // contract.
 type PrecompiledContract interface {
-	RequiredGas(input []byte) uint64  // RequiredPrice calculates the contract gas use
-	Run(input []byte) ([]byte, error) // Run runs the precompiled contract
+	RequiredGas(input []byte, rules params.Rules) uint64 // RequiredPrice calculates the contract gas use under the active rules
+	Run(input []byte) ([]byte, error)                    // Run runs the precompiled contract
 }
 
 // PrecompiledContractsHomestead contains the default set of pre-compiled Ethereum
@@ -60,9 +68,145 @@ var PrecompiledContractsByzantium = map[types.Address]PrecompiledContract{
 	util.BytesToAddress([]byte{8}): &bn256Pairing{},
 }
 
-// RunPrecompiledContract runs and evaluates the output of a precompiled contract.
-func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
-	gas := p.RequiredGas(input)
+// PrecompiledContractsIstanbul contains the default set of pre-compiled Ethereum
+// contracts used in the Istanbul release.
+var PrecompiledContractsIstanbul = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{1}): &ecrecover{},
+	util.BytesToAddress([]byte{2}): &sha256hash{},
+	util.BytesToAddress([]byte{3}): &ripemd160hash{},
+	util.BytesToAddress([]byte{4}): &dataCopy{},
+	util.BytesToAddress([]byte{5}): &bigModExp{},
+	util.BytesToAddress([]byte{6}): &bn256Add{},
+	util.BytesToAddress([]byte{7}): &bn256ScalarMul{},
+	util.BytesToAddress([]byte{8}): &bn256Pairing{},
+	util.BytesToAddress([]byte{9}): &blake2F{},
+}
+
+// PrecompiledContractsPrague contains the default set of pre-compiled Ethereum
+// contracts used in the Prague release, which adds the BLS12-381 operations (EIP-2537).
+var PrecompiledContractsPrague = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{0x01}): &ecrecover{},
+	util.BytesToAddress([]byte{0x02}): &sha256hash{},
+	util.BytesToAddress([]byte{0x03}): &ripemd160hash{},
+	util.BytesToAddress([]byte{0x04}): &dataCopy{},
+	util.BytesToAddress([]byte{0x05}): &bigModExp{},
+	util.BytesToAddress([]byte{0x06}): &bn256Add{},
+	util.BytesToAddress([]byte{0x07}): &bn256ScalarMul{},
+	util.BytesToAddress([]byte{0x08}): &bn256Pairing{},
+	util.BytesToAddress([]byte{0x09}): &blake2F{},
+	util.BytesToAddress([]byte{0x0b}): &bls12381G1Add{},
+	util.BytesToAddress([]byte{0x0c}): &bls12381G1MultiExp{},
+	util.BytesToAddress([]byte{0x0d}): &bls12381G2Add{},
+	util.BytesToAddress([]byte{0x0e}): &bls12381G2MultiExp{},
+	util.BytesToAddress([]byte{0x0f}): &bls12381Pairing{},
+	util.BytesToAddress([]byte{0x10}): &bls12381MapG1{},
+	util.BytesToAddress([]byte{0x11}): &bls12381MapG2{},
+}
+
+// PrecompiledContractsOsaka contains the default set of pre-compiled Ethereum
+// contracts used in the Osaka release, which adds the secp256r1 verification (EIP-7951).
+var PrecompiledContractsOsaka = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{0x01}):       &ecrecover{},
+	util.BytesToAddress([]byte{0x02}):       &sha256hash{},
+	util.BytesToAddress([]byte{0x03}):       &ripemd160hash{},
+	util.BytesToAddress([]byte{0x04}):       &dataCopy{},
+	util.BytesToAddress([]byte{0x05}):       &bigModExp{},
+	util.BytesToAddress([]byte{0x06}):       &bn256Add{},
+	util.BytesToAddress([]byte{0x07}):       &bn256ScalarMul{},
+	util.BytesToAddress([]byte{0x08}):       &bn256Pairing{},
+	util.BytesToAddress([]byte{0x09}):       &blake2F{},
+	util.BytesToAddress([]byte{0x0b}):       &bls12381G1Add{},
+	util.BytesToAddress([]byte{0x0c}):       &bls12381G1MultiExp{},
+	util.BytesToAddress([]byte{0x0d}):       &bls12381G2Add{},
+	util.BytesToAddress([]byte{0x0e}):       &bls12381G2MultiExp{},
+	util.BytesToAddress([]byte{0x0f}):       &bls12381Pairing{},
+	util.BytesToAddress([]byte{0x10}):       &bls12381MapG1{},
+	util.BytesToAddress([]byte{0x11}):       &bls12381MapG2{},
+	util.BytesToAddress([]byte{0x01, 0x00}): &p256Verify{},
+}
+
+// PrecompiledContracts is the set of precompiled contracts indexed by address.
+type PrecompiledContracts map[types.Address]PrecompiledContract
+
+// PrecompileOverride adds or overrides the precompiled contract at Address once the
+// block number reaches ActivationBlock, a nil Contract removes the precompile.
+type PrecompileOverride struct {
+	Address         types.Address
+	Contract        PrecompiledContract
+	ActivationBlock *big.Int // nil means active from genesis
+}
+
+// IsActive returns whether the override is active at the block number.
+func (o *PrecompileOverride) IsActive(num *big.Int) bool {
+	if o.ActivationBlock == nil {
+		return true
+	}
+	return num != nil && o.ActivationBlock.Cmp(num) <= 0
+}
+
+// ActivePrecompiles returns a new set of the precompiled contracts active under the
+// chain rules, with the overrides active at the block number applied in order. The
+// package level default sets are never modified.
+func ActivePrecompiles(rules params.Rules, num *big.Int, overrides []PrecompileOverride) PrecompiledContracts {
+	defaults := PrecompiledContractsHomestead
+	switch {
+	case rules.IsOsaka:
+		defaults = PrecompiledContractsOsaka
+	case rules.IsPrague:
+		defaults = PrecompiledContractsPrague
+	case rules.IsIstanbul:
+		defaults = PrecompiledContractsIstanbul
+	case rules.IsByzantium:
+		defaults = PrecompiledContractsByzantium
+	}
+	precompiles := make(PrecompiledContracts, len(defaults)+len(overrides))
+	for addr, p := range defaults {
+		precompiles[addr] = p
+	}
+	for i := range overrides {
+		override := &overrides[i]
+		if !override.IsActive(num) {
+			continue
+		}
+		if override.Contract == nil {
+			delete(precompiles, override.Address)
+		} else {
+			precompiles[override.Address] = override.Contract
+		}
+	}
+	return precompiles
+}
+
+// GMPrecompileAddresses are the addresses of the GM/T national cryptography precompiles.
+// They are not part of any Ethereum release, so they are only activated as overrides.
+type GMPrecompileAddresses struct {
+	SM3        types.Address
+	SM2Verify  types.Address
+	SM2Recover types.Address
+}
+
+// DefaultGMPrecompileAddresses are the default addresses of the GM/T precompiles. They are
+// placed at 0x5001-0x5003, away from the Ethereum precompiles at 0x01-0x11 and P256VERIFY at 0x100.
+var DefaultGMPrecompileAddresses = GMPrecompileAddresses{
+	SM3:        util.BytesToAddress([]byte{0x50, 0x01}),
+	SM2Verify:  util.BytesToAddress([]byte{0x50, 0x02}),
+	SM2Recover: util.BytesToAddress([]byte{0x50, 0x03}),
+}
+
+// GMPrecompiles returns the overrides adding the GM/T precompiles at the addresses from
+// the activation block, which are supposed to be set to Config.Precompiles.
+func GMPrecompiles(addrs GMPrecompileAddresses, activationBlock *big.Int) []PrecompileOverride {
+	return []PrecompileOverride{
+		{Address: addrs.SM3, Contract: &sm3hash{}, ActivationBlock: activationBlock},
+		{Address: addrs.SM2Verify, Contract: &sm2Verify{}, ActivationBlock: activationBlock},
+		{Address: addrs.SM2Recover, Contract: &sm2Recover{}, ActivationBlock: activationBlock},
+	}
+}
+
+// RunPrecompiledContract runs and evaluates the output of a precompiled contract,
+// the gas is charged by the schedule of the active rules.
+func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract, rules params.Rules) (ret []byte, err error) {
+	gas := p.RequiredGas(input, rules)
 	if contract.UseGas(gas) {
 		return p.Run(input)
 	}
@@ -72,7 +216,7 @@ func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contr
 // ECRECOVER implemented as a native contract.
 type ecrecover struct{}
 
-func (c *ecrecover) RequiredGas(input []byte) uint64 {
+func (c *ecrecover) RequiredGas(input []byte, rules params.Rules) uint64 {
 	return params.EcrecoverGas
 }
 
@@ -109,7 +253,7 @@ type sha256hash struct{}
 //
 // This method does not require any overflow checking as the input size gas costs
 // required for anything significant is so high it's impossible to pay for.
-func (c *sha256hash) RequiredGas(input []byte) uint64 {
+func (c *sha256hash) RequiredGas(input []byte, rules params.Rules) uint64 {
 	return uint64(len(input)+31)/32*params.Sha256PerWordGas + params.Sha256BaseGas
 }
 func (c *sha256hash) Run(input []byte) ([]byte, error) {
@@ -124,7 +268,7 @@ type ripemd160hash struct{}
 //
 // This method does not require any overflow checking as the input size gas costs
 // required for anything significant is so high it's impossible to pay for.
-func (c *ripemd160hash) RequiredGas(input []byte) uint64 {
+func (c *ripemd160hash) RequiredGas(input []byte, rules params.Rules) uint64 {
 	return uint64(len(input)+31)/32*params.Ripemd160PerWordGas + params.Ripemd160BaseGas
 }
 func (c *ripemd160hash) Run(input []byte) ([]byte, error) {
@@ -140,7 +284,7 @@ type dataCopy struct{}
 //
 // This method does not require any overflow checking as the input size gas costs
 // required for anything significant is so high it's impossible to pay for.
-func (c *dataCopy) RequiredGas(input []byte) uint64 {
+func (c *dataCopy) RequiredGas(input []byte, rules params.Rules) uint64 {
 	return uint64(len(input)+31)/32*params.IdentityPerWordGas + params.IdentityBaseGas
 }
 func (c *dataCopy) Run(in []byte) ([]byte, error) {
@@ -165,7 +309,7 @@ var (
 )
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-func (c *bigModExp) RequiredGas(input []byte) uint64 {
+func (c *bigModExp) RequiredGas(input []byte, rules params.Rules) uint64 {
 	var (
 		baseLen = new(big.Int).SetBytes(getData(input, 0, 32))
 		expLen  = new(big.Int).SetBytes(getData(input, 32, 32))
@@ -276,8 +420,11 @@ func newTwistPoint(blob []byte) (*bn256.G2, error) {
 type bn256Add struct{}
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-func (c *bn256Add) RequiredGas(input []byte) uint64 {
-	return params.Bn256AddGas
+func (c *bn256Add) RequiredGas(input []byte, rules params.Rules) uint64 {
+	if rules.IsIstanbul {
+		return params.Bn256AddGasIstanbul
+	}
+	return params.Bn256AddGasByzantium
 }
 
 func (c *bn256Add) Run(input []byte) ([]byte, error) {
@@ -298,8 +445,11 @@ func (c *bn256Add) Run(input []byte) ([]byte, error) {
 type bn256ScalarMul struct{}
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-func (c *bn256ScalarMul) RequiredGas(input []byte) uint64 {
-	return params.Bn256ScalarMulGas
+func (c *bn256ScalarMul) RequiredGas(input []byte, rules params.Rules) uint64 {
+	if rules.IsIstanbul {
+		return params.Bn256ScalarMulGasIstanbul
+	}
+	return params.Bn256ScalarMulGasByzantium
 }
 
 func (c *bn256ScalarMul) Run(input []byte) ([]byte, error) {
@@ -327,8 +477,11 @@ var (
 type bn256Pairing struct{}
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-func (c *bn256Pairing) RequiredGas(input []byte) uint64 {
-	return params.Bn256PairingBaseGas + uint64(len(input)/192)*params.Bn256PairingPerPointGas
+func (c *bn256Pairing) RequiredGas(input []byte, rules params.Rules) uint64 {
+	if rules.IsIstanbul {
+		return params.Bn256PairingBaseGasIstanbul + uint64(len(input)/192)*params.Bn256PairingPerPointGasIstanbul
+	}
+	return params.Bn256PairingBaseGasByzantium + uint64(len(input)/192)*params.Bn256PairingPerPointGasByzantium
 }
 
 func (c *bn256Pairing) Run(input []byte) ([]byte, error) {
@@ -359,3 +512,557 @@ func (c *bn256Pairing) Run(input []byte) ([]byte, error) {
 	}
 	return false32Byte, nil
 }
+
+const blake2FInputLength = 213
+
+var (
+	errBlake2FInvalidInputLength = errors.New("invalid input length")
+	errBlake2FInvalidFinalFlag   = errors.New("invalid final flag")
+)
+
+// blake2F implements the BLAKE2b F compression function as a native contract (EIP-152).
+type blake2F struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract, which is
+// proportional to the rounds. An input of invalid length is rejected by Run for free.
+func (c *blake2F) RequiredGas(input []byte, rules params.Rules) uint64 {
+	if len(input) != blake2FInputLength {
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(input[0:4])) * params.Blake2FRoundGas
+}
+
+func (c *blake2F) Run(input []byte) ([]byte, error) {
+	// Make sure the input is valid (correct length and final flag)
+	if len(input) != blake2FInputLength {
+		return nil, errBlake2FInvalidInputLength
+	}
+	if input[212] != 0 && input[212] != 1 {
+		return nil, errBlake2FInvalidFinalFlag
+	}
+	// Parse the input into the BLAKE2b call parameters
+	var (
+		rounds = binary.BigEndian.Uint32(input[0:4])
+		final  = input[212] == 1
+
+		h [8]uint64
+		m [16]uint64
+		t [2]uint64
+	)
+	for i := 0; i < 8; i++ {
+		offset := 4 + i*8
+		h[i] = binary.LittleEndian.Uint64(input[offset : offset+8])
+	}
+	for i := 0; i < 16; i++ {
+		offset := 68 + i*8
+		m[i] = binary.LittleEndian.Uint64(input[offset : offset+8])
+	}
+	t[0] = binary.LittleEndian.Uint64(input[196:204])
+	t[1] = binary.LittleEndian.Uint64(input[204:212])
+
+	// Execute the compression function, extract and return the result
+	blake2b.F(&h, m, t, final, rounds)
+
+	output := make([]byte, 64)
+	for i := 0; i < 8; i++ {
+		offset := i * 8
+		binary.LittleEndian.PutUint64(output[offset:offset+8], h[i])
+	}
+	return output, nil
+}
+
+var (
+	errBLS12381InvalidInputLength          = errors.New("invalid input length")
+	errBLS12381InvalidFieldElementTopBytes = errors.New("invalid field element top bytes")
+	errBLS12381G1PointSubgroup             = errors.New("g1 point is not on correct subgroup")
+	errBLS12381G2PointSubgroup             = errors.New("g2 point is not on correct subgroup")
+)
+
+// bls12381G1Add implements EIP-2537 G1Add precompile.
+type bls12381G1Add struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G1Add) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.Bls12381G1AddGas
+}
+
+func (c *bls12381G1Add) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 G1Add precompile.
+	// > G1 addition call expects `256` bytes as an input that is interpreted as byte concatenation of two G1 points (`128` bytes each).
+	// > Output is an encoding of addition operation result - single G1 point (`128` bytes).
+	if len(input) != 256 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	var err error
+	var p0, p1 *bls12381.PointG1
+
+	// Initialize G1
+	g := bls12381.NewG1()
+
+	// Decode G1 point p_0
+	if p0, err = g.DecodePoint(input[:128]); err != nil {
+		return nil, err
+	}
+	// Decode G1 point p_1
+	if p1, err = g.DecodePoint(input[128:]); err != nil {
+		return nil, err
+	}
+
+	// No need to check the subgroup here, as specified by EIP-2537
+
+	// Compute r = p_0 + p_1
+	r := g.New()
+	g.Add(r, p0, p1)
+
+	// Encode the G1 point result into 128 bytes
+	return g.EncodePoint(r), nil
+}
+
+// bls12381G1MultiExp implements EIP-2537 G1MultiExp precompile.
+type bls12381G1MultiExp struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G1MultiExp) RequiredGas(input []byte, rules params.Rules) uint64 {
+	// Calculate G1 point, scalar value pair length
+	k := len(input) / 160
+	if k == 0 {
+		// Return 0 gas for small input length
+		return 0
+	}
+	// Lookup discount value for G1 point, scalar value pair length
+	var discount uint64
+	if dLen := len(params.Bls12381G1MultiExpDiscountTable); k < dLen {
+		discount = params.Bls12381G1MultiExpDiscountTable[k-1]
+	} else {
+		discount = params.Bls12381G1MultiExpDiscountTable[dLen-1]
+	}
+	// Calculate gas and return the result
+	return (uint64(k) * params.Bls12381G1MulGas * discount) / 1000
+}
+
+func (c *bls12381G1MultiExp) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 G1MultiExp precompile.
+	// G1 multiplication call expects `160*k` bytes as an input that is interpreted as byte concatenation of `k` slices each of them being a byte concatenation of encoding of G1 point (`128` bytes) and encoding of a scalar value (`32` bytes).
+	// Output is an encoding of multiexponentiation operation result - single G1 point (`128` bytes).
+	k := len(input) / 160
+	if len(input) == 0 || len(input)%160 != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	var err error
+	points := make([]*bls12381.PointG1, k)
+	scalars := make([]*big.Int, k)
+
+	// Initialize G1
+	g := bls12381.NewG1()
+
+	// Decode point scalar pairs
+	for i := 0; i < k; i++ {
+		off := 160 * i
+		t0, t1, t2 := off, off+128, off+160
+		// Decode G1 point
+		if points[i], err = g.DecodePoint(input[t0:t1]); err != nil {
+			return nil, err
+		}
+		// 'point is on curve' check already done,
+		// Here we need to apply subgroup checks.
+		if !g.InCorrectSubgroup(points[i]) {
+			return nil, errBLS12381G1PointSubgroup
+		}
+		// Decode scalar value
+		scalars[i] = new(big.Int).SetBytes(input[t1:t2])
+	}
+
+	// Compute r = e_0 * p_0 + e_1 * p_1 + ... + e_(k-1) * p_(k-1)
+	r := g.New()
+	if _, err = g.MultiExp(r, points, scalars); err != nil {
+		return nil, err
+	}
+
+	// Encode the G1 point to 128 bytes
+	return g.EncodePoint(r), nil
+}
+
+// bls12381G2Add implements EIP-2537 G2Add precompile.
+type bls12381G2Add struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G2Add) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.Bls12381G2AddGas
+}
+
+func (c *bls12381G2Add) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 G2Add precompile.
+	// > G2 addition call expects `512` bytes as an input that is interpreted as byte concatenation of two G2 points (`256` bytes each).
+	// > Output is an encoding of addition operation result - single G2 point (`256` bytes).
+	if len(input) != 512 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	var err error
+	var p0, p1 *bls12381.PointG2
+
+	// Initialize G2
+	g := bls12381.NewG2()
+
+	// Decode G2 point p_0
+	if p0, err = g.DecodePoint(input[:256]); err != nil {
+		return nil, err
+	}
+	// Decode G2 point p_1
+	if p1, err = g.DecodePoint(input[256:]); err != nil {
+		return nil, err
+	}
+
+	// No need to check the subgroup here, as specified by EIP-2537
+
+	// Compute r = p_0 + p_1
+	r := g.New()
+	g.Add(r, p0, p1)
+
+	// Encode the G2 point into 256 bytes
+	return g.EncodePoint(r), nil
+}
+
+// bls12381G2MultiExp implements EIP-2537 G2MultiExp precompile.
+type bls12381G2MultiExp struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G2MultiExp) RequiredGas(input []byte, rules params.Rules) uint64 {
+	// Calculate G2 point, scalar value pair length
+	k := len(input) / 288
+	if k == 0 {
+		// Return 0 gas for small input length
+		return 0
+	}
+	// Lookup discount value for G2 point, scalar value pair length
+	var discount uint64
+	if dLen := len(params.Bls12381G2MultiExpDiscountTable); k < dLen {
+		discount = params.Bls12381G2MultiExpDiscountTable[k-1]
+	} else {
+		discount = params.Bls12381G2MultiExpDiscountTable[dLen-1]
+	}
+	// Calculate gas and return the result
+	return (uint64(k) * params.Bls12381G2MulGas * discount) / 1000
+}
+
+func (c *bls12381G2MultiExp) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 G2MultiExp precompile logic
+	// > G2 multiplication call expects `288*k` bytes as an input that is interpreted as byte concatenation of `k` slices each of them being a byte concatenation of encoding of G2 point (`256` bytes) and encoding of a scalar value (`32` bytes).
+	// > Output is an encoding of multiexponentiation operation result - single G2 point (`256` bytes).
+	k := len(input) / 288
+	if len(input) == 0 || len(input)%288 != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	var err error
+	points := make([]*bls12381.PointG2, k)
+	scalars := make([]*big.Int, k)
+
+	// Initialize G2
+	g := bls12381.NewG2()
+
+	// Decode point scalar pairs
+	for i := 0; i < k; i++ {
+		off := 288 * i
+		t0, t1, t2 := off, off+256, off+288
+		// Decode G2 point
+		if points[i], err = g.DecodePoint(input[t0:t1]); err != nil {
+			return nil, err
+		}
+		// 'point is on curve' check already done,
+		// Here we need to apply subgroup checks.
+		if !g.InCorrectSubgroup(points[i]) {
+			return nil, errBLS12381G2PointSubgroup
+		}
+		// Decode scalar value
+		scalars[i] = new(big.Int).SetBytes(input[t1:t2])
+	}
+
+	// Compute r = e_0 * p_0 + e_1 * p_1 + ... + e_(k-1) * p_(k-1)
+	r := g.New()
+	if _, err = g.MultiExp(r, points, scalars); err != nil {
+		return nil, err
+	}
+
+	// Encode the G2 point to 256 bytes.
+	return g.EncodePoint(r), nil
+}
+
+// bls12381Pairing implements EIP-2537 Pairing precompile.
+type bls12381Pairing struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381Pairing) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.Bls12381PairingBaseGas + uint64(len(input)/384)*params.Bls12381PairingPerPairGas
+}
+
+func (c *bls12381Pairing) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 Pairing precompile logic.
+	// > Pairing call expects `384*k` bytes as an inputs that is interpreted as byte concatenation of `k` slices. Each slice has the following structure:
+	// > - `128` bytes of G1 point encoding
+	// > - `256` bytes of G2 point encoding
+	// > Output is a `32` bytes where last single byte is `0x01` if pairing result is equal to multiplicative identity in a pairing target field and `0x00` otherwise
+	// > (which is equivalent of Big Endian encoding of Solidity values `uint256(1)` and `uin256(0)` respectively).
+	k := len(input) / 384
+	if len(input) == 0 || len(input)%384 != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+
+	// Initialize BLS12-381 pairing engine
+	e := bls12381.NewPairingEngine()
+	g1, g2 := e.G1, e.G2
+
+	// Decode pairs
+	for i := 0; i < k; i++ {
+		off := 384 * i
+		t0, t1, t2 := off, off+128, off+384
+
+		// Decode G1 point
+		p1, err := g1.DecodePoint(input[t0:t1])
+		if err != nil {
+			return nil, err
+		}
+		// Decode G2 point
+		p2, err := g2.DecodePoint(input[t1:t2])
+		if err != nil {
+			return nil, err
+		}
+
+		// 'point is on curve' check already done,
+		// Here we need to apply subgroup checks.
+		if !g1.InCorrectSubgroup(p1) {
+			return nil, errBLS12381G1PointSubgroup
+		}
+		if !g2.InCorrectSubgroup(p2) {
+			return nil, errBLS12381G2PointSubgroup
+		}
+
+		// Update pairing engine with G1 and G2 points
+		e.AddPair(p1, p2)
+	}
+	// Prepare 32 byte output
+	out := make([]byte, 32)
+
+	// Compute pairing and set the result
+	if e.Check() {
+		out[31] = 1
+	}
+	return out, nil
+}
+
+// decodeBLS12381FieldElement decodes BLS12-381 elliptic curve field element.
+// Removes top 16 bytes of 64 byte input.
+func decodeBLS12381FieldElement(in []byte) ([]byte, error) {
+	if len(in) != 64 {
+		return nil, errors.New("invalid field element length")
+	}
+	// check top bytes
+	for i := 0; i < 16; i++ {
+		if in[i] != byte(0x00) {
+			return nil, errBLS12381InvalidFieldElementTopBytes
+		}
+	}
+	out := make([]byte, 48)
+	copy(out[:], in[16:])
+	return out, nil
+}
+
+// bls12381MapG1 implements EIP-2537 MapG1 precompile.
+type bls12381MapG1 struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381MapG1) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.Bls12381MapG1Gas
+}
+
+func (c *bls12381MapG1) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 Map_To_G1 precompile.
+	// > Field-to-curve call expects `64` bytes as an input that is interpreted as an element of the base field.
+	// > Output of this call is `128` bytes and is G1 point following respective encoding rules.
+	if len(input) != 64 {
+		return nil, errBLS12381InvalidInputLength
+	}
+
+	// Decode input field element
+	fe, err := decodeBLS12381FieldElement(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize G1
+	g := bls12381.NewG1()
+
+	// Compute mapping
+	r, err := g.MapToCurve(fe)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the G1 point to 128 bytes
+	return g.EncodePoint(r), nil
+}
+
+// bls12381MapG2 implements EIP-2537 MapG2 precompile.
+type bls12381MapG2 struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381MapG2) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.Bls12381MapG2Gas
+}
+
+func (c *bls12381MapG2) Run(input []byte) ([]byte, error) {
+	// Implements EIP-2537 Map_FP2_TO_G2 precompile logic.
+	// > Field-to-curve call expects `128` bytes as an input that is interpreted as an element of the quadratic extension field.
+	// > Output of this call is `256` bytes and is G2 point following respective encoding rules.
+	if len(input) != 128 {
+		return nil, errBLS12381InvalidInputLength
+	}
+
+	// Decode input field element, the library expects the c1 coefficient first
+	fe := make([]byte, 96)
+	c0, err := decodeBLS12381FieldElement(input[:64])
+	if err != nil {
+		return nil, err
+	}
+	copy(fe[48:], c0)
+	c1, err := decodeBLS12381FieldElement(input[64:])
+	if err != nil {
+		return nil, err
+	}
+	copy(fe[:48], c1)
+
+	// Initialize G2
+	g := bls12381.NewG2()
+
+	// Compute mapping
+	r, err := g.MapToCurve(fe)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the G2 point to 256 bytes
+	return g.EncodePoint(r), nil
+}
+
+// P256VERIFY implemented as a native contract, it verifies the secp256r1 signature
+// as specified by EIP-7951 and is priced by it.
+type p256Verify struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *p256Verify) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.P256VerifyGas
+}
+
+func (c *p256Verify) Run(input []byte) ([]byte, error) {
+	const p256VerifyInputLength = 160
+
+	// "input" is (hash, r, s, x, y), each 32 bytes, the invalid input is not an error but
+	// returns nothing as the failed verification
+	if len(input) != p256VerifyInputLength {
+		return nil, nil
+	}
+	var (
+		r = new(big.Int).SetBytes(input[32:64])
+		s = new(big.Int).SetBytes(input[64:96])
+		x = new(big.Int).SetBytes(input[96:128])
+		y = new(big.Int).SetBytes(input[128:160])
+	)
+	curve := elliptic.P256()
+	// IsOnCurve rejects the coordinates out of [0, p-1] and the point at infinity
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	// ecdsa.Verify rejects r and s out of [1, n-1]
+	if ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, input[:32], r, s) {
+		return true32Byte, nil
+	}
+	return nil, nil
+}
+
+// SM3 implemented as a native contract.
+type sm3hash struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+//
+// This method does not require any overflow checking as the input size gas costs
+// required for anything significant is so high it's impossible to pay for.
+func (c *sm3hash) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return uint64(len(input)+31)/32*params.Sm3PerWordGas + params.Sm3BaseGas
+}
+func (c *sm3hash) Run(input []byte) ([]byte, error) {
+	h := sm3.Sum(input)
+	return h[:], nil
+}
+
+// SM2 signature verification implemented as a native contract.
+type sm2Verify struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *sm2Verify) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return params.Sm2VerifyGas
+}
+
+func (c *sm2Verify) Run(input []byte) ([]byte, error) {
+	const sm2VerifyInputLength = 160
+
+	input = common.RightPadBytes(input, sm2VerifyInputLength)
+	// "input" is (digest, r, s, x, y), each 32 bytes, the digest is SM3(ZA || message)
+	var (
+		r = new(big.Int).SetBytes(input[32:64])
+		s = new(big.Int).SetBytes(input[64:96])
+		x = new(big.Int).SetBytes(input[96:128])
+		y = new(big.Int).SetBytes(input[128:160])
+	)
+	if sm2.Verify(x, y, input[:32], r, s) {
+		return true32Byte, nil
+	}
+	return false32Byte, nil
+}
+
+// SM2 public key recovery implemented as a native contract.
+//
+// The SM2 digest is SM3(ZA || message) and ZA is derived from the public key being
+// recovered, so the key is recovered from the digest and then bound to the user id and
+// the message by recomputing the digest with ZA of the recovered key.
+type sm2Recover struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *sm2Recover) RequiredGas(input []byte, rules params.Rules) uint64 {
+	var data uint64
+	if len(input) > 160 {
+		data = uint64(len(input) - 160)
+	}
+	return params.Sm2RecoverGas + (data+31)/32*params.Sm3PerWordGas
+}
+
+func (c *sm2Recover) Run(input []byte) ([]byte, error) {
+	const sm2RecoverInputLength = 160
+
+	var data []byte
+	if len(input) > sm2RecoverInputLength {
+		data = input[sm2RecoverInputLength:]
+	}
+	input = common.RightPadBytes(input, sm2RecoverInputLength)
+	// "input" is (digest, v, r, s, uidLength), each 32 bytes, followed by the user id and
+	// the message, v is 27 or 28 as ecrecover
+	r := new(big.Int).SetBytes(input[64:96])
+	s := new(big.Int).SetBytes(input[96:128])
+	v := input[63] - 27
+	uidLen := new(big.Int).SetBytes(input[128:160])
+
+	if !allZero(input[32:63]) || uidLen.Cmp(big.NewInt(int64(len(data)))) > 0 {
+		return nil, nil
+	}
+	uid, msg := data[:uidLen.Uint64()], data[uidLen.Uint64():]
+	x, y, err := sm2.RecoverPubkey(input[:32], r, s, v)
+	// make sure the public key is a valid one
+	if err != nil {
+		return nil, nil
+	}
+	// make sure the digest is the one of the message signed by the recovered key
+	e, err := sm2.Digest(x, y, uid, msg)
+	if err != nil || !bytes.Equal(e, input[:32]) {
+		return nil, nil
+	}
+	// the address is derived from the public key in the same way as ecrecover
+	pubKey := append(common.LeftPadBytes(x.Bytes(), 32), common.LeftPadBytes(y.Bytes(), 32)...)
+	return common.LeftPadBytes(crypto.Keccak256(pubKey)[12:], 32), nil
+}
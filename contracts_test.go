@@ -17,13 +17,20 @@
 package evm
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"testing"
 
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/util"
 )
 
+// precompiledTestRules are the rules under which the precompiled contracts are tested, all forks are active
+var precompiledTestRules = params.Rules{IsByzantium: true, IsIstanbul: true, IsPrague: true, IsOsaka: true}
+
 // precompiledTest defines the input/output pairs for precompiled contract tests.
 type precompiledTest struct {
 	input, expected string
@@ -336,13 +343,70 @@ var bn256PairingTests = []precompiledTest{
 	},
 }
 
+// EIP-152 test vectors
+var blake2FMalformedInputTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBlake2FInvalidInputLength,
+		name:          "vector 0: empty input",
+	},
+	{
+		input:         "00000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001",
+		expectedError: errBlake2FInvalidInputLength,
+		name:          "vector 1: less than 213 bytes input",
+	},
+	{
+		input:         "000000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001",
+		expectedError: errBlake2FInvalidInputLength,
+		name:          "vector 2: more than 213 bytes input",
+	},
+	{
+		input:         "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000002",
+		expectedError: errBlake2FInvalidFinalFlag,
+		name:          "vector 3: malformed final block indicator flag",
+	},
+}
+
+var blake2FTests = []precompiledTest{
+	{
+		input:    "0000000048c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001",
+		expected: "08c9bcf367e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d282e6ad7f520e511f6c3e2b8c68059b9442be0454267ce079217e1319cde05b",
+		name:     "vector 4",
+	},
+	{
+		input:    "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001",
+		expected: "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923",
+		name:     "vector 5",
+	},
+	{
+		input:    "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000000",
+		expected: "75ab69d3190a562c51aef8d88f1c2775876944407270c42c9844252c26d2875298743e7f6d5ea2f2d3e8d226039cd31b4e426ac4f2d3d666a610c2116fde4735",
+		name:     "vector 6",
+	},
+	{
+		input:    "0000000148c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001",
+		expected: "b63a380cb2897d521994a85234ee2c181b5f844d2c624c002677e9703449d2fba551b3a8333bcdf5f2f7e08993d53923de3d64fcc68c034e717b9293fed7a421",
+		name:     "vector 7",
+	},
+}
+
+// precompiledFailureTest defines the input/error pairs for precompiled contract failure tests.
+type precompiledFailureTest struct {
+	input         string
+	expectedError error
+	name          string
+}
+
 func testPrecompiled(addr string, test precompiledTest, t *testing.T) {
-	p := PrecompiledContractsByzantium[util.HexToAddress(addr)]
+	testPrecompiledContract(PrecompiledContractsOsaka[util.HexToAddress(addr)], test, t)
+}
+
+func testPrecompiledContract(p PrecompiledContract, test precompiledTest, t *testing.T) {
 	in := util.Hex2Bytes(test.input)
 	contract := NewContract(AccountRef(util.HexToAddress("1337")),
-		nil, new(big.Int), p.RequiredGas(in))
+		nil, new(big.Int), p.RequiredGas(in, precompiledTestRules))
 	t.Run(fmt.Sprintf("%s-Gas=%d", test.name, contract.Gas), func(t *testing.T) {
-		if res, err := RunPrecompiledContract(p, in, contract); err != nil {
+		if res, err := RunPrecompiledContract(p, in, contract, precompiledTestRules); err != nil {
 			t.Error(err)
 		} else if util.Bytes2Hex(res) != test.expected {
 			t.Errorf("Expected %v, got %v", test.expected, util.Bytes2Hex(res))
@@ -350,13 +414,26 @@ func testPrecompiled(addr string, test precompiledTest, t *testing.T) {
 	})
 }
 
+func testPrecompiledFailure(addr string, test precompiledFailureTest, t *testing.T) {
+	p := PrecompiledContractsOsaka[util.HexToAddress(addr)]
+	in := util.Hex2Bytes(test.input)
+	contract := NewContract(AccountRef(util.HexToAddress("31337")),
+		nil, new(big.Int), p.RequiredGas(in, precompiledTestRules))
+	t.Run(test.name, func(t *testing.T) {
+		_, err := RunPrecompiledContract(p, in, contract, precompiledTestRules)
+		if err != test.expectedError {
+			t.Errorf("Expected error [%v], got [%v]", test.expectedError, err)
+		}
+	})
+}
+
 func benchmarkPrecompiled(addr string, test precompiledTest, bench *testing.B) {
 	if test.noBenchmark {
 		return
 	}
-	p := PrecompiledContractsByzantium[util.HexToAddress(addr)]
+	p := PrecompiledContractsOsaka[util.HexToAddress(addr)]
 	in := util.Hex2Bytes(test.input)
-	reqGas := p.RequiredGas(in)
+	reqGas := p.RequiredGas(in, precompiledTestRules)
 	contract := NewContract(AccountRef(util.HexToAddress("1337")),
 		nil, new(big.Int), reqGas)
 
@@ -371,7 +448,7 @@ func benchmarkPrecompiled(addr string, test precompiledTest, bench *testing.B) {
 		for i := 0; i < bench.N; i++ {
 			contract.Gas = reqGas
 			copy(data, in)
-			res, err = RunPrecompiledContract(p, data, contract)
+			res, err = RunPrecompiledContract(p, data, contract, precompiledTestRules)
 		}
 		bench.StopTimer()
 		//Check if it is correct
@@ -481,3 +558,397 @@ func BenchmarkPrecompiledBn256Pairing(bench *testing.B) {
 		benchmarkPrecompiled("08", test, bench)
 	}
 }
+
+// Tests the sample inputs from the EIP-152
+func TestPrecompiledBlake2F(t *testing.T) {
+	for _, test := range blake2FTests {
+		testPrecompiled("09", test, t)
+	}
+}
+
+func BenchmarkPrecompiledBlake2F(bench *testing.B) {
+	for _, test := range blake2FTests {
+		benchmarkPrecompiled("09", test, bench)
+	}
+}
+
+// Tests the malformed inputs from the EIP-152 are rejected
+func TestPrecompiledBlake2FMalformedInput(t *testing.T) {
+	for _, test := range blake2FMalformedInputTests {
+		testPrecompiledFailure("09", test, t)
+	}
+}
+
+// Tests the bn256 precompiles are repriced from Istanbul (EIP-1108)
+func TestPrecompiledBn256RequiredGas(t *testing.T) {
+	byzantium := params.Rules{IsByzantium: true}
+	istanbul := params.Rules{IsByzantium: true, IsIstanbul: true}
+	pairingInput := make([]byte, 2*192)
+	tests := []struct {
+		addr                byte
+		input               []byte
+		byzantium, istanbul uint64
+	}{
+		{6, nil, 500, 150},
+		{7, nil, 40000, 6000},
+		{8, nil, 100000, 45000},
+		{8, pairingInput, 260000, 113000},
+	}
+	for _, test := range tests {
+		p := PrecompiledContractsIstanbul[util.BytesToAddress([]byte{test.addr})]
+		if gas := p.RequiredGas(test.input, byzantium); gas != test.byzantium {
+			t.Errorf("precompile %d: expected byzantium gas %d, got %d", test.addr, test.byzantium, gas)
+		}
+		if gas := p.RequiredGas(test.input, istanbul); gas != test.istanbul {
+			t.Errorf("precompile %d: expected istanbul gas %d, got %d", test.addr, test.istanbul, gas)
+		}
+	}
+}
+
+// jsonPrecompiledTest is the json representation of the vectors in testdata/precompiles
+type jsonPrecompiledTest struct {
+	Input, Expected, ExpectedError string
+	Gas                            uint64
+	Name                           string
+	NoBenchmark                    bool
+}
+
+// loadJson loads the vectors from testdata/precompiles/<name>.json
+func loadJson(name string) ([]jsonPrecompiledTest, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("testdata/precompiles/%v.json", name))
+	if err != nil {
+		return nil, err
+	}
+	var tests []jsonPrecompiledTest
+	err = json.Unmarshal(data, &tests)
+	return tests, err
+}
+
+// testJson runs the vectors in testdata/precompiles/<name>.json, checking the gas as well
+func testJson(name, addr string, t *testing.T) {
+	tests, err := loadJson(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PrecompiledContractsOsaka[util.HexToAddress(addr)]
+	for _, test := range tests {
+		if gas := p.RequiredGas(util.Hex2Bytes(test.Input), precompiledTestRules); gas != test.Gas {
+			t.Errorf("%s: expected gas %d, got %d", test.Name, test.Gas, gas)
+		}
+		testPrecompiled(addr, precompiledTest{input: test.Input, expected: test.Expected, gas: test.Gas, name: test.Name}, t)
+	}
+}
+
+// testJsonFail runs the failure vectors in testdata/precompiles/fail-<name>.json
+func testJsonFail(name, addr string, t *testing.T) {
+	tests, err := loadJson("fail-" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PrecompiledContractsOsaka[util.HexToAddress(addr)]
+	for _, test := range tests {
+		in := util.Hex2Bytes(test.Input)
+		contract := NewContract(AccountRef(util.HexToAddress("31337")),
+			nil, new(big.Int), p.RequiredGas(in, precompiledTestRules))
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := RunPrecompiledContract(p, in, contract, precompiledTestRules)
+			if err == nil || err.Error() != test.ExpectedError {
+				t.Errorf("Expected error [%v], got [%v]", test.ExpectedError, err)
+			}
+		})
+	}
+}
+
+// benchJson benchmarks the vectors in testdata/precompiles/<name>.json
+func benchJson(name, addr string, b *testing.B) {
+	tests, err := loadJson(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, test := range tests {
+		benchmarkPrecompiled(addr, precompiledTest{input: test.Input, expected: test.Expected, name: test.Name, noBenchmark: test.NoBenchmark}, b)
+	}
+}
+
+// Tests the standard vectors from the EIP-2537
+func TestPrecompiledBLS12381G1Add(t *testing.T)      { testJson("blsG1Add", "0b", t) }
+func TestPrecompiledBLS12381G1MultiExp(t *testing.T) { testJson("blsG1MultiExp", "0c", t) }
+func TestPrecompiledBLS12381G2Add(t *testing.T)      { testJson("blsG2Add", "0d", t) }
+func TestPrecompiledBLS12381G2MultiExp(t *testing.T) { testJson("blsG2MultiExp", "0e", t) }
+func TestPrecompiledBLS12381Pairing(t *testing.T)    { testJson("blsPairing", "0f", t) }
+func TestPrecompiledBLS12381MapG1(t *testing.T)      { testJson("blsMapG1", "10", t) }
+func TestPrecompiledBLS12381MapG2(t *testing.T)      { testJson("blsMapG2", "11", t) }
+
+func BenchmarkPrecompiledBLS12381G1Add(b *testing.B)      { benchJson("blsG1Add", "0b", b) }
+func BenchmarkPrecompiledBLS12381G1MultiExp(b *testing.B) { benchJson("blsG1MultiExp", "0c", b) }
+func BenchmarkPrecompiledBLS12381G2Add(b *testing.B)      { benchJson("blsG2Add", "0d", b) }
+func BenchmarkPrecompiledBLS12381G2MultiExp(b *testing.B) { benchJson("blsG2MultiExp", "0e", b) }
+func BenchmarkPrecompiledBLS12381Pairing(b *testing.B)    { benchJson("blsPairing", "0f", b) }
+func BenchmarkPrecompiledBLS12381MapG1(b *testing.B)      { benchJson("blsMapG1", "10", b) }
+func BenchmarkPrecompiledBLS12381MapG2(b *testing.B)      { benchJson("blsMapG2", "11", b) }
+
+// Tests the Wycheproof vectors of the secp256r1 verification
+func TestPrecompiledP256Verify(t *testing.T) { testJson("p256Verify", "100", t) }
+
+func BenchmarkPrecompiledP256Verify(b *testing.B) { benchJson("p256Verify", "100", b) }
+
+// Tests the inputs rejected by EIP-7951 return nothing and are charged the flat price
+func TestPrecompiledP256VerifyInvalid(t *testing.T) {
+	const (
+		hash = "4cee90eb86eaa050036147a12d49004b6b9c72bd725d39d4785011fe190f0b4d"
+		r    = "a73bd4903f0ce3b639bbbf6e8e80d16931ff4bcf5993d58468e8fb19086e8cac"
+		s    = "36dbcd03009df8c59286b162af3bd7fcc0450c9aa81be5d10d312af6c66b1d60"
+		x    = "4aebd3099c618202fcfe16ae7770b0c49ab5eadf74b754204a3bb6060e44eff3"
+		y    = "7618b065f9832de4ca6ca971a7a1adc826d0f7c00181a5fb2ddf79ae00b4e10e"
+		n    = "ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551"
+		zero = "0000000000000000000000000000000000000000000000000000000000000000"
+	)
+	testPrecompiled("100", precompiledTest{input: hash + r + s + x + y, expected: "0000000000000000000000000000000000000000000000000000000000000001", name: "valid"}, t)
+	for _, test := range []precompiledTest{
+		{input: hash + r + s + x, name: "short_input"},
+		{input: hash + r + s + x + y + "00", name: "long_input"},
+		{input: hash + zero + s + x + y, name: "zero_r"},
+		{input: hash + r + n + x + y, name: "s_out_of_range"},
+		{input: hash + r + s + zero + zero, name: "point_at_infinity"},
+		{input: hash + r + s + y + x, name: "not_on_curve"},
+	} {
+		testPrecompiled("100", test, t)
+	}
+	if gas := PrecompiledContractsOsaka[util.HexToAddress("100")].RequiredGas(nil, precompiledTestRules); gas != params.P256VerifyGas {
+		t.Errorf("expected gas %d, got %d", params.P256VerifyGas, gas)
+	}
+}
+
+// Tests the malformed inputs from the EIP-2537 are rejected
+func TestPrecompiledBLS12381G1AddFail(t *testing.T)      { testJsonFail("blsG1Add", "0b", t) }
+func TestPrecompiledBLS12381G1MultiExpFail(t *testing.T) { testJsonFail("blsG1MultiExp", "0c", t) }
+func TestPrecompiledBLS12381G2AddFail(t *testing.T)      { testJsonFail("blsG2Add", "0d", t) }
+func TestPrecompiledBLS12381G2MultiExpFail(t *testing.T) { testJsonFail("blsG2MultiExp", "0e", t) }
+func TestPrecompiledBLS12381PairingFail(t *testing.T)    { testJsonFail("blsPairing", "0f", t) }
+func TestPrecompiledBLS12381MapG1Fail(t *testing.T)      { testJsonFail("blsMapG1", "10", t) }
+func TestPrecompiledBLS12381MapG2Fail(t *testing.T)      { testJsonFail("blsMapG2", "11", t) }
+
+// GM/T conformance vectors, the SM3 examples in GB/T 32905 and the SM2 signature example with
+// the recommended curve in GB/T 32918, the digest is SM3(ZA || "message digest")
+var (
+	sm3Tests = []precompiledTest{
+		{
+			input:    "616263",
+			expected: "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0",
+			name:     "abc",
+		},
+		{
+			input:    "61626364616263646162636461626364616263646162636461626364616263646162636461626364616263646162636461626364616263646162636461626364",
+			expected: "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732",
+			name:     "abcd*16",
+		},
+	}
+	sm2VerifyTests = []precompiledTest{
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"09f9df311e5421a150dd7d161e4bc5c672179fad1833fc076bb08ff356f35020" +
+				"ccea490ce26775a52dc6ea718cc1aa600aed05fbf35e084a6632f6072da9ad13",
+			expected: "0000000000000000000000000000000000000000000000000000000000000001",
+			name:     "valid",
+		},
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28641" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"09f9df311e5421a150dd7d161e4bc5c672179fad1833fc076bb08ff356f35020" +
+				"ccea490ce26775a52dc6ea718cc1aa600aed05fbf35e084a6632f6072da9ad13",
+			expected: "0000000000000000000000000000000000000000000000000000000000000000",
+			name:     "wrong_digest",
+		},
+		{
+			input:    "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640",
+			expected: "0000000000000000000000000000000000000000000000000000000000000000",
+			name:     "short_input",
+		},
+	}
+	sm2RecoverTests = []precompiledTest{
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" +
+				"000000000000000000000000000000000000000000000000000000000000001b" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"0000000000000000000000000000000000000000000000000000000000000010" +
+				"31323334353637383132333435363738" +
+				"6d65737361676520646967657374",
+			expected: "000000000000000000000000b04cfcd922861ff9bc82f92aaa1bdc1448d55798",
+			name:     "valid",
+		},
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" +
+				"000000000000000000000000000000000000000000000000000000000000001d" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"0000000000000000000000000000000000000000000000000000000000000010" +
+				"31323334353637383132333435363738" +
+				"6d65737361676520646967657374",
+			expected: "",
+			name:     "invalid_v",
+		},
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" +
+				"000000000000000000000000000000000000000000000000000000000000001b" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"0000000000000000000000000000000000000000000000000000000000000010" +
+				"31323334353637383132333435363738" +
+				"6d65737361676520646967657354",
+			expected: "",
+			name:     "wrong_message",
+		},
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" +
+				"000000000000000000000000000000000000000000000000000000000000001b" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"000000000000000000000000000000000000000000000000000000000000000f" +
+				"31323334353637383132333435363738" +
+				"6d65737361676520646967657374",
+			expected: "",
+			name:     "wrong_uid",
+		},
+		{
+			input: "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640" +
+				"000000000000000000000000000000000000000000000000000000000000001b" +
+				"f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3" +
+				"b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa" +
+				"00000000000000000000000000000000000000000000000000000000000000ff" +
+				"31323334353637383132333435363738" +
+				"6d65737361676520646967657374",
+			expected: "",
+			name:     "uid_length_out_of_range",
+		},
+	}
+)
+
+// Tests the GM/T precompiles are activated at the configured addresses
+func TestPrecompiledGM(t *testing.T) {
+	addrs := GMPrecompileAddresses{
+		SM3:        util.BytesToAddress([]byte{0x60, 0x01}),
+		SM2Verify:  util.BytesToAddress([]byte{0x60, 0x02}),
+		SM2Recover: util.BytesToAddress([]byte{0x60, 0x03}),
+	}
+	precompiles := ActivePrecompiles(precompiledTestRules, big.NewInt(10), GMPrecompiles(addrs, big.NewInt(10)))
+	for _, test := range sm3Tests {
+		testPrecompiledContract(precompiles[addrs.SM3], test, t)
+	}
+	for _, test := range sm2VerifyTests {
+		testPrecompiledContract(precompiles[addrs.SM2Verify], test, t)
+	}
+	for _, test := range sm2RecoverTests {
+		testPrecompiledContract(precompiles[addrs.SM2Recover], test, t)
+	}
+
+	precompiles = ActivePrecompiles(precompiledTestRules, big.NewInt(9), GMPrecompiles(addrs, big.NewInt(10)))
+	if precompiles[addrs.SM3] != nil || precompiles[addrs.SM2Verify] != nil || precompiles[addrs.SM2Recover] != nil {
+		t.Error("expected the GM/T precompiles to be inactive before the activation block")
+	}
+}
+
+// Tests the default GM/T addresses don't collide with the precompiles of any release
+func TestDefaultGMPrecompileAddresses(t *testing.T) {
+	releases := []map[types.Address]PrecompiledContract{
+		PrecompiledContractsHomestead, PrecompiledContractsByzantium, PrecompiledContractsIstanbul,
+		PrecompiledContractsPrague, PrecompiledContractsOsaka,
+	}
+	addrs := []types.Address{DefaultGMPrecompileAddresses.SM3, DefaultGMPrecompileAddresses.SM2Verify, DefaultGMPrecompileAddresses.SM2Recover}
+	for _, addr := range addrs {
+		for _, release := range releases {
+			if release[addr] != nil {
+				t.Errorf("expected the GM/T precompile at %x not to collide with the default precompiles", addr)
+			}
+		}
+	}
+	precompiles := ActivePrecompiles(precompiledTestRules, big.NewInt(0), GMPrecompiles(DefaultGMPrecompileAddresses, nil))
+	for _, addr := range addrs {
+		if precompiles[addr] == nil {
+			t.Errorf("expected the GM/T precompile at %x to be active", addr)
+		}
+	}
+}
+
+// mockPrecompile returns the fixed output for any input
+type mockPrecompile struct {
+	output []byte
+}
+
+func (c *mockPrecompile) RequiredGas(input []byte, rules params.Rules) uint64 {
+	return 10
+}
+
+func (c *mockPrecompile) Run(input []byte) ([]byte, error) {
+	return c.output, nil
+}
+
+// Tests the active precompiles are derived from the rules and the overrides
+func TestActivePrecompiles(t *testing.T) {
+	custom := &mockPrecompile{output: []byte{0x1}}
+	overrides := []PrecompileOverride{
+		{Address: util.BytesToAddress([]byte{0x10}), Contract: custom},
+		{Address: util.BytesToAddress([]byte{0x11}), Contract: custom, ActivationBlock: big.NewInt(100)},
+		{Address: util.BytesToAddress([]byte{4}), Contract: nil},
+		{Address: util.BytesToAddress([]byte{1}), Contract: custom},
+	}
+
+	homestead := ActivePrecompiles(params.Rules{}, big.NewInt(1), nil)
+	if len(homestead) != len(PrecompiledContractsHomestead) {
+		t.Errorf("expected %d homestead precompiles, got %d", len(PrecompiledContractsHomestead), len(homestead))
+	}
+
+	precompiles := ActivePrecompiles(params.Rules{IsByzantium: true}, big.NewInt(99), overrides)
+	if precompiles[util.BytesToAddress([]byte{0x10})] != custom {
+		t.Error("expected the added precompile to be active")
+	}
+	if precompiles[util.BytesToAddress([]byte{0x11})] != nil {
+		t.Error("expected the precompile to be inactive before its activation block")
+	}
+	if precompiles[util.BytesToAddress([]byte{4})] != nil {
+		t.Error("expected the precompile to be removed")
+	}
+	if precompiles[util.BytesToAddress([]byte{1})] != custom {
+		t.Error("expected the precompile to be overridden")
+	}
+	if precompiles[util.BytesToAddress([]byte{8})] == nil {
+		t.Error("expected the byzantium precompile to be active")
+	}
+
+	if precompiles[util.BytesToAddress([]byte{9})] != nil {
+		t.Error("expected the istanbul precompile to be inactive before istanbul")
+	}
+
+	istanbul := ActivePrecompiles(params.Rules{IsByzantium: true, IsIstanbul: true}, big.NewInt(1), nil)
+	if len(istanbul) != len(PrecompiledContractsIstanbul) || istanbul[util.BytesToAddress([]byte{9})] == nil {
+		t.Error("expected the istanbul precompiles to be active")
+	}
+	if istanbul[util.BytesToAddress([]byte{0x0b})] != nil {
+		t.Error("expected the prague precompile to be inactive before prague")
+	}
+
+	prague := ActivePrecompiles(params.Rules{IsByzantium: true, IsIstanbul: true, IsPrague: true}, big.NewInt(1), nil)
+	if len(prague) != len(PrecompiledContractsPrague) || prague[util.BytesToAddress([]byte{0x11})] == nil {
+		t.Error("expected the prague precompiles to be active")
+	}
+	if prague[util.BytesToAddress([]byte{0x01, 0x00})] != nil {
+		t.Error("expected the osaka precompile to be inactive before osaka")
+	}
+
+	osaka := ActivePrecompiles(precompiledTestRules, big.NewInt(1), nil)
+	if len(osaka) != len(PrecompiledContractsOsaka) || osaka[util.BytesToAddress([]byte{0x01, 0x00})] == nil {
+		t.Error("expected the osaka precompiles to be active")
+	}
+
+	precompiles = ActivePrecompiles(params.Rules{IsByzantium: true}, big.NewInt(100), overrides)
+	if precompiles[util.BytesToAddress([]byte{0x11})] != custom {
+		t.Error("expected the precompile to be active from its activation block")
+	}
+	// the default sets are never modified
+	if PrecompiledContractsByzantium[util.BytesToAddress([]byte{4})] == nil || PrecompiledContractsByzantium[util.BytesToAddress([]byte{1})] == custom {
+		t.Error("expected the default precompiles to be unchanged")
+	}
+}
@@ -17,12 +17,18 @@
 package evm
 
 import (
+	"bytes"
+	"context"
+	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
 	"github.com/DSiSc/evm-NG/util"
 	"github.com/DSiSc/repository"
 	"math/big"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -42,14 +48,19 @@ type (
 )
 
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
-func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
+func run(evm *EVM, contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	if evm.depth == 0 {
+		// the outermost call returns means the transaction ends, the hooks only release
+		// the transient resources, so their failure doesn't change the result of the call.
+		defer func() {
+			if hookErr := evm.runTxEndHooks(); hookErr != nil {
+				log.Error("run tx end hooks failed, err = %v", hookErr)
+			}
+		}()
+	}
 	if contract.CodeAddr != nil {
-		precompiles := PrecompiledContractsHomestead
-		if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if p := precompiles[*contract.CodeAddr]; p != nil {
-			return RunPrecompiledContract(p, input, contract)
+		if p := evm.precompiles[*contract.CodeAddr]; p != nil {
+			return RunPrecompiledContract(p, input, contract, evm.chainRules)
 		}
 	}
 	for _, interpreter := range evm.interpreters {
@@ -89,6 +100,10 @@ type Context struct {
 	BlockNumber *big.Int      // Provides information for NUMBER
 	Time        *big.Int      // Provides information for TIME
 	Difficulty  *big.Int      // Provides information for DIFFICULTY
+
+	// StorageWitness carries the storage system contract results along with the block,
+	// storage backend is accessed directly if it is nil, while the oracle requests fail
+	StorageWitness *storage.Witness
 }
 
 // EVM is the Ethereum Virtual Machine base object and provides
@@ -112,6 +127,8 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
 	chainRules params.Rules
+	// precompiles contains the precompiled contracts active in the current block
+	precompiles PrecompiledContracts
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
@@ -122,48 +139,62 @@ type EVM struct {
 	// abort is used to abort the EVM calling operations
 	// NOTE: must be set atomically
 	abort int32
+	// abortCtx is done once the EVM is cancelled, it is used to abort the
+	// off-chain operations of the system contracts.
+	abortOnce   sync.Once
+	abortCtx    context.Context
+	abortCancel context.CancelFunc
 	// callGasTemp holds the gas available for the current call. This is needed because the
 	// available gas is calculated in gasCall* according to the 63/64 rule and later
 	// applied in opCall*.
 	callGasTemp uint64
+	// txEndHooks are executed when the transaction ends, they are used to release
+	// the resources scoped to the transaction, such as the system buffers.
+	txEndHooks    map[string]func() error
+	txEndHookKeys []string
 }
 
-// NewEVM returns a new EVM. The returned EVM is not thread safe and should
-// only ever be used *once*.
+// NewEVM returns a new EVM running with the mainnet chain configuration. The
+// returned EVM is not thread safe and should only ever be used *once*.
 func NewEVM(ctx Context, statedb *repository.Repository) *EVM {
-	chainConfig := params.MainnetChainConfig
 	vmConfig := Config{
 		Debug:                   false,
 		NoRecursion:             false,
 		EnablePreimageRecording: false,
 	}
+	return NewEVMWithConfig(ctx, statedb, params.MainnetChainConfig, vmConfig)
+}
+
+// NewEVMWithConfig returns a new EVM running with the chain and vm configuration,
+// the active precompiled contracts are derived from the chain rules and the
+// precompile overrides of vmConfig. The interpreters of vmConfig must be checked
+// by Config.Validate. The returned EVM is not thread safe and should only ever be
+// used *once*.
+func NewEVMWithConfig(ctx Context, statedb *repository.Repository, chainConfig *params.ChainConfig, vmConfig Config) *EVM {
+	chainRules := chainConfig.Rules(ctx.BlockNumber)
 	evm := &EVM{
 		Context:      ctx,
 		StateDB:      statedb,
 		vmConfig:     vmConfig,
 		chainConfig:  chainConfig,
-		chainRules:   chainConfig.Rules(ctx.BlockNumber),
-		interpreters: make([]Interpreter, 0, 1),
+		chainRules:   chainRules,
+		precompiles:  ActivePrecompiles(chainRules, ctx.BlockNumber, vmConfig.Precompiles),
+		interpreters: make([]Interpreter, 0),
 	}
 
+	// The EWASM interpreters only run the wasm contracts, the other code falls
+	// through to the EVM interpreters. An interpreter listed in both is created once.
+	selected := make(map[string]bool)
 	if chainConfig.IsEWASM(ctx.BlockNumber) {
-		// to be implemented by EVM-C and Wagon PRs.
-		// if vmConfig.EWASMInterpreter != "" {
-		//  extIntOpts := strings.Split(vmConfig.EWASMInterpreter, ":")
-		//  path := extIntOpts[0]
-		//  options := []string{}
-		//  if len(extIntOpts) > 1 {
-		//    options = extIntOpts[1..]
-		//  }
-		//  evm.interpreters = append(evm.interpreters, NewEVMVCInterpreter(evm, vmConfig, options))
-		// } else {
-		// 	evm.interpreters = append(evm.interpreters, NewEWASMInterpreter(evm, vmConfig))
-		// }
-		panic("No supported ewasm interpreter yet.")
-	}
-
-	// vmConfig.EVMInterpreter will be used by EVM-C, it won't be checked here
-	// as we always want to have the built-in EVM as the failover option.
+		ewasmInterpreter := vmConfig.EWASMInterpreter
+		if len(strings.TrimSpace(ewasmInterpreter)) == 0 {
+			ewasmInterpreter = EWASMInterpreterWagon
+		}
+		evm.interpreters = append(evm.interpreters, newInterpreters(evm, vmConfig, ewasmInterpreter, selected)...)
+	}
+	evm.interpreters = append(evm.interpreters, newInterpreters(evm, vmConfig, vmConfig.EVMInterpreter, selected)...)
+
+	// We always want to have the built-in EVM as the failover option.
 	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 	evm.interpreter = evm.interpreters[0]
 
@@ -174,6 +205,16 @@ func NewEVM(ctx Context, statedb *repository.Repository) *EVM {
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
 	atomic.StoreInt32(&evm.abort, 1)
+	evm.AbortContext()
+	evm.abortCancel()
+}
+
+// AbortContext returns the context which is done once the EVM is cancelled.
+func (evm *EVM) AbortContext() context.Context {
+	evm.abortOnce.Do(func() {
+		evm.abortCtx, evm.abortCancel = context.WithCancel(context.Background())
+	})
+	return evm.abortCtx
 }
 
 // Interpreter returns the current interpreter
@@ -181,6 +222,45 @@ func (evm *EVM) Interpreter() Interpreter {
 	return evm.interpreter
 }
 
+// EmitLog adds the log emitted by the contract at address to the state, it is
+// shared by the LOG opcodes and the system contracts.
+func (evm *EVM) EmitLog(address types.Address, topics []types.Hash, data []byte) {
+	evm.StateDB.AddLog(&types.Log{
+		Address: address,
+		Topics:  topics,
+		Data:    data,
+		// This is a non-consensus field, but assigned here because
+		// core/state doesn't know the current block number.
+		BlockNumber: evm.BlockNumber.Uint64(),
+	})
+}
+
+// RegisterTxEndHook registers a hook to be executed when the transaction ends.
+// Hooks registered with the same key are executed only once, in the order of
+// their first registration.
+func (evm *EVM) RegisterTxEndHook(key string, hook func() error) {
+	if evm.txEndHooks == nil {
+		evm.txEndHooks = make(map[string]func() error)
+	}
+	if _, ok := evm.txEndHooks[key]; !ok {
+		evm.txEndHookKeys = append(evm.txEndHookKeys, key)
+	}
+	evm.txEndHooks[key] = hook
+}
+
+// runTxEndHooks executes and clears the registered tx end hooks, the first
+// error is returned after all the hooks have been executed.
+func (evm *EVM) runTxEndHooks() error {
+	var firstErr error
+	for _, key := range evm.txEndHookKeys {
+		if err := evm.txEndHooks[key](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	evm.txEndHooks, evm.txEndHookKeys = nil, nil
+	return firstErr
+}
+
 // Call executes the contract associated with the addr with the given input as
 // parameters. It also handles any necessary value transfer required and takes
 // the necessary steps to create accounts and reverses the state in case of an
@@ -204,11 +284,7 @@ func (evm *EVM) Call(caller ContractRef, addr types.Address, input []byte, gas u
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsHomestead
-		if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
+		if evm.precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
 			// Calling a non existing account, don't do anything, but ping the tracer
 			if evm.vmConfig.Debug && evm.depth == 0 {
 				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
@@ -425,6 +501,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	// by the error checking condition below.
 	if err == nil && !maxCodeSizeExceeded {
 		createDataGas := uint64(len(ret)) * params.CreateDataGas
+		// the wasm code also pays for being validated and metered before it runs
+		if evm.chainConfig.IsEWASM(evm.BlockNumber) && bytes.HasPrefix(ret, wasmMagic) {
+			createDataGas += uint64(len(ret)) * params.WasmCodeByteGas
+		}
 		if contract.UseGas(createDataGas) {
 			evm.StateDB.SetCode(address, ret)
 		} else {
@@ -470,3 +550,9 @@ func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *
 
 // ChainConfig returns the environment's chain configuration
 func (evm *EVM) ChainConfig() *params.ChainConfig { return evm.chainConfig }
+
+// Precompile returns the precompiled contract active at the address, nil if
+// there is none.
+func (evm *EVM) Precompile(addr types.Address) PrecompiledContract {
+	return evm.precompiles[addr]
+}
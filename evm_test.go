@@ -18,8 +18,15 @@ package evm
 import (
 	"testing"
 
+	"context"
 	"encoding/hex"
+	"errors"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/async"
+	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
+	sysutil "github.com/DSiSc/evm-NG/system/contract/util"
 	"github.com/DSiSc/evm-NG/util"
 	"github.com/DSiSc/repository"
 	"github.com/DSiSc/repository/config"
@@ -137,3 +144,277 @@ func (*eventCenter) NotifyAll() (errs []error) {
 func (*eventCenter) UnSubscribeAll() {
 
 }
+
+// test tx end hooks are executed once the outermost call returns
+func TestEVM_RegisterTxEndHook(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	executed := make([]string, 0)
+	evmInst.RegisterTxEndHook("hook1", func() error {
+		executed = append(executed, "hook1")
+		return nil
+	})
+	evmInst.RegisterTxEndHook("hook2", func() error {
+		executed = append(executed, "hook2")
+		return nil
+	})
+	evmInst.RegisterTxEndHook("hook1", func() error {
+		executed = append(executed, "hook1")
+		return nil
+	})
+
+	callerRef := AccountRef(callerAddress)
+	_, _, err := evmInst.Call(callerRef, contractAddress, input1, 3000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]string{"hook1", "hook2"}, executed)
+
+	_, _, err = evmInst.Call(callerRef, contractAddress, input1, 3000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]string{"hook1", "hook2"}, executed)
+
+	// failed hook doesn't overwrite the successful result
+	evmInst.RegisterTxEndHook("hook3", func() error {
+		return errors.New("release failed")
+	})
+	ret, _, err := evmInst.Call(callerRef, contractAddress, input1, 3000, big.NewInt(0))
+	assert.Nil(err)
+	assert.NotNil(ret)
+}
+
+// test the abort context is done once the evm is cancelled
+func TestEVM_AbortContext(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	ctx := evmInst.AbortContext()
+	assert.Nil(ctx.Err())
+	evmInst.Cancel()
+	assert.Equal(context.Canceled, ctx.Err())
+	assert.Equal(ctx, evmInst.AbortContext())
+}
+
+// test the failed system contract call is reverted with the error as reason
+func TestSysContractCall(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	unknownMethod := []byte{0x01, 0x02, 0x03, 0x04}
+	ret, gas, err := sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, unknownMethod, 3000, big.NewInt(0))
+	assert.Equal(errExecutionReverted, err)
+	assert.Equal(3000-params.SysContractCallGas, gas)
+	var reason string
+	assert.Equal(revertReasonMethodHash, ret[:4])
+	assert.Nil(sysutil.ExtractParam(ret[4:], &reason))
+	assert.Equal("unknown method", reason)
+}
+
+// test the required gas of the system contract is charged before the execution
+func TestSysContractCall_RequiredGas(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	args, _ := sysutil.EncodeReturnValue("price", []byte("BTC"), [4]byte{0x1, 0x2, 0x3, 0x4})
+	input := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("submit(string,bytes,bytes4)"))), args...)
+	requiredGas := SysContractRequiredGas(async.AsyncRequestAddr, input)
+	assert.Equal(params.SysContractCallGas+async.RequiredGas(input), requiredGas)
+	_, gas, err := sysContractCall(evmInst, AccountRef(callerAddress), async.AsyncRequestAddr, input, requiredGas-1, big.NewInt(0))
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(uint64(0), gas)
+	_, gas, err = sysContractCall(evmInst, AccountRef(callerAddress), async.AsyncRequestAddr, input, requiredGas+100, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(uint64(100), gas)
+	assert.Equal(params.SysContractCallGas, SysContractRequiredGas(buffer.SystemBufferAddr, input))
+}
+
+// test the callback gas of the fulfilled request is paid by the fulfill call, and the unused gas is returned
+func TestSysContractCall_AsyncCallbackGas(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+	assert.Nil(async.SetupGenesis(bc, util.HexToAddress("0x9"), callerAddress))
+
+	// the callback runs PUSH1 1 PUSH1 1 ADD STOP, which uses 9 gas
+	requester := util.HexToAddress("0x1234")
+	bc.CreateAccount(requester)
+	bc.SetCode(requester, []byte{0x60, 0x01, 0x60, 0x01, 0x01, 0x00})
+	args, _ := sysutil.EncodeReturnValue("price", []byte("BTC"), [4]byte{0x1, 0x2, 0x3, 0x4})
+	submit := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("submit(string,bytes,bytes4)"))), args...)
+	_, _, err := sysContractCall(evmInst, AccountRef(requester), async.AsyncRequestAddr, submit, 1000000, big.NewInt(0))
+	assert.Nil(err)
+
+	fulfill, err := (&async.Response{Id: 1, Result: []byte("100")}).FulfillInput()
+	assert.Nil(err)
+	_, gas, err := sysContractCall(evmInst, AccountRef(callerAddress), async.AsyncRequestAddr, fulfill, params.SysContractCallGas+async.CallbackGas-1, big.NewInt(0))
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(uint64(0), gas)
+	request, err := async.NewAsyncRequestContract(bc, 1, nil).GetRequest(1)
+	assert.Nil(err)
+	assert.Equal(async.Pending, request.Status)
+
+	ret, gas, err := sysContractCall(evmInst, AccountRef(callerAddress), async.AsyncRequestAddr, fulfill, 300000, big.NewInt(0))
+	assert.Nil(err)
+	var ok bool
+	assert.Nil(sysutil.ExtractParam(ret, &ok))
+	assert.True(ok)
+	assert.Equal(300000-params.SysContractCallGas-9, gas)
+}
+
+// test the system contract call transferring value is reverted without charging gas
+func TestSysContractCall_Value(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	input, _ := sysutil.EncodeReturnValue([]byte("Hello"))
+	writeMethod := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("Write(bytes)"))), input...)
+	ret, gas, err := sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, writeMethod, 10000, big.NewInt(1))
+	assert.Equal(errExecutionReverted, err)
+	assert.Equal(uint64(10000), gas)
+	var reason string
+	assert.Nil(sysutil.ExtractParam(ret[4:], &reason))
+	assert.Equal(errSysContractValue.Error(), reason)
+	assert.Equal(uint64(0), buffer.NewSystemBufferContract(bc, callerAddress, buffer.DefaultHandle).Length())
+	assert.Equal(big.NewInt(1000), bc.GetBalance(callerAddress))
+}
+
+// test the gas metered by the system contract during the execution is charged
+func TestSysContractCall_GasMeter(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	// 300 bytes are written in 2 chunks
+	input, _ := sysutil.EncodeReturnValue(make([]byte, 300))
+	writeMethod := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("Write(bytes)"))), input...)
+	requiredGas := params.SysContractCallGas + 2*params.SysBufferChunkGas + 300*params.SysBufferByteGas
+	_, gas, err := sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, writeMethod, requiredGas-1, big.NewInt(0))
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(uint64(0), gas)
+	assert.Equal(uint64(0), buffer.NewSystemBufferContract(bc, callerAddress, buffer.DefaultHandle).Length())
+
+	_, gas, err = sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, writeMethod, requiredGas+100, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(uint64(100), gas)
+	assert.Equal(uint64(300), buffer.NewSystemBufferContract(bc, callerAddress, buffer.DefaultHandle).Length())
+
+	openMethod := sysutil.ExtractMethodHash(sysutil.Hash([]byte("Open()")))
+	_, gas, err = sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, openMethod, 10000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(10000-params.SysContractCallGas-params.SysBufferOpenGas, gas)
+}
+
+// test the reading from the buffer cursor is resumed in the next call
+func TestSysContractCall_ReadFromCursor(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	input, _ := sysutil.EncodeReturnValue([]byte("Hello, World"))
+	writeMethod := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("Write(bytes)"))), input...)
+	_, _, err := sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, writeMethod, 10000, big.NewInt(0))
+	assert.Nil(err)
+
+	input, _ = sysutil.EncodeReturnValue(buffer.DefaultHandle, uint64(5))
+	readMethod := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("Read(uint256,uint256)"))), input...)
+	for _, expect := range []string{"Hello", ", Wor", "ld"} {
+		ret, _, err := sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, readMethod, 10000, big.NewInt(0))
+		assert.Nil(err)
+		var data []byte
+		assert.Nil(sysutil.ExtractParam(ret, &data))
+		assert.Equal([]byte(expect), data)
+	}
+}
+
+// test only the known errors are forwarded as the revert reason
+func TestEncodeRevertReason(t *testing.T) {
+	assert := assert.New(t)
+	for err, expect := range map[error]string{
+		storage.ObjectNotFoundError: "object not found",
+		// error replayed from the storage witness
+		errors.New(storage.ObjectNotFoundError.Error()):                                     "object not found",
+		&storage.ResponseError{StatusCode: 500, Message: "response error, RequestId: 1234"}: defaultRevertReason,
+		errors.New("dial tcp: connection refused"):                                          defaultRevertReason,
+	} {
+		var reason string
+		ret := encodeRevertReason(err)
+		assert.Equal(revertReasonMethodHash, ret[:4])
+		assert.Nil(sysutil.ExtractParam(ret[4:], &reason))
+		assert.Equal(expect, reason)
+	}
+}
+
+// test only the view methods of the system contract can be called statically
+func TestSysContractStaticCall(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEVM(bc)
+
+	input, _ := sysutil.EncodeReturnValue([]byte("Hello"))
+	writeMethod := append(sysutil.ExtractMethodHash(sysutil.Hash([]byte("Write(bytes)"))), input...)
+	_, gas, err := sysContractStaticCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, writeMethod, 3000)
+	assert.Equal(errWriteProtection, err)
+	assert.Equal(uint64(0), gas)
+	assert.Equal(uint64(0), buffer.NewSystemBufferContract(bc, callerAddress, buffer.DefaultHandle).Length())
+
+	_, _, err = sysContractCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, writeMethod, 10000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(uint64(5), buffer.NewSystemBufferContract(bc, callerAddress, buffer.DefaultHandle).Length())
+
+	lengthMethod := sysutil.ExtractMethodHash(sysutil.Hash([]byte("Length()")))
+	ret, gas, err := sysContractStaticCall(evmInst, AccountRef(callerAddress), buffer.SystemBufferAddr, lengthMethod, 3000)
+	assert.Nil(err)
+	assert.Equal(3000-params.SysContractCallGas, gas)
+	var length uint64
+	assert.Nil(sysutil.ExtractParam(ret, &length))
+	assert.Equal(uint64(5), length)
+}
+
+// test the precompile overrides only apply to the EVM created with them
+func TestNewEVMWithConfig_Precompiles(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	customAddr := util.BytesToAddress([]byte{0x10})
+	vmConfig := Config{
+		Precompiles: []PrecompileOverride{
+			{Address: customAddr, Contract: &mockPrecompile{output: []byte{0x1}}},
+		},
+	}
+	tx := types.Transaction{Data: types.TxData{From: &callerAddress, Amount: big.NewInt(0), Price: big.NewInt(1)}}
+	context := NewEVMContext(tx, &types.Header{Height: 1}, bc, types.Address{})
+	evmInst := NewEVMWithConfig(context, bc, params.TestChainConfig, vmConfig)
+	assert.NotNil(evmInst.Precompile(customAddr))
+	assert.NotNil(evmInst.Precompile(util.BytesToAddress([]byte{8})))
+
+	ret, leftGas, err := evmInst.Call(AccountRef(callerAddress), customAddr, nil, 100, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]byte{0x1}, ret)
+	assert.Equal(uint64(90), leftGas)
+
+	assert.Nil(mockEVM(bc).Precompile(customAddr))
+}
+
+func TestEVMCall_P256Verify(t *testing.T) {
+	assert := assert.New(t)
+	tests, err := loadJson("p256Verify")
+	assert.Nil(err)
+	bc := mockPreBlockChain()
+	p256Addr := util.BytesToAddress([]byte{0x01, 0x00})
+	tx := types.Transaction{Data: types.TxData{From: &callerAddress, Amount: big.NewInt(0), Price: big.NewInt(1)}}
+	context := NewEVMContext(tx, &types.Header{Height: 1}, bc, types.Address{})
+
+	// the precompile is selected by the osaka rules
+	evmInst := NewEVMWithConfig(context, bc, params.TestChainConfig, Config{})
+	ret, leftGas, err := evmInst.Call(AccountRef(callerAddress), p256Addr, util.Hex2Bytes(tests[0].Input), params.P256VerifyGas+100, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(true32Byte, ret)
+	assert.Equal(uint64(100), leftGas)
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.OsakaBlock = nil
+	assert.Nil(NewEVMWithConfig(context, bc, &chainConfig, Config{}).Precompile(p256Addr))
+}
@@ -0,0 +1,548 @@
+package evm
+
+import (
+	"errors"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+	"github.com/holiman/uint256"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync/atomic"
+)
+
+// EEI call and create results
+const (
+	eeiSuccess uint32 = 0
+	eeiFailure uint32 = 1
+	eeiRevert  uint32 = 2
+)
+
+var (
+	errWasmFinish            = errors.New("ewasm: execution finished")
+	errWasmAborted           = errors.New("ewasm: execution aborted")
+	errWasmMemoryOutOfBounds = errors.New("ewasm: out of bounds memory access")
+	errWasmMemoryLimit       = errors.New("ewasm: memory limit exceeded")
+	errWasmCallDepth         = errors.New("ewasm: max call depth exceeded")
+	errWasmInvalidTopics     = errors.New("ewasm: invalid number of log topics")
+)
+
+// ewasmEnv is the environment of a running EWASM contract, it implements the
+// Ethereum Environment Interface (EEI) on top of the state of the EVM. The host
+// functions panic to stop the execution, the panic is recovered by the wasm vm
+// and returned as the error of the execution.
+type ewasmEnv struct {
+	in       *EWASMInterpreter
+	evm      *EVM
+	contract *Contract
+	vm       *exec.VM
+	readOnly bool
+
+	pages      uint64 // pages of the linear memory
+	returnData []byte // return data of the last call or create
+	output     []byte // data returned by finish or revert
+}
+
+// resolve returns the host module imported by the contract
+func (env *ewasmEnv) resolve(name string) (*wasm.Module, error) {
+	switch name {
+	case ewasmModule:
+		return newHostModule(env.eeiFuncs()), nil
+	case meteringModule:
+		return newHostModule(map[string]interface{}{
+			"growMemory": env.growMemory,
+			"enterCall":  env.enterCall,
+			"leaveCall":  env.leaveCall,
+		}), nil
+	default:
+		return nil, errWasmInvalidImport
+	}
+}
+
+// eeiFuncs returns the host functions of the EEI
+func (env *ewasmEnv) eeiFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"useGas":              env.useGasFunc,
+		"getGasLeft":          env.getGasLeft,
+		"getAddress":          env.getAddress,
+		"getExternalBalance":  env.getExternalBalance,
+		"getBlockHash":        env.getBlockHash,
+		"getBlockCoinbase":    env.getBlockCoinbase,
+		"getBlockDifficulty":  env.getBlockDifficulty,
+		"getBlockGasLimit":    env.getBlockGasLimit,
+		"getBlockNumber":      env.getBlockNumber,
+		"getBlockTimestamp":   env.getBlockTimestamp,
+		"getTxGasPrice":       env.getTxGasPrice,
+		"getTxOrigin":         env.getTxOrigin,
+		"getCaller":           env.getCaller,
+		"getCallValue":        env.getCallValue,
+		"getCallDataSize":     env.getCallDataSize,
+		"callDataCopy":        env.callDataCopy,
+		"getCodeSize":         env.getCodeSize,
+		"codeCopy":            env.codeCopy,
+		"getExternalCodeSize": env.getExternalCodeSize,
+		"externalCodeCopy":    env.externalCodeCopy,
+		"getReturnDataSize":   env.getReturnDataSize,
+		"returnDataCopy":      env.returnDataCopy,
+		"storageLoad":         env.storageLoad,
+		"storageStore":        env.storageStore,
+		"log":                 env.log,
+		"call":                env.call,
+		"callCode":            env.callCode,
+		"callDelegate":        env.callDelegate,
+		"callStatic":          env.callStatic,
+		"create":              env.create,
+		"selfDestruct":        env.selfDestruct,
+		"finish":              env.finish,
+		"revert":              env.revert,
+	}
+}
+
+// newHostModule exports the go functions as the wasm host functions, the wasm
+// signatures are derived from the go signatures. The host function bodies are
+// only used by the validation, they are never executed.
+func newHostModule(funcs map[string]interface{}) *wasm.Module {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m := wasm.NewModule()
+	m.Types.Entries = make([]wasm.FunctionSig, len(names))
+	m.FunctionIndexSpace = make([]wasm.Function, len(names))
+	m.Export.Entries = make(map[string]wasm.ExportEntry, len(names))
+	for i, name := range names {
+		fn := reflect.ValueOf(funcs[name])
+		sig := &m.Types.Entries[i]
+		sig.Form = int8(wasm.TypeFunc)
+		for j := 1; j < fn.Type().NumIn(); j++ {
+			sig.ParamTypes = append(sig.ParamTypes, wasmValueType(fn.Type().In(j)))
+		}
+		for j := 0; j < fn.Type().NumOut(); j++ {
+			sig.ReturnTypes = append(sig.ReturnTypes, wasmValueType(fn.Type().Out(j)))
+		}
+		m.FunctionIndexSpace[i] = wasm.Function{
+			Sig:  sig,
+			Body: &wasm.FunctionBody{Module: m, Code: []byte{ops.Unreachable}},
+			Host: fn,
+		}
+		m.Export.Entries[name] = wasm.ExportEntry{FieldStr: name, Kind: wasm.ExternalFunction, Index: uint32(i)}
+	}
+	return m
+}
+
+func wasmValueType(t reflect.Type) wasm.ValueType {
+	switch t.Kind() {
+	case reflect.Int32, reflect.Uint32:
+		return wasm.ValueTypeI32
+	case reflect.Int64, reflect.Uint64:
+		return wasm.ValueTypeI64
+	default:
+		panic("unsupported host function value type " + t.String())
+	}
+}
+
+// useGas consumes the gas of the contract, it also stops the execution once the
+// EVM is cancelled.
+func (env *ewasmEnv) useGas(gas uint64) {
+	if atomic.LoadInt32(&env.evm.abort) != 0 {
+		panic(errWasmAborted)
+	}
+	if !env.contract.UseGas(gas) {
+		panic(ErrOutOfGas)
+	}
+}
+
+// useCopyGas consumes the gas of copying size bytes
+func (env *ewasmEnv) useCopyGas(gas uint64, size uint32) {
+	words, overflow := math.SafeMul(toWordSize(uint64(size)), params.CopyGas)
+	if overflow {
+		panic(errGasUintOverflow)
+	}
+	if gas, overflow = math.SafeAdd(gas, words); overflow {
+		panic(errGasUintOverflow)
+	}
+	env.useGas(gas)
+}
+
+// checkWrite stops the execution if the state is modified in static mode
+func (env *ewasmEnv) checkWrite() {
+	if env.readOnly {
+		panic(errWriteProtection)
+	}
+}
+
+// memory returns the slice of the linear memory
+func (env *ewasmEnv) memory(offset, size uint32) []byte {
+	mem := env.vm.Memory()
+	if uint64(offset)+uint64(size) > uint64(len(mem)) {
+		panic(errWasmMemoryOutOfBounds)
+	}
+	return mem[offset : uint64(offset)+uint64(size)]
+}
+
+func (env *ewasmEnv) readBytes(offset, size uint32) []byte {
+	return common.CopyBytes(env.memory(offset, size))
+}
+
+func (env *ewasmEnv) readAddress(offset uint32) types.Address {
+	var addr types.Address
+	copy(addr[:], env.memory(offset, uint32(len(addr))))
+	return addr
+}
+
+func (env *ewasmEnv) readHash(offset uint32) types.Hash {
+	var hash types.Hash
+	copy(hash[:], env.memory(offset, uint32(len(hash))))
+	return hash
+}
+
+// readU128 reads the little-endian 128 bits unsigned integer
+func (env *ewasmEnv) readU128(offset uint32) *big.Int {
+	le := env.memory(offset, 16)
+	be := make([]byte, len(le))
+	for i, b := range le {
+		be[len(be)-1-i] = b
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+func (env *ewasmEnv) writeBytes(offset uint32, data []byte) {
+	copy(env.memory(offset, uint32(len(data))), data)
+}
+
+// writeLittleEndian writes the lowest size bytes of the unsigned integer in little-endian
+func (env *ewasmEnv) writeLittleEndian(offset uint32, v *big.Int, size int) {
+	be := math.PaddedBigBytes(new(big.Int).And(v, new(big.Int).Sub(new(big.Int).Lsh(common.Big1, uint(size*8)), common.Big1)), size)
+	le := env.memory(offset, uint32(size))
+	for i, b := range be {
+		le[size-1-i] = b
+	}
+}
+
+func (env *ewasmEnv) useGasFunc(_ *exec.Process, gas uint64) {
+	env.useGas(gas)
+}
+
+func (env *ewasmEnv) getGasLeft(_ *exec.Process) uint64 {
+	env.useGas(GasQuickStep)
+	return env.contract.Gas
+}
+
+func (env *ewasmEnv) getAddress(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	addr := env.contract.Address()
+	env.writeBytes(resultOffset, addr[:])
+}
+
+func (env *ewasmEnv) getExternalBalance(_ *exec.Process, addressOffset, resultOffset uint32) {
+	env.useGas(env.in.gasTable.Balance)
+	balance := env.evm.StateDB.GetBalance(env.readAddress(addressOffset))
+	env.writeLittleEndian(resultOffset, balance, 16)
+}
+
+func (env *ewasmEnv) getBlockHash(_ *exec.Process, number uint64, resultOffset uint32) uint32 {
+	env.useGas(GasExtStep)
+	current := env.evm.BlockNumber.Uint64()
+	if number >= current || current-number > 256 {
+		return eeiFailure
+	}
+	hash := env.evm.GetHash(number)
+	env.writeBytes(resultOffset, hash[:])
+	return eeiSuccess
+}
+
+func (env *ewasmEnv) getBlockCoinbase(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	env.writeBytes(resultOffset, env.evm.Coinbase[:])
+}
+
+func (env *ewasmEnv) getBlockDifficulty(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	env.writeLittleEndian(resultOffset, env.evm.Difficulty, 32)
+}
+
+func (env *ewasmEnv) getBlockGasLimit(_ *exec.Process) uint64 {
+	env.useGas(GasQuickStep)
+	return env.evm.GasLimit
+}
+
+func (env *ewasmEnv) getBlockNumber(_ *exec.Process) uint64 {
+	env.useGas(GasQuickStep)
+	return env.evm.BlockNumber.Uint64()
+}
+
+func (env *ewasmEnv) getBlockTimestamp(_ *exec.Process) uint64 {
+	env.useGas(GasQuickStep)
+	return env.evm.Time.Uint64()
+}
+
+func (env *ewasmEnv) getTxGasPrice(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	env.writeLittleEndian(resultOffset, env.evm.GasPrice, 16)
+}
+
+func (env *ewasmEnv) getTxOrigin(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	env.writeBytes(resultOffset, env.evm.Origin[:])
+}
+
+func (env *ewasmEnv) getCaller(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	caller := env.contract.Caller()
+	env.writeBytes(resultOffset, caller[:])
+}
+
+func (env *ewasmEnv) getCallValue(_ *exec.Process, resultOffset uint32) {
+	env.useGas(GasQuickStep)
+	env.writeLittleEndian(resultOffset, env.contract.Value(), 16)
+}
+
+func (env *ewasmEnv) getCallDataSize(_ *exec.Process) uint32 {
+	env.useGas(GasQuickStep)
+	return uint32(len(env.contract.Input))
+}
+
+func (env *ewasmEnv) callDataCopy(_ *exec.Process, resultOffset, dataOffset, length uint32) {
+	env.useCopyGas(GasFastestStep, length)
+	env.writeBytes(resultOffset, getData(env.contract.Input, uint64(dataOffset), uint64(length)))
+}
+
+func (env *ewasmEnv) getCodeSize(_ *exec.Process) uint32 {
+	env.useGas(GasQuickStep)
+	return uint32(len(env.contract.Code))
+}
+
+func (env *ewasmEnv) codeCopy(_ *exec.Process, resultOffset, codeOffset, length uint32) {
+	env.useCopyGas(GasFastestStep, length)
+	env.writeBytes(resultOffset, getData(env.contract.Code, uint64(codeOffset), uint64(length)))
+}
+
+func (env *ewasmEnv) getExternalCodeSize(_ *exec.Process, addressOffset uint32) uint32 {
+	env.useGas(env.in.gasTable.ExtcodeSize)
+	addr := env.readAddress(addressOffset)
+	// the system contracts have no code, but report 1 as EXTCODESIZE so they can be called
+	if IsSystemContract(addr) {
+		return 1
+	}
+	return uint32(env.evm.StateDB.GetCodeSize(addr))
+}
+
+func (env *ewasmEnv) externalCodeCopy(_ *exec.Process, addressOffset, resultOffset, codeOffset, length uint32) {
+	env.useCopyGas(env.in.gasTable.ExtcodeCopy, length)
+	code := env.evm.StateDB.GetCode(env.readAddress(addressOffset))
+	env.writeBytes(resultOffset, getData(code, uint64(codeOffset), uint64(length)))
+}
+
+func (env *ewasmEnv) getReturnDataSize(_ *exec.Process) uint32 {
+	env.useGas(GasQuickStep)
+	return uint32(len(env.returnData))
+}
+
+func (env *ewasmEnv) returnDataCopy(_ *exec.Process, resultOffset, dataOffset, length uint32) {
+	env.useCopyGas(GasFastestStep, length)
+	if uint64(dataOffset)+uint64(length) > uint64(len(env.returnData)) {
+		panic(errReturnDataOutOfBounds)
+	}
+	env.writeBytes(resultOffset, env.returnData[dataOffset:uint64(dataOffset)+uint64(length)])
+}
+
+func (env *ewasmEnv) storageLoad(_ *exec.Process, pathOffset, resultOffset uint32) {
+	env.useGas(env.in.gasTable.SLoad)
+	val := env.evm.StateDB.GetHashTypeState(env.contract.Address(), env.readHash(pathOffset))
+	env.writeBytes(resultOffset, val[:])
+}
+
+func (env *ewasmEnv) storageStore(_ *exec.Process, pathOffset, valueOffset uint32) {
+	env.checkWrite()
+	loc, val := env.readHash(pathOffset), env.readHash(valueOffset)
+	env.useGas(sstoreGas(env.evm, env.contract.Address(), loc, val))
+	env.evm.StateDB.SetHashTypeState(env.contract.Address(), loc, val)
+}
+
+func (env *ewasmEnv) log(_ *exec.Process, dataOffset, length, numberOfTopics, topic1, topic2, topic3, topic4 uint32) {
+	env.checkWrite()
+	if numberOfTopics > 4 {
+		panic(errWasmInvalidTopics)
+	}
+	gas, overflow := math.SafeMul(uint64(length), params.LogDataGas)
+	if overflow {
+		panic(errGasUintOverflow)
+	}
+	env.useGas(params.LogGas + uint64(numberOfTopics)*params.LogTopicGas + gas)
+	topics := make([]types.Hash, numberOfTopics)
+	for i, offset := range []uint32{topic1, topic2, topic3, topic4}[:numberOfTopics] {
+		topics[i] = env.readHash(offset)
+	}
+	env.evm.EmitLog(env.contract.Address(), topics, env.readBytes(dataOffset, length))
+}
+
+// callGas charges the base gas of the call and returns the gas available for the callee
+func (env *ewasmEnv) callGas(base, gas uint64) uint64 {
+	available, err := callGas(env.in.gasTable, env.contract.Gas, base, uint256.NewInt(gas))
+	if err != nil {
+		panic(err)
+	}
+	total, overflow := math.SafeAdd(base, available)
+	if overflow {
+		panic(errGasUintOverflow)
+	}
+	env.useGas(total)
+	return available
+}
+
+// callResult records the return data of the call and returns the EEI result
+func (env *ewasmEnv) callResult(ret []byte, returnGas uint64, err error) uint32 {
+	env.contract.Gas += returnGas
+	env.returnData = ret
+	switch err {
+	case nil:
+		return eeiSuccess
+	case errExecutionReverted:
+		return eeiRevert
+	default:
+		return eeiFailure
+	}
+}
+
+func (env *ewasmEnv) call(_ *exec.Process, gas uint64, addressOffset, valueOffset, dataOffset, length uint32) uint32 {
+	addr, value, input := env.readAddress(addressOffset), env.readU128(valueOffset), env.readBytes(dataOffset, length)
+	transfersValue := value.Sign() != 0
+	if transfersValue {
+		env.checkWrite()
+	}
+	base := env.in.gasTable.Calls
+	if env.evm.ChainConfig().IsEIP158(env.evm.BlockNumber) {
+		if transfersValue && env.evm.StateDB.Empty(addr) {
+			base += params.CallNewAccountGas
+		}
+	} else if !env.evm.StateDB.Exist(addr) {
+		base += params.CallNewAccountGas
+	}
+	if transfersValue {
+		base += params.CallValueTransferGas
+	}
+	gas = env.callGas(base, gas)
+	if transfersValue {
+		gas += params.CallStipend
+	}
+	if IsSystemContract(addr) && env.readOnly {
+		return env.callResult(sysContractStaticCall(env.evm, env.contract.self, addr, input, gas))
+	}
+	if IsSystemContract(addr) {
+		return env.callResult(sysContractCall(env.evm, env.contract.self, addr, input, gas, value))
+	}
+	return env.callResult(env.evm.Call(env.contract, addr, input, gas, value))
+}
+
+func (env *ewasmEnv) callCode(_ *exec.Process, gas uint64, addressOffset, valueOffset, dataOffset, length uint32) uint32 {
+	addr, value, input := env.readAddress(addressOffset), env.readU128(valueOffset), env.readBytes(dataOffset, length)
+	base := env.in.gasTable.Calls
+	if value.Sign() != 0 {
+		base += params.CallValueTransferGas
+	}
+	gas = env.callGas(base, gas)
+	if value.Sign() != 0 {
+		gas += params.CallStipend
+	}
+	return env.callResult(env.evm.CallCode(env.contract, addr, input, gas, value))
+}
+
+func (env *ewasmEnv) callDelegate(_ *exec.Process, gas uint64, addressOffset, dataOffset, length uint32) uint32 {
+	addr, input := env.readAddress(addressOffset), env.readBytes(dataOffset, length)
+	gas = env.callGas(env.in.gasTable.Calls, gas)
+	return env.callResult(env.evm.DelegateCall(env.contract, addr, input, gas))
+}
+
+func (env *ewasmEnv) callStatic(_ *exec.Process, gas uint64, addressOffset, dataOffset, length uint32) uint32 {
+	addr, input := env.readAddress(addressOffset), env.readBytes(dataOffset, length)
+	gas = env.callGas(env.in.gasTable.Calls, gas)
+	if IsSystemContract(addr) {
+		return env.callResult(sysContractStaticCall(env.evm, env.contract.self, addr, input, gas))
+	}
+	return env.callResult(env.evm.StaticCall(env.contract, addr, input, gas))
+}
+
+func (env *ewasmEnv) create(_ *exec.Process, valueOffset, dataOffset, length, resultOffset uint32) uint32 {
+	env.checkWrite()
+	value, input := env.readU128(valueOffset), env.readBytes(dataOffset, length)
+	env.useGas(params.CreateGas)
+	gas := env.contract.Gas
+	if env.evm.ChainConfig().IsEIP150(env.evm.BlockNumber) {
+		gas -= gas / 64
+	}
+	env.useGas(gas)
+	ret, addr, returnGas, err := env.evm.Create(env.contract, input, gas, value)
+	if err == nil || (err == ErrCodeStoreOutOfGas && !env.evm.ChainConfig().IsHomestead(env.evm.BlockNumber)) {
+		env.writeBytes(resultOffset, addr[:])
+		err = nil
+	}
+	if err != errExecutionReverted {
+		// only the revert reason is returned by the creation
+		ret = nil
+	}
+	return env.callResult(ret, returnGas, err)
+}
+
+func (env *ewasmEnv) selfDestruct(_ *exec.Process, addressOffset uint32) {
+	env.checkWrite()
+	beneficiary := env.readAddress(addressOffset)
+	gas := uint64(0)
+	if env.evm.ChainConfig().IsEIP150(env.evm.BlockNumber) {
+		gas = env.in.gasTable.Suicide
+		if env.evm.ChainConfig().IsEIP158(env.evm.BlockNumber) {
+			if env.evm.StateDB.Empty(beneficiary) && env.evm.StateDB.GetBalance(env.contract.Address()).Sign() != 0 {
+				gas += env.in.gasTable.CreateBySuicide
+			}
+		} else if !env.evm.StateDB.Exist(beneficiary) {
+			gas += env.in.gasTable.CreateBySuicide
+		}
+	}
+	env.useGas(gas)
+	if !env.evm.StateDB.HasSuicided(env.contract.Address()) {
+		env.evm.StateDB.AddRefund(params.SuicideRefundGas)
+	}
+	env.evm.StateDB.AddBalance(beneficiary, env.evm.StateDB.GetBalance(env.contract.Address()))
+	env.evm.StateDB.Suicide(env.contract.Address())
+	panic(errWasmFinish)
+}
+
+func (env *ewasmEnv) finish(_ *exec.Process, dataOffset, length uint32) {
+	env.output = env.readBytes(dataOffset, length)
+	panic(errWasmFinish)
+}
+
+func (env *ewasmEnv) revert(_ *exec.Process, dataOffset, length uint32) {
+	env.output = env.readBytes(dataOffset, length)
+	panic(errExecutionReverted)
+}
+
+// growMemory charges the pages before memory.grow, the memory can't exceed the limit
+func (env *ewasmEnv) growMemory(_ *exec.Process, pages uint32) uint32 {
+	if env.pages+uint64(pages) > params.WasmMaxMemoryPages {
+		panic(errWasmMemoryLimit)
+	}
+	env.useGas(uint64(pages) * params.WasmMemoryPageGas)
+	env.pages += uint64(pages)
+	return pages
+}
+
+// enterCall increases the depth of the wasm function calls before a call, the wasm
+// calls are executed recursively so the depth is limited across all the contracts.
+func (env *ewasmEnv) enterCall(_ *exec.Process) {
+	if env.in.callDepth >= params.WasmCallDepth {
+		panic(errWasmCallDepth)
+	}
+	env.in.callDepth++
+}
+
+// leaveCall decreases the depth of the wasm function calls after a call
+func (env *ewasmEnv) leaveCall(_ *exec.Process) {
+	env.in.callDepth--
+}
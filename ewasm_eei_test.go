@@ -0,0 +1,179 @@
+package evm
+
+import (
+	"encoding/binary"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/rpc"
+	"github.com/go-interpreter/wagon/wasm"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestEWASMEnv_Context(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "getCaller", params: []wasm.ValueType{i32}},
+		{name: "getAddress", params: []wasm.ValueType{i32}},
+		{name: "getBlockNumber", results: []wasm.ValueType{i64}},
+		{name: "getCallDataSize", results: []wasm.ValueType{i32}},
+		{name: "finish", params: []wasm.ValueType{i32, i32}},
+	}
+	main := wasmCode(
+		testI32Const(0), testCall(0),
+		testI32Const(20), testCall(1),
+		testI32Const(40), testCall(2), []byte{ops.I64Store, 3, 0},
+		testI32Const(48), testCall(3), []byte{ops.I32Store, 2, 0},
+		testI32Const(0), testI32Const(52), testCall(4),
+	)
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, main, nil))
+
+	ret, _, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, []byte{1, 2, 3}, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(52, len(ret))
+	assert.Equal(callerAddress[:], ret[:20])
+	assert.Equal(wasmContractAddress[:], ret[20:40])
+	assert.Equal(uint64(1), binary.LittleEndian.Uint64(ret[40:48]))
+	assert.Equal(uint32(3), binary.LittleEndian.Uint32(ret[48:52]))
+}
+
+func TestEWASMEnv_StorageLoad(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "storageLoad", params: []wasm.ValueType{i32, i32}},
+		{name: "finish", params: []wasm.ValueType{i32, i32}},
+	}
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, wasmCode(
+		testI32Const(0), testI32Const(32), testCall(0),
+		testI32Const(32), testI32Const(32), testCall(1),
+	), nil))
+	value := types.Hash{31: 0x2a}
+	bc.SetHashTypeState(wasmContractAddress, types.Hash{}, value)
+
+	ret, _, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(value[:], ret)
+}
+
+func TestEWASMEnv_WriteProtection(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{{name: "storageStore", params: []wasm.ValueType{i32, i32}}}
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, wasmCode(testI32Const(0), testI32Const(0), testCall(0)), nil))
+
+	_, _, err := mockEWASMEVM(bc, Config{}).StaticCall(AccountRef(callerAddress), wasmContractAddress, nil, 100000)
+	assert.Equal(errWriteProtection, err)
+}
+
+func TestEWASMEnv_ExternalCodeSize(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "getExternalCodeSize", params: []wasm.ValueType{i32}, results: []wasm.ValueType{i32}},
+		{name: "finish", params: []wasm.ValueType{i32, i32}},
+	}
+	main := wasmCode(
+		testI32Const(64), testI32Const(0), testCall(0), []byte{ops.I32Store, 2, 0},
+		testI32Const(68), testI32Const(20), testCall(0), []byte{ops.I32Store, 2, 0},
+		testI32Const(64), testI32Const(8), testCall(1),
+	)
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, main, append(rpc.RpcContractAddr[:], callerAddress[:]...)))
+
+	ret, _, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	// the system contract reports 1 as EXTCODESIZE does
+	assert.Equal(uint32(1), binary.LittleEndian.Uint32(ret[0:4]))
+	assert.Equal(uint32(0), binary.LittleEndian.Uint32(ret[4:8]))
+}
+
+func TestEWASMEnv_CallEVMContract(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "call", params: []wasm.ValueType{i64, i32, i32, i32, i32}, results: []wasm.ValueType{i32}},
+		{name: "getReturnDataSize", results: []wasm.ValueType{i32}},
+		{name: "returnDataCopy", params: []wasm.ValueType{i32, i32, i32}},
+		{name: "finish", params: []wasm.ValueType{i32, i32}},
+	}
+	// memory: address at 0, zero value at 32, input at 64, the result is copied to 128
+	data := make([]byte, 68)
+	copy(data, contractAddress[:])
+	copy(data[64:], input1)
+	main := wasmCode(
+		testI64Const(10000), testI32Const(0), testI32Const(32), testI32Const(64), testI32Const(int32(len(input1))), testCall(0),
+		[]byte{ops.If, 0x40, ops.Unreachable, ops.End},
+		testI32Const(128), testI32Const(0), testCall(1), testCall(2),
+		testI32Const(128), testCall(1), testCall(3),
+	)
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, main, data))
+
+	expect, _, err := mockEVM(bc).Call(AccountRef(callerAddress), contractAddress, input1, 10000, big.NewInt(0))
+	assert.Nil(err)
+	ret, _, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(expect, ret)
+}
+
+func TestEWASMEnv_CallFailure(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "call", params: []wasm.ValueType{i64, i32, i32, i32, i32}, results: []wasm.ValueType{i32}},
+		{name: "finish", params: []wasm.ValueType{i32, i32}},
+	}
+	// call the contract with too little gas and return the result
+	main := wasmCode(
+		testI32Const(64),
+		testI64Const(1), testI32Const(0), testI32Const(32), testI32Const(0), testI32Const(0), testCall(0),
+		[]byte{ops.I32Store, 2, 0},
+		testI32Const(64), testI32Const(4), testCall(1),
+	)
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, main, contractAddress[:]))
+
+	ret, _, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]byte{byte(eeiFailure), 0, 0, 0}, ret)
+}
+
+func TestEWASMEnv_Create(t *testing.T) {
+	assert := assert.New(t)
+	finish := []wasmTestImport{{name: "finish", params: []wasm.ValueType{i32, i32}}}
+	runtime := newTestWasm(finish, wasmCode(testI32Const(0), testI32Const(4), testCall(0)), []byte("wasm"))
+	// the init code returns the runtime code in its data
+	initCode := newTestWasm(finish, wasmCode(testI32Const(0), testI32Const(int32(len(runtime))), testCall(0)), runtime)
+
+	bc := mockPreBlockChain()
+	evmInst := mockEWASMEVM(bc, Config{})
+	_, addr, _, err := evmInst.Create(AccountRef(callerAddress), initCode, 1000000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(runtime, bc.GetCode(addr))
+
+	ret, _, err := evmInst.Call(AccountRef(callerAddress), addr, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]byte("wasm"), ret)
+}
+
+func TestEWASMEnv_Log(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "log", params: []wasm.ValueType{i32, i32, i32, i32, i32, i32, i32}},
+	}
+	main := wasmCode(testI32Const(0), testI32Const(4), testI32Const(1), testI32Const(32), testI32Const(0), testI32Const(0), testI32Const(0), testCall(0))
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, main, []byte("data")))
+
+	_, leftGas, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	usedGas := 7*params.WasmInstructionGas + params.WasmCallGas + params.WasmMemoryPageGas + params.LogGas + params.LogTopicGas + 4*params.LogDataGas
+	assert.Equal(100000-usedGas, leftGas)
+
+	// more than 4 topics
+	main = wasmCode(testI32Const(0), testI32Const(4), testI32Const(5), testI32Const(32), testI32Const(0), testI32Const(0), testI32Const(0), testCall(0))
+	mockWasmContract(bc, newTestWasm(imports, main, nil))
+	_, _, err = mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Equal(errWasmInvalidTopics, err)
+}
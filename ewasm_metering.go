@@ -0,0 +1,230 @@
+package evm
+
+import (
+	"errors"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+)
+
+const (
+	// ewasmModule is the namespace of the Ethereum Environment Interface
+	ewasmModule = "ethereum"
+	// meteringModule is the namespace of the host functions injected by the metering,
+	// contracts are not allowed to import it.
+	meteringModule = "metering"
+)
+
+var errWasmFloatingPoint = errors.New("ewasm: floating point instruction is not allowed")
+
+var (
+	sigUseGas     = wasm.FunctionSig{Form: int8(wasm.TypeFunc), ParamTypes: []wasm.ValueType{wasm.ValueTypeI64}}
+	sigGrowMemory = wasm.FunctionSig{Form: int8(wasm.TypeFunc), ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}}
+	sigCallDepth  = wasm.FunctionSig{Form: int8(wasm.TypeFunc)}
+)
+
+// meteringFuncs are the function indices of the host functions called by the injected code
+type meteringFuncs struct {
+	useGas     uint32 // ethereum.useGas(i64), charges the gas of the following instructions
+	growMemory uint32 // metering.growMemory(i32) i32, charges the pages before memory.grow
+	enterCall  uint32 // metering.enterCall(), increases the call depth before call
+	leaveCall  uint32 // metering.leaveCall(), decreases the call depth after call
+}
+
+// injectMetering rewrites the decoded module in place so that the gas of every basic
+// block is charged through ethereum.useGas before the block is executed, the pages
+// are charged before memory.grow and the call depth is tracked around the calls.
+// The metering host functions are imported after the existing imports, so the
+// indices of the functions defined by the module are shifted.
+func injectMetering(m *wasm.Module) error {
+	if m.Types == nil {
+		m.Types = &wasm.SectionTypes{}
+		insertSection(m, m.Types)
+	}
+	if m.Import == nil {
+		m.Import = &wasm.SectionImports{}
+		insertSection(m, m.Import)
+	}
+	imported := uint32(0)
+	useGas, hasUseGas := uint32(0), false
+	for _, entry := range m.Import.Entries {
+		fn, ok := entry.Type.(wasm.FuncImport)
+		if !ok {
+			continue
+		}
+		if entry.ModuleName == ewasmModule && entry.FieldName == "useGas" && int(fn.Type) < len(m.Types.Entries) && sameSig(m.Types.Entries[fn.Type], sigUseGas) {
+			useGas, hasUseGas = imported, true
+		}
+		imported++
+	}
+
+	added := uint32(0)
+	addImport := func(module, field string, sig wasm.FunctionSig) uint32 {
+		m.Import.Entries = append(m.Import.Entries, wasm.ImportEntry{
+			ModuleName: module,
+			FieldName:  field,
+			Type:       wasm.FuncImport{Type: typeIndex(m, sig)},
+		})
+		added++
+		return imported + added - 1
+	}
+	if !hasUseGas {
+		useGas = addImport(ewasmModule, "useGas", sigUseGas)
+	}
+	funcs := meteringFuncs{
+		useGas:     useGas,
+		growMemory: addImport(meteringModule, "growMemory", sigGrowMemory),
+		enterCall:  addImport(meteringModule, "enterCall", sigCallDepth),
+		leaveCall:  addImport(meteringModule, "leaveCall", sigCallDepth),
+	}
+
+	shift := func(index uint32) uint32 {
+		if index >= imported {
+			return index + added
+		}
+		return index
+	}
+	if m.Code != nil {
+		for i := range m.Code.Bodies {
+			code, err := meterBody(m.Code.Bodies[i].Code, funcs, shift)
+			if err != nil {
+				return err
+			}
+			m.Code.Bodies[i].Code = code
+		}
+	}
+	if m.Export != nil {
+		for name, entry := range m.Export.Entries {
+			if entry.Kind == wasm.ExternalFunction {
+				entry.Index = shift(entry.Index)
+				m.Export.Entries[name] = entry
+			}
+		}
+	}
+	if m.Elements != nil {
+		for i := range m.Elements.Entries {
+			for j, index := range m.Elements.Entries[i].Elems {
+				m.Elements.Entries[i].Elems[j] = shift(index)
+			}
+		}
+	}
+	if m.Start != nil {
+		m.Start.Index = shift(m.Start.Index)
+	}
+	return nil
+}
+
+// meterBody injects the metering into the function body code
+func meterBody(code []byte, funcs meteringFuncs, shift func(uint32) uint32) ([]byte, error) {
+	instrs, err := disasm.Disassemble(code)
+	if err != nil {
+		return nil, err
+	}
+	metered := make([]disasm.Instr, 0, len(instrs)*2)
+	block := make([]disasm.Instr, 0)
+	cost := uint64(0)
+	flush := func() {
+		if cost > 0 {
+			metered = append(metered, wasmI64Const(int64(cost)), wasmCall(funcs.useGas))
+		}
+		metered = append(metered, block...)
+		block, cost = block[:0], 0
+	}
+	for _, instr := range instrs {
+		if isFloatOp(instr.Op) {
+			return nil, errWasmFloatingPoint
+		}
+		switch instr.Op.Code {
+		case ops.Call, ops.CallIndirect:
+			if instr.Op.Code == ops.Call {
+				instr.Immediates[0] = shift(instr.Immediates[0].(uint32))
+			}
+			cost += params.WasmCallGas
+			block = append(block, wasmCall(funcs.enterCall), instr, wasmCall(funcs.leaveCall))
+			continue
+		case ops.GrowMemory:
+			block = append(block, wasmCall(funcs.growMemory))
+		}
+		cost += params.WasmInstructionGas
+		block = append(block, instr)
+		switch instr.Op.Code {
+		case ops.Block, ops.Loop, ops.If, ops.Else, ops.End, ops.Br, ops.BrIf, ops.BrTable, ops.Return, ops.Unreachable:
+			// the control flow may leave the basic block after this instruction,
+			// the following instructions are charged by the next block
+			flush()
+		}
+	}
+	flush()
+	return disasm.Assemble(metered)
+}
+
+// isFloatOp returns whether the operator takes or returns the floating point values,
+// they are not allowed as their results may be non-deterministic.
+func isFloatOp(op ops.Op) bool {
+	if op.Returns == wasm.ValueTypeF32 || op.Returns == wasm.ValueTypeF64 {
+		return true
+	}
+	for _, arg := range op.Args {
+		if arg == wasm.ValueTypeF32 || arg == wasm.ValueTypeF64 {
+			return true
+		}
+	}
+	return false
+}
+
+func wasmI64Const(v int64) disasm.Instr {
+	return disasm.Instr{Op: mustOp(ops.I64Const), Immediates: []interface{}{v}}
+}
+
+func wasmCall(index uint32) disasm.Instr {
+	return disasm.Instr{Op: mustOp(ops.Call), Immediates: []interface{}{index}}
+}
+
+func mustOp(code byte) ops.Op {
+	op, err := ops.New(code)
+	if err != nil {
+		panic(err)
+	}
+	return op
+}
+
+// typeIndex returns the index of the function type, it is added if it doesn't exist
+func typeIndex(m *wasm.Module, sig wasm.FunctionSig) uint32 {
+	for i, entry := range m.Types.Entries {
+		if sameSig(entry, sig) {
+			return uint32(i)
+		}
+	}
+	m.Types.Entries = append(m.Types.Entries, sig)
+	return uint32(len(m.Types.Entries) - 1)
+}
+
+func sameSig(a, b wasm.FunctionSig) bool {
+	if len(a.ParamTypes) != len(b.ParamTypes) || len(a.ReturnTypes) != len(b.ReturnTypes) {
+		return false
+	}
+	for i := range a.ParamTypes {
+		if a.ParamTypes[i] != b.ParamTypes[i] {
+			return false
+		}
+	}
+	for i := range a.ReturnTypes {
+		if a.ReturnTypes[i] != b.ReturnTypes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// insertSection inserts the section before the first known section with a greater id,
+// the custom sections are kept in place.
+func insertSection(m *wasm.Module, section wasm.Section) {
+	for i, s := range m.Sections {
+		if id := s.SectionID(); id != wasm.SectionIDCustom && id > section.SectionID() {
+			m.Sections = append(m.Sections[:i], append([]wasm.Section{section}, m.Sections[i:]...)...)
+			return
+		}
+	}
+	m.Sections = append(m.Sections, section)
+}
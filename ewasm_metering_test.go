@@ -0,0 +1,88 @@
+package evm
+
+import (
+	"bytes"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/wasm"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// disassembled returns the opcodes and immediates of the code
+func disassembled(code []byte) ([]byte, [][]interface{}) {
+	instrs, err := disasm.Disassemble(code)
+	if err != nil {
+		panic(err)
+	}
+	codes, immediates := make([]byte, 0), make([][]interface{}, 0)
+	for _, instr := range instrs {
+		codes = append(codes, instr.Op.Code)
+		immediates = append(immediates, instr.Immediates)
+	}
+	return codes, immediates
+}
+
+func TestMeterBody(t *testing.T) {
+	assert := assert.New(t)
+	funcs := meteringFuncs{useGas: 0, growMemory: 1, enterCall: 2, leaveCall: 3}
+	shift := func(index uint32) uint32 { return index + 4 }
+	code := wasmCode(
+		testI32Const(1), []byte{ops.GrowMemory, 0, ops.Drop},
+		[]byte{ops.Loop, 0x40}, testCall(1), []byte{ops.End},
+	)
+	metered, err := meterBody(code, funcs, shift)
+	assert.Nil(err)
+
+	codes, immediates := disassembled(metered)
+	assert.Equal([]byte{
+		ops.I64Const, ops.Call, ops.I32Const, ops.Call, ops.GrowMemory, ops.Drop, ops.Loop,
+		ops.I64Const, ops.Call, ops.Call, ops.Call, ops.Call, ops.End,
+	}, codes)
+	// the block before the loop
+	assert.Equal(int64(4*params.WasmInstructionGas), immediates[0][0])
+	assert.Equal(funcs.useGas, immediates[1][0])
+	assert.Equal(funcs.growMemory, immediates[3][0])
+	// the loop body with the call
+	assert.Equal(int64(params.WasmCallGas+params.WasmInstructionGas), immediates[7][0])
+	assert.Equal(funcs.enterCall, immediates[9][0])
+	assert.Equal(uint32(5), immediates[10][0])
+	assert.Equal(funcs.leaveCall, immediates[11][0])
+
+	_, err = meterBody([]byte{ops.F64Const, 0, 0, 0, 0, 0, 0, 0, 0, ops.Drop}, funcs, shift)
+	assert.Equal(errWasmFloatingPoint, err)
+	_, err = meterBody([]byte{ops.I32Const, 0, ops.F32ConvertSI32, ops.Drop}, funcs, shift)
+	assert.Equal(errWasmFloatingPoint, err)
+}
+
+func TestInjectMetering(t *testing.T) {
+	assert := assert.New(t)
+	m := newTestWasmModule([]wasmTestImport{{name: "finish", params: []wasm.ValueType{i32, i32}}}, []wasmTestFunc{{code: testCall(2)}, {}}, 1, nil)
+	assert.Nil(injectMetering(m))
+
+	assert.Equal(5, len(m.Import.Entries))
+	assert.Equal("useGas", m.Import.Entries[1].FieldName)
+	assert.Equal(ewasmModule, m.Import.Entries[1].ModuleName)
+	for i, name := range []string{"growMemory", "enterCall", "leaveCall"} {
+		assert.Equal(meteringModule, m.Import.Entries[i+2].ModuleName)
+		assert.Equal(name, m.Import.Entries[i+2].FieldName)
+	}
+	assert.Equal(uint32(5), m.Export.Entries["main"].Index)
+	assert.Equal(uint32(0), m.Export.Entries["memory"].Index)
+	_, immediates := disassembled(m.Code.Bodies[0].Code)
+	assert.Equal(uint32(6), immediates[3][0])
+
+	// the imported useGas is reused
+	m = newTestWasmModule([]wasmTestImport{{name: "useGas", params: []wasm.ValueType{i64}}}, []wasmTestFunc{{}}, 1, nil)
+	assert.Nil(injectMetering(m))
+	assert.Equal(4, len(m.Import.Entries))
+	assert.Equal(uint32(4), m.Export.Entries["main"].Index)
+
+	// the missing sections are created in order
+	m = &wasm.Module{Version: 1}
+	assert.Nil(injectMetering(m))
+	assert.Equal([]wasm.Section{m.Types, m.Import}, m.Sections)
+	buf := new(bytes.Buffer)
+	assert.Nil(wasm.EncodeModule(buf, m))
+}
@@ -17,9 +17,8 @@
 package evm
 
 import (
-	"math/big"
-
 	"github.com/DSiSc/evm-NG/params"
+	"github.com/holiman/uint256"
 )
 
 // Gas costs
@@ -40,7 +39,7 @@ const (
 //
 // The cost of gas was changed during the homestead price change HF. To allow for EIP150
 // to be implemented. The returned gas is gas - base * 63 / 64.
-func callGas(gasTable params.GasTable, availableGas, base uint64, callCost *big.Int) (uint64, error) {
+func callGas(gasTable params.GasTable, availableGas, base uint64, callCost *uint256.Int) (uint64, error) {
 	if gasTable.CreateBySuicide > 0 {
 		availableGas = availableGas - base
 		gas := availableGas - availableGas/64
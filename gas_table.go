@@ -20,7 +20,6 @@ import (
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/evm-NG/common/math"
 	"github.com/DSiSc/evm-NG/params"
-	"github.com/DSiSc/evm-NG/util"
 )
 
 // memoryGasCost calculates the quadratic gas for memory expansion. It does so
@@ -69,7 +68,7 @@ func gasCallDataCopy(gt params.GasTable, evm *EVM, contract *Contract, stack *St
 		return 0, errGasUintOverflow
 	}
 
-	words, overflow := bigUint64(stack.Back(2))
+	words, overflow := stack.Back(2).Uint64WithOverflow()
 	if overflow {
 		return 0, errGasUintOverflow
 	}
@@ -95,7 +94,7 @@ func gasReturnDataCopy(gt params.GasTable, evm *EVM, contract *Contract, stack *
 		return 0, errGasUintOverflow
 	}
 
-	words, overflow := bigUint64(stack.Back(2))
+	words, overflow := stack.Back(2).Uint64WithOverflow()
 	if overflow {
 		return 0, errGasUintOverflow
 	}
@@ -111,10 +110,14 @@ func gasReturnDataCopy(gt params.GasTable, evm *EVM, contract *Contract, stack *
 }
 
 func gasSStore(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	var (
-		y, x    = stack.Back(1), stack.Back(0)
-		current = evm.StateDB.GetHashTypeState(contract.Address(), util.BigToHash(x))
-	)
+	y, x := stack.Back(1), stack.Back(0)
+	return sstoreGas(evm, contract.Address(), types.Hash(x.Bytes32()), types.Hash(y.Bytes32())), nil
+}
+
+// sstoreGas returns the gas of storing value at loc of the address and updates
+// the refund counter, it is shared by SSTORE and the EWASM storageStore.
+func sstoreGas(evm *EVM, address types.Address, loc, value types.Hash) uint64 {
+	current := evm.StateDB.GetHashTypeState(address, loc)
 	// The legacy gas metering only takes into consideration the current state
 	// Legacy rules should be applied if we are in Petersburg (removal of EIP-1283)
 	// OR Constantinople is not active
@@ -125,13 +128,13 @@ func gasSStore(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 		// 2. From a non-zero value address to a zero-value address (DELETE)
 		// 3. From a non-zero to a non-zero                         (CHANGE)
 		switch {
-		case current == (types.Hash{}) && y.Sign() != 0: // 0 => non 0
-			return params.SstoreSetGas, nil
-		case current != (types.Hash{}) && y.Sign() == 0: // non 0 => 0
+		case current == (types.Hash{}) && value != (types.Hash{}): // 0 => non 0
+			return params.SstoreSetGas
+		case current != (types.Hash{}) && value == (types.Hash{}): // non 0 => 0
 			evm.StateDB.AddRefund(params.SstoreRefundGas)
-			return params.SstoreClearGas, nil
+			return params.SstoreClearGas
 		default: // non 0 => non 0 (or 0 => 0)
-			return params.SstoreResetGas, nil
+			return params.SstoreResetGas
 		}
 	}
 	// The new gas metering is based on net gas costs (EIP-1283):
@@ -148,19 +151,18 @@ func gasSStore(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 	// 	  2.2.2. If original value equals new value (this storage slot is reset)
 	//       2.2.2.1. If original value is 0, add 19800 gas to refund counter.
 	// 	     2.2.2.2. Otherwise, add 4800 gas to refund counter.
-	value := util.BigToHash(y)
 	if current == value { // noop (1)
-		return params.NetSstoreNoopGas, nil
+		return params.NetSstoreNoopGas
 	}
-	original := evm.StateDB.GetCommittedHashTypeState(contract.Address(), util.BigToHash(x))
+	original := evm.StateDB.GetCommittedHashTypeState(address, loc)
 	if original == current {
 		if original == (types.Hash{}) { // create slot (2.1.1)
-			return params.NetSstoreInitGas, nil
+			return params.NetSstoreInitGas
 		}
 		if value == (types.Hash{}) { // delete slot (2.1.2b)
 			evm.StateDB.AddRefund(params.NetSstoreClearRefund)
 		}
-		return params.NetSstoreCleanGas, nil // write existing slot (2.1.2)
+		return params.NetSstoreCleanGas // write existing slot (2.1.2)
 	}
 	if original != (types.Hash{}) {
 		if current == (types.Hash{}) { // recreate slot (2.2.1.1)
@@ -176,12 +178,12 @@ func gasSStore(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 			evm.StateDB.AddRefund(params.NetSstoreResetRefund)
 		}
 	}
-	return params.NetSstoreDirtyGas, nil
+	return params.NetSstoreDirtyGas
 }
 
 func makeGasLog(n uint64) gasFunc {
 	return func(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-		requestedSize, overflow := bigUint64(stack.Back(1))
+		requestedSize, overflow := stack.Back(1).Uint64WithOverflow()
 		if overflow {
 			return 0, errGasUintOverflow
 		}
@@ -220,7 +222,7 @@ func gasSha3(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem
 		return 0, errGasUintOverflow
 	}
 
-	wordGas, overflow := bigUint64(stack.Back(1))
+	wordGas, overflow := stack.Back(1).Uint64WithOverflow()
 	if overflow {
 		return 0, errGasUintOverflow
 	}
@@ -244,7 +246,7 @@ func gasCodeCopy(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack,
 		return 0, errGasUintOverflow
 	}
 
-	wordGas, overflow := bigUint64(stack.Back(2))
+	wordGas, overflow := stack.Back(2).Uint64WithOverflow()
 	if overflow {
 		return 0, errGasUintOverflow
 	}
@@ -268,7 +270,7 @@ func gasExtCodeCopy(gt params.GasTable, evm *EVM, contract *Contract, stack *Sta
 		return 0, errGasUintOverflow
 	}
 
-	wordGas, overflow := bigUint64(stack.Back(3))
+	wordGas, overflow := stack.Back(3).Uint64WithOverflow()
 	if overflow {
 		return 0, errGasUintOverflow
 	}
@@ -344,7 +346,7 @@ func gasCreate2(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack,
 	if gas, overflow = math.SafeAdd(gas, params.Create2Gas); overflow {
 		return 0, errGasUintOverflow
 	}
-	wordGas, overflow := bigUint64(stack.Back(2))
+	wordGas, overflow := stack.Back(2).Uint64WithOverflow()
 	if overflow {
 		return 0, errGasUintOverflow
 	}
@@ -387,7 +389,7 @@ func gasCall(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem
 	var (
 		gas            = gt.Calls
 		transfersValue = stack.Back(2).Sign() != 0
-		address        = util.BigToAddress(stack.Back(1))
+		address        = types.Address(stack.Back(1).Bytes20())
 		eip158         = evm.ChainConfig().IsEIP158(evm.BlockNumber)
 	)
 	if eip158 {
@@ -457,7 +459,7 @@ func gasSuicide(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack,
 	if evm.ChainConfig().IsEIP150(evm.BlockNumber) {
 		gas = gt.Suicide
 		var (
-			address = util.BigToAddress(stack.Back(0))
+			address = types.Address(stack.Back(0).Bytes20())
 			eip158  = evm.ChainConfig().IsEIP158(evm.BlockNumber)
 		)
 
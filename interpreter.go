@@ -24,6 +24,7 @@ import (
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/evm-NG/common/math"
 	"github.com/DSiSc/evm-NG/params"
+	"github.com/hashicorp/golang-lru/simplelru"
 )
 
 // Config are the configuration options for the Interpreter
@@ -42,10 +43,30 @@ type Config struct {
 	// table.
 	JumpTable [256]operation
 
-	// Type of the EWASM interpreter
+	// Comma separated names of the registered EWASM interpreters tried in order
+	// once EWASM is activated, the built-in wagon interpreter is used if it is empty
 	EWASMInterpreter string
-	// Type of the EVM interpreter
+	// Comma separated names of the registered interpreters tried in order before
+	// the built-in EVM interpreter
 	EVMInterpreter string
+
+	// EnablePredecode runs the contract code pre-decoded into instructions, the
+	// common sequences are fused and the static gas is paid per basic block.
+	EnablePredecode bool
+
+	// Precompiles adds or overrides the precompiled contracts derived from the
+	// chain rules, they only apply to the EVM created with this configuration.
+	Precompiles []PrecompileOverride
+}
+
+// Validate checks the interpreters selected by the configuration are registered, it
+// is supposed to be called once the configuration is loaded, as the EVM created with
+// an unknown interpreter panics.
+func (c *Config) Validate() error {
+	if err := validateInterpreters(c.EWASMInterpreter); err != nil {
+		return err
+	}
+	return validateInterpreters(c.EVMInterpreter)
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -84,13 +105,13 @@ type EVMInterpreter struct {
 	cfg      Config
 	gasTable params.GasTable
 
-	intPool *intPool
-
 	hasher    keccakState // Keccak256 hasher instance shared across opcodes
 	hasherBuf types.Hash  // Keccak256 hasher result array shared aross opcodes
 
 	readOnly   bool   // Whether to throw on stateful modifications
 	returnData []byte // Last CALL's return data for subsequent reuse
+
+	decoded *simplelru.LRU // pre-decoded code by code hash, the least recently used is evicted
 }
 
 // NewEVMInterpreter returns a new instance of the Interpreter.
@@ -110,14 +131,6 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 // considered a revert-and-consume-all-gas operation except for
 // errExecutionReverted which means revert-and-keep-gas-left.
 func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
-	if in.intPool == nil {
-		in.intPool = poolOfIntPools.get()
-		defer func() {
-			poolOfIntPools.put(in.intPool)
-			in.intPool = nil
-		}()
-	}
-
 	// Increment the call depth which is restricted to 1024
 	in.evm.depth++
 	defer func() { in.evm.depth-- }()
@@ -155,8 +168,14 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	)
 	contract.Input = input
 
-	// Reclaim the stack as an int pool when the execution stops
-	defer func() { in.intPool.put(stack.data...) }()
+	// Run the pre-decoded code until the plain interpreter has to take over. The
+	// tracer needs the gas of every opcode, so it always runs on the plain interpreter.
+	if in.cfg.EnablePredecode && !in.cfg.Debug {
+		var done bool
+		if ret, done, err = in.runDecoded(contract, mem, stack, &pc); done {
+			return ret, err
+		}
+	}
 
 	if in.cfg.Debug {
 		defer func() {
@@ -187,10 +206,8 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			return nil, fmt.Errorf("invalid opcode 0x%x", int(op))
 		}
 		// Validate stack
-		if sLen := stack.len(); sLen < operation.minStack {
-			return nil, fmt.Errorf("stack underflow (%d <=> %d)", sLen, operation.minStack)
-		} else if sLen > operation.maxStack {
-			return nil, fmt.Errorf("stack limit reached %d (%d)", sLen, operation.maxStack)
+		if err := checkStack(stack, &operation); err != nil {
+			return nil, err
 		}
 		// If the operation is valid, enforce and write restrictions
 		if in.readOnly && in.evm.chainRules.IsByzantium {
@@ -244,11 +261,6 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 
 		// execute the operation
 		res, err = operation.execute(&pc, in, contract, mem, stack)
-		// verifyPool is a build flag. Pool verification makes sure the integrity
-		// of the integer pool by comparing values to a default value.
-		if verifyPool {
-			verifyIntegerPool(in.intPool)
-		}
 		// if the operation clears the return data (e.g. it has returning data)
 		// set the last return to the result of the operation.
 		if operation.returns {
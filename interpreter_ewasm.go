@@ -0,0 +1,254 @@
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/validate"
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"sync"
+)
+
+// EWASMInterpreterWagon is the name of the built-in EWASM interpreter, it is
+// also selected if Config.EWASMInterpreter is empty.
+const EWASMInterpreterWagon = "wagon"
+
+// wasmPageSize is the size of a page of the wasm linear memory
+const wasmPageSize = 65536
+
+// wasmModuleCacheSize is the number of the metered contracts kept in wasmModuleCache
+const wasmModuleCacheSize = 1024
+
+// wasmMagic is the preamble of the WebAssembly binary, which is never a valid
+// EVM bytecode prefix to run as it starts with STOP.
+var wasmMagic = []byte("\x00asm")
+
+var (
+	errWasmInvalidImport = errors.New("ewasm: only the functions of the ethereum module can be imported")
+	errWasmInvalidExport = errors.New("ewasm: main function and memory must be exported")
+	errWasmStartFunction = errors.New("ewasm: start function is not allowed")
+	errWasmTooManyLocals = errors.New("ewasm: too many locals")
+)
+
+// wasmModuleCache keeps the validated and metered binaries of the deployed contracts by
+// code hash, so the contracts are only checked and metered once. The metered binary is
+// still read and instantiated on every call, as the imported host functions are resolved
+// to the environment of the call. The cache doesn't change the gas, which is charged the
+// same whether the contract is cached or not.
+var (
+	wasmModuleCacheLock sync.Mutex
+	wasmModuleCache, _  = simplelru.NewLRU(wasmModuleCacheSize, nil)
+)
+
+// EWASMInterpreter runs the WebAssembly contracts on the wagon engine. The
+// contracts import the host functions of the Ethereum Environment Interface
+// from the "ethereum" module, and export the "main" function and the "memory".
+// The gas is metered by the code injected into the contracts before they are
+// executed.
+type EWASMInterpreter struct {
+	evm      *EVM
+	cfg      Config
+	gasTable params.GasTable
+
+	readOnly  bool   // Whether to throw on stateful modifications
+	callDepth uint64 // Depth of the wasm function calls of all the running contracts
+}
+
+// NewEWASMInterpreter returns a new instance of the EWASM interpreter.
+func NewEWASMInterpreter(evm *EVM, cfg Config) *EWASMInterpreter {
+	return &EWASMInterpreter{
+		evm:      evm,
+		cfg:      cfg,
+		gasTable: evm.ChainConfig().GasTable(evm.BlockNumber),
+	}
+}
+
+// Run instantiates the wasm contract and executes its main function, the data
+// passed to finish or revert is returned.
+func (in *EWASMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	// Increment the call depth which is restricted to 1024
+	in.evm.depth++
+	defer func() { in.evm.depth-- }()
+
+	// Make sure the readOnly is only set if we aren't in readOnly yet.
+	// This makes also sure that the readOnly flag isn't removed for child calls.
+	if readOnly && !in.readOnly {
+		in.readOnly = true
+		defer func() { in.readOnly = false }()
+	}
+	contract.Input = input
+
+	env := &ewasmEnv{
+		in:       in,
+		evm:      in.evm,
+		contract: contract,
+		readOnly: in.readOnly,
+	}
+	vm, main, err := in.instantiate(contract.CodeHash, contract.Code, env)
+	if err != nil {
+		return nil, err
+	}
+	env.vm = vm
+
+	// the wasm calls left by the failed execution are dropped
+	defer func(depth uint64) { in.callDepth = depth }(in.callDepth)
+	_, err = vm.ExecCode(int64(main))
+	switch err {
+	case nil, errWasmFinish:
+		return env.output, nil
+	case errExecutionReverted:
+		return env.output, errExecutionReverted
+	case errWasmAborted:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// CanRun tells if the code is a WebAssembly binary.
+func (in *EWASMInterpreter) CanRun(code []byte) bool {
+	return bytes.HasPrefix(code, wasmMagic)
+}
+
+// instantiate validates the contract, injects the metering and creates the wasm vm
+// with the host functions of env. The initial pages of the memory are charged. The
+// metered binary is cached by codeHash, the init code without hash is never cached.
+func (in *EWASMInterpreter) instantiate(codeHash types.Hash, code []byte, env *ewasmEnv) (vm *exec.VM, main uint32, err error) {
+	defer func() {
+		// wagon may panic on the malformed module
+		if r := recover(); r != nil {
+			vm, err = nil, fmt.Errorf("ewasm: invalid module: %v", r)
+		}
+	}()
+	var module *wasm.Module
+	if cached := getMeteredModule(codeHash); cached != nil {
+		if module, err = wasm.ReadModule(bytes.NewReader(cached), env.resolve); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		var metered []byte
+		if metered, err = meterModule(code); err != nil {
+			return nil, 0, err
+		}
+		if module, err = wasm.ReadModule(bytes.NewReader(metered), env.resolve); err != nil {
+			return nil, 0, err
+		}
+		if err = validate.VerifyModule(module); err != nil {
+			return nil, 0, err
+		}
+		if codeHash != (types.Hash{}) {
+			addMeteredModule(codeHash, metered)
+		}
+	}
+
+	main = module.Export.Entries["main"].Index
+	if fn := module.GetFunction(int(main)); fn == nil || fn.IsHost() || len(fn.Sig.ParamTypes) != 0 || len(fn.Sig.ReturnTypes) != 0 {
+		return nil, 0, errWasmInvalidExport
+	}
+	env.pages = uint64(module.Memory.Entries[0].Limits.Initial)
+	if uint64(len(module.LinearMemoryIndexSpace[0])) > env.pages*wasmPageSize {
+		return nil, 0, errWasmMemoryOutOfBounds
+	}
+	if !env.contract.UseGas(env.pages * params.WasmMemoryPageGas) {
+		return nil, 0, ErrOutOfGas
+	}
+
+	vm, err = exec.NewVM(module)
+	if err != nil {
+		return nil, 0, err
+	}
+	vm.RecoverPanic = true
+	return vm, main, nil
+}
+
+// get the metered binary of the contract with codeHash from the cache, nil if it is not cached
+func getMeteredModule(codeHash types.Hash) []byte {
+	wasmModuleCacheLock.Lock()
+	defer wasmModuleCacheLock.Unlock()
+	if cached, ok := wasmModuleCache.Get(codeHash); ok {
+		return cached.([]byte)
+	}
+	return nil
+}
+
+// add the metered binary of the contract with codeHash to the cache
+func addMeteredModule(codeHash types.Hash, metered []byte) {
+	wasmModuleCacheLock.Lock()
+	defer wasmModuleCacheLock.Unlock()
+	wasmModuleCache.Add(codeHash, metered)
+}
+
+// meterModule decodes and checks the contract, and returns the binary with the metering injected
+func meterModule(code []byte) ([]byte, error) {
+	decoded, err := wasm.DecodeModule(bytes.NewReader(code))
+	if err != nil {
+		return nil, err
+	}
+	if err = checkModule(decoded); err != nil {
+		return nil, err
+	}
+	if err = injectMetering(decoded); err != nil {
+		return nil, err
+	}
+	metered := new(bytes.Buffer)
+	if err = wasm.EncodeModule(metered, decoded); err != nil {
+		return nil, err
+	}
+	return metered.Bytes(), nil
+}
+
+// checkModule checks the imports, exports and locals of the decoded contract
+func checkModule(m *wasm.Module) error {
+	if m.Start != nil {
+		return errWasmStartFunction
+	}
+	if m.Import != nil {
+		for _, entry := range m.Import.Entries {
+			if _, ok := entry.Type.(wasm.FuncImport); !ok || entry.ModuleName != ewasmModule {
+				return errWasmInvalidImport
+			}
+		}
+	}
+	if m.Export == nil {
+		return errWasmInvalidExport
+	}
+	if main, ok := m.Export.Entries["main"]; !ok || main.Kind != wasm.ExternalFunction {
+		return errWasmInvalidExport
+	}
+	if memory, ok := m.Export.Entries["memory"]; !ok || memory.Kind != wasm.ExternalMemory {
+		return errWasmInvalidExport
+	}
+	if m.Memory == nil || len(m.Memory.Entries) != 1 {
+		return errWasmInvalidExport
+	}
+	if uint64(m.Memory.Entries[0].Limits.Initial) > params.WasmMaxMemoryPages {
+		return errWasmMemoryLimit
+	}
+	return checkLocals(m)
+}
+
+// checkLocals checks the locals of each function, including the params, are within
+// params.WasmMaxLocals, as they are allocated on every call of the function.
+func checkLocals(m *wasm.Module) error {
+	if m.Code == nil {
+		return nil
+	}
+	for i, body := range m.Code.Bodies {
+		var locals uint64
+		// the mismatched functions are rejected by wagon
+		if m.Function != nil && m.Types != nil && i < len(m.Function.Types) && int(m.Function.Types[i]) < len(m.Types.Entries) {
+			locals = uint64(len(m.Types.Entries[m.Function.Types[i]].ParamTypes))
+		}
+		for _, entry := range body.Locals {
+			locals += uint64(entry.Count)
+		}
+		if locals > params.WasmMaxLocals {
+			return errWasmTooManyLocals
+		}
+	}
+	return nil
+}
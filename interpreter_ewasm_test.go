@@ -0,0 +1,328 @@
+package evm
+
+import (
+	"bytes"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/DSiSc/repository"
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+var wasmContractAddress = util.HexToAddress("0x6d3f1ee5f1ab8ad2d5e0d2a5a4c2c1d8b6f2e7a1")
+
+var (
+	i32 = wasm.ValueTypeI32
+	i64 = wasm.ValueTypeI64
+)
+
+// wasmTestImport is a function imported from the ethereum module
+type wasmTestImport struct {
+	name            string
+	params, results []wasm.ValueType
+}
+
+// wasmTestFunc is a function defined by the test contract
+type wasmTestFunc struct {
+	params, results []wasm.ValueType
+	code            []byte // body without the final end
+}
+
+// newTestWasmModule returns the contract exporting the first function as main and
+// the memory of pages, the data is placed at the offset 0 of the memory.
+func newTestWasmModule(imports []wasmTestImport, funcs []wasmTestFunc, pages uint32, data []byte) *wasm.Module {
+	m := &wasm.Module{
+		Version:  1,
+		Types:    &wasm.SectionTypes{},
+		Import:   &wasm.SectionImports{},
+		Function: &wasm.SectionFunctions{},
+		Memory:   &wasm.SectionMemories{Entries: []wasm.Memory{{Limits: wasm.ResizableLimits{Initial: pages}}}},
+		Export: &wasm.SectionExports{Entries: map[string]wasm.ExportEntry{
+			"main":   {FieldStr: "main", Kind: wasm.ExternalFunction, Index: uint32(len(imports))},
+			"memory": {FieldStr: "memory", Kind: wasm.ExternalMemory, Index: 0},
+		}},
+		Code: &wasm.SectionCode{},
+		Data: &wasm.SectionData{},
+	}
+	addType := func(params, results []wasm.ValueType) uint32 {
+		m.Types.Entries = append(m.Types.Entries, wasm.FunctionSig{Form: int8(wasm.TypeFunc), ParamTypes: params, ReturnTypes: results})
+		return uint32(len(m.Types.Entries) - 1)
+	}
+	for _, imp := range imports {
+		m.Import.Entries = append(m.Import.Entries, wasm.ImportEntry{
+			ModuleName: ewasmModule,
+			FieldName:  imp.name,
+			Type:       wasm.FuncImport{Type: addType(imp.params, imp.results)},
+		})
+	}
+	for _, fn := range funcs {
+		m.Function.Types = append(m.Function.Types, addType(fn.params, fn.results))
+		m.Code.Bodies = append(m.Code.Bodies, wasm.FunctionBody{Code: fn.code})
+	}
+	if len(data) > 0 {
+		m.Data.Entries = append(m.Data.Entries, wasm.DataSegment{Offset: []byte{ops.I32Const, 0, ops.End}, Data: data})
+	}
+	m.Sections = []wasm.Section{m.Types, m.Import, m.Function, m.Memory, m.Export, m.Code, m.Data}
+	return m
+}
+
+func encodeTestWasmModule(m *wasm.Module) []byte {
+	buf := new(bytes.Buffer)
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestWasm returns the binary of the contract running code as main
+func newTestWasm(imports []wasmTestImport, code []byte, data []byte) []byte {
+	return encodeTestWasmModule(newTestWasmModule(imports, []wasmTestFunc{{code: code}}, 1, data))
+}
+
+// wasmCode concatenates the instructions
+func wasmCode(instrs ...[]byte) []byte {
+	return bytes.Join(instrs, nil)
+}
+
+func testI32Const(v int32) []byte {
+	buf := bytes.NewBuffer([]byte{ops.I32Const})
+	leb128.WriteVarint64(buf, int64(v))
+	return buf.Bytes()
+}
+
+func testI64Const(v int64) []byte {
+	buf := bytes.NewBuffer([]byte{ops.I64Const})
+	leb128.WriteVarint64(buf, v)
+	return buf.Bytes()
+}
+
+func testCall(index uint32) []byte {
+	buf := bytes.NewBuffer([]byte{ops.Call})
+	leb128.WriteVarUint32(buf, index)
+	return buf.Bytes()
+}
+
+// mockEWASMEVM returns the evm with the EWASM fork activated
+func mockEWASMEVM(bc *repository.Repository, vmConfig Config) *EVM {
+	chainConfig := *params.TestChainConfig
+	chainConfig.EWASMBlock = big.NewInt(0)
+	tx := types.Transaction{Data: types.TxData{From: &callerAddress, Amount: big.NewInt(0), Price: big.NewInt(1)}}
+	context := NewEVMContext(tx, &types.Header{Height: 1}, bc, types.Address{})
+	return NewEVMWithConfig(context, bc, &chainConfig, vmConfig)
+}
+
+// deploy the wasm contract at wasmContractAddress
+func mockWasmContract(bc *repository.Repository, code []byte) {
+	bc.CreateAccount(wasmContractAddress)
+	bc.SetCode(wasmContractAddress, code)
+}
+
+func TestNewEVMWithConfig_EWASM(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := mockEWASMEVM(bc, Config{})
+	assert.Equal(2, len(evmInst.interpreters))
+	assert.IsType(&EWASMInterpreter{}, evmInst.interpreters[0])
+	assert.IsType(&EVMInterpreter{}, evmInst.interpreters[1])
+
+	evmInst = mockEWASMEVM(bc, Config{EWASMInterpreter: EWASMInterpreterWagon})
+	assert.IsType(&EWASMInterpreter{}, evmInst.interpreters[0])
+
+	// the unregistered interpreter is not replaced by the built-in one
+	assert.NotNil((&Config{EWASMInterpreter: "evmc"}).Validate())
+	assert.Panics(func() { mockEWASMEVM(bc, Config{EWASMInterpreter: "evmc"}) })
+
+	// the EVM bytecode is still run by the EVM interpreter
+	_, _, err := evmInst.Call(AccountRef(callerAddress), contractAddress, input1, 3000, big.NewInt(0))
+	assert.Nil(err)
+
+	assert.Equal(1, len(mockEVM(bc).interpreters))
+}
+
+func TestEWASMInterpreter_CanRun(t *testing.T) {
+	assert := assert.New(t)
+	in := NewEWASMInterpreter(mockEWASMEVM(mockPreBlockChain(), Config{}), Config{})
+	assert.True(in.CanRun(newTestWasm(nil, nil, nil)))
+	assert.True(in.CanRun([]byte("\x00asm")))
+	assert.False(in.CanRun([]byte("\x00as")))
+	assert.False(in.CanRun(code))
+	assert.False(in.CanRun(nil))
+}
+
+func TestEWASMInterpreter_Run(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{
+		{name: "callDataCopy", params: []wasm.ValueType{i32, i32, i32}},
+		{name: "storageStore", params: []wasm.ValueType{i32, i32}},
+		{name: "finish", params: []wasm.ValueType{i32, i32}},
+	}
+	// copy the call data to memory, store it at the zero key and return it
+	main := wasmCode(
+		testI32Const(0), testI32Const(0), testI32Const(32), testCall(0),
+		testI32Const(32), testI32Const(0), testCall(1),
+		testI32Const(0), testI32Const(32), testCall(2),
+	)
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, main, nil))
+
+	input := util.HashToBytes(util.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303132"))
+	ret, leftGas, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, input, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(input, ret)
+	assert.Equal(util.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303132"), bc.GetHashTypeState(wasmContractAddress, types.Hash{}))
+	// instructions, copy, store and the memory page
+	usedGas := 7*params.WasmInstructionGas + 3*params.WasmCallGas + GasFastestStep + params.CopyGas + params.SstoreSetGas + params.WasmMemoryPageGas
+	assert.Equal(100000-usedGas, leftGas)
+}
+
+func TestEWASMInterpreter_Revert(t *testing.T) {
+	assert := assert.New(t)
+	imports := []wasmTestImport{{name: "revert", params: []wasm.ValueType{i32, i32}}}
+	bc := mockPreBlockChain()
+	mockWasmContract(bc, newTestWasm(imports, wasmCode(testI32Const(0), testI32Const(4), testCall(0)), []byte{0xde, 0xad, 0xbe, 0xef}))
+
+	ret, leftGas, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Equal(errExecutionReverted, err)
+	assert.Equal([]byte{0xde, 0xad, 0xbe, 0xef}, ret)
+	assert.Equal(100000-2*params.WasmInstructionGas-params.WasmCallGas-params.WasmMemoryPageGas, leftGas)
+}
+
+func TestEWASMInterpreter_OutOfGas(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	// loop forever
+	mockWasmContract(bc, newTestWasm(nil, []byte{ops.Loop, 0x40, ops.Br, 0, ops.End}, nil))
+
+	_, leftGas, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(uint64(0), leftGas)
+
+	_, _, err = mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, params.WasmMemoryPageGas-1, big.NewInt(0))
+	assert.Equal(ErrOutOfGas, err)
+}
+
+func TestEWASMInterpreter_Memory(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	grow := func(pages int32) []byte {
+		return wasmCode(testI32Const(pages), []byte{ops.GrowMemory, 0, ops.Drop})
+	}
+	mockWasmContract(bc, newTestWasm(nil, grow(2), nil))
+	_, leftGas, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(100000-3*params.WasmInstructionGas-3*params.WasmMemoryPageGas, leftGas)
+
+	mockWasmContract(bc, newTestWasm(nil, grow(int32(params.WasmMaxMemoryPages)), nil))
+	_, _, err = mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000000, big.NewInt(0))
+	assert.Equal(errWasmMemoryLimit, err)
+
+	mockWasmContract(bc, newTestWasm(nil, grow(-1), nil))
+	_, _, err = mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000000, big.NewInt(0))
+	assert.Equal(errWasmMemoryLimit, err)
+
+	// the host function can't access the memory out of bounds
+	imports := []wasmTestImport{{name: "finish", params: []wasm.ValueType{i32, i32}}}
+	mockWasmContract(bc, newTestWasm(imports, wasmCode(testI32Const(wasmPageSize-1), testI32Const(2), testCall(0)), nil))
+	_, _, err = mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+	assert.Equal(errWasmMemoryOutOfBounds, err)
+}
+
+func TestEWASMInterpreter_CallDepth(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	funcs := []wasmTestFunc{
+		{code: testCall(1)},
+		{code: testCall(1)}, // recurse forever
+	}
+	mockWasmContract(bc, encodeTestWasmModule(newTestWasmModule(nil, funcs, 1, nil)))
+
+	evmInst := mockEWASMEVM(bc, Config{})
+	_, _, err := evmInst.Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000000, big.NewInt(0))
+	assert.Equal(errWasmCallDepth, err)
+	assert.Equal(uint64(0), evmInst.interpreters[0].(*EWASMInterpreter).callDepth)
+}
+
+func TestEWASMInterpreter_InvalidModule(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	run := func(code []byte) error {
+		mockWasmContract(bc, code)
+		_, _, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+		return err
+	}
+
+	assert.NotNil(run([]byte("\x00asm\x01\x00\x00\x00\xff")))
+
+	// floating point
+	assert.Equal(errWasmFloatingPoint, run(newTestWasm(nil, []byte{ops.F32Const, 0, 0, 0, 0, ops.Drop}, nil)))
+
+	// main is not exported
+	m := newTestWasmModule(nil, []wasmTestFunc{{}}, 1, nil)
+	delete(m.Export.Entries, "main")
+	assert.Equal(errWasmInvalidExport, run(encodeTestWasmModule(m)))
+
+	// main takes params
+	assert.Equal(errWasmInvalidExport, run(encodeTestWasmModule(newTestWasmModule(nil, []wasmTestFunc{{params: []wasm.ValueType{i32}}}, 1, nil))))
+
+	// imported from other modules
+	m = newTestWasmModule([]wasmTestImport{{name: "finish", params: []wasm.ValueType{i32, i32}}}, []wasmTestFunc{{}}, 1, nil)
+	m.Import.Entries[0].ModuleName = meteringModule
+	assert.Equal(errWasmInvalidImport, run(encodeTestWasmModule(m)))
+
+	// unknown EEI function
+	assert.NotNil(run(newTestWasm([]wasmTestImport{{name: "unknown"}}, nil, nil)))
+
+	// too many pages
+	assert.Equal(errWasmMemoryLimit, run(encodeTestWasmModule(newTestWasmModule(nil, []wasmTestFunc{{}}, uint32(params.WasmMaxMemoryPages)+1, nil))))
+
+	// operands missing
+	assert.NotNil(run(newTestWasm(nil, []byte{ops.I32Add, ops.Drop}, nil)))
+
+	// too many locals
+	m = newTestWasmModule(nil, []wasmTestFunc{{}, {params: []wasm.ValueType{i64}}}, 1, nil)
+	m.Code.Bodies[1].Locals = []wasm.LocalEntry{{Count: uint32(params.WasmMaxLocals) - 1, Type: i32}}
+	assert.Nil(run(encodeTestWasmModule(m)))
+	m.Code.Bodies[1].Locals[0].Count++
+	assert.Equal(errWasmTooManyLocals, run(encodeTestWasmModule(m)))
+}
+
+func TestEWASMInterpreter_ModuleCache(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	imports := []wasmTestImport{{name: "finish", params: []wasm.ValueType{i32, i32}}}
+	// a data segment makes the code unique to the test
+	mockWasmContract(bc, newTestWasm(imports, wasmCode(testI32Const(0), testI32Const(4), testCall(0)), []byte("ache")))
+	codeHash := bc.GetCodeHash(wasmContractAddress)
+	assert.Nil(getMeteredModule(codeHash))
+
+	// the cached contract runs the same and is charged the same
+	for i := 0; i < 2; i++ {
+		ret, leftGas, err := mockEWASMEVM(bc, Config{}).Call(AccountRef(callerAddress), wasmContractAddress, nil, 100000, big.NewInt(0))
+		assert.Nil(err)
+		assert.Equal([]byte("ache"), ret)
+		assert.Equal(100000-2*params.WasmInstructionGas-params.WasmCallGas-params.WasmMemoryPageGas, leftGas)
+		assert.NotNil(getMeteredModule(codeHash))
+	}
+}
+
+func TestEWASMInterpreter_Create(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	runtime := newTestWasm(nil, nil, nil)
+	imports := []wasmTestImport{{name: "finish", params: []wasm.ValueType{i32, i32}}}
+	// the init code returns the runtime code placed in its memory
+	initCode := newTestWasm(imports, wasmCode(testI32Const(0), testI32Const(int32(len(runtime))), testCall(0)), runtime)
+
+	ret, addr, leftGas, err := mockEWASMEVM(bc, Config{}).Create(AccountRef(callerAddress), initCode, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(runtime, ret)
+	assert.Equal(runtime, bc.GetCode(addr))
+	// the deployed wasm code is charged per byte on top of the code deposit
+	depositGas := uint64(len(runtime)) * (params.CreateDataGas + params.WasmCodeByteGas)
+	assert.Equal(100000-2*params.WasmInstructionGas-params.WasmCallGas-params.WasmMemoryPageGas-depositGas, leftGas)
+}
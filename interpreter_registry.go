@@ -0,0 +1,74 @@
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// InterpreterFactory creates the interpreter running the contracts of the evm
+type InterpreterFactory func(evm *EVM, cfg Config) Interpreter
+
+var (
+	ErrInterpreterRegistered = errors.New("interpreter already registered")
+	ErrUnknownInterpreter    = errors.New("unknown interpreter")
+)
+
+var (
+	interpretersLock     sync.RWMutex
+	interpreterFactories = map[string]InterpreterFactory{
+		EWASMInterpreterWagon: func(evm *EVM, cfg Config) Interpreter { return NewEWASMInterpreter(evm, cfg) },
+	}
+)
+
+// RegisterInterpreter registers the interpreter factory with name, the interpreters
+// are selected by the names in Config.EWASMInterpreter and Config.EVMInterpreter.
+func RegisterInterpreter(name string, factory InterpreterFactory) error {
+	interpretersLock.Lock()
+	defer interpretersLock.Unlock()
+	if interpreterFactories[name] != nil {
+		return fmt.Errorf("%v: %s", ErrInterpreterRegistered, name)
+	}
+	interpreterFactories[name] = factory
+	return nil
+}
+
+// get the interpreter factory registered with name
+func getInterpreterFactory(name string) InterpreterFactory {
+	interpretersLock.RLock()
+	defer interpretersLock.RUnlock()
+	return interpreterFactories[name]
+}
+
+// validateInterpreters checks all the comma separated names are registered
+func validateInterpreters(names string) error {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) != 0 && getInterpreterFactory(name) == nil {
+			return fmt.Errorf("%v: %s", ErrUnknownInterpreter, name)
+		}
+	}
+	return nil
+}
+
+// newInterpreters creates the interpreters selected by the comma separated names in
+// order. The names already in selected are ignored, so an interpreter is created once
+// even if it is listed more than once. The names are supposed to be checked by
+// Config.Validate, a name not registered panics instead of running another interpreter.
+func newInterpreters(evm *EVM, cfg Config, names string, selected map[string]bool) []Interpreter {
+	interpreters := make([]Interpreter, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 || selected[name] {
+			continue
+		}
+		factory := getInterpreterFactory(name)
+		if factory == nil {
+			panic(fmt.Errorf("%v: %s", ErrUnknownInterpreter, name))
+		}
+		selected[name] = true
+		interpreters = append(interpreters, factory(evm, cfg))
+	}
+	return interpreters
+}
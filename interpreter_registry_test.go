@@ -0,0 +1,124 @@
+package evm
+
+import (
+	"bytes"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+// mockInterpreter runs the code starting with its prefix and returns its name
+type mockInterpreter struct {
+	name   string
+	prefix []byte
+}
+
+func (in *mockInterpreter) Run(contract *Contract, input []byte, static bool) ([]byte, error) {
+	return []byte(in.name), nil
+}
+
+func (in *mockInterpreter) CanRun(code []byte) bool {
+	return bytes.HasPrefix(code, in.prefix)
+}
+
+// register the mock interpreter, it is removed by the returned function
+func registerMockInterpreter(name string, prefix []byte) func() {
+	err := RegisterInterpreter(name, func(evm *EVM, cfg Config) Interpreter {
+		return &mockInterpreter{name: name, prefix: prefix}
+	})
+	if err != nil {
+		panic(err)
+	}
+	return func() {
+		interpretersLock.Lock()
+		defer interpretersLock.Unlock()
+		delete(interpreterFactories, name)
+	}
+}
+
+func TestRegisterInterpreter(t *testing.T) {
+	assert := assert.New(t)
+	defer registerMockInterpreter("mock", []byte{0xef})()
+
+	err := RegisterInterpreter("mock", func(evm *EVM, cfg Config) Interpreter { return nil })
+	assert.NotNil(err)
+	assert.Contains(err.Error(), ErrInterpreterRegistered.Error())
+	assert.NotNil(RegisterInterpreter(EWASMInterpreterWagon, func(evm *EVM, cfg Config) Interpreter { return nil }))
+	assert.NotNil(getInterpreterFactory("mock"))
+	assert.Nil(getInterpreterFactory("unknown"))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert := assert.New(t)
+	defer registerMockInterpreter("mock", []byte{0xef})()
+
+	assert.Nil((&Config{}).Validate())
+	assert.Nil((&Config{EWASMInterpreter: "mock, " + EWASMInterpreterWagon, EVMInterpreter: "mock,"}).Validate())
+
+	err := (&Config{EWASMInterpreter: "mock,unknown"}).Validate()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), ErrUnknownInterpreter.Error())
+	assert.Contains(err.Error(), "unknown")
+
+	err = (&Config{EVMInterpreter: "unknown"}).Validate()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), ErrUnknownInterpreter.Error())
+}
+
+func TestNewEVMWithConfig_Interpreters(t *testing.T) {
+	assert := assert.New(t)
+	defer registerMockInterpreter("mock1", []byte{0xef})()
+	defer registerMockInterpreter("mock2", []byte{0xef, 0x01})()
+	bc := mockPreBlockChain()
+
+	// the built-in EVM interpreter is always the last one
+	evmInst := NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EVMInterpreter: "mock2, mock1,mock2"})
+	assert.Equal(3, len(evmInst.interpreters))
+	assert.Equal("mock2", evmInst.interpreters[0].(*mockInterpreter).name)
+	assert.Equal("mock1", evmInst.interpreters[1].(*mockInterpreter).name)
+	assert.IsType(&EVMInterpreter{}, evmInst.interpreters[2])
+	assert.Equal(evmInst.interpreters[0], evmInst.Interpreter())
+
+	// the EWASM interpreters precede the EVM interpreters
+	evmInst = mockEWASMEVM(bc, Config{EWASMInterpreter: "mock1," + EWASMInterpreterWagon, EVMInterpreter: "mock2"})
+	assert.Equal(4, len(evmInst.interpreters))
+	assert.Equal("mock1", evmInst.interpreters[0].(*mockInterpreter).name)
+	assert.IsType(&EWASMInterpreter{}, evmInst.interpreters[1])
+	assert.Equal("mock2", evmInst.interpreters[2].(*mockInterpreter).name)
+	assert.IsType(&EVMInterpreter{}, evmInst.interpreters[3])
+
+	// the EWASM interpreters are not used before EWASM is activated
+	evmInst = NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EWASMInterpreter: "mock1"})
+	assert.Equal(1, len(evmInst.interpreters))
+
+	// the unknown names are not silently replaced by another interpreter
+	assert.Panics(func() {
+		NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EVMInterpreter: "unknown,mock1"})
+	})
+
+	// the interpreter in both lists is created once
+	evmInst = mockEWASMEVM(bc, Config{EWASMInterpreter: "mock1", EVMInterpreter: "mock1,mock2"})
+	assert.Equal(3, len(evmInst.interpreters))
+	assert.Equal("mock1", evmInst.interpreters[0].(*mockInterpreter).name)
+	assert.Equal("mock2", evmInst.interpreters[1].(*mockInterpreter).name)
+	assert.IsType(&EVMInterpreter{}, evmInst.interpreters[2])
+}
+
+func TestEVM_RunRegisteredInterpreter(t *testing.T) {
+	assert := assert.New(t)
+	defer registerMockInterpreter("mock", []byte{0xef})()
+	bc := mockPreBlockChain()
+	address := util.HexToAddress("0x2f3e4d5c6b7a8910a1b2c3d4e5f60718293a4b5c")
+	bc.CreateAccount(address)
+	bc.SetCode(address, []byte{0xef, 0x00})
+
+	evmInst := NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EVMInterpreter: "mock"})
+	ret, _, err := evmInst.Call(AccountRef(callerAddress), address, nil, 3000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]byte("mock"), ret)
+
+	// the other code falls through to the built-in EVM interpreter
+	_, _, err = evmInst.Call(AccountRef(callerAddress), contractAddress, input1, 3000, big.NewInt(0))
+	assert.Nil(err)
+}
@@ -22,7 +22,6 @@ import (
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/evm-NG/common/hexutil"
 	"github.com/DSiSc/evm-NG/common/math"
-	"github.com/DSiSc/evm-NG/util"
 	"io"
 	"math/big"
 	"time"
@@ -152,8 +151,8 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 	// it in the local storage container.
 	if op == SSTORE && stack.len() >= 2 {
 		var (
-			value   = util.BigToHash(stack.data[stack.len()-2])
-			address = util.BigToHash(stack.data[stack.len()-1])
+			value   = types.Hash(stack.data[stack.len()-2].Bytes32())
+			address = types.Hash(stack.data[stack.len()-1].Bytes32())
 		)
 		l.changedValues[contract.Address()][address] = value
 	}
@@ -168,7 +167,7 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 	if !l.cfg.DisableStack {
 		stck = make([]*big.Int, len(stack.Data()))
 		for i, item := range stack.Data() {
-			stck[i] = new(big.Int).Set(item)
+			stck[i] = item.ToBig()
 		}
 	}
 	// Copy a snapshot of the current storage to a new container
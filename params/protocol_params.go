@@ -71,22 +71,79 @@ const (
 
 	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract
 
+	// WebAssembly (EWASM) execution prices and limits
+
+	WasmInstructionGas uint64 = 1    // Once per executed WebAssembly instruction.
+	WasmCallGas        uint64 = 10   // Once per WebAssembly call and call_indirect instruction.
+	WasmMemoryPageGas  uint64 = 6144 // Per 64KiB page of the linear memory, the price of 2048 EVM memory words.
+	WasmMaxMemoryPages uint64 = 256  // Maximum pages of the linear memory of a contract (16MiB).
+	WasmCallDepth      uint64 = 8192 // Maximum depth of the WebAssembly function calls of an EVM.
+	WasmMaxLocals      uint64 = 1024 // Maximum locals of a WebAssembly function, including the params.
+	WasmCodeByteGas    uint64 = 50   // Per byte of the deployed WebAssembly code, paying for the validation and the metering.
+
+	SysContractCallGas uint64 = 700  // Once per system contract call, the contracts charge their own costs on top of it.
+	SysBufferChunkGas  uint64 = 2500 // Per chunk of 256 bytes written to the system buffer, the buffers only live in the transaction.
+	SysBufferOpenGas   uint64 = 5000 // Per system buffer handle opened.
+	SysBufferByteGas   uint64 = 3    // Per byte written to the system buffer, on top of the chunk price.
+	SysObjectByteGas   uint64 = 16   // Per byte of the object got from or put to the storage backend.
+
+	SysObjectMaxSize uint64 = 4 * 1024 * 1024 // Maximum size of the object got from or put to the storage backend.
+
 	// Precompiled contract gas prices
 
-	EcrecoverGas            uint64 = 3000   // Elliptic curve sender recovery gas price
-	Sha256BaseGas           uint64 = 60     // Base price for a SHA256 operation
-	Sha256PerWordGas        uint64 = 12     // Per-word price for a SHA256 operation
-	Ripemd160BaseGas        uint64 = 600    // Base price for a RIPEMD160 operation
-	Ripemd160PerWordGas     uint64 = 120    // Per-word price for a RIPEMD160 operation
-	IdentityBaseGas         uint64 = 15     // Base price for a data copy operation
-	IdentityPerWordGas      uint64 = 3      // Per-work price for a data copy operation
-	ModExpQuadCoeffDiv      uint64 = 20     // Divisor for the quadratic particle of the big int modular exponentiation
-	Bn256AddGas             uint64 = 500    // Gas needed for an elliptic curve addition
-	Bn256ScalarMulGas       uint64 = 40000  // Gas needed for an elliptic curve scalar multiplication
-	Bn256PairingBaseGas     uint64 = 100000 // Base price for an elliptic curve pairing check
-	Bn256PairingPerPointGas uint64 = 80000  // Per-point price for an elliptic curve pairing check
+	EcrecoverGas                     uint64 = 3000   // Elliptic curve sender recovery gas price
+	Sha256BaseGas                    uint64 = 60     // Base price for a SHA256 operation
+	Sha256PerWordGas                 uint64 = 12     // Per-word price for a SHA256 operation
+	Ripemd160BaseGas                 uint64 = 600    // Base price for a RIPEMD160 operation
+	Ripemd160PerWordGas              uint64 = 120    // Per-word price for a RIPEMD160 operation
+	IdentityBaseGas                  uint64 = 15     // Base price for a data copy operation
+	IdentityPerWordGas               uint64 = 3      // Per-work price for a data copy operation
+	ModExpQuadCoeffDiv               uint64 = 20     // Divisor for the quadratic particle of the big int modular exponentiation
+	Bn256AddGasByzantium             uint64 = 500    // Byzantium gas needed for an elliptic curve addition
+	Bn256AddGasIstanbul              uint64 = 150    // Gas needed for an elliptic curve addition
+	Bn256ScalarMulGasByzantium       uint64 = 40000  // Byzantium gas needed for an elliptic curve scalar multiplication
+	Bn256ScalarMulGasIstanbul        uint64 = 6000   // Gas needed for an elliptic curve scalar multiplication
+	Bn256PairingBaseGasByzantium     uint64 = 100000 // Byzantium base price for an elliptic curve pairing check
+	Bn256PairingBaseGasIstanbul      uint64 = 45000  // Base price for an elliptic curve pairing check
+	Bn256PairingPerPointGasByzantium uint64 = 80000  // Byzantium per-point price for an elliptic curve pairing check
+	Bn256PairingPerPointGasIstanbul  uint64 = 34000  // Per-point price for an elliptic curve pairing check
+	Blake2FRoundGas                  uint64 = 1      // Per-round price for a BLAKE2b F compression
+
+	Sm3BaseGas    uint64 = 60     // Base price for a SM3 operation
+	Sm3PerWordGas uint64 = 12     // Per-word price for a SM3 operation
+	Sm2VerifyGas  uint64 = 150000 // Price for a SM2 signature verification
+	Sm2RecoverGas uint64 = 170000 // Price for a SM2 public key recovery
+
+	P256VerifyGas uint64 = 6900 // Price for a secp256r1 signature verification (EIP-7951)
+
+	Bls12381G1AddGas          uint64 = 375   // Price for BLS12-381 elliptic curve G1 point addition
+	Bls12381G1MulGas          uint64 = 12000 // Price for BLS12-381 elliptic curve G1 point scalar multiplication
+	Bls12381G2AddGas          uint64 = 600   // Price for BLS12-381 elliptic curve G2 point addition
+	Bls12381G2MulGas          uint64 = 22500 // Price for BLS12-381 elliptic curve G2 point scalar multiplication
+	Bls12381PairingBaseGas    uint64 = 37700 // Base gas price for BLS12-381 elliptic curve pairing check
+	Bls12381PairingPerPairGas uint64 = 32600 // Per-point pair gas price for BLS12-381 elliptic curve pairing check
+	Bls12381MapG1Gas          uint64 = 5500  // Gas price for BLS12-381 mapping field element to G1 operation
+	Bls12381MapG2Gas          uint64 = 23800 // Gas price for BLS12-381 mapping field element to G2 operation
+)
+
+// The bn256 prices before the EIP-1108 repricing, kept for the callers of the old names.
+const (
+	// Deprecated: use Bn256AddGasByzantium instead.
+	Bn256AddGas = Bn256AddGasByzantium
+	// Deprecated: use Bn256ScalarMulGasByzantium instead.
+	Bn256ScalarMulGas = Bn256ScalarMulGasByzantium
+	// Deprecated: use Bn256PairingBaseGasByzantium instead.
+	Bn256PairingBaseGas = Bn256PairingBaseGasByzantium
+	// Deprecated: use Bn256PairingPerPointGasByzantium instead.
+	Bn256PairingPerPointGas = Bn256PairingPerPointGasByzantium
 )
 
+// Bls12381G1MultiExpDiscountTable is the gas discount table for BLS12-381 G1 multi exponentiation operation
+var Bls12381G1MultiExpDiscountTable = [128]uint64{1000, 949, 848, 797, 764, 750, 738, 728, 719, 712, 705, 698, 692, 687, 682, 677, 673, 669, 665, 661, 658, 654, 651, 648, 645, 642, 640, 637, 635, 632, 630, 627, 625, 623, 621, 619, 617, 615, 613, 611, 609, 608, 606, 604, 603, 601, 599, 598, 596, 595, 593, 592, 591, 589, 588, 586, 585, 584, 582, 581, 580, 579, 577, 576, 575, 574, 573, 572, 570, 569, 568, 567, 566, 565, 564, 563, 562, 561, 560, 559, 558, 557, 556, 555, 554, 553, 552, 551, 550, 549, 548, 547, 547, 546, 545, 544, 543, 542, 541, 540, 540, 539, 538, 537, 536, 536, 535, 534, 533, 532, 532, 531, 530, 529, 528, 528, 527, 526, 525, 525, 524, 523, 522, 522, 521, 520, 520, 519}
+
+// Bls12381G2MultiExpDiscountTable is the gas discount table for BLS12-381 G2 multi exponentiation operation
+var Bls12381G2MultiExpDiscountTable = [128]uint64{1000, 1000, 923, 884, 855, 832, 812, 796, 782, 770, 759, 749, 740, 732, 724, 717, 711, 704, 699, 693, 688, 683, 679, 674, 670, 666, 663, 659, 655, 652, 649, 646, 643, 640, 637, 634, 632, 629, 627, 624, 622, 620, 618, 615, 613, 611, 609, 607, 606, 604, 602, 600, 598, 597, 595, 593, 592, 590, 589, 587, 586, 584, 583, 582, 580, 579, 578, 576, 575, 574, 573, 571, 570, 569, 568, 567, 566, 565, 563, 562, 561, 560, 559, 558, 557, 556, 555, 554, 553, 552, 552, 551, 550, 549, 548, 547, 546, 545, 545, 544, 543, 542, 541, 541, 540, 539, 538, 537, 537, 536, 535, 535, 534, 533, 532, 532, 531, 530, 530, 529, 528, 528, 527, 526, 526, 525, 524, 524}
+
 var (
 	DifficultyBoundDivisor = big.NewInt(2048)   // The bound divisor of the difficulty, used in the update calculations.
 	GenesisDifficulty      = big.NewInt(131072) // Difficulty of the Genesis block.
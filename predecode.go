@@ -0,0 +1,291 @@
+package evm
+
+import (
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/holiman/uint256"
+	"sync/atomic"
+)
+
+// decodedCodeCacheSize is the number of the pre-decoded contracts kept by an interpreter
+const decodedCodeCacheSize = 128
+
+// decodedKind tells how the decoded instruction is executed
+type decodedKind byte
+
+const (
+	decodedOpcode    decodedKind = iota // executed by the jump table
+	decodedPush                         // PUSH with the decoded immediate
+	decodedPushJump                     // fused PUSH and JUMP
+	decodedPushJumpi                    // fused PUSH and JUMPI
+	decodedStackPair                    // fused pair of DUP and SWAP
+)
+
+// decodedOp is an instruction of the pre-decoded code
+type decodedOp struct {
+	kind decodedKind
+	op   OpCode // the opcode, the first one of the fused instructions
+	next OpCode // the second opcode of the fused instructions
+	pc   uint64 // position of the instruction in the code
+	gas  uint64 // static gas of the instruction
+
+	arg    uint256.Int // immediate of PUSH
+	target int32       // index of the JUMPDEST the fused jump goes to, -1 if it's invalid
+
+	blockStart bool   // whether the instruction starts a basic block
+	blockGas   uint64 // static gas of the basic block it starts
+}
+
+// decodedCode is the contract code converted into the stream of instructions
+type decodedCode struct {
+	ops   []decodedOp
+	index []int32 // index of the instruction at each position of the code
+}
+
+// decodeCode converts the code into the stream of instructions. The common
+// sequences are fused into one instruction, and the static gas of a basic
+// block is paid at once on entering it.
+func decodeCode(code []byte, jumpTable *[256]operation) *decodedCode {
+	c := &decodedCode{
+		ops:   make([]decodedOp, 0, len(code)+1),
+		index: make([]int32, len(code)+1),
+	}
+	codeLen := uint64(len(code))
+	for pc := uint64(0); pc < codeLen; {
+		d := decodedOp{op: OpCode(code[pc]), pc: pc, target: -1}
+		size := uint64(1)
+		switch {
+		case d.op.IsPush():
+			n := uint64(d.op-PUSH1) + 1
+			d.kind = decodedPush
+			d.arg.SetBytes(getData(code, pc+1, n))
+			size += n
+			if next := pc + size; next < codeLen && canFuse(jumpTable, OpCode(code[next]), JUMP, JUMPI) {
+				d.next = OpCode(code[next])
+				if d.kind = decodedPushJump; d.next == JUMPI {
+					d.kind = decodedPushJumpi
+				}
+				size++
+			}
+		case isStackOp(d.op) && pc+1 < codeLen && isStackOp(OpCode(code[pc+1])) && jumpTable[code[pc+1]].valid:
+			d.kind = decodedStackPair
+			d.next = OpCode(code[pc+1])
+			size++
+		}
+		d.gas = jumpTable[d.op].constantGas
+		if d.kind != decodedOpcode && d.kind != decodedPush {
+			d.gas += jumpTable[d.next].constantGas
+		}
+		c.index[pc] = int32(len(c.ops))
+		c.ops = append(c.ops, d)
+		pc += size
+	}
+	// the execution stops once it runs past the end of the code
+	c.index[codeLen] = int32(len(c.ops))
+	c.ops = append(c.ops, decodedOp{op: STOP, pc: codeLen, target: -1})
+
+	dests := codeBitmap(code)
+	block := 0
+	for i := range c.ops {
+		d := &c.ops[i]
+		if i == 0 || d.op == JUMPDEST || endsBlock(jumpTable, &c.ops[i-1]) {
+			d.blockStart = true
+			block = i
+		}
+		c.ops[block].blockGas += d.gas
+
+		if d.kind == decodedPushJump || d.kind == decodedPushJumpi {
+			if dest, overflow := d.arg.Uint64WithOverflow(); !overflow && dest < codeLen &&
+				OpCode(code[dest]) == JUMPDEST && dests.codeSegment(dest) {
+				d.target = c.index[dest]
+			}
+		}
+	}
+	return c
+}
+
+// canFuse checks if the opcode is one of the fusible opcodes and valid in the jump table
+func canFuse(jumpTable *[256]operation, op OpCode, fusible ...OpCode) bool {
+	for _, f := range fusible {
+		if op == f {
+			return jumpTable[op].valid
+		}
+	}
+	return false
+}
+
+// isStackOp checks if the opcode is DUP or SWAP
+func isStackOp(op OpCode) bool {
+	return op >= DUP1 && op <= SWAP16
+}
+
+// endsBlock checks if the basic block ends with the instruction. Besides the jumps
+// and halts, the instructions observing the gas left end the block, so that they
+// see the gas as if the static gas was paid per instruction.
+func endsBlock(jumpTable *[256]operation, d *decodedOp) bool {
+	op := d.op
+	if d.kind != decodedOpcode && d.kind != decodedPush {
+		op = d.next
+	}
+	switch op {
+	case GAS, CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2:
+		return true
+	}
+	operation := &jumpTable[op]
+	return operation.jumps || operation.halts || operation.reverts
+}
+
+// decodedCode returns the pre-decoded code of the contract, it is cached by the code hash.
+func (in *EVMInterpreter) decodedCode(contract *Contract) *decodedCode {
+	// initcode without code hash isn't cached
+	if contract.CodeHash == (types.Hash{}) {
+		return decodeCode(contract.Code, &in.cfg.JumpTable)
+	}
+	if in.decoded == nil {
+		in.decoded, _ = simplelru.NewLRU(decodedCodeCacheSize, nil)
+	}
+	if cached, ok := in.decoded.Get(contract.CodeHash); ok {
+		return cached.(*decodedCode)
+	}
+	code := decodeCode(contract.Code, &in.cfg.JumpTable)
+	in.decoded.Add(contract.CodeHash, code)
+	return code
+}
+
+// runDecoded runs the pre-decoded code of the contract with the same semantic and gas
+// as the plain interpreter. It returns done false with pc of the instruction the plain
+// interpreter continues from if a basic block can't pay its static gas in advance,
+// the instructions in the block are then charged one by one to fail the same way.
+func (in *EVMInterpreter) runDecoded(contract *Contract, mem *Memory, stack *Stack, pc *uint64) (ret []byte, done bool, err error) {
+	var (
+		code    = in.decodedCode(contract)
+		i       = int32(0)
+		prepaid uint64 // static gas of the rest of the block paid in advance
+	)
+	for atomic.LoadInt32(&in.evm.abort) == 0 {
+		d := &code.ops[i]
+		if d.blockStart {
+			if !contract.UseGas(d.blockGas) {
+				*pc = d.pc
+				return nil, false, nil
+			}
+			prepaid = d.blockGas
+		}
+		prepaid -= d.gas
+
+		switch d.kind {
+		case decodedPush:
+			if err = checkStack(stack, &in.cfg.JumpTable[d.op]); err != nil {
+				return nil, true, err
+			}
+			stack.push(&d.arg)
+			i++
+			continue
+		case decodedPushJump:
+			if err = checkStack(stack, &in.cfg.JumpTable[d.op]); err != nil {
+				return nil, true, err
+			}
+			if d.target < 0 {
+				return nil, true, errInvalidJump
+			}
+			i = d.target
+			continue
+		case decodedPushJumpi:
+			if err = checkStack(stack, &in.cfg.JumpTable[d.op]); err != nil {
+				return nil, true, err
+			}
+			stack.push(&d.arg)
+			if err = checkStack(stack, &in.cfg.JumpTable[d.next]); err != nil {
+				return nil, true, err
+			}
+			stack.pop()
+			if cond := stack.pop(); cond.IsZero() {
+				i++
+			} else if d.target < 0 {
+				return nil, true, errInvalidJump
+			} else {
+				i = d.target
+			}
+			continue
+		case decodedStackPair:
+			for _, op := range [2]OpCode{d.op, d.next} {
+				if err = checkStack(stack, &in.cfg.JumpTable[op]); err != nil {
+					return nil, true, err
+				}
+				if op >= SWAP1 {
+					stack.swap(int(op-SWAP1) + 2)
+				} else {
+					stack.dup(int(op-DUP1) + 1)
+				}
+			}
+			i++
+			continue
+		}
+
+		operation := &in.cfg.JumpTable[d.op]
+		if !operation.valid {
+			return nil, true, fmt.Errorf("invalid opcode 0x%x", int(d.op))
+		}
+		if err = checkStack(stack, operation); err != nil {
+			return nil, true, err
+		}
+		if in.readOnly && in.evm.chainRules.IsByzantium {
+			if operation.writes || (d.op == CALL && stack.Back(2).Sign() != 0) {
+				return nil, true, errWriteProtection
+			}
+		}
+		var memorySize uint64
+		if operation.memorySize != nil {
+			memSize, overflow := operation.memorySize(stack)
+			if overflow {
+				return nil, true, errGasUintOverflow
+			}
+			if memorySize, overflow = math.SafeMul(toWordSize(memSize), 32); overflow {
+				return nil, true, errGasUintOverflow
+			}
+		}
+		// the dynamic gas is calculated with the gas left as if the rest of the block
+		// wasn't paid, the plain interpreter takes over if it can't be paid again.
+		handover := false
+		if operation.dynamicGas != nil {
+			contract.Gas += prepaid
+			cost, err := operation.dynamicGas(in.gasTable, in.evm, contract, stack, mem, memorySize)
+			if err != nil || !contract.UseGas(cost) {
+				return nil, true, ErrOutOfGas
+			}
+			if !contract.UseGas(prepaid) {
+				handover = true
+			}
+		}
+		if memorySize > 0 {
+			mem.Resize(memorySize)
+		}
+
+		*pc = d.pc
+		res, err := operation.execute(pc, in, contract, mem, stack)
+		if operation.returns {
+			in.returnData = res
+		}
+		switch {
+		case err != nil:
+			return nil, true, err
+		case operation.reverts:
+			return res, true, errExecutionReverted
+		case operation.halts:
+			return res, true, nil
+		case !operation.jumps:
+			*pc++
+		}
+		if handover {
+			return nil, false, nil
+		}
+		if operation.jumps {
+			i = code.index[*pc]
+		} else {
+			i++
+		}
+	}
+	return nil, true, nil
+}
@@ -0,0 +1,221 @@
+package evm
+
+import (
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var predecodeAddress = util.HexToAddress("0x6d2b3c4e5f60718293a4b5c6d7e8f90a1b2c3d4e")
+
+// asm assembles the opcodes and immediates into code
+func asm(items ...interface{}) []byte {
+	code := make([]byte, 0)
+	for _, item := range items {
+		switch v := item.(type) {
+		case OpCode:
+			code = append(code, byte(v))
+		case int:
+			code = append(code, byte(v))
+		case []byte:
+			code = append(code, v...)
+		default:
+			panic(fmt.Sprintf("unsupported item %v", item))
+		}
+	}
+	return code
+}
+
+var predecodePrograms = map[string][]byte{
+	// count down from 10, accumulate the counter in slot 0 and store the gas left in slot 1
+	"loop": asm(
+		PUSH1, 0x0a,
+		JUMPDEST, DUP1, ISZERO, PUSH1, 0x17, JUMPI,
+		PUSH1, 0x01, SWAP1, SUB, DUP1, PUSH1, 0x00, SLOAD, ADD, PUSH1, 0x00, SSTORE,
+		PUSH1, 0x02, JUMP,
+		JUMPDEST, GAS, PUSH1, 0x01, SSTORE,
+		PUSH1, 0x00, SLOAD, PUSH1, 0x00, MSTORE, PUSH1, 0x20, PUSH1, 0x00, RETURN,
+	),
+	"shuffle": asm(
+		PUSH1, 0x01, PUSH1, 0x02, PUSH1, 0x03, DUP2, SWAP1, DUP3, SWAP2, SWAP1, DUP1,
+		ADD, ADD, ADD, ADD, ADD, PUSH1, 0x00, MSTORE, PUSH1, 0x20, PUSH1, 0x00, SHA3,
+		PUSH1, 0x00, SSTORE, PUSH1, 0x20, PUSH1, 0x00, RETURN,
+	),
+	"revert":         asm(PUSH1, 0x2a, PUSH1, 0x00, MSTORE, PUSH1, 0x20, PUSH1, 0x00, REVERT),
+	"invalid jump":   asm(PUSH1, 0x01, PUSH1, 0x02, ADD, PUSH1, 0x03, JUMP, JUMPDEST),
+	"invalid jumpi":  asm(PUSH1, 0x01, PUSH1, 0x00, JUMPI, STOP),
+	"stack pair":     asm(PUSH1, 0x01, DUP2, SWAP1),
+	"jumpi":          asm(PUSH1, 0x00, JUMPI),
+	"dynamic jump":   asm(PUSH1, 0x05, DUP1, POP, JUMP, JUMPDEST, PUSH1, 0x01, PUSH1, 0x00, SSTORE, STOP),
+	"invalid opcode": asm(PUSH1, 0x01, PUSH1, 0x00, SSTORE, 0xfe),
+	"truncated push": asm(PUSH1, 0x01, PUSH1, 0x00, SSTORE, PUSH2, 0x01),
+	"call": asm(
+		PUSH4, input1, PUSH1, 0x00, MSTORE,
+		PUSH1, 0x20, PUSH1, 0x00, PUSH1, 0x04, PUSH1, 0x1c, PUSH1, 0x00, PUSH20, contractAddress[:], GAS, CALL,
+		PUSH1, 0x01, SSTORE, GAS, PUSH1, 0x00, SSTORE, PUSH1, 0x20, PUSH1, 0x00, RETURN,
+	),
+}
+
+type predecodeResult struct {
+	ret     []byte
+	leftGas uint64
+	err     string
+	storage [2]types.Hash
+}
+
+// runPredecodeCode runs the code with the gas and reverts the state once it's done
+func runPredecodeCode(bc *repository.Repository, code []byte, gas uint64, predecode bool) predecodeResult {
+	snapshot := bc.Snapshot()
+	defer bc.RevertToSnapshot(snapshot)
+	bc.CreateAccount(predecodeAddress)
+	bc.SetCode(predecodeAddress, code)
+
+	evmInst := NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EnablePredecode: predecode})
+	ret, leftGas, err := evmInst.Call(AccountRef(callerAddress), predecodeAddress, nil, gas, big.NewInt(0))
+	result := predecodeResult{ret: ret, leftGas: leftGas, err: fmt.Sprint(err)}
+	for i := range result.storage {
+		result.storage[i] = bc.GetHashTypeState(predecodeAddress, types.Hash{31: byte(i)})
+	}
+	return result
+}
+
+// assertPredecodeParity runs the code with the gas from 0 to the gas used on success and a few more,
+// the pre-decoded code must have the same result as the plain interpreter with every gas.
+func assertPredecodeParity(assert *assert.Assertions, bc *repository.Repository, name string, code []byte) {
+	full := runPredecodeCode(bc, code, 1000000, false)
+	used := 1000000 - full.leftGas
+	for gas := uint64(0); gas <= used+10; gas++ {
+		if gas > 300 && gas < used-300 && gas%97 != 0 {
+			continue
+		}
+		expect := runPredecodeCode(bc, code, gas, false)
+		assert.Equal(expect, runPredecodeCode(bc, code, gas, true), "%s with gas %d", name, gas)
+	}
+}
+
+func TestPredecode_Parity(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	for name, code := range predecodePrograms {
+		assertPredecodeParity(assert, bc, name, code)
+	}
+}
+
+func TestPredecode_RandomParity(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	opcodes := []OpCode{ADD, SUB, MUL, ISZERO, POP, JUMPDEST, DUP1, DUP2, DUP3, SWAP1, SWAP2, MSTORE, SSTORE, GAS, PC}
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 50; n++ {
+		code := make([]byte, 0)
+		for len(code) < 64 {
+			switch r := rnd.Intn(10); {
+			case r < 3:
+				code = append(code, byte(PUSH1), byte(rnd.Intn(80)))
+			case r < 4:
+				code = append(code, byte(PUSH1), byte(rnd.Intn(64)), byte(JUMP+OpCode(rnd.Intn(2))))
+			default:
+				code = append(code, byte(opcodes[rnd.Intn(len(opcodes))]))
+			}
+		}
+		for _, gas := range []uint64{0, 21, 50, 100, 1000, 5000, 30000, 100000} {
+			expect := runPredecodeCode(bc, code, gas, false)
+			assert.Equal(expect, runPredecodeCode(bc, code, gas, true), "code %x with gas %d", code, gas)
+		}
+	}
+}
+
+func TestDecodeCode(t *testing.T) {
+	assert := assert.New(t)
+	code := decodeCode(predecodePrograms["loop"], &byzantiumInstructionSet)
+
+	kinds := make([]decodedKind, 0)
+	for _, d := range code.ops {
+		kinds = append(kinds, d.kind)
+	}
+	assert.Equal([]decodedKind{
+		decodedPush,
+		decodedOpcode, decodedOpcode, decodedOpcode, decodedPushJumpi,
+		decodedPush, decodedOpcode, decodedOpcode, decodedOpcode, decodedPush, decodedOpcode, decodedOpcode, decodedPush, decodedOpcode, decodedPushJump,
+		decodedOpcode, decodedOpcode, decodedPush, decodedOpcode,
+		decodedPush, decodedOpcode, decodedPush, decodedOpcode, decodedPush, decodedPush, decodedOpcode,
+		decodedOpcode,
+	}, kinds)
+
+	// the blocks start at the JUMPDESTs and after the jumps and GAS
+	assert.True(code.ops[0].blockStart)
+	assert.Equal(GasFastestStep, code.ops[0].blockGas)
+	assert.True(code.ops[1].blockStart)
+	assert.Equal(params.JumpdestGas+3*GasFastestStep+GasSlowStep, code.ops[1].blockGas)
+	assert.Equal(code.index[0x17], code.ops[4].target)
+	assert.Equal(int32(1), code.ops[14].target)
+	assert.True(code.ops[5].blockStart)
+	assert.True(code.ops[15].blockStart)
+	assert.True(code.ops[17].blockStart)
+	assert.Equal(OpCode(STOP), code.ops[len(code.ops)-1].op)
+	assert.Equal(int32(len(code.ops)-1), code.index[len(predecodePrograms["loop"])])
+
+	// the stack ops are fused in pairs
+	code = decodeCode(predecodePrograms["shuffle"], &byzantiumInstructionSet)
+	assert.Equal(decodedStackPair, code.ops[3].kind)
+	assert.Equal(DUP2, code.ops[3].op)
+	assert.Equal(SWAP1, code.ops[3].next)
+	assert.Equal(decodedStackPair, code.ops[4].kind)
+	assert.Equal(decodedStackPair, code.ops[5].kind)
+	assert.Equal(decodedOpcode, code.ops[6].kind)
+}
+
+func TestEVMInterpreter_DecodedCodeCache(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	evmInst := NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EnablePredecode: true})
+	_, _, err := evmInst.Call(AccountRef(callerAddress), contractAddress, input1, 3000, big.NewInt(0))
+	assert.Nil(err)
+
+	in := evmInst.interpreters[0].(*EVMInterpreter)
+	decoded, ok := in.decoded.Get(bc.GetCodeHash(contractAddress))
+	assert.True(ok)
+	assert.Equal(1, in.decoded.Len())
+	assert.True(decoded == in.decodedCode(&Contract{Code: code, CodeHash: bc.GetCodeHash(contractAddress)}))
+	assert.False(decoded == in.decodedCode(&Contract{Code: code}))
+
+	// the cache is bounded, the least recently used code is evicted
+	for i := 0; i < decodedCodeCacheSize; i++ {
+		in.decodedCode(&Contract{Code: code, CodeHash: util.BytesToHash([]byte{byte(i >> 8), byte(i), 1})})
+	}
+	assert.Equal(decodedCodeCacheSize, in.decoded.Len())
+	assert.False(in.decoded.Contains(bc.GetCodeHash(contractAddress)))
+}
+
+func benchmarkPredecode(b *testing.B, predecode bool) {
+	bc := mockPreBlockChain()
+	bc.CreateAccount(predecodeAddress)
+	// count down from 1000 with the stack ops
+	bc.SetCode(predecodeAddress, asm(
+		PUSH2, 0x03, 0xe8,
+		JUMPDEST, DUP1, ISZERO, PUSH1, 0x14, JUMPI,
+		PUSH1, 0x01, DUP2, SWAP1, SWAP2, POP, SUB, PUSH1, 0x03, JUMP,
+		STOP, JUMPDEST, STOP,
+	))
+	evmInst := NewEVMWithConfig(mockEVM(bc).Context, bc, mockEVM(bc).ChainConfig(), Config{EnablePredecode: predecode})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := evmInst.Call(AccountRef(callerAddress), predecodeAddress, nil, 10000000, big.NewInt(0)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEVMInterpreter_Plain(b *testing.B) {
+	benchmarkPredecode(b, false)
+}
+
+func BenchmarkEVMInterpreter_Predecode(b *testing.B) {
+	benchmarkPredecode(b, true)
+}
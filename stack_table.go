@@ -17,9 +17,22 @@
 package evm
 
 import (
+	"fmt"
+
 	"github.com/DSiSc/evm-NG/params"
 )
 
+// checkStack validates there are enough stack items available to perform the operation
+// and the stack stays in the limit.
+func checkStack(stack *Stack, operation *operation) error {
+	if sLen := stack.len(); sLen < operation.minStack {
+		return fmt.Errorf("stack underflow (%d <=> %d)", sLen, operation.minStack)
+	} else if sLen > operation.maxStack {
+		return fmt.Errorf("stack limit reached %d (%d)", sLen, operation.maxStack)
+	}
+	return nil
+}
+
 func minSwapStack(n int) int {
 	return minStack(n, n)
 }
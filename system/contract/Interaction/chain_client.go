@@ -0,0 +1,201 @@
+package Interaction
+
+import (
+	"bytes"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	wutils "github.com/DSiSc/wallet/utils"
+	wcmn "github.com/DSiSc/web3go/common"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+)
+
+var (
+	TransactionNotFoundError = errors.New("transaction not found")
+	ProofNotSupportedError   = errors.New("transaction proof is not supported by the chain client")
+)
+
+// Receipt the execution result of a transaction
+type Receipt struct {
+	// Status 1 means success, 0 means failed
+	Status uint64
+}
+
+// TransactionProof proves the transaction is included in the source chain block, see HeaderRelayContract.VerifyTransaction
+type TransactionProof struct {
+	// Header rlp encoded RelayHeader of the block including the transaction
+	Header []byte
+	// Index and Proof are the merkle path of the transaction in the block
+	Index uint64
+	Proof []types.Hash
+}
+
+// ChainClient is the rpc client of a chain taking part in the cross chain transfer
+type ChainClient interface {
+	// SendRawTransaction broadcast the encoded transaction, return the transaction hash
+	SendRawTransaction(tx []byte) (types.Hash, error)
+	// GetTransactionReceipt return the receipt of the transaction, nil if it is still pending
+	GetTransactionReceipt(hash types.Hash) (*Receipt, error)
+	// GetTransactionCount return the nonce of the account at the latest block
+	GetTransactionCount(addr types.Address) (uint64, error)
+	// GetTransactionProof return the inclusion proof of the transaction, TransactionNotFoundError if it is not included
+	GetTransactionProof(hash types.Hash) (*TransactionProof, error)
+}
+
+// web3ChainClient access the chain through its web3 rpc endpoint
+type web3ChainClient struct {
+	web *wutils.Web3
+}
+
+// NewWeb3ChainClient create a client connected to the web3 rpc endpoint
+func NewWeb3ChainClient(host string, port uint16, ssl bool) (ChainClient, error) {
+	web, err := wutils.NewWeb3(host, strconv.Itoa(int(port)), ssl)
+	if err != nil {
+		return nil, err
+	}
+	return &web3ChainClient{web: web}, nil
+}
+
+func (this *web3ChainClient) SendRawTransaction(tx []byte) (types.Hash, error) {
+	hash, err := this.web.Eth.SendRawTransaction(tx)
+	return types.Hash(hash), err
+}
+
+func (this *web3ChainClient) GetTransactionReceipt(hash types.Hash) (*Receipt, error) {
+	receipt, err := this.web.Eth.GetTransactionReceipt(wcmn.Hash(hash))
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	return &Receipt{Status: receipt.Status.Uint64()}, nil
+}
+
+func (this *web3ChainClient) GetTransactionCount(addr types.Address) (uint64, error) {
+	nonce, err := this.web.Eth.GetTransactionCount(wcmn.Address(addr), "latest")
+	if err != nil {
+		return 0, err
+	}
+	return nonce.Uint64(), nil
+}
+
+// GetTransactionProof the web3 rpc doesn't serve the relay headers, use a ChainInfo.Client supporting them instead
+func (this *web3ChainClient) GetTransactionProof(hash types.Hash) (*TransactionProof, error) {
+	return nil, ProofNotSupportedError
+}
+
+// MemChainClient in-memory chain client, the transactions are executed successfully once sent
+// unless the failure is set. Each transaction is included in its own block, whose height is the
+// position of the transaction. It is used to test the cross chain transfer without live chains.
+type MemChainClient struct {
+	lock     sync.Mutex
+	chainId  uint64
+	txs      [][]byte
+	receipts map[types.Hash]*Receipt
+	nonces   map[types.Address]uint64
+	failure  error
+}
+
+// NewMemChainClient create an empty in-memory chain client
+func NewMemChainClient() *MemChainClient {
+	return &MemChainClient{
+		txs:      make([][]byte, 0),
+		receipts: make(map[types.Hash]*Receipt),
+		nonces:   make(map[types.Address]uint64),
+	}
+}
+
+func (this *MemChainClient) SendRawTransaction(tx []byte) (types.Hash, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.failure != nil {
+		return types.Hash{}, this.failure
+	}
+	var hash types.Hash
+	copy(hash[:], crypto.Keccak256(tx))
+	this.txs = append(this.txs, tx)
+	this.receipts[hash] = &Receipt{Status: SUCCESS}
+	return hash, nil
+}
+
+func (this *MemChainClient) GetTransactionReceipt(hash types.Hash) (*Receipt, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	receipt, ok := this.receipts[hash]
+	if !ok {
+		return nil, TransactionNotFoundError
+	}
+	return receipt, nil
+}
+
+func (this *MemChainClient) GetTransactionCount(addr types.Address) (uint64, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.nonces[addr], nil
+}
+
+func (this *MemChainClient) GetTransactionProof(hash types.Hash) (*TransactionProof, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for i, tx := range this.txs {
+		if !bytes.Equal(crypto.Keccak256(tx), hash[:]) {
+			continue
+		}
+		header, err := rlp.EncodeToBytes(this.header(uint64(i), tx))
+		if err != nil {
+			return nil, err
+		}
+		return &TransactionProof{Header: header, Index: 0, Proof: []types.Hash{}}, nil
+	}
+	return nil, TransactionNotFoundError
+}
+
+// Header return the header of the block including the transaction at position i
+func (this *MemChainClient) Header(i uint64) (*RelayHeader, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if i >= uint64(len(this.txs)) {
+		return nil, HeaderNotFoundError
+	}
+	return this.header(i, this.txs[i]), nil
+}
+
+// the block including the single transaction tx has its leaf hash as the transaction root
+func (this *MemChainClient) header(i uint64, tx []byte) *RelayHeader {
+	return &RelayHeader{ChainID: this.chainId, Height: i, TxRoot: MerkleLeafHash(tx)}
+}
+
+// SetChainId set the chain id of the block headers
+func (this *MemChainClient) SetChainId(chainId uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.chainId = chainId
+}
+
+// SetNonce set the account nonce returned by GetTransactionCount
+func (this *MemChainClient) SetNonce(addr types.Address, nonce uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.nonces[addr] = nonce
+}
+
+// SetFailure make the following transactions fail to be sent with err, nil to recover
+func (this *MemChainClient) SetFailure(err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.failure = err
+}
+
+// SetReceipt override the receipt of the transaction
+func (this *MemChainClient) SetReceipt(hash types.Hash, receipt *Receipt) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.receipts[hash] = receipt
+}
+
+// Transactions return the transactions sent to the chain in order
+func (this *MemChainClient) Transactions() [][]byte {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([][]byte{}, this.txs...)
+}
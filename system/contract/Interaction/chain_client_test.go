@@ -0,0 +1,70 @@
+package Interaction
+
+import (
+	"errors"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMemChainClient(t *testing.T) {
+	assert := assert.New(t)
+	client := NewMemChainClient()
+
+	hash, err := client.SendRawTransaction([]byte{0x1})
+	assert.Nil(err)
+	receipt, err := client.GetTransactionReceipt(hash)
+	assert.Nil(err)
+	assert.Equal(uint64(SUCCESS), receipt.Status)
+	_, err = client.GetTransactionReceipt(types.Hash{})
+	assert.Equal(TransactionNotFoundError, err)
+
+	client.SetReceipt(hash, &Receipt{Status: FAILED})
+	receipt, _ = client.GetTransactionReceipt(hash)
+	assert.Equal(uint64(FAILED), receipt.Status)
+
+	nonce, err := client.GetTransactionCount(types.Address{0x1})
+	assert.Nil(err)
+	assert.Equal(uint64(0), nonce)
+	client.SetNonce(types.Address{0x1}, 5)
+	nonce, _ = client.GetTransactionCount(types.Address{0x1})
+	assert.Equal(uint64(5), nonce)
+
+	// each transaction is included in its own block
+	client.SetChainId(3)
+	proof, err := client.GetTransactionProof(hash)
+	assert.Nil(err)
+	header, err := client.Header(0)
+	assert.Nil(err)
+	assert.Equal(uint64(3), header.ChainID)
+	encoded, _ := rlp.EncodeToBytes(header)
+	assert.Equal(encoded, proof.Header)
+	assert.True(VerifyMerkleProof(header.TxRoot, []byte{0x1}, proof.Index, proof.Proof))
+	_, err = client.GetTransactionProof(types.Hash{})
+	assert.Equal(TransactionNotFoundError, err)
+	_, err = client.Header(1)
+	assert.Equal(HeaderNotFoundError, err)
+
+	sendErr := errors.New("connection refused")
+	client.SetFailure(sendErr)
+	_, err = client.SendRawTransaction([]byte{0x2})
+	assert.Equal(sendErr, err)
+	assert.Equal([][]byte{{0x1}}, client.Transactions())
+}
+
+func TestChainInfo_Dial(t *testing.T) {
+	assert := assert.New(t)
+	client := NewMemChainClient()
+	chain := &ChainInfo{Client: client}
+	dialed, err := chain.Dial()
+	assert.Nil(err)
+	assert.Equal(client, dialed)
+
+	chain = &ChainInfo{Host: "127.0.0.1", Port: 47768}
+	dialed, err = chain.Dial()
+	assert.Nil(err)
+	assert.IsType(&web3ChainClient{}, dialed)
+	_, err = dialed.GetTransactionProof(types.Hash{})
+	assert.Equal(ProofNotSupportedError, err)
+}
@@ -0,0 +1,152 @@
+package Interaction
+
+import (
+	"crypto/ecdsa"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	"github.com/pkg/errors"
+	"math/big"
+	"sync"
+)
+
+var (
+	UnknownChainError        = errors.New("unknown chain")
+	SignerNotConfiguredError = errors.New("cross chain signer is not configured")
+)
+
+// ChainInfo the registry entry of a chain taking part in the cross chain transfer
+type ChainInfo struct {
+	// Host and Port of the chain's web3 rpc endpoint
+	Host string
+	Port uint16
+	Ssl  bool
+	// ChainId the EIP155 chain id used to sign the transactions sent to the chain
+	ChainId uint64
+	// BridgeAddr address of the cross chain bridge contract deployed on the chain
+	BridgeAddr types.Address
+	// Client is used to access the chain instead of the web3 rpc endpoint if it is not nil
+	Client ChainClient
+}
+
+// Signer signs the relay transactions with the relayer key, so that the key can be kept in a wallet or HSM
+// instead of the node config.
+type Signer interface {
+	// Address return the relayer account address
+	Address() types.Address
+	// SignTx sign the transaction sent to the chain identified by chainId
+	SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error)
+}
+
+// CrossChainConfig node configuration of the cross chain contract
+type CrossChainConfig struct {
+	// LocalChain chain flag of the chain this node belongs to
+	LocalChain string
+	// Chains registry of the chains, keyed by chain flag
+	Chains map[string]ChainInfo
+	// GasLimit gas limit of the relay transactions
+	GasLimit uint64
+	// Signer signs the relay transactions, the cross chain transfer is disabled if it is nil
+	Signer Signer
+}
+
+// DefaultConfig return the default cross chain config, which registers no chain
+func DefaultConfig() CrossChainConfig {
+	return CrossChainConfig{
+		Chains:   make(map[string]ChainInfo),
+		GasLimit: 6721975,
+	}
+}
+
+var (
+	lock   sync.RWMutex
+	config = DefaultConfig()
+)
+
+// SetConfig set the cross chain config of the node, it should be called at node start
+func SetConfig(c CrossChainConfig) error {
+	if len(c.LocalChain) > 0 {
+		if _, ok := c.Chains[c.LocalChain]; !ok {
+			return errors.Errorf("%v: %s", UnknownChainError, c.LocalChain)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	config = c
+	return nil
+}
+
+// GetConfig return the cross chain config of the node
+func GetConfig() CrossChainConfig {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// LookupChain return the registered chain with specified chain flag
+func LookupChain(chainFlag string) (*ChainInfo, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	chain, ok := config.Chains[chainFlag]
+	if !ok {
+		return nil, errors.Errorf("%v: %s", UnknownChainError, chainFlag)
+	}
+	return &chain, nil
+}
+
+// LookupChainById return the registered chain with specified chain id
+func LookupChainById(chainId uint64) (*ChainInfo, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, chain := range config.Chains {
+		if chain.ChainId == chainId {
+			chain := chain
+			return &chain, nil
+		}
+	}
+	return nil, errors.Errorf("%v: chain id %d", UnknownChainError, chainId)
+}
+
+// LocalChain return the chain this node belongs to
+func LocalChain() (*ChainInfo, error) {
+	return LookupChain(GetConfig().LocalChain)
+}
+
+// GetSigner return the relayer signer
+func GetSigner() (Signer, error) {
+	signer := GetConfig().Signer
+	if signer == nil {
+		return nil, SignerNotConfiguredError
+	}
+	return signer, nil
+}
+
+// Dial return the client of the chain, connect to the web3 rpc endpoint if no client is set
+func (this *ChainInfo) Dial() (ChainClient, error) {
+	if this.Client != nil {
+		return this.Client, nil
+	}
+	return NewWeb3ChainClient(this.Host, this.Port, this.Ssl)
+}
+
+// PrivateKeySigner signs the transactions with a local private key
+type PrivateKeySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewPrivateKeySigner create a signer from the hex encoded private key
+func NewPrivateKeySigner(hexKey string) (*PrivateKeySigner, error) {
+	key, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKeySigner{key: key}, nil
+}
+
+func (this *PrivateKeySigner) Address() types.Address {
+	return crypto.PubkeyToAddress(this.key.PublicKey)
+}
+
+func (this *PrivateKeySigner) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	return wtypes.SignTx(tx, wtypes.NewEIP155Signer(chainId), this.key)
+}
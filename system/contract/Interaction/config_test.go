@@ -0,0 +1,58 @@
+package Interaction
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func mockCrossChainConfig() CrossChainConfig {
+	config := DefaultConfig()
+	config.LocalChain = "chainA"
+	config.Chains["chainA"] = ChainInfo{Host: "127.0.0.1", Port: 47768, ChainId: 1, BridgeAddr: types.Address{0x1}}
+	config.Chains["chainB"] = ChainInfo{Host: "127.0.0.1", Port: 47769, ChainId: 2, BridgeAddr: types.Address{0x2}}
+	return config
+}
+
+func TestSetConfig(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	config := mockCrossChainConfig()
+	config.LocalChain = "chainC"
+	assert.NotNil(SetConfig(config))
+	assert.Nil(SetConfig(mockCrossChainConfig()))
+
+	local, err := LocalChain()
+	assert.Nil(err)
+	assert.Equal(uint64(1), local.ChainId)
+	chain, err := LookupChain("chainB")
+	assert.Nil(err)
+	assert.Equal(types.Address{0x2}, chain.BridgeAddr)
+	chain, err = LookupChainById(2)
+	assert.Nil(err)
+	assert.Equal(uint16(47769), chain.Port)
+	_, err = LookupChain("chainC")
+	assert.NotNil(err)
+	_, err = LookupChainById(3)
+	assert.NotNil(err)
+}
+
+func TestGetPubliceAcccount(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	_, err := GetPubliceAcccount()
+	assert.Equal(SignerNotConfiguredError, err)
+
+	key, _ := crypto.GenerateKey()
+	signer := &PrivateKeySigner{key: key}
+	config := mockCrossChainConfig()
+	config.Signer = signer
+	assert.Nil(SetConfig(config))
+	addr, err := GetPubliceAcccount()
+	assert.Nil(err)
+	assert.Equal(crypto.PubkeyToAddress(key.PublicKey), addr)
+
+	_, err = NewPrivateKeySigner("not a key")
+	assert.NotNil(err)
+}
@@ -0,0 +1,355 @@
+package Interaction
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	cutil "github.com/DSiSc/crypto-suite/util"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+var CrossChainAddr = cutil.HexToAddress("0000000000000000000000000000000000011100")
+
+const (
+	crossChainRecordKey = "CrossChainRecordKey"
+	transferTimeoutKey  = "CrossChainTransferTimeoutKey"
+)
+
+// DefaultTransferTimeout number of blocks to wait for the target chain confirmation if the governor doesn't set it
+const DefaultTransferTimeout = uint64(100)
+
+// off-chain operations recorded in witness
+const (
+	forwardOp = "cross-forward"
+	receiptOp = "cross-receipt"
+)
+
+var (
+	forwardFundsMethod  = util.MustNewMethod("forwardFunds(address to,uint64 amount,string payload,string chainFlag)", "bytes32")
+	getTxStateMethod    = util.MustNewMethod("getTxState(bytes32 localTxHash)", "uint64")
+	getTransferMethod   = util.MustNewMethod("getTransfer(bytes32 localTxHash)", "bytes32", "address", "uint64", "uint64", "uint64")
+	updateTxStateMethod = util.MustNewMethod("updateTxState(bytes32 localTxHash)", "uint64")
+	setTimeoutMethod    = util.MustNewMethod("setTransferTimeout(uint64 blocks)")
+	getTimeoutMethod    = util.MustNewMethod("getTransferTimeout()", "uint64")
+	crossGovernorMethod = util.MustNewMethod("transferGovernor(address governor)")
+)
+
+var (
+	forwardFundsMethodHash  = string(forwardFundsMethod.Id())
+	getTxStateMethodHash    = string(getTxStateMethod.Id())
+	getTransferMethodHash   = string(getTransferMethod.Id())
+	updateTxStateMethodHash = string(updateTxStateMethod.Id())
+	setTimeoutMethodHash    = string(setTimeoutMethod.Id())
+	getTimeoutMethodHash    = string(getTimeoutMethod.Id())
+	crossGovernorMethodHash = string(crossGovernorMethod.Id())
+)
+
+// TransferStateChangedEvent emitted on every state change of the transfer
+var TransferStateChangedEvent = util.MustNewEvent("TransferStateChanged(bytes32 indexed localTxHash,bytes32 targetTxHash,uint64 status)")
+
+// CrossChainABI abi metadata of the cross chain contract
+var CrossChainABI = &util.ABI{
+	Methods: []*util.Method{
+		forwardFundsMethod, getTxStateMethod, getTransferMethod, updateTxStateMethod,
+		setTimeoutMethod, getTimeoutMethod, crossGovernorMethod,
+	},
+	Events: []*util.Event{TransferStateChangedEvent},
+}
+
+var (
+	RecordNotFoundError = errors.New("cross chain transfer not found")
+	RecordExistError    = errors.New("cross chain transfer already exists")
+)
+
+// IsCrossChainViewMethod check the method called with input doesn't modify the state
+func IsCrossChainViewMethod(input []byte) bool {
+	switch string(util.ExtractMethodHash(input)) {
+	case getTxStateMethodHash, getTransferMethodHash, getTimeoutMethodHash:
+		return true
+	default:
+		return false
+	}
+}
+
+// execute the cross chain contract, caller is the address calling the contract
+func CrossChainExecute(cross *CrossChainContract, caller types.Address, input []byte) ([]byte, error) {
+	methodHash := util.ExtractMethodHash(input)
+	switch string(methodHash) {
+	case forwardFundsMethodHash:
+		var to types.Address
+		var amount uint64
+		payload := new(string)
+		chainFlag := new(string)
+		err := util.ExtractParam(input[len(methodHash):], &to, &amount, payload, chainFlag)
+		if err != nil {
+			return nil, err
+		}
+		localHash, err := cross.ForwardFunds(to, amount, *payload, *chainFlag)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(localHash)
+	case getTxStateMethodHash:
+		var localHash types.Hash
+		err := util.ExtractParam(input[len(methodHash):], &localHash)
+		if err != nil {
+			return nil, err
+		}
+		record, err := cross.GetTransfer(localHash)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(uint64(record.Status))
+	case getTransferMethodHash:
+		var localHash types.Hash
+		err := util.ExtractParam(input[len(methodHash):], &localHash)
+		if err != nil {
+			return nil, err
+		}
+		record, err := cross.GetTransfer(localHash)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(record.TargetTxHash, record.To, record.Amount, uint64(record.Status), record.Deadline)
+	case updateTxStateMethodHash:
+		var localHash types.Hash
+		err := util.ExtractParam(input[len(methodHash):], &localHash)
+		if err != nil {
+			return nil, err
+		}
+		status, err := cross.UpdateTxState(localHash)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(uint64(status))
+	case setTimeoutMethodHash:
+		var blocks uint64
+		err := util.ExtractParam(input[len(methodHash):], &blocks)
+		if err != nil {
+			return nil, err
+		}
+		return nil, cross.SetTransferTimeout(caller, blocks)
+	case getTimeoutMethodHash:
+		return util.EncodeReturnValue(cross.TransferTimeout())
+	case crossGovernorMethodHash:
+		var governor types.Address
+		err := util.ExtractParam(input[len(methodHash):], &governor)
+		if err != nil {
+			return nil, err
+		}
+		return nil, util.NewGovernor(cross.db, CrossChainAddr).Transfer(caller, governor)
+	default:
+		return nil, errors.New("unknown method")
+	}
+}
+
+// TransferRecord the cross chain transfer persisted in contract storage, keyed by the local transaction hash
+type TransferRecord struct {
+	LocalTxHash  types.Hash
+	TargetTxHash types.Hash
+	ChainFlag    string
+	To           types.Address
+	Amount       uint64
+	Status       Status
+	// Deadline the transfer fails if it is still not confirmed after this block
+	Deadline uint64
+}
+
+// CrossChainContract tracks the cross chain transfers, the transfer is PENDING once forwarded,
+// then becomes CONFIRMED or FAILED according to the receipt on the target chain or the timeout.
+type CrossChainContract struct {
+	db          *repository.Repository
+	blockNumber uint64
+	witness     *storage.Witness
+	emitter     util.EventEmitter
+}
+
+// NewCrossChainContract create a new instance.
+// blockNumber: number of the block being executed, used to check the transfer timeout
+// witness: off-chain results of the block, the chains are accessed directly if it is nil
+func NewCrossChainContract(db *repository.Repository, blockNumber uint64, witness *storage.Witness) *CrossChainContract {
+	return &CrossChainContract{
+		db:          db,
+		blockNumber: blockNumber,
+		witness:     witness,
+	}
+}
+
+// SetupCrossChainGenesis record the governor and the transfer timeout in the genesis state
+func SetupCrossChainGenesis(db *repository.Repository, governor types.Address, transferTimeout uint64) error {
+	if err := util.NewGovernor(db, CrossChainAddr).Set(governor); err != nil {
+		return err
+	}
+	return putTransferTimeout(db, transferTimeout)
+}
+
+// TransferTimeout return the number of blocks to wait for the target chain confirmation before the transfer fails
+func (this *CrossChainContract) TransferTimeout() uint64 {
+	val, err := this.db.Get(util.Hash([]byte(transferTimeoutKey)))
+	if err != nil || len(val) != 8 {
+		return DefaultTransferTimeout
+	}
+	return binary.BigEndian.Uint64(val)
+}
+
+// SetTransferTimeout set the transfer timeout of the new transfers, only the governor can set it
+func (this *CrossChainContract) SetTransferTimeout(caller types.Address, blocks uint64) error {
+	if err := util.NewGovernor(this.db, CrossChainAddr).Check(caller); err != nil {
+		return err
+	}
+	return putTransferTimeout(this.db, blocks)
+}
+
+// ForwardFunds send the raw transaction to the local chain and relay the transfer to the target chain,
+// return the local transaction hash identifying the PENDING transfer.
+func (this *CrossChainContract) ForwardFunds(to types.Address, amount uint64, payload string, chainFlag string) (types.Hash, error) {
+	ret, err := this.call(forwardOp, chainFlag, payload, func() ([]byte, error) {
+		from, err := GetPubliceAcccount()
+		if err != nil {
+			return nil, err
+		}
+		localHash, targetHash, err := CallCrossRawTransactionReq(from, to, amount, payload, chainFlag)
+		if err != nil {
+			return nil, err
+		}
+		return rlp.EncodeToBytes([]types.Hash{localHash, targetHash})
+	})
+	if err != nil {
+		return types.Hash{}, err
+	}
+	hashes := make([]types.Hash, 0, 2)
+	if err = rlp.DecodeBytes(ret, &hashes); err != nil {
+		return types.Hash{}, err
+	}
+	if len(hashes) != 2 {
+		return types.Hash{}, errors.New("invalid forward result")
+	}
+
+	if _, err = this.GetTransfer(hashes[0]); err == nil {
+		return types.Hash{}, RecordExistError
+	}
+	record := &TransferRecord{
+		LocalTxHash:  hashes[0],
+		TargetTxHash: hashes[1],
+		ChainFlag:    chainFlag,
+		To:           to,
+		Amount:       amount,
+		Status:       PENDING,
+		Deadline:     this.blockNumber + this.TransferTimeout(),
+	}
+	if err = this.saveRecord(record); err != nil {
+		return types.Hash{}, err
+	}
+	return record.LocalTxHash, nil
+}
+
+// GetTransfer return the transfer record identified by the local transaction hash
+func (this *CrossChainContract) GetTransfer(localHash types.Hash) (*TransferRecord, error) {
+	data, err := this.db.Get(this.recordKey(localHash))
+	if err != nil || len(data) == 0 {
+		return nil, RecordNotFoundError
+	}
+	record := new(TransferRecord)
+	if err = rlp.DecodeBytes(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// UpdateTxState check the receipt of the PENDING transfer on the target chain, the transfer becomes CONFIRMED
+// or FAILED according to the receipt, or FAILED if it is not confirmed before the deadline.
+func (this *CrossChainContract) UpdateTxState(localHash types.Hash) (Status, error) {
+	record, err := this.GetTransfer(localHash)
+	if err != nil {
+		return FAILED, err
+	}
+	if record.Status != PENDING {
+		return record.Status, nil
+	}
+
+	ret, err := this.call(receiptOp, record.ChainFlag, fmt.Sprintf("%x", record.TargetTxHash), func() ([]byte, error) {
+		chain, err := LookupChain(record.ChainFlag)
+		if err != nil {
+			return nil, err
+		}
+		client, err := chain.Dial()
+		if err != nil {
+			return nil, err
+		}
+		receipt, err := client.GetTransactionReceipt(record.TargetTxHash)
+		if err == TransactionNotFoundError || (err == nil && receipt == nil) {
+			// still pending
+			return []byte{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rlp.EncodeToBytes(receipt)
+	})
+	if err != nil {
+		return record.Status, err
+	}
+
+	switch {
+	case len(ret) > 0:
+		receipt := new(Receipt)
+		if err = rlp.DecodeBytes(ret, receipt); err != nil {
+			return record.Status, err
+		}
+		if receipt.Status == SUCCESS {
+			record.Status = CONFIRMED
+		} else {
+			record.Status = FAILED
+		}
+	case this.blockNumber > record.Deadline:
+		record.Status = FAILED
+	default:
+		return record.Status, nil
+	}
+	return record.Status, this.saveRecord(record)
+}
+
+func (this *CrossChainContract) Address() types.Address {
+	return CrossChainAddr
+}
+
+// SetEventEmitter set the emitter of the transfer events, no event is emitted if it is not set
+func (this *CrossChainContract) SetEventEmitter(emitter util.EventEmitter) {
+	this.emitter = emitter
+}
+
+// persist the record and emit the state change event
+func (this *CrossChainContract) saveRecord(record *TransferRecord) error {
+	data, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		return err
+	}
+	if err = this.db.Put(this.recordKey(record.LocalTxHash), data); err != nil {
+		return err
+	}
+	return TransferStateChangedEvent.Emit(this.emitter, CrossChainAddr, record.LocalTxHash, record.TargetTxHash, uint64(record.Status))
+}
+
+// call the off-chain operation through the witness if it is not nil
+func (this *CrossChainContract) call(op, url, name string, callFunc func() ([]byte, error)) ([]byte, error) {
+	if this.witness == nil {
+		return callFunc()
+	}
+	return this.witness.Call(op, url, name, callFunc)
+}
+
+// return the storage key of the record
+func (this *CrossChainContract) recordKey(localHash types.Hash) []byte {
+	return util.Hash(append([]byte(crossChainRecordKey), localHash[:]...))
+}
+
+// persist the transfer timeout
+func putTransferTimeout(db *repository.Repository, blocks uint64) error {
+	var val [8]byte
+	binary.BigEndian.PutUint64(val[:], blocks)
+	return db.Put(util.Hash([]byte(transferTimeoutKey)), val[:])
+}
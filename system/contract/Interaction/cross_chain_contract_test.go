@@ -0,0 +1,231 @@
+package Interaction
+
+import (
+	"errors"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func mockCrossChainDB() *repository.Repository {
+	db := &repository.Repository{}
+	cache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return cache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		cache[string(key)] = value
+		return nil
+	})
+	return db
+}
+
+// mockEmitter return the emitter recording the emitted logs
+func mockEmitter() (util.EventEmitter, *[]*types.Log) {
+	logs := make([]*types.Log, 0)
+	return func(address types.Address, topics []types.Hash, data []byte) {
+		logs = append(logs, &types.Log{Address: address, Topics: topics, Data: data})
+	}, &logs
+}
+
+func forwardMockTransfer(t *testing.T, cross *CrossChainContract) types.Hash {
+	localHash, err := cross.ForwardFunds(types.Address{0x4}, 10, mockRawTransaction(t, types.Address{0x1}, 10), "chainB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return localHash
+}
+
+func TestCrossChainContract_Confirmed(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	_, targetClient, _ := mockCrossChainClients(t)
+	db := mockCrossChainDB()
+	emitter, logs := mockEmitter()
+
+	cross := NewCrossChainContract(db, 10, nil)
+	cross.SetEventEmitter(emitter)
+	assert.Equal(CrossChainAddr, cross.Address())
+	localHash := forwardMockTransfer(t, cross)
+	record, err := cross.GetTransfer(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(PENDING), record.Status)
+	assert.Equal(uint64(110), record.Deadline)
+	assert.Equal(types.Address{0x4}, record.To)
+	assert.Equal(1, len(*logs))
+	assert.Equal(CrossChainAddr, (*logs)[0].Address)
+	assert.Equal([]types.Hash{TransferStateChangedEvent.Id(), localHash}, (*logs)[0].Topics)
+	var (
+		targetHash types.Hash
+		logStatus  uint64
+	)
+	assert.Nil(util.ExtractParam((*logs)[0].Data, &targetHash, &logStatus))
+	assert.Equal(record.TargetTxHash, targetHash)
+	assert.Equal(uint64(PENDING), logStatus)
+	assert.NotNil(CrossChainABI.Event("TransferStateChanged"))
+	assert.Equal("TransferStateChanged(bytes32,bytes32,uint64)", TransferStateChangedEvent.Signature())
+
+	status, err := cross.UpdateTxState(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(CONFIRMED), status)
+	assert.Equal(2, len(*logs))
+
+	// the confirmed transfer never changes again
+	targetClient.SetReceipt(record.TargetTxHash, &Receipt{Status: FAILED})
+	status, err = cross.UpdateTxState(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(CONFIRMED), status)
+	assert.Equal(2, len(*logs))
+
+	_, err = cross.GetTransfer(types.Hash{})
+	assert.Equal(RecordNotFoundError, err)
+}
+
+func TestCrossChainContract_Failed(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	_, targetClient, _ := mockCrossChainClients(t)
+	db := mockCrossChainDB()
+
+	cross := NewCrossChainContract(db, 10, nil)
+	localHash := forwardMockTransfer(t, cross)
+	record, _ := cross.GetTransfer(localHash)
+	targetClient.SetReceipt(record.TargetTxHash, &Receipt{Status: FAILED})
+	status, err := cross.UpdateTxState(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(FAILED), status)
+}
+
+func TestCrossChainContract_Timeout(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	_, targetClient, _ := mockCrossChainClients(t)
+	db := mockCrossChainDB()
+
+	localHash := forwardMockTransfer(t, NewCrossChainContract(db, 10, nil))
+	record, _ := NewCrossChainContract(db, 10, nil).GetTransfer(localHash)
+	targetClient.SetReceipt(record.TargetTxHash, nil)
+
+	status, err := NewCrossChainContract(db, 110, nil).UpdateTxState(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(PENDING), status)
+	status, err = NewCrossChainContract(db, 111, nil).UpdateTxState(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(FAILED), status)
+}
+
+func TestCrossChainContract_TransferTimeout(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	mockCrossChainClients(t)
+	db := mockCrossChainDB()
+	governor := types.Address{0x9}
+	assert.Nil(SetupCrossChainGenesis(db, governor, 20))
+
+	cross := NewCrossChainContract(db, 10, nil)
+	ret, err := CrossChainExecute(cross, types.Address{0x1}, util.ExtractMethodHash(util.Hash([]byte("getTransferTimeout()"))))
+	assert.Nil(err)
+	var timeout uint64
+	assert.Nil(util.ExtractParam(ret, &timeout))
+	assert.Equal(uint64(20), timeout)
+
+	// only the governor can change the timeout, which applies to the new transfers
+	input, _ := util.EncodeReturnValue(uint64(50))
+	setTimeout := append(util.ExtractMethodHash(util.Hash([]byte("setTransferTimeout(uint64)"))), input...)
+	_, err = CrossChainExecute(cross, types.Address{0x1}, setTimeout)
+	assert.Equal(util.NotGovernorError, err)
+	localHash := forwardMockTransfer(t, cross)
+	_, err = CrossChainExecute(cross, governor, setTimeout)
+	assert.Nil(err)
+	record, _ := cross.GetTransfer(localHash)
+	assert.Equal(uint64(30), record.Deadline)
+	assert.Equal(uint64(50), cross.TransferTimeout())
+
+	input, _ = util.EncodeReturnValue(types.Address{0x1})
+	_, err = CrossChainExecute(cross, governor, append(util.ExtractMethodHash(util.Hash([]byte("transferGovernor(address)"))), input...))
+	assert.Nil(err)
+	assert.Equal(util.NotGovernorError, cross.SetTransferTimeout(governor, 10))
+	assert.Nil(cross.SetTransferTimeout(types.Address{0x1}, 10))
+	assert.Equal(uint64(10), cross.TransferTimeout())
+}
+
+func TestCrossChainContract_Witness(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	localClient, targetClient, _ := mockCrossChainClients(t)
+
+	db := mockCrossChainDB()
+	proposerWitness := storage.NewProposerWitness()
+	cross := NewCrossChainContract(db, 10, proposerWitness)
+	localHash := forwardMockTransfer(t, cross)
+	_, err := cross.UpdateTxState(localHash)
+	assert.Nil(err)
+	data, _ := proposerWitness.Encode()
+
+	// validators replay the results without accessing the chains
+	localClient.SetFailure(errors.New("connection refused"))
+	targetClient.SetFailure(errors.New("connection refused"))
+	db = mockCrossChainDB()
+	validatorWitness, err := storage.NewValidatorWitness(data)
+	assert.Nil(err)
+	cross = NewCrossChainContract(db, 10, validatorWitness)
+	assert.Equal(localHash, forwardMockTransfer(t, cross))
+	status, err := cross.UpdateTxState(localHash)
+	assert.Nil(err)
+	assert.Equal(Status(CONFIRMED), status)
+	assert.Nil(validatorWitness.Finish())
+	assert.Equal(1, len(localClient.Transactions()))
+}
+
+func TestCrossChainExecute(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	mockCrossChainClients(t)
+	db := mockCrossChainDB()
+	cross := NewCrossChainContract(db, 10, nil)
+
+	input, _ := util.EncodeReturnValue(types.Address{0x4}, uint64(10), mockRawTransaction(t, types.Address{0x1}, 10), "chainB")
+	ret, err := CrossChainExecute(cross, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("forwardFunds(address,uint64,string,string)"))), input...))
+	assert.Nil(err)
+	var localHash types.Hash
+	assert.Nil(util.ExtractParam(ret, &localHash))
+
+	input, _ = util.EncodeReturnValue(localHash)
+	ret, err = CrossChainExecute(cross, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("getTxState(bytes32)"))), input...))
+	assert.Nil(err)
+	var status uint64
+	assert.Nil(util.ExtractParam(ret, &status))
+	assert.Equal(uint64(PENDING), status)
+
+	ret, err = CrossChainExecute(cross, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("updateTxState(bytes32)"))), input...))
+	assert.Nil(err)
+	assert.Nil(util.ExtractParam(ret, &status))
+	assert.Equal(uint64(CONFIRMED), status)
+
+	ret, err = CrossChainExecute(cross, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("getTransfer(bytes32)"))), input...))
+	assert.Nil(err)
+	var targetHash types.Hash
+	var to types.Address
+	var amount, deadline uint64
+	assert.Nil(util.ExtractParam(ret, &targetHash, &to, &amount, &status, &deadline))
+	assert.Equal(types.Address{0x4}, to)
+	assert.Equal(uint64(10), amount)
+	assert.Equal(uint64(CONFIRMED), status)
+
+	input, _ = util.EncodeReturnValue(types.Hash{})
+	_, err = CrossChainExecute(cross, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("getTxState(bytes32)"))), input...))
+	assert.Equal(RecordNotFoundError, err)
+	_, err = CrossChainExecute(cross, types.Address{0x1}, []byte{0, 0, 0, 0})
+	assert.NotNil(err)
+}
@@ -0,0 +1,124 @@
+package Interaction
+
+import (
+	"github.com/DSiSc/craft/rlp"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	eutil "github.com/DSiSc/evm-NG/system/contract/util"
+	wcmn "github.com/DSiSc/web3go/common"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+// signer recording the signed transactions
+type mockSigner struct {
+	*PrivateKeySigner
+	chainId *big.Int
+	txs     []*types.Transaction
+}
+
+func (this *mockSigner) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	this.chainId = chainId
+	this.txs = append(this.txs, tx)
+	return this.PrivateKeySigner.SignTx(tx, chainId)
+}
+
+func mockCrossChainClients(t *testing.T) (*MemChainClient, *MemChainClient, *mockSigner) {
+	localClient, targetClient := NewMemChainClient(), NewMemChainClient()
+	key, _ := crypto.GenerateKey()
+	signer := &mockSigner{PrivateKeySigner: &PrivateKeySigner{key: key}}
+	config := mockCrossChainConfig()
+	config.Signer = signer
+	chainA, chainB := config.Chains["chainA"], config.Chains["chainB"]
+	chainA.Client, chainB.Client = localClient, targetClient
+	localClient.SetChainId(chainA.ChainId)
+	targetClient.SetChainId(chainB.ChainId)
+	config.Chains["chainA"], config.Chains["chainB"] = chainA, chainB
+	if err := SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return localClient, targetClient, signer
+}
+
+func mockRawTransaction(t *testing.T, to types.Address, amount int64) string {
+	tx := new(types.Transaction)
+	from := types.Address{0x3}
+	tx.Data.From = &from
+	tx.Data.Recipient = &to
+	tx.Data.Price = big.NewInt(0)
+	tx.Data.Amount = big.NewInt(amount)
+	tx.Data.Payload = []byte{}
+	tx.Data.V, tx.Data.R, tx.Data.S = big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	tx.Data.Hash = &types.Hash{}
+	txBytes, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wcmn.BytesToHex(txBytes)
+}
+
+func TestCallCrossRawTransactionReq(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	localClient, targetClient, signer := mockCrossChainClients(t)
+	relayer := signer.Address()
+	targetClient.SetNonce(relayer, 7)
+
+	payload := mockRawTransaction(t, types.Address{0x1}, 10)
+	localHash, targetHash, err := CallCrossRawTransactionReq(relayer, types.Address{0x4}, 10, payload, "chainB")
+	assert.Nil(err)
+	assert.Equal([][]byte{wcmn.HexToBytes(payload)}, localClient.Transactions())
+	assert.Equal(1, len(targetClient.Transactions()))
+	receipt, err := localClient.GetTransactionReceipt(localHash)
+	assert.Nil(err)
+	assert.Equal(uint64(SUCCESS), receipt.Status)
+	_, err = targetClient.GetTransactionReceipt(targetHash)
+	assert.Nil(err)
+
+	assert.Equal(1, len(signer.txs))
+	assert.Equal(big.NewInt(2), signer.chainId)
+	relayTx := signer.txs[0]
+	assert.Equal(uint64(6721975), relayTx.Data.GasLimit)
+	assert.Equal(types.Address{0x2}, *relayTx.Data.Recipient)
+	assert.Equal(uint64(7), relayTx.Data.AccountNonce)
+	assert.Equal(relayer, *relayTx.Data.From)
+
+	// the relayed transaction calls ReceiveFunds of the target chain with the proof of the local transaction
+	assert.Equal(eutil.ExtractMethodHash(eutil.Hash([]byte("ReceiveFunds(address,uint64,string,uint64,bytes,uint64,bytes32[])"))), relayTx.Data.Payload[:4])
+	var (
+		to             types.Address
+		amount         uint64
+		relayedPayload string
+		srcChainId     uint64
+		header         []byte
+		index          uint64
+		proof          []types.Hash
+	)
+	assert.Nil(eutil.ExtractParam(relayTx.Data.Payload[4:], &to, &amount, &relayedPayload, &srcChainId, &header, &index, &proof))
+	assert.Equal(types.Address{0x4}, to)
+	assert.Equal(uint64(10), amount)
+	assert.Equal(payload, relayedPayload)
+	assert.Equal(uint64(1), srcChainId)
+	localHeader, err := DecodeRelayHeader(header)
+	assert.Nil(err)
+	assert.Equal(uint64(1), localHeader.ChainID)
+	assert.True(VerifyMerkleProof(localHeader.TxRoot, wcmn.HexToBytes(payload), index, proof))
+}
+
+func TestCallCrossRawTransactionReq_Mismatch(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	localClient, targetClient, signer := mockCrossChainClients(t)
+	relayer := signer.Address()
+
+	// the raw transaction must transfer the same amount to the local bridge contract
+	_, _, err := CallCrossRawTransactionReq(relayer, types.Address{0x4}, 10, mockRawTransaction(t, types.Address{0x1}, 11), "chainB")
+	assert.NotNil(err)
+	_, _, err = CallCrossRawTransactionReq(relayer, types.Address{0x4}, 10, mockRawTransaction(t, types.Address{0x2}, 10), "chainB")
+	assert.NotNil(err)
+	_, _, err = CallCrossRawTransactionReq(relayer, types.Address{0x4}, 10, mockRawTransaction(t, types.Address{0x1}, 10), "chainC")
+	assert.NotNil(err)
+	assert.Equal(0, len(localClient.Transactions()))
+	assert.Equal(0, len(targetClient.Transactions()))
+}
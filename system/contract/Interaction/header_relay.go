@@ -0,0 +1,399 @@
+package Interaction
+
+import (
+	"encoding/binary"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	cutil "github.com/DSiSc/crypto-suite/util"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+var HeaderRelayAddr = cutil.HexToAddress("0000000000000000000000000000000000011001")
+
+const (
+	headerRelayKey     = "HeaderRelayKey"
+	relayValidatorsKey = "HeaderRelayValidatorsKey"
+	relayBridgeKey     = "HeaderRelayBridgeKey"
+)
+
+// prefixes of the merkle tree hashes, so that an inner node can't be proved as a leaf
+const (
+	merkleLeafPrefix = byte(0x00)
+	merkleNodePrefix = byte(0x01)
+)
+
+var (
+	submitHeaderMethodHash     = string(util.ExtractMethodHash(util.Hash([]byte("submitHeader(bytes,bytes[])"))))
+	getHeaderMethodHash        = string(util.ExtractMethodHash(util.Hash([]byte("getHeader(uint64,uint64)"))))
+	setValidatorsMethodHash    = string(util.ExtractMethodHash(util.Hash([]byte("setValidators(uint64,address[])"))))
+	getValidatorsMethodHash    = string(util.ExtractMethodHash(util.Hash([]byte("getValidators(uint64)"))))
+	setBridgeMethodHash        = string(util.ExtractMethodHash(util.Hash([]byte("setBridge(uint64,address)"))))
+	getBridgeMethodHash        = string(util.ExtractMethodHash(util.Hash([]byte("getBridge(uint64)"))))
+	transferGovernorMethodHash = string(util.ExtractMethodHash(util.Hash([]byte("transferGovernor(address)"))))
+)
+
+var (
+	HeaderNotFoundError      = errors.New("source chain header not found")
+	HeaderConflictError      = errors.New("conflict with the relayed source chain header")
+	InsufficientQuorumError  = errors.New("insufficient validator signatures")
+	InvalidMerkleProofError  = errors.New("invalid merkle proof")
+	HeaderMismatchError      = errors.New("header mismatch with the relayed source chain header")
+	NoValidatorsDefinedError = errors.New("no validators defined for the source chain")
+	BridgeNotDefinedError    = errors.New("no bridge defined for the source chain")
+)
+
+// IsHeaderRelayViewMethod check the method called with input doesn't modify the state
+func IsHeaderRelayViewMethod(input []byte) bool {
+	switch string(util.ExtractMethodHash(input)) {
+	case getHeaderMethodHash, getValidatorsMethodHash, getBridgeMethodHash:
+		return true
+	default:
+		return false
+	}
+}
+
+// execute the header relay contract
+func HeaderRelayExecute(relay *HeaderRelayContract, caller types.Address, input []byte) ([]byte, error) {
+	methodHash := util.ExtractMethodHash(input)
+	switch string(methodHash) {
+	case submitHeaderMethodHash:
+		header := make([]byte, 0)
+		signatures := make([][]byte, 0)
+		err := util.ExtractParam(input[len(methodHash):], &header, &signatures)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := relay.SubmitHeader(header, signatures)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(hash)
+	case getHeaderMethodHash:
+		var chainId, height uint64
+		err := util.ExtractParam(input[len(methodHash):], &chainId, &height)
+		if err != nil {
+			return nil, err
+		}
+		header, err := relay.GetHeader(chainId, height)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(header.Hash(), header.TxRoot, header.ReceiptsRoot)
+	case setValidatorsMethodHash:
+		var chainId uint64
+		validators := make([]types.Address, 0)
+		err := util.ExtractParam(input[len(methodHash):], &chainId, &validators)
+		if err != nil {
+			return nil, err
+		}
+		return nil, relay.SetValidators(caller, chainId, validators)
+	case getValidatorsMethodHash:
+		var chainId uint64
+		err := util.ExtractParam(input[len(methodHash):], &chainId)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(relay.Validators(chainId))
+	case setBridgeMethodHash:
+		var chainId uint64
+		var bridge types.Address
+		err := util.ExtractParam(input[len(methodHash):], &chainId, &bridge)
+		if err != nil {
+			return nil, err
+		}
+		return nil, relay.SetBridge(caller, chainId, bridge)
+	case getBridgeMethodHash:
+		var chainId uint64
+		err := util.ExtractParam(input[len(methodHash):], &chainId)
+		if err != nil {
+			return nil, err
+		}
+		bridge, err := relay.Bridge(chainId)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(bridge)
+	case transferGovernorMethodHash:
+		var governor types.Address
+		err := util.ExtractParam(input[len(methodHash):], &governor)
+		if err != nil {
+			return nil, err
+		}
+		return nil, util.NewGovernor(relay.db, HeaderRelayAddr).Transfer(caller, governor)
+	default:
+		return nil, errors.New("unknown method")
+	}
+}
+
+// RelayHeader the source chain block header relayed to the contract. It is not the native block header of the
+// source chain: it has the leading fields of the craft types.Header without the extra and signature data, so its
+// hash keccak256(rlp(RelayHeader)) differs from the source block hash, and it is this hash the validators sign.
+// TxRoot is the root of the merkle tree verified by VerifyMerkleProof over the raw encoded transactions of the block.
+type RelayHeader struct {
+	ChainID       uint64
+	PrevBlockHash types.Hash
+	StateRoot     types.Hash
+	TxRoot        types.Hash
+	ReceiptsRoot  types.Hash
+	Height        uint64
+	Timestamp     uint64
+	CoinBase      types.Address
+}
+
+// DecodeRelayHeader decode the rlp encoded header
+func DecodeRelayHeader(data []byte) (*RelayHeader, error) {
+	header := new(RelayHeader)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// Hash return the hash of the header
+func (this *RelayHeader) Hash() types.Hash {
+	data, _ := rlp.EncodeToBytes(this)
+	var hash types.Hash
+	copy(hash[:], crypto.Keccak256(data))
+	return hash
+}
+
+// HeaderRelayContract stores the source chain headers signed by the quorum of the source chain validators,
+// so that the cross chain transactions can be verified against the headers instead of trusting the rpc node.
+// It is a custom attestation scheme rather than a light client: the validators sign the RelayHeader hash, not
+// the native block, and the transactions are proved against the custom merkle tree of VerifyMerkleProof, so the
+// source chain must commit that tree in TxRoot. The bridge contract address of each source chain is recorded too.
+type HeaderRelayContract struct {
+	db *repository.Repository
+}
+
+// NewHeaderRelayContract create a new instance
+func NewHeaderRelayContract(db *repository.Repository) *HeaderRelayContract {
+	return &HeaderRelayContract{
+		db: db,
+	}
+}
+
+// SetupGenesis record the governor, the initial validators and bridge addresses of the source chains in the genesis state
+func SetupGenesis(db *repository.Repository, governor types.Address, validators map[uint64][]types.Address, bridges map[uint64]types.Address) error {
+	if err := util.NewGovernor(db, HeaderRelayAddr).Set(governor); err != nil {
+		return err
+	}
+	for chainId, chainValidators := range validators {
+		if err := putValidators(db, chainId, chainValidators); err != nil {
+			return err
+		}
+	}
+	for chainId, bridge := range bridges {
+		if err := db.Put(bridgeKey(chainId), bridge[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubmitHeader store the rlp encoded source chain header, signatures are the [R || S || V] signatures of
+// the header hash, more than 2/3 of the validators recorded for the source chain must sign the header.
+func (this *HeaderRelayContract) SubmitHeader(data []byte, signatures [][]byte) (types.Hash, error) {
+	header, err := DecodeRelayHeader(data)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	hash := header.Hash()
+	if err = verifyQuorum(hash, signatures, this.Validators(header.ChainID)); err != nil {
+		return types.Hash{}, err
+	}
+
+	if stored, err := this.GetHeader(header.ChainID, header.Height); err == nil {
+		if stored.Hash() != hash {
+			return types.Hash{}, HeaderConflictError
+		}
+		return hash, nil
+	}
+	encoded, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	return hash, this.db.Put(this.headerKey(header.ChainID, header.Height), encoded)
+}
+
+// GetHeader return the relayed header of the source chain at specified height
+func (this *HeaderRelayContract) GetHeader(chainId, height uint64) (*RelayHeader, error) {
+	data, err := this.db.Get(this.headerKey(chainId, height))
+	if err != nil || len(data) == 0 {
+		return nil, HeaderNotFoundError
+	}
+	return DecodeRelayHeader(data)
+}
+
+// VerifyTransaction verify the transaction is included in the source chain block identified by the rlp encoded
+// header, the header must have been relayed and proof is the merkle path of the transaction in the block.
+func (this *HeaderRelayContract) VerifyTransaction(data []byte, tx []byte, index uint64, proof []types.Hash) (*RelayHeader, error) {
+	header, err := DecodeRelayHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := this.GetHeader(header.ChainID, header.Height)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Hash() != header.Hash() {
+		return nil, HeaderMismatchError
+	}
+	if !VerifyMerkleProof(header.TxRoot, tx, index, proof) {
+		return nil, InvalidMerkleProofError
+	}
+	return header, nil
+}
+
+// Validators return the validators of the source chain recorded in the contract state
+func (this *HeaderRelayContract) Validators(chainId uint64) []types.Address {
+	validators := make([]types.Address, 0)
+	data, err := this.db.Get(validatorsKey(chainId))
+	if err != nil || len(data) == 0 {
+		return validators
+	}
+	if err = rlp.DecodeBytes(data, &validators); err != nil {
+		return []types.Address{}
+	}
+	return validators
+}
+
+// SetValidators replace the validators of the source chain, only the governor can change them
+func (this *HeaderRelayContract) SetValidators(caller types.Address, chainId uint64, validators []types.Address) error {
+	if err := util.NewGovernor(this.db, HeaderRelayAddr).Check(caller); err != nil {
+		return err
+	}
+	return putValidators(this.db, chainId, validators)
+}
+
+// Bridge return the address of the bridge contract receiving the cross chain transfers on the source chain
+func (this *HeaderRelayContract) Bridge(chainId uint64) (types.Address, error) {
+	var bridge types.Address
+	val, err := this.db.Get(bridgeKey(chainId))
+	if err != nil || len(val) != len(bridge) {
+		return types.Address{}, BridgeNotDefinedError
+	}
+	copy(bridge[:], val)
+	return bridge, nil
+}
+
+// SetBridge set the bridge contract address of the source chain, only the governor can change it
+func (this *HeaderRelayContract) SetBridge(caller types.Address, chainId uint64, bridge types.Address) error {
+	if err := util.NewGovernor(this.db, HeaderRelayAddr).Check(caller); err != nil {
+		return err
+	}
+	return this.db.Put(bridgeKey(chainId), bridge[:])
+}
+
+func (this *HeaderRelayContract) Address() types.Address {
+	return HeaderRelayAddr
+}
+
+// return the storage key of the header
+func (this *HeaderRelayContract) headerKey(chainId, height uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], chainId)
+	binary.BigEndian.PutUint64(key[8:], height)
+	return util.Hash(append([]byte(headerRelayKey), key...))
+}
+
+// return the storage key of the source chain validators
+func validatorsKey(chainId uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, chainId)
+	return util.Hash(append([]byte(relayValidatorsKey), key...))
+}
+
+// return the storage key of the source chain bridge address
+func bridgeKey(chainId uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, chainId)
+	return util.Hash(append([]byte(relayBridgeKey), key...))
+}
+
+// record the validators of the source chain in the contract state
+func putValidators(db *repository.Repository, chainId uint64, validators []types.Address) error {
+	val, err := rlp.EncodeToBytes(validators)
+	if err != nil {
+		return err
+	}
+	return db.Put(validatorsKey(chainId), val)
+}
+
+// VerifyMerkleProof verify the leaf is at index of the binary merkle tree with root. The leaf hash is
+// keccak256(0x00 || leaf), the parent hash is keccak256(0x01 || left || right), proof is the sibling hashes
+// from the leaf level to the root. The tree of a single leaf has the leaf hash as root and an empty proof.
+func VerifyMerkleProof(root types.Hash, leaf []byte, index uint64, proof []types.Hash) bool {
+	if len(proof) < 64 && index>>uint(len(proof)) != 0 {
+		return false
+	}
+	hash := MerkleLeafHash(leaf)
+	for _, sibling := range proof {
+		if index&1 == 0 {
+			hash = MerkleNodeHash(hash, sibling)
+		} else {
+			hash = MerkleNodeHash(sibling, hash)
+		}
+		index >>= 1
+	}
+	return hash == root
+}
+
+// MerkleLeafHash return the hash of the leaf in the merkle tree verified by VerifyMerkleProof
+func MerkleLeafHash(leaf []byte) types.Hash {
+	var hash types.Hash
+	copy(hash[:], crypto.Keccak256([]byte{merkleLeafPrefix}, leaf))
+	return hash
+}
+
+// MerkleNodeHash return the hash of the inner node in the merkle tree verified by VerifyMerkleProof
+func MerkleNodeHash(left, right types.Hash) types.Hash {
+	var hash types.Hash
+	copy(hash[:], crypto.Keccak256([]byte{merkleNodePrefix}, left[:], right[:]))
+	return hash
+}
+
+// check more than 2/3 of the validators signed the hash
+func verifyQuorum(hash types.Hash, signatures [][]byte, validators []types.Address) error {
+	if len(validators) == 0 {
+		return NoValidatorsDefinedError
+	}
+	signed := make(map[types.Address]bool)
+	for _, sig := range signatures {
+		signer, err := recoverSigner(hash, sig)
+		if err != nil {
+			continue
+		}
+		for _, validator := range validators {
+			if validator == signer {
+				signed[signer] = true
+			}
+		}
+	}
+	if 3*len(signed) <= 2*len(validators) {
+		return InsufficientQuorumError
+	}
+	return nil
+}
+
+// recover the address signing the hash
+func recoverSigner(hash types.Hash, signature []byte) (types.Address, error) {
+	if len(signature) != 65 {
+		return types.Address{}, errors.New("invalid signature length")
+	}
+	sig := make([]byte, 65)
+	copy(sig, signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pubKey, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil || len(pubKey) == 0 {
+		return types.Address{}, errors.New("invalid signature")
+	}
+	var signer types.Address
+	copy(signer[:], crypto.Keccak256(pubKey[1:])[12:])
+	return signer, nil
+}
@@ -0,0 +1,208 @@
+package Interaction
+
+import (
+	"crypto/ecdsa"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var relayGovernor = types.Address{0x9}
+
+// record n validators of chain 2 in the genesis state
+func mockValidators(t *testing.T, db *repository.Repository, n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, 0, n)
+	validators := make([]types.Address, 0, n)
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		validators = append(validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	if err := SetupGenesis(db, relayGovernor, map[uint64][]types.Address{2: validators}, map[uint64]types.Address{2: {0x2}}); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func signHeader(header *RelayHeader, keys ...*ecdsa.PrivateKey) [][]byte {
+	hash := header.Hash()
+	signatures := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		sig, _ := crypto.Sign(hash[:], key)
+		sig[64] += 27
+		signatures = append(signatures, sig)
+	}
+	return signatures
+}
+
+func TestHeaderRelayContract_SubmitHeader(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockCrossChainDB()
+	keys := mockValidators(t, db, 4)
+	relay := NewHeaderRelayContract(db)
+	assert.Equal(HeaderRelayAddr, relay.Address())
+
+	header := &RelayHeader{ChainID: 2, Height: 10, TxRoot: types.Hash{0x1}}
+	data, _ := rlp.EncodeToBytes(header)
+	_, err := relay.SubmitHeader(data, signHeader(header, keys[0], keys[1]))
+	assert.Equal(InsufficientQuorumError, err)
+	_, err = relay.SubmitHeader(data, signHeader(header, keys[0], keys[1], keys[1]))
+	assert.Equal(InsufficientQuorumError, err)
+	_, err = relay.GetHeader(2, 10)
+	assert.Equal(HeaderNotFoundError, err)
+
+	hash, err := relay.SubmitHeader(data, signHeader(header, keys[0], keys[1], keys[2]))
+	assert.Nil(err)
+	assert.Equal(header.Hash(), hash)
+	stored, err := relay.GetHeader(2, 10)
+	assert.Nil(err)
+	assert.Equal(header, stored)
+
+	// resubmitting is a no-op, but a different header at the same height is rejected
+	_, err = relay.SubmitHeader(data, signHeader(header, keys[1], keys[2], keys[3]))
+	assert.Nil(err)
+	forked := &RelayHeader{ChainID: 2, Height: 10, TxRoot: types.Hash{0x2}}
+	forkedData, _ := rlp.EncodeToBytes(forked)
+	_, err = relay.SubmitHeader(forkedData, signHeader(forked, keys...))
+	assert.Equal(HeaderConflictError, err)
+
+	// the chain has no validators
+	noValidators := &RelayHeader{ChainID: 1, Height: 10}
+	noValidatorsData, _ := rlp.EncodeToBytes(noValidators)
+	_, err = relay.SubmitHeader(noValidatorsData, signHeader(noValidators, keys...))
+	assert.Equal(NoValidatorsDefinedError, err)
+}
+
+func TestHeaderRelayContract_SetValidators(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockCrossChainDB()
+	keys := mockValidators(t, db, 1)
+	relay := NewHeaderRelayContract(db)
+	assert.Equal([]types.Address{crypto.PubkeyToAddress(keys[0].PublicKey)}, relay.Validators(2))
+	assert.Equal([]types.Address{}, relay.Validators(3))
+
+	// only the governor can change the validators
+	validators := []types.Address{{0x1}, {0x2}}
+	input, _ := util.EncodeReturnValue(uint64(3), validators)
+	setValidators := append(util.ExtractMethodHash(util.Hash([]byte("setValidators(uint64,address[])"))), input...)
+	_, err := HeaderRelayExecute(relay, types.Address{0x1}, setValidators)
+	assert.Equal(util.NotGovernorError, err)
+	_, err = HeaderRelayExecute(relay, relayGovernor, setValidators)
+	assert.Nil(err)
+
+	input, _ = util.EncodeReturnValue(uint64(3))
+	ret, err := HeaderRelayExecute(relay, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("getValidators(uint64)"))), input...))
+	assert.Nil(err)
+	stored := make([]types.Address, 0)
+	assert.Nil(util.ExtractParam(ret, &stored))
+	assert.Equal(validators, stored)
+
+	input, _ = util.EncodeReturnValue(types.Address{0x1})
+	_, err = HeaderRelayExecute(relay, relayGovernor, append(util.ExtractMethodHash(util.Hash([]byte("transferGovernor(address)"))), input...))
+	assert.Nil(err)
+	assert.Equal(util.NotGovernorError, relay.SetValidators(relayGovernor, 3, nil))
+	assert.Nil(relay.SetValidators(types.Address{0x1}, 3, nil))
+	assert.Equal([]types.Address{}, relay.Validators(3))
+}
+
+func TestHeaderRelayContract_SetBridge(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockCrossChainDB()
+	mockValidators(t, db, 1)
+	relay := NewHeaderRelayContract(db)
+	bridge, err := relay.Bridge(2)
+	assert.Nil(err)
+	assert.Equal(types.Address{0x2}, bridge)
+	_, err = relay.Bridge(3)
+	assert.Equal(BridgeNotDefinedError, err)
+
+	// only the governor can change the bridge
+	input, _ := util.EncodeReturnValue(uint64(3), types.Address{0x3})
+	setBridge := append(util.ExtractMethodHash(util.Hash([]byte("setBridge(uint64,address)"))), input...)
+	_, err = HeaderRelayExecute(relay, types.Address{0x1}, setBridge)
+	assert.Equal(util.NotGovernorError, err)
+	assert.False(IsHeaderRelayViewMethod(setBridge))
+	_, err = HeaderRelayExecute(relay, relayGovernor, setBridge)
+	assert.Nil(err)
+
+	input, _ = util.EncodeReturnValue(uint64(3))
+	getBridge := append(util.ExtractMethodHash(util.Hash([]byte("getBridge(uint64)"))), input...)
+	assert.True(IsHeaderRelayViewMethod(getBridge))
+	ret, err := HeaderRelayExecute(relay, types.Address{0x1}, getBridge)
+	assert.Nil(err)
+	assert.Nil(util.ExtractParam(ret, &bridge))
+	assert.Equal(types.Address{0x3}, bridge)
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	assert := assert.New(t)
+	leaves := [][]byte{[]byte("tx0"), []byte("tx1"), []byte("tx2"), []byte("tx3")}
+	hashes := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, crypto.Keccak256([]byte{0x00}, leaf))
+	}
+	left, right := crypto.Keccak256([]byte{0x01}, hashes[0], hashes[1]), crypto.Keccak256([]byte{0x01}, hashes[2], hashes[3])
+	var root, h1, h2, hLeft, hRight types.Hash
+	copy(root[:], crypto.Keccak256([]byte{0x01}, left, right))
+	copy(h1[:], hashes[1])
+	copy(h2[:], hashes[2])
+	copy(hLeft[:], left)
+	copy(hRight[:], right)
+
+	assert.True(VerifyMerkleProof(root, leaves[3], 3, []types.Hash{h2, hLeft}))
+	assert.False(VerifyMerkleProof(root, leaves[3], 2, []types.Hash{h2, hLeft}))
+	assert.False(VerifyMerkleProof(root, leaves[3], 7, []types.Hash{h2, hLeft}))
+	assert.False(VerifyMerkleProof(root, leaves[0], 3, []types.Hash{h2, hLeft}))
+	assert.False(VerifyMerkleProof(root, leaves[0], 0, []types.Hash{h1}))
+
+	// the inner node can't be proved as a leaf
+	innerLeaf := append(append([]byte{}, hLeft[:]...), hRight[:]...)
+	assert.False(VerifyMerkleProof(root, innerLeaf, 0, []types.Hash{}))
+	assert.True(VerifyMerkleProof(MerkleLeafHash(leaves[0]), leaves[0], 0, []types.Hash{}))
+}
+
+func TestHeaderRelayContract_VerifyTransaction(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockCrossChainDB()
+	keys := mockValidators(t, db, 1)
+	relay := NewHeaderRelayContract(db)
+
+	tx, sibling := []byte("tx0"), types.Hash{0x1}
+	header := &RelayHeader{ChainID: 2, Height: 10}
+	header.TxRoot = MerkleNodeHash(MerkleLeafHash(tx), sibling)
+	data, _ := rlp.EncodeToBytes(header)
+	_, err := relay.VerifyTransaction(data, tx, 0, []types.Hash{sibling})
+	assert.Equal(HeaderNotFoundError, err)
+
+	input, _ := util.EncodeReturnValue(data, signHeader(header, keys[0]))
+	_, err = HeaderRelayExecute(relay, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("submitHeader(bytes,bytes[])"))), input...))
+	assert.Nil(err)
+	verified, err := relay.VerifyTransaction(data, tx, 0, []types.Hash{sibling})
+	assert.Nil(err)
+	assert.Equal(header, verified)
+	_, err = relay.VerifyTransaction(data, []byte("tx1"), 0, []types.Hash{sibling})
+	assert.Equal(InvalidMerkleProofError, err)
+
+	// the header must be the relayed one
+	fake := &RelayHeader{ChainID: 2, Height: 10, TxRoot: types.Hash{0x2}}
+	fakeData, _ := rlp.EncodeToBytes(fake)
+	_, err = relay.VerifyTransaction(fakeData, tx, 0, []types.Hash{sibling})
+	assert.Equal(HeaderMismatchError, err)
+
+	input, _ = util.EncodeReturnValue(uint64(2), uint64(10))
+	ret, err := HeaderRelayExecute(relay, types.Address{0x1}, append(util.ExtractMethodHash(util.Hash([]byte("getHeader(uint64,uint64)"))), input...))
+	assert.Nil(err)
+	var hash, txRoot, receiptsRoot types.Hash
+	assert.Nil(util.ExtractParam(ret, &hash, &txRoot, &receiptsRoot))
+	assert.Equal(header.Hash(), hash)
+	assert.Equal(header.TxRoot, txRoot)
+}
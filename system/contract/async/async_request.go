@@ -0,0 +1,341 @@
+package async
+
+import (
+	"encoding/binary"
+	"github.com/DSiSc/craft/types"
+	cutil "github.com/DSiSc/crypto-suite/util"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+var AsyncRequestAddr = cutil.HexToAddress("0000000000000000000000000000000000011000")
+
+const (
+	asyncRequestKey   = "AsyncRequestKey"
+	asyncNextIdKey    = "AsyncNextIdKey"
+	asyncFulfillerKey = "AsyncFulfillerKey"
+)
+
+// CallbackGas gas limit of the callback into the requesting contract, it is recorded in the request when submitted.
+// The callback gas is charged from the gas of the fulfill call delivering the result, and the unused gas is returned to it.
+const CallbackGas uint64 = 200000
+
+// request status
+const (
+	// Pending the request is waiting for the result
+	Pending uint64 = iota
+	// Fulfilled the result has been delivered
+	Fulfilled
+	// Failed the request failed off-chain, the error message has been delivered
+	Failed
+)
+
+var (
+	submitMethodHash           = string(util.ExtractMethodHash(util.Hash([]byte("submit(string,bytes,bytes4)"))))
+	fulfillMethodHash          = string(util.ExtractMethodHash(util.Hash([]byte("fulfill(uint64,bytes,string)"))))
+	getRequestMethodHash       = string(util.ExtractMethodHash(util.Hash([]byte("getRequest(uint64)"))))
+	setFulfillerMethodHash     = string(util.ExtractMethodHash(util.Hash([]byte("setFulfiller(address)"))))
+	transferGovernorMethodHash = string(util.ExtractMethodHash(util.Hash([]byte("transferGovernor(address)"))))
+)
+
+var (
+	// RequestSubmittedEvent emitted when a request is submitted, the node watches it to process the requests
+	RequestSubmittedEvent = util.MustNewEvent("RequestSubmitted(uint64 indexed id,address indexed caller,string op,bytes params)")
+	// RequestFulfilledEvent emitted when the result of a request is delivered
+	RequestFulfilledEvent = util.MustNewEvent("RequestFulfilled(uint64 indexed id,uint64 status)")
+)
+
+// AsyncABI abi metadata of the async request contract
+var AsyncABI = &util.ABI{
+	Methods: []*util.Method{
+		util.MustNewMethod("submit(string op,bytes params,bytes4 callback)", "uint64"),
+		util.MustNewMethod("fulfill(uint64 id,bytes result,string errMsg)", "bool"),
+		util.MustNewMethod("getRequest(uint64 id)", "address", "string", "uint64", "bytes"),
+		util.MustNewMethod("setFulfiller(address fulfiller)"),
+		util.MustNewMethod("transferGovernor(address governor)"),
+	},
+	Events: []*util.Event{RequestSubmittedEvent, RequestFulfilledEvent},
+}
+
+var (
+	RequestNotFoundError     = errors.New("async request not found")
+	RequestFulfilledError    = errors.New("async request has been fulfilled")
+	PermissionDeniedError    = errors.New("only the fulfiller can deliver the results")
+	FulfillerNotDefinedError = errors.New("async request fulfiller is not defined")
+)
+
+// CallbackFunc call back into the requesting contract with the input and the callback gas, return the unused gas
+type CallbackFunc func(to types.Address, input []byte, gas uint64) (uint64, error)
+
+// RequiredGas return the gas charged before executing the contract with input, submitting a request pays
+// for the request storage.
+func RequiredGas(input []byte) uint64 {
+	if string(util.ExtractMethodHash(input)) != submitMethodHash {
+		return 0
+	}
+	words := (uint64(len(input)) + 31) / 32
+	gas, overflow := math.SafeMul(words, params.SstoreSetGas)
+	if overflow {
+		return math.MaxUint64
+	}
+	return gas
+}
+
+// IsViewMethod check the method called with input doesn't modify the state
+func IsViewMethod(input []byte) bool {
+	return string(util.ExtractMethodHash(input)) == getRequestMethodHash
+}
+
+// execute the async request contract, caller is the address calling the contract,
+// gas is the meter of the call paying for the callback gas of the fulfilled request
+func AsyncExecute(async *AsyncRequestContract, caller types.Address, input []byte, gas *util.GasMeter, callback CallbackFunc) ([]byte, error) {
+	methodHash := util.ExtractMethodHash(input)
+	switch string(methodHash) {
+	case submitMethodHash:
+		op := new(string)
+		params := make([]byte, 0)
+		var selector [4]byte
+		err := util.ExtractParam(input[len(methodHash):], op, &params, &selector)
+		if err != nil {
+			return nil, err
+		}
+		id, err := async.Submit(caller, *op, params, selector)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(id)
+	case fulfillMethodHash:
+		var id uint64
+		result := make([]byte, 0)
+		errMsg := new(string)
+		err := util.ExtractParam(input[len(methodHash):], &id, &result, errMsg)
+		if err != nil {
+			return nil, err
+		}
+		request, err := async.Fulfill(caller, id, result, *errMsg)
+		if err != nil {
+			return nil, err
+		}
+		// the result is recorded even if the callback fails, so that the request is never delivered twice
+		callbackInput, err := request.CallbackInput()
+		if err != nil {
+			return nil, err
+		}
+		if err = gas.UseGas(request.CallbackGas); err != nil {
+			return nil, err
+		}
+		leftOver, err := callback(request.Caller, callbackInput, request.CallbackGas)
+		gas.RefundGas(leftOver)
+		return util.EncodeReturnValue(err == nil)
+	case getRequestMethodHash:
+		var id uint64
+		err := util.ExtractParam(input[len(methodHash):], &id)
+		if err != nil {
+			return nil, err
+		}
+		request, err := async.GetRequest(id)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(request.Caller, request.Op, request.Status, request.Result)
+	case setFulfillerMethodHash:
+		var fulfiller types.Address
+		err := util.ExtractParam(input[len(methodHash):], &fulfiller)
+		if err != nil {
+			return nil, err
+		}
+		return nil, async.SetFulfiller(caller, fulfiller)
+	case transferGovernorMethodHash:
+		var governor types.Address
+		err := util.ExtractParam(input[len(methodHash):], &governor)
+		if err != nil {
+			return nil, err
+		}
+		return nil, util.NewGovernor(async.db, AsyncRequestAddr).Transfer(caller, governor)
+	default:
+		return nil, errors.New("unknown method")
+	}
+}
+
+// SetupGenesis record the governor and the fulfiller in the genesis state
+func SetupGenesis(db *repository.Repository, governor types.Address, fulfiller types.Address) error {
+	if err := util.NewGovernor(db, AsyncRequestAddr).Set(governor); err != nil {
+		return err
+	}
+	return db.Put(util.Hash([]byte(asyncFulfillerKey)), fulfiller[:])
+}
+
+// Request the off-chain request submitted by contract
+type Request struct {
+	Id     uint64
+	Caller types.Address
+	// Op name of the off-chain handler processing the request
+	Op     string
+	Params []byte
+	// Callback selector of the requesting contract method receiving the result,
+	// which is called as `callback(uint64 id, bool ok, bytes result)`
+	Callback [4]byte
+	// CallbackGas gas limit of the callback, paid by the fulfill call
+	CallbackGas uint64
+	Status      uint64
+	Result      []byte
+	BlockNumber uint64
+}
+
+// CallbackInput return the input calling back into the requesting contract, result is the error message
+// if the request failed.
+func (this *Request) CallbackInput() ([]byte, error) {
+	args, err := util.EncodeReturnValue(this.Id, this.Status == Fulfilled, this.Result)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, this.Callback[:]...), args...), nil
+}
+
+// AsyncRequestContract keeps the off-chain requests submitted by contracts. The requests are processed by the node
+// outside the execution, and the results are delivered by the later system transactions calling `fulfill`,
+// so the execution is never blocked by the network I/O.
+type AsyncRequestContract struct {
+	db          *repository.Repository
+	blockNumber uint64
+	emitter     util.EventEmitter
+}
+
+// NewAsyncRequestContract create a new instance.
+// blockNumber: number of the block being executed
+// emitter: emitter of the RequestSubmitted and RequestFulfilled events, no event is emitted if it is nil
+func NewAsyncRequestContract(db *repository.Repository, blockNumber uint64, emitter util.EventEmitter) *AsyncRequestContract {
+	return &AsyncRequestContract{
+		db:          db,
+		blockNumber: blockNumber,
+		emitter:     emitter,
+	}
+}
+
+// Submit record the request and return its id
+func (this *AsyncRequestContract) Submit(caller types.Address, op string, params []byte, callback [4]byte) (uint64, error) {
+	id := this.nextId()
+	request := &Request{
+		Id:          id,
+		Caller:      caller,
+		Op:          op,
+		Params:      params,
+		Callback:    callback,
+		CallbackGas: CallbackGas,
+		Status:      Pending,
+		Result:      []byte{},
+		BlockNumber: this.blockNumber,
+	}
+	if err := this.saveRequest(request); err != nil {
+		return 0, err
+	}
+	if err := this.db.Put(this.nextIdKey(), encodeUint64(id+1)); err != nil {
+		return 0, err
+	}
+	if err := RequestSubmittedEvent.Emit(this.emitter, AsyncRequestAddr, id, caller, op, params); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Fulfill record the result of the pending request, the request failed if errMsg is not empty
+func (this *AsyncRequestContract) Fulfill(caller types.Address, id uint64, result []byte, errMsg string) (*Request, error) {
+	fulfiller, ok := this.Fulfiller()
+	if !ok {
+		return nil, FulfillerNotDefinedError
+	}
+	if caller != fulfiller {
+		return nil, PermissionDeniedError
+	}
+	request, err := this.GetRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != Pending {
+		return nil, RequestFulfilledError
+	}
+	if len(errMsg) > 0 {
+		request.Status, request.Result = Failed, []byte(errMsg)
+	} else {
+		request.Status, request.Result = Fulfilled, result
+	}
+	if err = this.saveRequest(request); err != nil {
+		return nil, err
+	}
+	if err = RequestFulfilledEvent.Emit(this.emitter, AsyncRequestAddr, id, request.Status); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetRequest return the request with specified id
+func (this *AsyncRequestContract) GetRequest(id uint64) (*Request, error) {
+	data, err := this.db.Get(this.requestKey(id))
+	if err != nil || len(data) == 0 {
+		return nil, RequestNotFoundError
+	}
+	request := new(Request)
+	if err = rlp.DecodeBytes(data, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Fulfiller return the account delivering the results recorded in the contract state, ok is false if it is not defined
+func (this *AsyncRequestContract) Fulfiller() (fulfiller types.Address, ok bool) {
+	val, err := this.db.Get(util.Hash([]byte(asyncFulfillerKey)))
+	if err != nil || len(val) != len(fulfiller) {
+		return types.Address{}, false
+	}
+	copy(fulfiller[:], val)
+	return fulfiller, fulfiller != types.Address{}
+}
+
+// SetFulfiller replace the fulfiller, only the governor can change it
+func (this *AsyncRequestContract) SetFulfiller(caller types.Address, fulfiller types.Address) error {
+	if err := util.NewGovernor(this.db, AsyncRequestAddr).Check(caller); err != nil {
+		return err
+	}
+	return this.db.Put(util.Hash([]byte(asyncFulfillerKey)), fulfiller[:])
+}
+
+func (this *AsyncRequestContract) Address() types.Address {
+	return AsyncRequestAddr
+}
+
+// return the id of the next request, id starts from 1
+func (this *AsyncRequestContract) nextId() uint64 {
+	val, err := this.db.Get(this.nextIdKey())
+	if err != nil || len(val) != 8 {
+		return 1
+	}
+	return binary.BigEndian.Uint64(val)
+}
+
+func (this *AsyncRequestContract) saveRequest(request *Request) error {
+	data, err := rlp.EncodeToBytes(request)
+	if err != nil {
+		return err
+	}
+	return this.db.Put(this.requestKey(request.Id), data)
+}
+
+// return the storage key of the request
+func (this *AsyncRequestContract) requestKey(id uint64) []byte {
+	return util.Hash(append([]byte(asyncRequestKey), encodeUint64(id)...))
+}
+
+// return the storage key of the next request id
+func (this *AsyncRequestContract) nextIdKey() []byte {
+	return util.Hash([]byte(asyncNextIdKey))
+}
+
+func encodeUint64(val uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, val)
+	return data
+}
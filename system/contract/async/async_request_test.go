@@ -0,0 +1,201 @@
+package async
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+var (
+	mockCaller    = types.Address{0x1}
+	mockFulfiller = types.Address{0x2}
+	mockGovernor  = types.Address{0x3}
+	mockCallback  = [4]byte{0x1, 0x2, 0x3, 0x4}
+)
+
+func mockAsyncDB() *repository.Repository {
+	db := &repository.Repository{}
+	cache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return cache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		cache[string(key)] = value
+		return nil
+	})
+	return db
+}
+
+// emitter recording the logs
+func mockEmitter() (util.EventEmitter, *[]*types.Log) {
+	logs := make([]*types.Log, 0)
+	emitter := func(address types.Address, topics []types.Hash, data []byte) {
+		logs = append(logs, &types.Log{Address: address, Topics: topics, Data: data})
+	}
+	return emitter, &logs
+}
+
+// async request contract with the governor and fulfiller recorded in genesis state
+func mockAsyncContract(t *testing.T) (*AsyncRequestContract, *[]*types.Log) {
+	db := mockAsyncDB()
+	if err := SetupGenesis(db, mockGovernor, mockFulfiller); err != nil {
+		t.Fatal(err)
+	}
+	emitter, logs := mockEmitter()
+	return NewAsyncRequestContract(db, 10, emitter), logs
+}
+
+func TestAsyncRequestContract_Fulfill(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	async, logs := mockAsyncContract(t)
+	assert.Equal(AsyncRequestAddr, async.Address())
+	id, err := async.Submit(mockCaller, "price", []byte("BTC"), mockCallback)
+	assert.Nil(err)
+	assert.Equal(uint64(1), id)
+	id, err = async.Submit(mockCaller, "price", []byte("ETH"), mockCallback)
+	assert.Nil(err)
+	assert.Equal(uint64(2), id)
+	assert.Equal(2, len(*logs))
+
+	request, err := async.GetRequest(1)
+	assert.Nil(err)
+	assert.Equal(Pending, request.Status)
+	assert.Equal([]byte("BTC"), request.Params)
+	assert.Equal(uint64(10), request.BlockNumber)
+	assert.Equal(CallbackGas, request.CallbackGas)
+
+	_, err = async.Fulfill(mockCaller, 1, []byte("100"), "")
+	assert.Equal(PermissionDeniedError, err)
+	request, err = async.Fulfill(mockFulfiller, 1, []byte("100"), "")
+	assert.Nil(err)
+	assert.Equal(Fulfilled, request.Status)
+	assert.Equal([]byte("100"), request.Result)
+	assert.Equal(3, len(*logs))
+	assert.Equal(RequestFulfilledEvent.Id(), (*logs)[2].Topics[0])
+
+	_, err = async.Fulfill(mockFulfiller, 1, []byte("100"), "")
+	assert.Equal(RequestFulfilledError, err)
+
+	request, err = async.Fulfill(mockFulfiller, 2, nil, "not found")
+	assert.Nil(err)
+	assert.Equal(Failed, request.Status)
+	assert.Equal([]byte("not found"), request.Result)
+
+	_, err = async.Fulfill(mockFulfiller, 3, nil, "")
+	assert.Equal(RequestNotFoundError, err)
+}
+
+func TestAsyncRequestContract_FulfillerNotDefined(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	async := NewAsyncRequestContract(mockAsyncDB(), 10, nil)
+	id, err := async.Submit(mockCaller, "price", []byte("BTC"), mockCallback)
+	assert.Nil(err)
+	_, err = async.Fulfill(types.Address{}, id, nil, "")
+	assert.Equal(FulfillerNotDefinedError, err)
+}
+
+func TestAsyncRequestContract_SetFulfiller(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	async, _ := mockAsyncContract(t)
+	fulfiller, ok := async.Fulfiller()
+	assert.True(ok)
+	assert.Equal(mockFulfiller, fulfiller)
+
+	// only the governor can replace the fulfiller
+	args, _ := util.EncodeReturnValue(mockCaller)
+	setFulfiller := append([]byte(setFulfillerMethodHash), args...)
+	_, err := AsyncExecute(async, mockFulfiller, setFulfiller, nil, nil)
+	assert.Equal(util.NotGovernorError, err)
+	_, err = AsyncExecute(async, mockGovernor, setFulfiller, nil, nil)
+	assert.Nil(err)
+	fulfiller, _ = async.Fulfiller()
+	assert.Equal(mockCaller, fulfiller)
+
+	id, _ := async.Submit(mockCaller, "price", []byte("BTC"), mockCallback)
+	_, err = async.Fulfill(mockFulfiller, id, nil, "")
+	assert.Equal(PermissionDeniedError, err)
+	_, err = async.Fulfill(mockCaller, id, nil, "")
+	assert.Nil(err)
+
+	args, _ = util.EncodeReturnValue(mockCaller)
+	_, err = AsyncExecute(async, mockGovernor, append([]byte(transferGovernorMethodHash), args...), nil, nil)
+	assert.Nil(err)
+	assert.Equal(util.NotGovernorError, async.SetFulfiller(mockGovernor, mockFulfiller))
+}
+
+func TestRequiredGas(t *testing.T) {
+	assert := assert.New(t)
+	args, _ := util.EncodeReturnValue("price", []byte("BTC"), mockCallback)
+	input := append([]byte(submitMethodHash), args...)
+	words := (uint64(len(input)) + 31) / 32
+	assert.Equal(words*20000, RequiredGas(input))
+
+	args, _ = util.EncodeReturnValue(uint64(1))
+	assert.Equal(uint64(0), RequiredGas(append([]byte(getRequestMethodHash), args...)))
+}
+
+func TestAsyncExecute(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	async, logs := mockAsyncContract(t)
+
+	var callbackTo types.Address
+	var callbackInput []byte
+	var callbackGas uint64
+	callback := func(to types.Address, input []byte, gas uint64) (uint64, error) {
+		callbackTo, callbackInput, callbackGas = to, input, gas
+		return 0, nil
+	}
+
+	args, _ := util.EncodeReturnValue("price", []byte("BTC"), mockCallback)
+	ret, err := AsyncExecute(async, mockCaller, append([]byte(submitMethodHash), args...), nil, callback)
+	assert.Nil(err)
+	var id uint64
+	assert.Nil(util.ExtractParam(ret, &id))
+	assert.Equal(uint64(1), id)
+
+	requests := RequestsFromLogs(*logs)
+	assert.Equal(1, len(requests))
+	assert.Equal(id, requests[0].Id)
+	assert.Equal(mockCaller, requests[0].Caller)
+	assert.Equal("price", requests[0].Op)
+	assert.Equal([]byte("BTC"), requests[0].Params)
+
+	input, err := (&Response{Id: id, Result: []byte("100")}).FulfillInput()
+	assert.Nil(err)
+	ret, err = AsyncExecute(async, mockFulfiller, input, nil, callback)
+	assert.Nil(err)
+	var ok bool
+	assert.Nil(util.ExtractParam(ret, &ok))
+	assert.True(ok)
+	assert.Equal(mockCaller, callbackTo)
+	assert.Equal(CallbackGas, callbackGas)
+	assert.Equal(mockCallback[:], callbackInput[:4])
+	var callbackId uint64
+	var success bool
+	result := make([]byte, 0)
+	assert.Nil(util.ExtractParam(callbackInput[4:], &callbackId, &success, &result))
+	assert.Equal(id, callbackId)
+	assert.True(success)
+	assert.Equal([]byte("100"), result)
+
+	args, _ = util.EncodeReturnValue(id)
+	ret, err = AsyncExecute(async, mockCaller, append([]byte(getRequestMethodHash), args...), nil, callback)
+	assert.Nil(err)
+	var caller types.Address
+	op := new(string)
+	var status uint64
+	result = make([]byte, 0)
+	assert.Nil(util.ExtractParam(ret, &caller, op, &status, &result))
+	assert.Equal(mockCaller, caller)
+	assert.Equal("price", *op)
+	assert.Equal(Fulfilled, status)
+	assert.Equal([]byte("100"), result)
+}
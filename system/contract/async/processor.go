@@ -0,0 +1,217 @@
+package async
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+var (
+	HandlerExistError     = errors.New("async request handler already registered")
+	HandlerNotFoundError  = errors.New("async request handler not found")
+	HandlerTimeoutError   = errors.New("async request handler timeout")
+	SenderNotDefinedError = errors.New("async request fulfill sender is not defined")
+)
+
+// Handler process the params of the off-chain request, it is called outside the execution
+type Handler func(params []byte) ([]byte, error)
+
+var (
+	handlersLock sync.RWMutex
+	handlers     = make(map[string]Handler)
+)
+
+// RegisterHandler register the handler processing the requests with op
+func RegisterHandler(op string, handler Handler) error {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	if handlers[op] != nil {
+		return errors.Wrapf(HandlerExistError, "%s", op)
+	}
+	handlers[op] = handler
+	return nil
+}
+
+// get the handler registered with op
+func getHandler(op string) Handler {
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+	return handlers[op]
+}
+
+// RequestsFromLogs return the requests submitted in the logs of the block
+func RequestsFromLogs(logs []*types.Log) []*Request {
+	requests := make([]*Request, 0)
+	for _, log := range logs {
+		if log.Address != AsyncRequestAddr || len(log.Topics) != 3 || log.Topics[0] != RequestSubmittedEvent.Id() {
+			continue
+		}
+		op := new(string)
+		params := make([]byte, 0)
+		if err := util.ExtractParam(log.Data, op, &params); err != nil {
+			continue
+		}
+		var caller types.Address
+		copy(caller[:], log.Topics[2][12:])
+		requests = append(requests, &Request{
+			Id:          binary.BigEndian.Uint64(log.Topics[1][24:]),
+			Caller:      caller,
+			Op:          *op,
+			Params:      params,
+			Status:      Pending,
+			BlockNumber: log.BlockNumber,
+		})
+	}
+	return requests
+}
+
+// Response the result of the off-chain request, Error is not empty if the request failed
+type Response struct {
+	Id     uint64
+	Result []byte
+	Error  string
+}
+
+// FulfillInput return the input of the system transaction delivering the response to the async request contract
+func (this *Response) FulfillInput() ([]byte, error) {
+	args, err := util.EncodeReturnValue(this.Id, this.Result, this.Error)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fulfillMethodHash), args...), nil
+}
+
+// Processor process the off-chain requests with the registered handlers
+type Processor struct {
+	timeout time.Duration
+}
+
+// NewProcessor create a new processor, the request fails if its handler does not return in timeout
+func NewProcessor(timeout time.Duration) *Processor {
+	return &Processor{
+		timeout: timeout,
+	}
+}
+
+// Process process the requests concurrently, the responses are in the order of the requests
+func (this *Processor) Process(requests []*Request) []*Response {
+	responses := make([]*Response, len(requests))
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request *Request) {
+			defer wg.Done()
+			responses[i] = this.process(request)
+		}(i, request)
+	}
+	wg.Wait()
+	return responses
+}
+
+// process the request with its handler
+func (this *Processor) process(request *Request) *Response {
+	response := &Response{
+		Id:     request.Id,
+		Result: []byte{},
+	}
+	handler := getHandler(request.Op)
+	if handler == nil {
+		response.Error = errors.Wrapf(HandlerNotFoundError, "%s", request.Op).Error()
+		return response
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resultCh <- result{err: fmt.Errorf("handler panic: %v", r)}
+			}
+		}()
+		data, err := handler(request.Params)
+		resultCh <- result{data: data, err: err}
+	}()
+
+	select {
+	case ret := <-resultCh:
+		if ret.err != nil {
+			response.Error = ret.err.Error()
+		} else if ret.data != nil {
+			response.Result = ret.data
+		}
+	case <-time.After(this.timeout):
+		response.Error = HandlerTimeoutError.Error()
+	}
+	return response
+}
+
+// Sender sends the system transaction calling the async request contract with input from the fulfiller account
+type Sender interface {
+	SendFulfill(input []byte) error
+}
+
+// Config node configuration of the async request processing, only the fulfiller node processes the requests
+type Config struct {
+	// Timeout the request fails if its handler does not return in timeout
+	Timeout time.Duration
+	// Sender sends the fulfill transactions, the requests are not processed if it is nil
+	Sender Sender
+}
+
+// DefaultConfig return the default config, which processes no request
+func DefaultConfig() Config {
+	return Config{
+		Timeout: 10 * time.Second,
+	}
+}
+
+var (
+	lock   sync.RWMutex
+	config = DefaultConfig()
+)
+
+// SetConfig set the async request config of the node
+func SetConfig(c Config) {
+	lock.Lock()
+	defer lock.Unlock()
+	config = c
+}
+
+// GetConfig return the async request config of the node
+func GetConfig() Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// ProcessBlockLogs process the requests submitted in the logs of the committed block and deliver the results
+// with the configured sender. The fulfiller node calls it once the block is committed, so that the requests
+// of the discarded blocks are never processed. The first error of sending the results is returned.
+func ProcessBlockLogs(logs []*types.Log) error {
+	c := GetConfig()
+	if c.Sender == nil {
+		return SenderNotDefinedError
+	}
+	requests := RequestsFromLogs(logs)
+	if len(requests) == 0 {
+		return nil
+	}
+	var firstErr error
+	for _, response := range NewProcessor(c.Timeout).Process(requests) {
+		input, err := response.FulfillInput()
+		if err == nil {
+			err = c.Sender.SendFulfill(input)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
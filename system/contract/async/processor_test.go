@@ -0,0 +1,82 @@
+package async
+
+import (
+	"errors"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	assert := assert.New(t)
+	defer delete(handlers, "test-register")
+	handler := func(params []byte) ([]byte, error) {
+		return params, nil
+	}
+	assert.Nil(RegisterHandler("test-register", handler))
+	assert.NotNil(getHandler("test-register"))
+	err := RegisterHandler("test-register", handler)
+	assert.NotNil(err)
+}
+
+func TestProcessor_Process(t *testing.T) {
+	assert := assert.New(t)
+	defer delete(handlers, "test-echo")
+	defer delete(handlers, "test-fail")
+	defer delete(handlers, "test-slow")
+	RegisterHandler("test-echo", func(params []byte) ([]byte, error) {
+		return params, nil
+	})
+	RegisterHandler("test-fail", func(params []byte) ([]byte, error) {
+		return nil, errors.New("failed")
+	})
+	RegisterHandler("test-slow", func(params []byte) ([]byte, error) {
+		time.Sleep(time.Second)
+		return params, nil
+	})
+
+	requests := []*Request{
+		{Id: 1, Op: "test-echo", Params: []byte("hello")},
+		{Id: 2, Op: "test-fail"},
+		{Id: 3, Op: "test-slow"},
+		{Id: 4, Op: "test-unknown"},
+	}
+	responses := NewProcessor(100 * time.Millisecond).Process(requests)
+	assert.Equal(4, len(responses))
+	assert.Equal(&Response{Id: 1, Result: []byte("hello")}, responses[0])
+	assert.Equal(&Response{Id: 2, Result: []byte{}, Error: "failed"}, responses[1])
+	assert.Equal(&Response{Id: 3, Result: []byte{}, Error: HandlerTimeoutError.Error()}, responses[2])
+	assert.Equal(uint64(4), responses[3].Id)
+	assert.Contains(responses[3].Error, HandlerNotFoundError.Error())
+}
+
+// sender recording the fulfill inputs
+type mockSender struct {
+	inputs [][]byte
+}
+
+func (this *mockSender) SendFulfill(input []byte) error {
+	this.inputs = append(this.inputs, input)
+	return nil
+}
+
+func TestProcessBlockLogs(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+	defer delete(handlers, "test-price")
+	RegisterHandler("test-price", func(params []byte) ([]byte, error) {
+		return []byte("100"), nil
+	})
+	emitter, logs := mockEmitter()
+	assert.Nil(RequestSubmittedEvent.Emit(emitter, AsyncRequestAddr, uint64(7), types.Address{0x1}, "test-price", []byte("BTC")))
+	assert.Nil(RequestFulfilledEvent.Emit(emitter, AsyncRequestAddr, uint64(6), Fulfilled))
+
+	assert.Equal(SenderNotDefinedError, ProcessBlockLogs(*logs))
+
+	sender := new(mockSender)
+	SetConfig(Config{Timeout: time.Second, Sender: sender})
+	assert.Nil(ProcessBlockLogs(*logs))
+	expect, _ := (&Response{Id: 7, Result: []byte("100")}).FulfillInput()
+	assert.Equal([][]byte{expect}, sender.inputs)
+}
@@ -1,37 +1,60 @@
 package buffer
 
 import (
+	"errors"
 	"github.com/DSiSc/craft/types"
 	"io"
 )
 
+// SystemBufferReadWriterCloser wrap the system buffer contract as the go io interfaces.
+// Read and Seek use the read cursor persisted in the buffer, so the reading can be resumed by a later instance.
 type SystemBufferReadWriterCloser struct {
 	sysBufferContract *SystemBufferContract
-	cursor            uint64
 }
 
 //NewSystemBufferReadWriterCloser create a new instance
 func NewSystemBufferReadWriterCloser(sysBufferContract *SystemBufferContract) *SystemBufferReadWriterCloser {
 	return &SystemBufferReadWriterCloser{
-		cursor:            0,
 		sysBufferContract: sysBufferContract,
 	}
 }
 
+// Read implements io.Reader, it reads from the persisted cursor and advances it
 func (this *SystemBufferReadWriterCloser) Read(data []byte) (n int, err error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	ret, err := this.sysBufferContract.ReadFromCursor(uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	if len(ret) == 0 {
+		return 0, io.EOF
+	}
+	return copy(data, ret), nil
+}
+
+// ReadAt implements io.ReaderAt, it doesn't change the read cursor
+func (this *SystemBufferReadWriterCloser) ReadAt(data []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
 	totalLen := this.sysBufferContract.Length()
-	if this.cursor >= totalLen {
+	if uint64(off) >= totalLen {
 		return 0, io.EOF
 	}
-	size := uint64(0)
-	if totalLen-this.cursor > uint64(len(data)) {
-		size = uint64(len(data))
-	} else {
-		size = totalLen - this.cursor
+	size := uint64(len(data))
+	if totalLen-uint64(off) < size {
+		size = totalLen - uint64(off)
+	}
+	ret, err := this.sysBufferContract.Read(uint64(off), size)
+	if err != nil {
+		return 0, err
 	}
-	ret, err := this.sysBufferContract.Read(this.cursor, size)
 	n = copy(data, ret)
-	this.cursor += uint64(n)
+	if n < len(data) {
+		return n, io.EOF
+	}
 	return n, nil
 }
 
@@ -40,6 +63,39 @@ func (this *SystemBufferReadWriterCloser) Write(data []byte) (n int, err error)
 	return int(len), err
 }
 
+// WriteAt implements io.WriterAt, off must not be greater than the buffer length
+func (this *SystemBufferReadWriterCloser) WriteAt(data []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	len, err := this.sysBufferContract.WriteAt(uint64(off), data)
+	return int(len), err
+}
+
+// Seek implements io.Seeker, it moves the persisted read cursor
+func (this *SystemBufferReadWriterCloser) Seek(offset int64, whence int) (int64, error) {
+	var base int64
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = int64(this.sysBufferContract.Cursor())
+	case io.SeekEnd:
+		base = int64(this.sysBufferContract.Length())
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	pos := base + offset
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	cursor, err := this.sysBufferContract.Seek(uint64(pos))
+	if err != nil {
+		return 0, err
+	}
+	return int64(cursor), nil
+}
+
 func (this *SystemBufferReadWriterCloser) Close() error {
 	return this.sysBufferContract.Close()
 }
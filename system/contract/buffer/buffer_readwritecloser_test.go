@@ -4,7 +4,9 @@ import (
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/evm-NG/common/hexutil"
 	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"reflect"
 	"testing"
 )
@@ -27,6 +29,38 @@ func TestNewSystemBufferReadWriterCloser(t *testing.T) {
 }
 
 func TestSystemBufferReadWriterCloser_Read(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	mockLowLevelCache(db)
+	sysBuffer := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+	_, err := sysBuffer.Write(mockData)
+	assert.Nil(err)
+	sysRWC := NewSystemBufferReadWriterCloser(sysBuffer)
+	assert.NotNil(sysRWC)
+
+	data := make([]byte, 10)
+	n1, err := sysRWC.Read(data)
+	assert.Nil(err)
+	assert.Equal(len(data), n1)
+	assert.Equal(mockData[:n1], data)
+
+	// the cursor is persisted in the buffer, a new instance resumes the reading
+	sysRWC = NewSystemBufferReadWriterCloser(NewSystemBufferContract(db, mockOwner, DefaultHandle))
+	assert.Equal(uint64(n1), sysRWC.sysBufferContract.Cursor())
+	data = make([]byte, len(mockData))
+	n2, err := sysRWC.Read(data)
+	assert.Nil(err)
+	assert.Equal(len(mockData)-n1, n2)
+	assert.Equal(mockData[n1:], data[:n2])
+
+	data = make([]byte, 10)
+	_, err = sysRWC.Read(data)
+	assert.Equal(io.EOF, err)
+	assert.Equal(uint64(len(mockData)), sysBuffer.Cursor())
+}
+
+func TestSystemBufferReadWriterCloser_ReadAt(t *testing.T) {
 	defer monkey.UnpatchAll()
 	assert := assert.New(t)
 	sysRWC := NewSystemBufferReadWriterCloser(mockSystemBuffer())
@@ -40,18 +74,71 @@ func TestSystemBufferReadWriterCloser_Read(t *testing.T) {
 	})
 
 	data := make([]byte, 10)
-	n1, err := sysRWC.Read(data)
+	n, err := sysRWC.ReadAt(data, 5)
 	assert.Nil(err)
-	assert.Equal(len(data), n1)
+	assert.Equal(len(data), n)
+	assert.Equal(mockData[5:15], data)
 
-	data = make([]byte, len(mockData))
-	n2, err := sysRWC.Read(data)
+	n, err = sysRWC.ReadAt(data, int64(len(mockData)-2))
+	assert.Equal(io.EOF, err)
+	assert.Equal(2, n)
+
+	_, err = sysRWC.ReadAt(data, int64(len(mockData)))
+	assert.Equal(io.EOF, err)
+	_, err = sysRWC.ReadAt(data, -1)
+	assert.NotNil(err)
+}
+
+func TestSystemBufferReadWriterCloser_WriteAt(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	sysRWC := NewSystemBufferReadWriterCloser(mockSystemBuffer())
+	assert.NotNil(sysRWC)
+
+	monkey.PatchInstanceMethod(reflect.TypeOf(sysRWC.sysBufferContract), "WriteAt", func(sysBuffer *SystemBufferContract, offset uint64, data []byte) (uint64, error) {
+		return uint64(len(data)), nil
+	})
+
+	data := []byte("Hello, World")
+	n, err := sysRWC.WriteAt(data, 3)
 	assert.Nil(err)
-	assert.Equal(len(mockData)-n1, n2)
+	assert.Equal(len(data), n)
+	_, err = sysRWC.WriteAt(data, -1)
+	assert.NotNil(err)
+}
 
-	data = make([]byte, 10)
+func TestSystemBufferReadWriterCloser_Seek(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	mockLowLevelCache(db)
+	sysBuffer := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+	_, err := sysBuffer.Write(mockData)
+	assert.Nil(err)
+	sysRWC := NewSystemBufferReadWriterCloser(sysBuffer)
+	assert.NotNil(sysRWC)
+
+	pos, err := sysRWC.Seek(10, io.SeekStart)
+	assert.Nil(err)
+	assert.Equal(int64(10), pos)
+	assert.Equal(uint64(10), sysBuffer.Cursor())
+	pos, err = sysRWC.Seek(5, io.SeekCurrent)
+	assert.Nil(err)
+	assert.Equal(int64(15), pos)
+	data := make([]byte, 5)
 	_, err = sysRWC.Read(data)
+	assert.Nil(err)
+	assert.Equal(mockData[15:20], data)
+	pos, err = sysRWC.Seek(-1, io.SeekEnd)
+	assert.Nil(err)
+	assert.Equal(int64(len(mockData)-1), pos)
+	_, err = sysRWC.Seek(-1, io.SeekStart)
+	assert.NotNil(err)
+	_, err = sysRWC.Seek(1, io.SeekEnd)
+	assert.Equal(InvalidPositionError, err)
+	_, err = sysRWC.Seek(0, 3)
 	assert.NotNil(err)
+	assert.Equal(uint64(len(mockData)-1), sysBuffer.Cursor())
 }
 
 func TestSystemBufferReadWriterCloser_Write(t *testing.T) {
@@ -6,6 +6,7 @@ import (
 	"github.com/DSiSc/craft/types"
 	cutil "github.com/DSiSc/crypto-suite/util"
 	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/system/contract/util"
 	"github.com/DSiSc/repository"
 	"math/big"
@@ -14,18 +15,72 @@ import (
 var SystemBufferAddr = cutil.HexToAddress("0000000000000000000000000000000000011111")
 
 const (
-	systemBufferCacheKey = "SystemBufferCacheKey"
-	truncSize            = 256
+	systemBufferCacheKey  = "SystemBufferCacheKey"
+	systemBufferHandleKey = "SystemBufferHandleKey"
+	systemBufferCursorKey = "SystemBufferCursorKey"
+	truncSize             = uint64(256)
+)
+
+// DefaultHandle is the handle id of the buffer used when caller doesn't specify one
+const DefaultHandle = uint64(0)
+
+var (
+	readMethod         = util.MustNewMethod("Read(uint64 offset,uint64 size)", "bytes")
+	writeMethod        = util.MustNewMethod("Write(bytes data)", "uint64")
+	lengthMethod       = util.MustNewMethod("Length()", "uint64")
+	closeMethod        = util.MustNewMethod("Close()")
+	openMethod         = util.MustNewMethod("Open()", "uint256")
+	seekMethod         = util.MustNewMethod("Seek(uint256 handle,uint256 offset)", "uint64")
+	truncateMethod     = util.MustNewMethod("Truncate(uint256 handle,uint256 size)")
+	readAtMethod       = util.MustNewMethod("ReadAt(uint256 handle,uint256 offset,uint256 size)", "bytes")
+	writeAtMethod      = util.MustNewMethod("WriteAt(uint256 handle,uint256 offset,bytes data)", "uint64")
+	handleLengthMethod = util.MustNewMethod("Length(uint256 handle)", "uint64")
+	handleCloseMethod  = util.MustNewMethod("Close(uint256 handle)")
+	handleReadMethod   = util.MustNewMethod("Read(uint256 handle,uint256 size)", "bytes")
 )
 
 var (
-	systemBufferCacheStart = util.Hash([]byte(systemBufferCacheKey))
-	readMethodHash         = string(util.ExtractMethodHash(util.Hash([]byte("Read(uint64,uint64)"))))
-	writeMethodHash        = string(util.ExtractMethodHash(util.Hash([]byte("Write(bytes)"))))
-	lengthMethodHash       = string(util.ExtractMethodHash(util.Hash([]byte("Length()"))))
-	closeMethodHash        = string(util.ExtractMethodHash(util.Hash([]byte("Close()"))))
+	readMethodHash         = string(readMethod.Id())
+	writeMethodHash        = string(writeMethod.Id())
+	lengthMethodHash       = string(lengthMethod.Id())
+	closeMethodHash        = string(closeMethod.Id())
+	openMethodHash         = string(openMethod.Id())
+	seekMethodHash         = string(seekMethod.Id())
+	truncateMethodHash     = string(truncateMethod.Id())
+	readAtMethodHash       = string(readAtMethod.Id())
+	writeAtMethodHash      = string(writeAtMethod.Id())
+	handleLengthMethodHash = string(handleLengthMethod.Id())
+	handleCloseMethodHash  = string(handleCloseMethod.Id())
+	handleReadMethodHash   = string(handleReadMethod.Id())
 )
 
+// BufferWrittenEvent emitted when the data is written to the buffer by the contract
+var BufferWrittenEvent = util.MustNewEvent("BufferWritten(address indexed owner,uint64 indexed handle,uint64 offset,uint64 size)")
+
+// BufferABI abi metadata of the system buffer contract
+var BufferABI = &util.ABI{
+	Methods: []*util.Method{
+		readMethod, writeMethod, lengthMethod, closeMethod, openMethod, seekMethod,
+		truncateMethod, readAtMethod, writeAtMethod, handleLengthMethod, handleCloseMethod, handleReadMethod,
+	},
+	Events: []*util.Event{BufferWrittenEvent},
+}
+
+var (
+	InvalidHandleError   = errors.New("invalid buffer handle")
+	InvalidPositionError = errors.New("invalid buffer position")
+)
+
+// IsViewMethod check the method called with input doesn't modify the buffer
+func IsViewMethod(input []byte) bool {
+	switch string(util.ExtractMethodHash(input)) {
+	case readMethodHash, lengthMethodHash, readAtMethodHash, handleLengthMethodHash:
+		return true
+	default:
+		return false
+	}
+}
+
 // execute the system buffer contract
 func BufferExecute(sysBuffer *SystemBufferContract, input []byte) ([]byte, error) {
 	methodHash := util.ExtractMethodHash(input)
@@ -51,10 +106,14 @@ func BufferExecute(sysBuffer *SystemBufferContract, input []byte) ([]byte, error
 		if err != nil {
 			return nil, err
 		}
+		offset := sysBuffer.Length()
 		size, err := sysBuffer.Write(data)
 		if err != nil {
 			return nil, err
 		}
+		if err = sysBuffer.emitWritten(offset, size); err != nil {
+			return nil, err
+		}
 		retData, err := util.EncodeReturnValue(size)
 		if err != nil {
 			return nil, err
@@ -66,20 +125,136 @@ func BufferExecute(sysBuffer *SystemBufferContract, input []byte) ([]byte, error
 	case closeMethodHash:
 		err := sysBuffer.Close()
 		return nil, err
+	case openMethodHash:
+		handleBuffer, err := sysBuffer.Open()
+		if err != nil {
+			return nil, err
+		}
+		// handle is returned as uint256 like the handle arguments of the other methods
+		return util.EncodeReturnValue(new(big.Int).SetUint64(handleBuffer.Handle()))
+	case seekMethodHash:
+		var handle, offset uint64
+		err := util.ExtractParam(input[len(methodHash):], &handle, &offset)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		pos, err := handleBuffer.Seek(offset)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(pos)
+	case handleReadMethodHash:
+		var handle, size uint64
+		err := util.ExtractParam(input[len(methodHash):], &handle, &size)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		data, err := handleBuffer.ReadFromCursor(size)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(data)
+	case truncateMethodHash:
+		var handle, size uint64
+		err := util.ExtractParam(input[len(methodHash):], &handle, &size)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		return nil, handleBuffer.Truncate(size)
+	case readAtMethodHash:
+		var handle, offset, size uint64
+		err := util.ExtractParam(input[len(methodHash):], &handle, &offset, &size)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		data, err := handleBuffer.Read(offset, size)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(data)
+	case writeAtMethodHash:
+		var handle, offset uint64
+		data := make([]byte, 0)
+		err := util.ExtractParam(input[len(methodHash):], &handle, &offset, &data)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		size, err := handleBuffer.WriteAt(offset, data)
+		if err != nil {
+			return nil, err
+		}
+		if err = handleBuffer.emitWritten(offset, size); err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(size)
+	case handleLengthMethodHash:
+		var handle uint64
+		err := util.ExtractParam(input[len(methodHash):], &handle)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(handleBuffer.Length())
+	case handleCloseMethodHash:
+		var handle uint64
+		err := util.ExtractParam(input[len(methodHash):], &handle)
+		if err != nil {
+			return nil, err
+		}
+		handleBuffer, err := sysBuffer.WithHandle(handle)
+		if err != nil {
+			return nil, err
+		}
+		return nil, handleBuffer.Close()
 	default:
 		return nil, errors.New("unknown method")
 	}
 }
 
-// SystemBufferContract used to cache the system contract data
+// SystemBufferContract used to cache the system contract data.
+// Each caller owns its private buffers, which are identified by the owner address and a handle id.
 type SystemBufferContract struct {
-	db *repository.Repository
+	db       *repository.Repository
+	owner    types.Address
+	handle   uint64
+	baseKey  *big.Int
+	emitter  util.EventEmitter
+	gasMeter *util.GasMeter
 }
 
 // NewSystemBufferContract create a SystemBufferContract instance.
-func NewSystemBufferContract(db *repository.Repository) *SystemBufferContract {
+// owner: address of the contract owning the buffer
+// handle: id used to distinguish the buffers of the same owner
+func NewSystemBufferContract(db *repository.Repository, owner types.Address, handle uint64) *SystemBufferContract {
+	handleBytes := encodeUint64(handle)
 	return &SystemBufferContract{
-		db: db,
+		db:      db,
+		owner:   owner,
+		handle:  handle,
+		baseKey: new(big.Int).SetBytes(util.Hash(append(append([]byte(systemBufferCacheKey), owner[:]...), handleBytes...))),
 	}
 }
 
@@ -87,117 +262,369 @@ func NewSystemBufferContract(db *repository.Repository) *SystemBufferContract {
 // offset: length of the bytes to be skipped
 // size: max length to read
 func (this *SystemBufferContract) Read(offset, size uint64) ([]byte, error) {
-	data := make([]byte, 0)
-	val, err := this.db.Get([]byte(systemBufferCacheKey))
-	if err != nil {
-		return nil, err
-	}
-	if val == nil || offset+size > binary.BigEndian.Uint64(val) {
+	end, overflow := math.SafeAdd(offset, size)
+	if overflow || end > this.Length() {
 		return nil, errors.New("invalid read position")
 	}
-	preLen := int(offset % truncSize)
-	for start := offset / truncSize; uint64(len(data)) < size+uint64(preLen); start++ {
-		key := getKey(int64(start))
-		val, err := this.db.Get(key)
-		if err != nil || len(val) <= 0 {
-			return make([]byte, 0), err
+	data := make([]byte, 0, size)
+	for index := offset / truncSize; uint64(len(data)) < size; index++ {
+		chunk, err := this.db.Get(this.chunkKey(index))
+		if err != nil {
+			return nil, err
+		}
+		chunkStart := index * truncSize
+		from, to := uint64(0), uint64(len(chunk))
+		if offset > chunkStart {
+			from = offset - chunkStart
+		}
+		if end < chunkStart+to {
+			to = end - chunkStart
+		}
+		if from >= to {
+			return nil, errors.New("buffer data corrupted")
 		}
-		data = append(data, val...)
+		data = append(data, chunk[from:to]...)
 	}
-	return data[preLen : preLen+int(size)], nil
+	return data, nil
 }
 
 // Write write data to buffer
 // data: data to be written
 // return an error if write failed, otherwise return the data length have been written to buffer.
 func (this *SystemBufferContract) Write(data []byte) (uint64, error) {
-	saveLen := len(data)
+	saveLen := uint64(len(data))
 	currentLen := this.Length()
-	newStart := currentLen / truncSize
+	newLen, overflow := math.SafeAdd(currentLen, saveLen)
+	if overflow {
+		return 0, errors.New("buffer size overflow")
+	}
+	if err := this.gasMeter.UseGas(saveLen * params.SysBufferByteGas); err != nil {
+		return 0, err
+	}
 
-	// TODO：preReserve大小不是一个整的trunc ？？? truncSize - (currentLen % truncSize)
-	// fill full the pre-reserve location
-	if currentLen%truncSize != 0 {
-		preReserve := currentLen % truncSize
-		key := getKey(int64(newStart))
+	// fill up the last chunk if it is partially used
+	if remain := currentLen % truncSize; remain != 0 && len(data) > 0 {
+		key := this.chunkKey(currentLen / truncSize)
 		preData, err := this.db.Get(key)
 		if err != nil {
 			return 0, err
 		}
-
-		if uint64(len(data)) > preReserve {
-			err = this.db.Put(key, append(preData, data[:preReserve]...))
-			data = data[preReserve:]
-		} else {
-			this.db.Put(key, append(preData, data...))
-			data = data[len(data):]
+		fill := truncSize - remain
+		if uint64(len(data)) < fill {
+			fill = uint64(len(data))
 		}
-		if err != nil {
+		chunk := make([]byte, 0, remain+fill)
+		chunk = append(append(chunk, preData...), data[:fill]...)
+		if err = this.putChunk(key, chunk); err != nil {
 			return 0, err
 		}
-		newStart++
+		data = data[fill:]
+		currentLen += fill
 	}
 
-	// save data
-	for i := 0; i*truncSize < len(data); i++ {
-		key := getKey(int64(newStart))
-		start := i * truncSize
-		end := len(data)
-		if len(data) > (i+1)*truncSize {
-			end = (i + 1) * truncSize
+	// save the rest data in new chunks
+	for index := currentLen / truncSize; len(data) > 0; index++ {
+		size := uint64(len(data))
+		if size > truncSize {
+			size = truncSize
 		}
-		err := this.db.Put(key, data[start:end])
-		if err != nil {
+		if err := this.putChunk(this.chunkKey(index), data[:size]); err != nil {
 			return 0, err
 		}
-		newStart++
+		data = data[size:]
 	}
-	newLen := currentLen + uint64(saveLen)
-	val := make([]byte, 8)
-	binary.BigEndian.PutUint64(val, newLen)
-	err := this.db.Put([]byte(systemBufferCacheKey), val)
+
+	err := this.db.Put(this.lengthKey(), encodeUint64(newLen))
 	if err != nil {
 		return 0, err
 	}
-	return uint64(saveLen), nil
+	return saveLen, nil
 }
 
 // Length return the length of the data in buffer
 func (this *SystemBufferContract) Length() uint64 {
-	val, err := this.db.Get([]byte(systemBufferCacheKey))
-	if err != nil || val == nil {
+	val, err := this.db.Get(this.lengthKey())
+	if err != nil || len(val) != 8 {
 		return 0
 	}
 	return binary.BigEndian.Uint64(val)
 }
 
-// Length return the length of the data in buffer
-func (this *SystemBufferContract) Close() error {
-	cacheLen := this.Length()
-	if cacheLen <= 0 {
+// WriteAt write data to buffer starting at the specified offset, the data beyond the
+// current length will be appended to the buffer.
+// offset: position to start writing, must not be greater than the buffer length
+// return an error if write failed, otherwise return the data length have been written to buffer.
+func (this *SystemBufferContract) WriteAt(offset uint64, data []byte) (uint64, error) {
+	currentLen := this.Length()
+	if offset > currentLen {
+		return 0, InvalidPositionError
+	}
+	if _, overflow := math.SafeAdd(offset, uint64(len(data))); overflow {
+		return 0, errors.New("buffer size overflow")
+	}
+	// the appended data is charged by Write
+	overwrite := currentLen - offset
+	if overwrite > uint64(len(data)) {
+		overwrite = uint64(len(data))
+	}
+	if err := this.gasMeter.UseGas(overwrite * params.SysBufferByteGas); err != nil {
+		return 0, err
+	}
+
+	// overwrite the existing chunks
+	written := uint64(0)
+	for index := offset / truncSize; offset+written < currentLen && written < uint64(len(data)); index++ {
+		key := this.chunkKey(index)
+		preData, err := this.db.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		from := offset + written - index*truncSize
+		if from >= uint64(len(preData)) {
+			return 0, errors.New("buffer data corrupted")
+		}
+		chunk := make([]byte, len(preData))
+		copy(chunk, preData)
+		n := uint64(copy(chunk[from:], data[written:]))
+		if err = this.putChunk(key, chunk); err != nil {
+			return 0, err
+		}
+		written += n
+	}
+
+	// append the rest data
+	if written < uint64(len(data)) {
+		if _, err := this.Write(data[written:]); err != nil {
+			return 0, err
+		}
+	}
+	return uint64(len(data)), nil
+}
+
+// Truncate shrink the buffer to the specified size
+// size: new length of the buffer, must not be greater than the current length
+func (this *SystemBufferContract) Truncate(size uint64) error {
+	currentLen := this.Length()
+	if size > currentLen {
+		return InvalidPositionError
+	}
+	if size == currentLen {
 		return nil
 	}
 
-	err := this.db.Delete([]byte(systemBufferCacheKey))
+	chunkCount := (currentLen + truncSize - 1) / truncSize
+	keepCount := (size + truncSize - 1) / truncSize
+	for index := keepCount; index < chunkCount; index++ {
+		if err := this.db.Delete(this.chunkKey(index)); err != nil {
+			return err
+		}
+	}
+
+	// trim the last kept chunk
+	if remain := size % truncSize; remain != 0 {
+		key := this.chunkKey(keepCount - 1)
+		preData, err := this.db.Get(key)
+		if err != nil {
+			return err
+		}
+		if uint64(len(preData)) < remain {
+			return errors.New("buffer data corrupted")
+		}
+		chunk := make([]byte, remain)
+		copy(chunk, preData)
+		if err = this.db.Put(key, chunk); err != nil {
+			return err
+		}
+	}
+
+	if err := this.db.Put(this.lengthKey(), encodeUint64(size)); err != nil {
+		return err
+	}
+	if this.Cursor() > size {
+		return this.db.Put(this.cursorKey(), encodeUint64(size))
+	}
+	return nil
+}
+
+// Seek set the read cursor of the buffer, the cursor is persisted, so the reading can be resumed in later calls.
+// offset: new position of the cursor, must not be greater than the buffer length
+func (this *SystemBufferContract) Seek(offset uint64) (uint64, error) {
+	if offset > this.Length() {
+		return 0, InvalidPositionError
+	}
+	if err := this.db.Put(this.cursorKey(), encodeUint64(offset)); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// Cursor return the current read cursor of the buffer
+func (this *SystemBufferContract) Cursor() uint64 {
+	val, err := this.db.Get(this.cursorKey())
+	if err != nil || len(val) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(val)
+}
+
+// ReadFromCursor read at most size bytes from the read cursor and move the cursor to the end of the read data,
+// so the next call resumes where this one stopped. An empty slice is returned if the cursor is at the end.
+func (this *SystemBufferContract) ReadFromCursor(size uint64) ([]byte, error) {
+	cursor, length := this.Cursor(), this.Length()
+	if cursor > length {
+		return nil, InvalidPositionError
+	}
+	if length-cursor < size {
+		size = length - cursor
+	}
+	data, err := this.Read(cursor, size)
 	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		if err := this.db.Put(this.cursorKey(), encodeUint64(cursor+size)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Close clear the data in buffer
+func (this *SystemBufferContract) Close() error {
+	if err := this.db.Delete(this.cursorKey()); err != nil {
 		return err
 	}
 
-	//TODO：可以整除的情况下是否会多释放？（8/4 == 2，释放0，1，2）
-	for i := 0; uint64(i) <= (cacheLen / truncSize); i++ {
-		key := getKey(int64(i))
-		this.db.Delete(key)
+	cacheLen := this.Length()
+	err := this.db.Delete(this.lengthKey())
+	if err != nil {
+		return err
+	}
+
+	chunkCount := (cacheLen + truncSize - 1) / truncSize
+	for index := uint64(0); index < chunkCount; index++ {
+		if err := this.db.Delete(this.chunkKey(index)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Open allocate a new buffer for the owner, the handle id of the new buffer is returned by Handle()
+func (this *SystemBufferContract) Open() (*SystemBufferContract, error) {
+	handle := this.nextHandle()
+	if handle == math.MaxUint64 {
+		return nil, errors.New("too many buffers opened")
+	}
+	if err := this.gasMeter.UseGas(params.SysBufferOpenGas); err != nil {
+		return nil, err
+	}
+	if err := this.db.Put(this.handleKey(), encodeUint64(handle+1)); err != nil {
+		return nil, err
+	}
+	return this.withHandle(handle), nil
+}
+
+// WithHandle return the opened buffer with the specified handle id of the same owner
+func (this *SystemBufferContract) WithHandle(handle uint64) (*SystemBufferContract, error) {
+	if handle != DefaultHandle && handle >= this.nextHandle() {
+		return nil, InvalidHandleError
+	}
+	if handle == this.handle {
+		return this, nil
+	}
+	return this.withHandle(handle), nil
+}
+
+// Release clear all the buffers of the owner, including the default one
+func (this *SystemBufferContract) Release() error {
+	nextHandle := this.nextHandle()
+	for handle := DefaultHandle; handle < nextHandle; handle++ {
+		if err := NewSystemBufferContract(this.db, this.owner, handle).Close(); err != nil {
+			return err
+		}
+	}
+	return this.db.Delete(this.handleKey())
+}
+
+// SetGasMeter set the meter charging the chunks written and the buffers opened, nothing is charged if it is not set
+func (this *SystemBufferContract) SetGasMeter(gasMeter *util.GasMeter) {
+	this.gasMeter = gasMeter
+}
+
+// SetEventEmitter set the emitter of the buffer events, no event is emitted if it is not set
+func (this *SystemBufferContract) SetEventEmitter(emitter util.EventEmitter) {
+	this.emitter = emitter
+}
+
+// Address return the address of system buffer contract
 func (this *SystemBufferContract) Address() types.Address {
 	return SystemBufferAddr
 }
 
-// get db key based on the offset
-func getKey(offset int64) []byte {
-	posStart := big.NewInt(0).SetBytes(systemBufferCacheStart)
-	pos := posStart.Add(posStart, big.NewInt(offset))
-	return math.PaddedBigBytes(pos, util.HashLenght)
+// Owner return the address of the contract owning the buffer
+func (this *SystemBufferContract) Owner() types.Address {
+	return this.owner
+}
+
+// Handle return the handle id of the buffer
+func (this *SystemBufferContract) Handle() uint64 {
+	return this.handle
+}
+
+// return the buffer of the same owner with the specified handle id
+func (this *SystemBufferContract) withHandle(handle uint64) *SystemBufferContract {
+	handleBuffer := NewSystemBufferContract(this.db, this.owner, handle)
+	handleBuffer.emitter = this.emitter
+	handleBuffer.gasMeter = this.gasMeter
+	return handleBuffer
+}
+
+// charge and put the chunk to the state
+func (this *SystemBufferContract) putChunk(key []byte, chunk []byte) error {
+	if err := this.gasMeter.UseGas(params.SysBufferChunkGas); err != nil {
+		return err
+	}
+	return this.db.Put(key, chunk)
+}
+
+// emit the BufferWrittenEvent
+func (this *SystemBufferContract) emitWritten(offset, size uint64) error {
+	return BufferWrittenEvent.Emit(this.emitter, SystemBufferAddr, this.owner, this.handle, offset, size)
+}
+
+// db key of the buffer length
+func (this *SystemBufferContract) lengthKey() []byte {
+	return math.PaddedBigBytes(this.baseKey, util.HashLenght)
+}
+
+// db key of the chunk with specified index
+func (this *SystemBufferContract) chunkKey(index uint64) []byte {
+	pos := new(big.Int).Add(this.baseKey, new(big.Int).SetUint64(index+1))
+	return math.PaddedBigBytes(math.U256(pos), util.HashLenght)
+}
+
+// db key of the buffer read cursor
+func (this *SystemBufferContract) cursorKey() []byte {
+	return util.Hash(append([]byte(systemBufferCursorKey), this.lengthKey()...))
+}
+
+// db key of the next handle id of the owner
+func (this *SystemBufferContract) handleKey() []byte {
+	return util.Hash(append([]byte(systemBufferHandleKey), this.owner[:]...))
+}
+
+// next handle id to be allocated, handle ids start after the DefaultHandle
+func (this *SystemBufferContract) nextHandle() uint64 {
+	val, err := this.db.Get(this.handleKey())
+	if err != nil || len(val) != 8 {
+		return DefaultHandle + 1
+	}
+	return binary.BigEndian.Uint64(val)
+}
+
+func encodeUint64(val uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, val)
+	return data
 }
@@ -3,18 +3,42 @@ package buffer
 import (
 	"bytes"
 	"encoding/binary"
+	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/util"
 	"github.com/DSiSc/monkey"
 	"github.com/DSiSc/repository"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
 	"reflect"
 	"testing"
+	"testing/quick"
 )
 
+var mockOwner = types.Address{0x01}
+
+// mock the repository with an in-memory key-value store
+func mockLowLevelCache(db *repository.Repository) map[string][]byte {
+	lowLevelCache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return lowLevelCache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		lowLevelCache[string(key)] = value
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Delete", func(chain *repository.Repository, key []byte) error {
+		delete(lowLevelCache, string(key))
+		return nil
+	})
+	return lowLevelCache
+}
+
 func TestNewSystemBufferContract(t *testing.T) {
 	assert := assert.New(t)
 	db := &repository.Repository{}
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 
 }
@@ -23,12 +47,12 @@ func TestBufferExecute(t *testing.T) {
 	defer monkey.UnpatchAll()
 	assert := assert.New(t)
 	db := &repository.Repository{}
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 
 	data := []byte{0x11, 0x11, 0x11}
 	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
-		if bytes.Equal([]byte(systemBufferCacheKey), key) {
+		if bytes.Equal(bc.lengthKey(), key) {
 			val := make([]byte, 8)
 			binary.BigEndian.PutUint64(val, 3)
 			return val, nil
@@ -46,7 +70,7 @@ func TestBufferExecute1(t *testing.T) {
 	defer monkey.UnpatchAll()
 	assert := assert.New(t)
 	db := &repository.Repository{}
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 
 	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
@@ -72,7 +96,7 @@ func TestBufferExecute2(t *testing.T) {
 	defer monkey.UnpatchAll()
 	assert := assert.New(t)
 	db := &repository.Repository{}
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	input, _ := hexutil.Decode("0x82172882")
 	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
@@ -98,12 +122,12 @@ func TestBufferExecute3(t *testing.T) {
 	defer monkey.UnpatchAll()
 	assert := assert.New(t)
 	db := &repository.Repository{}
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 
 	var data []byte
 	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
-		if !bytes.Equal([]byte(systemBufferCacheKey), key) {
+		if !bytes.Equal(bc.lengthKey(), key) {
 			data = value
 		}
 		return nil
@@ -130,14 +154,14 @@ func TestSystemBufferContract_Read(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	_, err := bc.Read(0, 1)
 	assert.NotNil(err)
 
 	data := []byte{0x11, 0x11, 0x11}
 	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
-		if bytes.Equal([]byte(systemBufferCacheKey), key) {
+		if bytes.Equal(bc.lengthKey(), key) {
 			val := make([]byte, 8)
 			binary.BigEndian.PutUint64(val, 3)
 			return val, nil
@@ -161,7 +185,7 @@ func TestSystemBufferContract_Write(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	data, _ := hexutil.Decode("0x111111111111111111111111111111111111111111116666")
 	len, err := bc.Write(data)
@@ -181,7 +205,7 @@ func TestSystemBufferContract_Read1(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	data, err := bc.Read(0, 1)
 	assert.NotNil(err)
@@ -208,7 +232,7 @@ func TestSystemBufferContract_Read2(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	data, err := bc.Read(0, 1)
 	assert.NotNil(err)
@@ -239,7 +263,7 @@ func TestSystemBufferContract_Write1(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	data, _ := hexutil.Decode("0x111111111111111111111111111111111111111111116666")
 	len, err := bc.Write(data)
@@ -259,19 +283,19 @@ func TestSystemBufferContract_Write2(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	data, _ := hexutil.Decode("0x111111111111111111111111111111111111111111116666")
 	len, err := bc.Write(data)
 	assert.Nil(err)
 	assert.Equal(uint64(0x18), len)
-	assert.Equal(uint64(0x18), binary.BigEndian.Uint64(lowLevelCache[systemBufferCacheKey]))
+	assert.Equal(uint64(0x18), binary.BigEndian.Uint64(lowLevelCache[string(bc.lengthKey())]))
 
 	data, _ = hexutil.Decode("0x1234")
 	len, err = bc.Write(data)
 	assert.Nil(err)
 	assert.Equal(uint64(2), len)
-	assert.Equal(uint64(0x1A), binary.BigEndian.Uint64(lowLevelCache[systemBufferCacheKey]))
+	assert.Equal(uint64(0x1A), binary.BigEndian.Uint64(lowLevelCache[string(bc.lengthKey())]))
 }
 
 func TestSystemBufferContract_Length(t *testing.T) {
@@ -286,7 +310,7 @@ func TestSystemBufferContract_Length(t *testing.T) {
 		lowLevelCache[string(key)] = value
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 
 	saveLen := bc.Length()
@@ -322,7 +346,7 @@ func TestSystemBufferContract_Delete(t *testing.T) {
 		delete(lowLevelCache, string(key))
 		return nil
 	})
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 
 	data, _ := hexutil.Decode("0x111111111111111111111111111111111111111111116666")
@@ -349,7 +373,338 @@ func TestSystemBufferContract_Delete(t *testing.T) {
 func TestSystemBufferContract_Address(t *testing.T) {
 	assert := assert.New(t)
 	db := &repository.Repository{}
-	bc := NewSystemBufferContract(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
 	assert.NotNil(bc)
 	assert.Equal(SystemBufferAddr, bc.Address())
 }
+
+func TestSystemBufferContract_Owner(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	lowLevelCache := mockLowLevelCache(db)
+	bc1 := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+	bc2 := NewSystemBufferContract(db, types.Address{0x02}, DefaultHandle)
+	bc3 := NewSystemBufferContract(db, mockOwner, 1)
+	assert.Equal(mockOwner, bc1.Owner())
+	assert.Equal(uint64(1), bc3.Handle())
+
+	_, err := bc1.Write([]byte{0x11, 0x11})
+	assert.Nil(err)
+	_, err = bc2.Write([]byte{0x22})
+	assert.Nil(err)
+	assert.Equal(uint64(2), bc1.Length())
+	assert.Equal(uint64(1), bc2.Length())
+	assert.Equal(uint64(0), bc3.Length())
+
+	data, err := bc2.Read(0, 1)
+	assert.Nil(err)
+	assert.Equal([]byte{0x22}, data)
+
+	assert.Nil(bc1.Close())
+	assert.Equal(uint64(0), bc1.Length())
+	assert.Equal(uint64(1), bc2.Length())
+	assert.Nil(bc2.Close())
+	assert.Equal(0, len(lowLevelCache))
+}
+
+func TestSystemBufferContract_Property(t *testing.T) {
+	defer monkey.UnpatchAll()
+	db := &repository.Repository{}
+	lowLevelCache := mockLowLevelCache(db)
+
+	// write random sized data, then verify random reads against the written data
+	property := func(seed int64, writeSizes []uint16) bool {
+		random := rand.New(rand.NewSource(seed))
+		bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+		expect := make([]byte, 0)
+		for _, writeSize := range writeSizes {
+			data := make([]byte, int(writeSize)%(3*int(truncSize)))
+			random.Read(data)
+			n, err := bc.Write(data)
+			if err != nil || n != uint64(len(data)) {
+				return false
+			}
+			expect = append(expect, data...)
+		}
+		if bc.Length() != uint64(len(expect)) {
+			return false
+		}
+		for i := 0; i < 16 && len(expect) > 0; i++ {
+			offset := random.Intn(len(expect) + 1)
+			size := random.Intn(len(expect) - offset + 1)
+			data, err := bc.Read(uint64(offset), uint64(size))
+			if err != nil || !bytes.Equal(expect[offset:offset+size], data) {
+				return false
+			}
+		}
+		if _, err := bc.Read(uint64(len(expect)), 1); err == nil {
+			return false
+		}
+		return bc.Close() == nil && len(lowLevelCache) == 0
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSystemBufferContract_Open(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	lowLevelCache := mockLowLevelCache(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+
+	_, err := bc.WithHandle(1)
+	assert.Equal(InvalidHandleError, err)
+
+	bc1, err := bc.Open()
+	assert.Nil(err)
+	assert.Equal(uint64(1), bc1.Handle())
+	bc2, err := bc1.Open()
+	assert.Nil(err)
+	assert.Equal(uint64(2), bc2.Handle())
+
+	_, err = bc1.Write([]byte{0x11})
+	assert.Nil(err)
+	_, err = bc2.Write([]byte{0x22, 0x22})
+	assert.Nil(err)
+	handleBuffer, err := bc.WithHandle(2)
+	assert.Nil(err)
+	assert.Equal(uint64(2), handleBuffer.Length())
+	_, err = handleBuffer.Seek(1)
+	assert.Nil(err)
+	assert.Equal(uint64(1), bc2.Cursor())
+	assert.Equal(uint64(0), bc1.Cursor())
+
+	assert.Nil(bc.Release())
+	assert.Equal(0, len(lowLevelCache))
+	_, err = bc.WithHandle(1)
+	assert.Equal(InvalidHandleError, err)
+}
+
+func TestSystemBufferContract_WriteAt(t *testing.T) {
+	defer monkey.UnpatchAll()
+	db := &repository.Repository{}
+	lowLevelCache := mockLowLevelCache(db)
+
+	// apply random WriteAt/Truncate/Seek operations, then verify the buffer against the model
+	property := func(seed int64, opCount uint8) bool {
+		random := rand.New(rand.NewSource(seed))
+		bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+		expect, cursor := make([]byte, 0), uint64(0)
+		for i := 0; i < int(opCount)%32; i++ {
+			switch random.Intn(3) {
+			case 0:
+				offset := random.Intn(len(expect) + 1)
+				data := make([]byte, random.Intn(3*int(truncSize)))
+				random.Read(data)
+				n, err := bc.WriteAt(uint64(offset), data)
+				if err != nil || n != uint64(len(data)) {
+					return false
+				}
+				if offset+len(data) > len(expect) {
+					expect = append(expect, make([]byte, offset+len(data)-len(expect))...)
+				}
+				copy(expect[offset:], data)
+			case 1:
+				size := random.Intn(len(expect) + 1)
+				if err := bc.Truncate(uint64(size)); err != nil {
+					return false
+				}
+				expect = expect[:size]
+				if cursor > uint64(size) {
+					cursor = uint64(size)
+				}
+			default:
+				pos := uint64(random.Intn(len(expect) + 1))
+				if ret, err := bc.Seek(pos); err != nil || ret != pos {
+					return false
+				}
+				cursor = pos
+			}
+		}
+		data, err := bc.Read(0, uint64(len(expect)))
+		if err != nil || !bytes.Equal(expect, data) || bc.Cursor() != cursor {
+			return false
+		}
+		if _, err := bc.WriteAt(uint64(len(expect))+1, []byte{0x01}); err != InvalidPositionError {
+			return false
+		}
+		if err := bc.Truncate(uint64(len(expect)) + 1); err != InvalidPositionError {
+			return false
+		}
+		if _, err := bc.Seek(uint64(len(expect)) + 1); err != InvalidPositionError {
+			return false
+		}
+		return bc.Close() == nil && len(lowLevelCache) == 0
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBufferExecute4(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	lowLevelCache := mockLowLevelCache(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+
+	ret, err := BufferExecute(bc, util.ExtractMethodHash(util.Hash([]byte("Open()"))))
+	assert.Nil(err)
+	var handle uint64
+	assert.Nil(util.ExtractParam(ret, &handle))
+	assert.Equal(uint64(1), handle)
+	assert.Equal("uint256", openMethod.Outputs[0].Type.String())
+
+	input, _ := util.EncodeReturnValue(handle, uint64(0), []byte("Hello, World"))
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("WriteAt(uint256,uint256,bytes)"))), input...))
+	assert.Nil(err)
+
+	input, _ = util.EncodeReturnValue(handle, uint64(5))
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Truncate(uint256,uint256)"))), input...))
+	assert.Nil(err)
+
+	input, _ = util.EncodeReturnValue(handle, uint64(1), uint64(4))
+	ret, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("ReadAt(uint256,uint256,uint256)"))), input...))
+	assert.Nil(err)
+	var data []byte
+	assert.Nil(util.ExtractParam(ret, &data))
+	assert.Equal([]byte("ello"), data)
+
+	input, _ = util.EncodeReturnValue(handle, uint64(3))
+	ret, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Seek(uint256,uint256)"))), input...))
+	assert.Nil(err)
+	var pos uint64
+	assert.Nil(util.ExtractParam(ret, &pos))
+	assert.Equal(uint64(3), pos)
+
+	input, _ = util.EncodeReturnValue(handle)
+	ret, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Length(uint256)"))), input...))
+	assert.Nil(err)
+	var length uint64
+	assert.Nil(util.ExtractParam(ret, &length))
+	assert.Equal(uint64(5), length)
+
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Close(uint256)"))), input...))
+	assert.Nil(err)
+
+	input, _ = util.EncodeReturnValue(uint64(2), uint64(0))
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Seek(uint256,uint256)"))), input...))
+	assert.Equal(InvalidHandleError, err)
+
+	assert.Nil(bc.Release())
+	assert.Equal(0, len(lowLevelCache))
+}
+
+func TestBufferExecute_Events(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	mockLowLevelCache(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+	logs := make([]*types.Log, 0)
+	bc.SetEventEmitter(func(address types.Address, topics []types.Hash, data []byte) {
+		logs = append(logs, &types.Log{Address: address, Topics: topics, Data: data})
+	})
+
+	input, _ := util.EncodeReturnValue([]byte("Hello"))
+	_, err := BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Write(bytes)"))), input...))
+	assert.Nil(err)
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Write(bytes)"))), input...))
+	assert.Nil(err)
+
+	ret, err := BufferExecute(bc, util.ExtractMethodHash(util.Hash([]byte("Open()"))))
+	assert.Nil(err)
+	var handle uint64
+	assert.Nil(util.ExtractParam(ret, &handle))
+	input, _ = util.EncodeReturnValue(handle, uint64(0), []byte("World"))
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("WriteAt(uint256,uint256,bytes)"))), input...))
+	assert.Nil(err)
+
+	assert.Equal(3, len(logs))
+	var offset, size uint64
+	for i, expected := range []struct{ handle, offset uint64 }{{DefaultHandle, 0}, {DefaultHandle, 5}, {handle, 0}} {
+		assert.Equal(SystemBufferAddr, logs[i].Address)
+		assert.Equal([]types.Hash{BufferWrittenEvent.Id(), mockOwnerTopic(), handleTopic(expected.handle)}, logs[i].Topics)
+		assert.Nil(util.ExtractParam(logs[i].Data, &offset, &size))
+		assert.Equal(expected.offset, offset)
+		assert.Equal(uint64(5), size)
+	}
+}
+
+func mockOwnerTopic() types.Hash {
+	var topic types.Hash
+	copy(topic[12:], mockOwner[:])
+	return topic
+}
+
+func handleTopic(handle uint64) types.Hash {
+	var topic types.Hash
+	binary.BigEndian.PutUint64(topic[24:], handle)
+	return topic
+}
+
+func TestSystemBufferContract_GasMeter(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	mockLowLevelCache(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+	meter := util.NewGasMeter(3*params.SysBufferChunkGas + 300*params.SysBufferByteGas)
+	bc.SetGasMeter(meter)
+
+	// the bytes, the partial chunk filled up and the new chunk are charged
+	_, err := bc.Write(make([]byte, 100))
+	assert.Nil(err)
+	_, err = bc.Write(make([]byte, 200))
+	assert.Nil(err)
+	assert.Equal(uint64(0), meter.Gas())
+	_, err = bc.Write(make([]byte, 1))
+	assert.Equal(util.OutOfGasError, err)
+
+	meter.RefundGas(params.SysBufferOpenGas)
+	handleBuffer, err := bc.Open()
+	assert.Nil(err)
+	assert.Equal(uint64(0), meter.Gas())
+	_, err = handleBuffer.WriteAt(0, []byte{0x1})
+	assert.Equal(util.OutOfGasError, err)
+
+	// the overwritten bytes are charged once
+	meter.RefundGas(2*params.SysBufferChunkGas + 10*params.SysBufferByteGas)
+	_, err = bc.WriteAt(295, make([]byte, 10))
+	assert.Nil(err)
+	assert.Equal(uint64(0), meter.Gas())
+}
+
+func TestBufferExecute_ReadFromCursor(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	mockLowLevelCache(db)
+	bc := NewSystemBufferContract(db, mockOwner, DefaultHandle)
+	input, _ := util.EncodeReturnValue([]byte("Hello, World"))
+	_, err := BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Write(bytes)"))), input...))
+	assert.Nil(err)
+
+	readHash := util.ExtractMethodHash(util.Hash([]byte("Read(uint256,uint256)")))
+	read := func(size uint64) []byte {
+		// every call works on a new contract instance, only the persisted cursor is shared
+		input, _ := util.EncodeReturnValue(DefaultHandle, size)
+		ret, err := BufferExecute(NewSystemBufferContract(db, mockOwner, DefaultHandle), append(readHash, input...))
+		assert.Nil(err)
+		var data []byte
+		assert.Nil(util.ExtractParam(ret, &data))
+		return data
+	}
+	assert.Equal([]byte("Hello"), read(5))
+	assert.Equal([]byte(", World"), read(20))
+	assert.Equal(0, len(read(5)))
+
+	input, _ = util.EncodeReturnValue(DefaultHandle, uint64(7))
+	_, err = BufferExecute(bc, append(util.ExtractMethodHash(util.Hash([]byte("Seek(uint256,uint256)"))), input...))
+	assert.Nil(err)
+	assert.Equal([]byte("World"), read(5))
+	assert.False(IsViewMethod(readHash))
+}
@@ -0,0 +1,103 @@
+package oracle
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	InvalidJsonPathError  = errors.New("invalid json path")
+	JsonPathNotFoundError = errors.New("json path not found")
+)
+
+// ExtractJsonPath return the value at path of the json document.
+// The path is a dot separated field list with optional array indexes, such as `$.data.prices[0].usd`.
+// String value is returned as its raw text, number as its literal, and others as compact json.
+func ExtractJsonPath(data []byte, path string) ([]byte, error) {
+	segments, err := parseJsonPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err = decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			if segment.isIndex {
+				return nil, errors.Errorf("%v: %s", JsonPathNotFoundError, path)
+			}
+			field, ok := node[segment.field]
+			if !ok {
+				return nil, errors.Errorf("%v: %s", JsonPathNotFoundError, path)
+			}
+			value = field
+		case []interface{}:
+			if !segment.isIndex || segment.index >= len(node) {
+				return nil, errors.Errorf("%v: %s", JsonPathNotFoundError, path)
+			}
+			value = node[segment.index]
+		default:
+			return nil, errors.Errorf("%v: %s", JsonPathNotFoundError, path)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case json.Number:
+		return []byte(v.String()), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// a field name or array index in json path
+type jsonPathSegment struct {
+	field   string
+	index   int
+	isIndex bool
+}
+
+// split the json path into segments
+func parseJsonPath(path string) ([]jsonPathSegment, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	segments := make([]jsonPathSegment, 0)
+	if len(path) == 0 {
+		return segments, nil
+	}
+	for _, part := range strings.Split(path, ".") {
+		field := part
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			field = part[:i]
+		}
+		if len(field) > 0 {
+			segments = append(segments, jsonPathSegment{field: field})
+		}
+		rest := part[len(field):]
+		if len(field) == 0 && len(rest) == 0 {
+			return nil, errors.Errorf("%v: %s", InvalidJsonPathError, path)
+		}
+		for len(rest) > 0 {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end < 0 {
+				return nil, errors.Errorf("%v: %s", InvalidJsonPathError, path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, errors.Errorf("%v: %s", InvalidJsonPathError, path)
+			}
+			segments = append(segments, jsonPathSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,36 @@
+package oracle
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExtractJsonPath(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte(`{"a":{"b":[{"c":"text"},{"c":12345678901234567890}]},"d":true,"e":null}`)
+	tests := map[string]string{
+		"":           `{"a":{"b":[{"c":"text"},{"c":12345678901234567890}]},"d":true,"e":null}`,
+		"$":          `{"a":{"b":[{"c":"text"},{"c":12345678901234567890}]},"d":true,"e":null}`,
+		"$.a.b[0].c": "text",
+		"a.b[1].c":   "12345678901234567890",
+		"a.b[0]":     `{"c":"text"}`,
+		"d":          "true",
+		"e":          "null",
+	}
+	for path, expect := range tests {
+		ret, err := ExtractJsonPath(data, path)
+		assert.Nil(err, path)
+		assert.Equal(expect, string(ret), path)
+	}
+
+	for _, path := range []string{"x", "a.b[2]", "a[0]", "a.b.c", "d.e"} {
+		_, err := ExtractJsonPath(data, path)
+		assert.NotNil(err, path)
+	}
+	for _, path := range []string{"a..b", "a.b[x]", "a.b[0", "a.b[-1]"} {
+		_, err := ExtractJsonPath(data, path)
+		assert.NotNil(err, path)
+	}
+	_, err := ExtractJsonPath([]byte("not json"), "a")
+	assert.NotNil(err)
+}
@@ -0,0 +1,464 @@
+package oracle
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	cutil "github.com/DSiSc/crypto-suite/util"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/constant"
+	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var OracleAddr = cutil.HexToAddress("0000000000000000000000000000000000011010")
+
+// SignatureHeader is the response header carrying the signature of the response,
+// it is the hex encoded [R || S || V] secp256k1 signature of SignatureHash.
+const SignatureHeader = "X-Oracle-Signature"
+
+// TimestampHeader is the response header carrying the unix time in seconds when the response is signed
+const TimestampHeader = "X-Oracle-Timestamp"
+
+// MaxResponseAge is the max difference in seconds between the response timestamp and the block time
+const MaxResponseAge = uint64(300)
+
+const (
+	getOp  = "oracle-get"
+	postOp = "oracle-post"
+
+	oracleEndpointsKey = "OracleEndpointsKey"
+)
+
+var (
+	getMethodHash          = string(util.ExtractMethodHash(util.Hash([]byte("Get(string,string)"))))
+	postMethodHash         = string(util.ExtractMethodHash(util.Hash([]byte("Post(string,bytes,string)"))))
+	getToBufferMethodHash  = string(util.ExtractMethodHash(util.Hash([]byte("GetToBuffer(string,string)"))))
+	postToBufferMethodHash = string(util.ExtractMethodHash(util.Hash([]byte("PostToBuffer(string,bytes,string)"))))
+	setEndpointMethodHash  = string(util.ExtractMethodHash(util.Hash([]byte("SetEndpoint(string,address)"))))
+	removeEndpointHash     = string(util.ExtractMethodHash(util.Hash([]byte("RemoveEndpoint(string)"))))
+	transferGovernorHash   = string(util.ExtractMethodHash(util.Hash([]byte("TransferGovernor(address)"))))
+)
+
+var (
+	NotWhitelistedError    = errors.New("url is not whitelisted")
+	InvalidSignatureError  = errors.New("invalid response signature")
+	ResponseTooLargeError  = errors.New("response too large")
+	MissingSignatureError  = errors.New("response signature is missing")
+	UnexpectedSignerError  = errors.New("response is not signed by the endpoint signer")
+	InvalidStatusCodeError = errors.New("invalid response status")
+	InvalidTimestampError  = errors.New("invalid response timestamp")
+	StaleResponseError     = errors.New("response timestamp is too far from the block time")
+	EndpointNotFoundError  = errors.New("endpoint not found")
+	WitnessRequiredError   = errors.New("oracle request requires the storage witness")
+)
+
+// execute the oracle contract, caller is the address calling the contract
+func OracleExecute(oracle *OracleContract, caller types.Address, input []byte) ([]byte, error) {
+	methodHash := util.ExtractMethodHash(input)
+	switch string(methodHash) {
+	case getMethodHash, getToBufferMethodHash:
+		rawUrl := new(string)
+		jsonPath := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		result, err := oracle.Get(*rawUrl, *jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		if string(methodHash) == getToBufferMethodHash {
+			return oracle.writeBuffer(result)
+		}
+		return util.EncodeReturnValue(result)
+	case postMethodHash, postToBufferMethodHash:
+		rawUrl := new(string)
+		body := make([]byte, 0)
+		jsonPath := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, &body, jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		result, err := oracle.Post(*rawUrl, body, *jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		if string(methodHash) == postToBufferMethodHash {
+			return oracle.writeBuffer(result)
+		}
+		return util.EncodeReturnValue(result)
+	case setEndpointMethodHash:
+		var rawUrl string
+		var signer types.Address
+		err := util.ExtractParam(input[len(methodHash):], &rawUrl, &signer)
+		if err != nil {
+			return nil, err
+		}
+		return nil, oracle.SetEndpoint(caller, Endpoint{Url: rawUrl, Signer: signer})
+	case removeEndpointHash:
+		var rawUrl string
+		err := util.ExtractParam(input[len(methodHash):], &rawUrl)
+		if err != nil {
+			return nil, err
+		}
+		return nil, oracle.RemoveEndpoint(caller, rawUrl)
+	case transferGovernorHash:
+		var governor types.Address
+		err := util.ExtractParam(input[len(methodHash):], &governor)
+		if err != nil {
+			return nil, err
+		}
+		return nil, util.NewGovernor(oracle.db, OracleAddr).Transfer(caller, governor)
+	default:
+		return nil, errors.New("unknown method")
+	}
+}
+
+// Endpoint a whitelisted http endpoint, the endpoints are recorded in the contract state and managed by the governor
+type Endpoint struct {
+	// Url prefix of the whitelisted urls, such as `https://api.example.com/price`
+	Url string
+	// Signer address of the key signing the responses of the endpoint
+	Signer types.Address
+}
+
+// Config node configuration of the oracle contract
+type Config struct {
+	// Timeout deadline of an oracle contract call, 0 means no deadline
+	Timeout time.Duration
+	// MaxResponseSize max size of the response body, 0 means no limit
+	MaxResponseSize uint64
+}
+
+// DefaultConfig return the default oracle config
+func DefaultConfig() Config {
+	return Config{
+		Timeout:         10 * time.Second,
+		MaxResponseSize: 1024 * 1024,
+	}
+}
+
+var (
+	lock   sync.RWMutex
+	config = DefaultConfig()
+)
+
+// SetConfig set the oracle config of the node
+func SetConfig(c Config) {
+	lock.Lock()
+	defer lock.Unlock()
+	config = c
+}
+
+// GetConfig return the oracle config of the node
+func GetConfig() Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// SetupGenesis record the governor and the initial whitelisted endpoints in the genesis state
+func SetupGenesis(db *repository.Repository, governor types.Address, endpoints ...Endpoint) error {
+	for _, endpoint := range endpoints {
+		if _, err := parseEndpointUrl(endpoint.Url); err != nil {
+			return err
+		}
+	}
+	if err := util.NewGovernor(db, OracleAddr).Set(governor); err != nil {
+		return err
+	}
+	return putEndpoints(db, endpoints)
+}
+
+// signed response recorded in witness, validators verify the signature again
+type signedResponse struct {
+	Body      []byte
+	Timestamp uint64
+	Signature []byte
+}
+
+// SignatureHash return the hash signed by the endpoint, it is
+// keccak256(len(url) || url || len(request) || request || timestamp || body),
+// where the lengths and the timestamp are 8 bytes big endian, the request is empty for GET.
+func SignatureHash(rawurl string, request []byte, timestamp uint64, body []byte) []byte {
+	var urlLen, requestLen, timestampBytes [8]byte
+	binary.BigEndian.PutUint64(urlLen[:], uint64(len(rawurl)))
+	binary.BigEndian.PutUint64(requestLen[:], uint64(len(request)))
+	binary.BigEndian.PutUint64(timestampBytes[:], timestamp)
+	return crypto.Keccak256(urlLen[:], []byte(rawurl), requestLen[:], request, timestampBytes[:], body)
+}
+
+// OracleContract fetch the signed data from the whitelisted http endpoints
+type OracleContract struct {
+	ctx         context.Context
+	db          *repository.Repository
+	blockTime   uint64
+	sysBufferRW *buffer.SystemBufferReadWriterCloser
+	witness     *storage.Witness
+	client      *http.Client
+}
+
+// NewOracleContract create a new instance.
+// ctx: the http requests are aborted once ctx is done
+// blockTime: time of the executing block, the responses signed too far from it are rejected
+// witness: responses fetched while executing the block, the requests fail with WitnessRequiredError if it is nil,
+// since the live responses can't be reproduced by the validators
+func NewOracleContract(ctx context.Context, db *repository.Repository, blockTime uint64, rw *buffer.SystemBufferReadWriterCloser, witness *storage.Witness) *OracleContract {
+	return &OracleContract{
+		ctx:         ctx,
+		db:          db,
+		blockTime:   blockTime,
+		sysBufferRW: rw,
+		witness:     witness,
+		client:      &http.Client{},
+	}
+}
+
+// Get send a GET request to the whitelisted url, and return the value at jsonPath of the verified response,
+// the whole response body is returned if jsonPath is empty.
+func (this *OracleContract) Get(rawurl, jsonPath string) ([]byte, error) {
+	return this.request(getOp, http.MethodGet, rawurl, nil, jsonPath)
+}
+
+// Post send a POST request with json body to the whitelisted url, and return the value at jsonPath of the verified response,
+// the whole response body is returned if jsonPath is empty.
+func (this *OracleContract) Post(rawurl string, body []byte, jsonPath string) ([]byte, error) {
+	return this.request(postOp, http.MethodPost, rawurl, body, jsonPath)
+}
+
+func (this *OracleContract) Address() types.Address {
+	return OracleAddr
+}
+
+// Endpoints return the whitelisted endpoints recorded in the contract state
+func (this *OracleContract) Endpoints() []Endpoint {
+	endpoints := make([]Endpoint, 0)
+	val, err := this.db.Get(util.Hash([]byte(oracleEndpointsKey)))
+	if err != nil || len(val) == 0 || rlp.DecodeBytes(val, &endpoints) != nil {
+		return make([]Endpoint, 0)
+	}
+	return endpoints
+}
+
+// SetEndpoint whitelist the endpoint, the signer is replaced if the endpoint url is whitelisted already.
+// only the governor can change the endpoints.
+func (this *OracleContract) SetEndpoint(caller types.Address, endpoint Endpoint) error {
+	if err := util.NewGovernor(this.db, OracleAddr).Check(caller); err != nil {
+		return err
+	}
+	if _, err := parseEndpointUrl(endpoint.Url); err != nil {
+		return err
+	}
+	endpoints := this.Endpoints()
+	for i := range endpoints {
+		if endpoints[i].Url == endpoint.Url {
+			endpoints[i].Signer = endpoint.Signer
+			return putEndpoints(this.db, endpoints)
+		}
+	}
+	return putEndpoints(this.db, append(endpoints, endpoint))
+}
+
+// RemoveEndpoint remove the endpoint with the url from the whitelist, only the governor can change the endpoints.
+func (this *OracleContract) RemoveEndpoint(caller types.Address, rawurl string) error {
+	if err := util.NewGovernor(this.db, OracleAddr).Check(caller); err != nil {
+		return err
+	}
+	endpoints := this.Endpoints()
+	for i := range endpoints {
+		if endpoints[i].Url == rawurl {
+			return putEndpoints(this.db, append(endpoints[:i], endpoints[i+1:]...))
+		}
+	}
+	return EndpointNotFoundError
+}
+
+// send the request through the witness, then verify and extract the response
+func (this *OracleContract) request(op, method, rawurl string, body []byte, jsonPath string) ([]byte, error) {
+	config := GetConfig()
+	endpoint, err := matchEndpoint(this.Endpoints(), rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	callFunc := func() ([]byte, error) {
+		resp, err := this.send(config, method, rawurl, body)
+		if err != nil {
+			return nil, err
+		}
+		return rlp.EncodeToBytes(resp)
+	}
+	if this.witness == nil {
+		return nil, WitnessRequiredError
+	}
+	name := fmt.Sprintf("%x:%s", util.Hash(body), jsonPath)
+	encodedResp, err := this.witness.Call(op, rawurl, name, callFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(signedResponse)
+	if err = rlp.DecodeBytes(encodedResp, resp); err != nil {
+		return nil, err
+	}
+	if err = verifySignature(resp, endpoint.Signer, rawurl, body, this.blockTime); err != nil {
+		return nil, err
+	}
+	if len(jsonPath) == 0 {
+		return resp.Body, nil
+	}
+	return ExtractJsonPath(resp.Body, jsonPath)
+}
+
+// send the http request, return the response body and its signature
+func (this *OracleContract) send(config Config, method, rawurl string, body []byte) (*signedResponse, error) {
+	ctx := this.ctx
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest(method, rawurl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := this.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("%v: %s", InvalidStatusCodeError, resp.Status)
+	}
+
+	var reader io.Reader = resp.Body
+	if config.MaxResponseSize > 0 {
+		reader = io.LimitReader(resp.Body, int64(config.MaxResponseSize)+1)
+	}
+	respBody, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxResponseSize > 0 && uint64(len(respBody)) > config.MaxResponseSize {
+		return nil, ResponseTooLargeError
+	}
+	signature, err := hexutil.Decode(resp.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, MissingSignatureError
+	}
+	timestamp, err := strconv.ParseUint(resp.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return nil, InvalidTimestampError
+	}
+	return &signedResponse{
+		Body:      respBody,
+		Timestamp: timestamp,
+		Signature: signature,
+	}, nil
+}
+
+// write the result to `sysBufferRW`, return the encoded buffer address
+func (this *OracleContract) writeBuffer(result []byte) ([]byte, error) {
+	for len(result) > 0 {
+		size := len(result)
+		if size > constant.BufferMaxReadWriteSize {
+			size = constant.BufferMaxReadWriteSize
+		}
+		nw, err := this.sysBufferRW.Write(result[:size])
+		if err != nil {
+			return nil, err
+		}
+		if nw < size {
+			return nil, io.ErrShortWrite
+		}
+		result = result[size:]
+	}
+	return util.EncodeReturnValue(this.sysBufferRW.ContractAddress())
+}
+
+// verify the response of the request is signed by signer, and it is signed around the block time
+func verifySignature(resp *signedResponse, signer types.Address, rawurl string, request []byte, blockTime uint64) error {
+	if resp.Timestamp+MaxResponseAge < blockTime || blockTime+MaxResponseAge < resp.Timestamp {
+		return StaleResponseError
+	}
+	if len(resp.Signature) != 65 {
+		return InvalidSignatureError
+	}
+	sig := make([]byte, 65)
+	copy(sig, resp.Signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pubKey, err := crypto.Ecrecover(SignatureHash(rawurl, request, resp.Timestamp, resp.Body), sig)
+	if err != nil || len(pubKey) == 0 {
+		return InvalidSignatureError
+	}
+	var recovered types.Address
+	copy(recovered[:], crypto.Keccak256(pubKey[1:])[12:])
+	if recovered != signer {
+		return UnexpectedSignerError
+	}
+	return nil
+}
+
+// find the whitelisted endpoint matching the url
+func matchEndpoint(endpoints []Endpoint, rawurl string) (*Endpoint, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	for i := range endpoints {
+		prefix, err := parseEndpointUrl(endpoints[i].Url)
+		if err != nil {
+			continue
+		}
+		if u.Scheme != prefix.Scheme || u.Host != prefix.Host || len(u.User.String()) > 0 {
+			continue
+		}
+		prefixPath := strings.TrimSuffix(prefix.Path, "/")
+		if u.Path == prefixPath || strings.HasPrefix(u.Path, prefixPath+"/") {
+			return &endpoints[i], nil
+		}
+	}
+	return nil, errors.Errorf("%v: %s", NotWhitelistedError, rawurl)
+}
+
+// record the whitelisted endpoints in the contract state
+func putEndpoints(db *repository.Repository, endpoints []Endpoint) error {
+	val, err := rlp.EncodeToBytes(endpoints)
+	if err != nil {
+		return err
+	}
+	return db.Put(util.Hash([]byte(oracleEndpointsKey)), val)
+}
+
+// parse the endpoint url prefix, only http and https are allowed
+func parseEndpointUrl(rawurl string) (*url.URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, errors.Errorf("invalid endpoint url: %s", rawurl)
+	}
+	return u, nil
+}
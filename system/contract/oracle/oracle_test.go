@@ -0,0 +1,301 @@
+package oracle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const (
+	testPriceJson = `{"data":{"symbol":"ETH","prices":[{"usd":1234.5678}]}}`
+	mockBlockTime = uint64(1600000000)
+)
+
+var mockGovernor = types.Address{0x1}
+
+// mockSignedServer sign the responses at mockBlockTime, the response of `/price/echo` is the request body
+func mockSignedServer(t *testing.T, key *ecdsa.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, _ := ioutil.ReadAll(r.Body)
+		body := []byte(testPriceJson)
+		if r.URL.Path == "/price/echo" {
+			body = request
+		}
+		rawurl := "http://" + r.Host + r.URL.RequestURI()
+		sig, err := crypto.Sign(SignatureHash(rawurl, request, mockBlockTime, body), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Path != "/price/unsigned" {
+			w.Header().Set(SignatureHeader, hexutil.Encode(sig))
+		}
+		w.Header().Set(TimestampHeader, strconv.FormatUint(mockBlockTime, 10))
+		w.Write(body)
+	}))
+}
+
+func mockOracleDB() *repository.Repository {
+	db := &repository.Repository{}
+	cache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return cache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		cache[string(key)] = value
+		return nil
+	})
+	return db
+}
+
+// mockOracleContract create the oracle contract whitelisting the `/price` endpoint of the server
+func mockOracleContract(t *testing.T, db *repository.Repository, server *httptest.Server, signer types.Address, witness *storage.Witness) (*OracleContract, *bytes.Buffer) {
+	if err := SetupGenesis(db, mockGovernor, Endpoint{Url: server.URL + "/price", Signer: signer}); err != nil {
+		t.Fatal(err)
+	}
+	bytesBuffer := bytes.NewBufferString("")
+	sysBufferRW := &buffer.SystemBufferReadWriterCloser{}
+	monkey.PatchInstanceMethod(reflect.TypeOf(sysBufferRW), "Write", func(brw *buffer.SystemBufferReadWriterCloser, p []byte) (n int, err error) {
+		return bytesBuffer.Write(p)
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(sysBufferRW), "ContractAddress", func(brw *buffer.SystemBufferReadWriterCloser) types.Address {
+		return buffer.SystemBufferAddr
+	})
+	return NewOracleContract(context.Background(), db, mockBlockTime, sysBufferRW, witness), bytesBuffer
+}
+
+func TestSetupGenesis(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockOracleDB()
+	assert.NotNil(SetupGenesis(db, mockGovernor, Endpoint{Url: "ftp://example.com"}))
+	assert.NotNil(SetupGenesis(db, mockGovernor, Endpoint{Url: "/price"}))
+	assert.Nil(SetupGenesis(db, mockGovernor, Endpoint{Url: "https://example.com/price"}))
+
+	oracle := NewOracleContract(context.Background(), db, mockBlockTime, nil, nil)
+	assert.Equal([]Endpoint{{Url: "https://example.com/price"}}, oracle.Endpoints())
+	governor, _ := util.NewGovernor(db, OracleAddr).Address()
+	assert.Equal(mockGovernor, governor)
+}
+
+func TestOracleContract_SetEndpoint(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockOracleDB()
+	assert.Nil(SetupGenesis(db, mockGovernor))
+	oracle := NewOracleContract(context.Background(), db, mockBlockTime, nil, nil)
+	signer := types.Address{0x2}
+
+	// only the governor can change the endpoints
+	assert.Equal(util.NotGovernorError, oracle.SetEndpoint(signer, Endpoint{Url: "https://example.com/price", Signer: signer}))
+	assert.Equal(util.NotGovernorError, oracle.RemoveEndpoint(signer, "https://example.com/price"))
+	assert.NotNil(oracle.SetEndpoint(mockGovernor, Endpoint{Url: "ftp://example.com"}))
+
+	assert.Nil(oracle.SetEndpoint(mockGovernor, Endpoint{Url: "https://example.com/price"}))
+	assert.Nil(oracle.SetEndpoint(mockGovernor, Endpoint{Url: "https://example.com/weather"}))
+	assert.Nil(oracle.SetEndpoint(mockGovernor, Endpoint{Url: "https://example.com/price", Signer: signer}))
+	assert.Equal([]Endpoint{{Url: "https://example.com/price", Signer: signer}, {Url: "https://example.com/weather"}}, oracle.Endpoints())
+
+	assert.Nil(oracle.RemoveEndpoint(mockGovernor, "https://example.com/price"))
+	assert.Equal(EndpointNotFoundError, oracle.RemoveEndpoint(mockGovernor, "https://example.com/price"))
+	assert.Equal([]Endpoint{{Url: "https://example.com/weather"}}, oracle.Endpoints())
+}
+
+func TestMatchEndpoint(t *testing.T) {
+	assert := assert.New(t)
+	endpoints := []Endpoint{{Url: "https://example.com/price/"}}
+	_, err := matchEndpoint(endpoints, "https://example.com/price")
+	assert.Nil(err)
+	_, err = matchEndpoint(endpoints, "https://example.com/price/eth?base=usd")
+	assert.Nil(err)
+	_, err = matchEndpoint(endpoints, "https://example.com/prices")
+	assert.NotNil(err)
+	_, err = matchEndpoint(endpoints, "http://example.com/price")
+	assert.NotNil(err)
+	_, err = matchEndpoint(endpoints, "https://example.com.evil.org/price")
+	assert.NotNil(err)
+	_, err = matchEndpoint(endpoints, "https://user@example.com/price")
+	assert.NotNil(err)
+}
+
+func TestOracleContract_Get(t *testing.T) {
+	assert := assert.New(t)
+	key, _ := crypto.GenerateKey()
+	server := mockSignedServer(t, key)
+	defer server.Close()
+	defer monkey.UnpatchAll()
+
+	oracle, _ := mockOracleContract(t, mockOracleDB(), server, crypto.PubkeyToAddress(key.PublicKey), storage.NewProposerWitness())
+	assert.Equal(OracleAddr, oracle.Address())
+	ret, err := oracle.Get(server.URL+"/price", "")
+	assert.Nil(err)
+	assert.Equal(testPriceJson, string(ret))
+	ret, err = oracle.Get(server.URL+"/price", "$.data.prices[0].usd")
+	assert.Nil(err)
+	assert.Equal("1234.5678", string(ret))
+
+	_, err = oracle.Get(server.URL+"/other", "")
+	assert.NotNil(err)
+	_, err = oracle.Get(server.URL+"/price/unsigned", "")
+	assert.NotNil(err)
+
+	// responses signed too long before or after the block time are rejected
+	oracle.blockTime = mockBlockTime + MaxResponseAge + 1
+	_, err = oracle.Get(server.URL+"/price", "")
+	assert.Equal(StaleResponseError, err)
+	oracle.blockTime = mockBlockTime - MaxResponseAge - 1
+	_, err = oracle.Get(server.URL+"/price", "")
+	assert.Equal(StaleResponseError, err)
+}
+
+// test the signature binds the response to the url and the request
+func TestVerifySignature(t *testing.T) {
+	assert := assert.New(t)
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	body := []byte(testPriceJson)
+	sig, _ := crypto.Sign(SignatureHash("https://example.com/price", []byte("ab"), mockBlockTime, body), key)
+	resp := &signedResponse{Body: body, Timestamp: mockBlockTime, Signature: sig}
+
+	assert.Nil(verifySignature(resp, signer, "https://example.com/price", []byte("ab"), mockBlockTime))
+	assert.Nil(verifySignature(resp, signer, "https://example.com/price", []byte("ab"), mockBlockTime+MaxResponseAge))
+	assert.Equal(StaleResponseError, verifySignature(resp, signer, "https://example.com/price", []byte("ab"), mockBlockTime+MaxResponseAge+1))
+	assert.Equal(UnexpectedSignerError, verifySignature(resp, signer, "https://example.com/prices", []byte("ab"), mockBlockTime))
+	assert.Equal(UnexpectedSignerError, verifySignature(resp, signer, "https://example.com/price", []byte("ac"), mockBlockTime))
+	assert.Equal(UnexpectedSignerError, verifySignature(resp, signer, "https://example.com/pricea", []byte("b"), mockBlockTime))
+
+	replayed := *resp
+	replayed.Timestamp++
+	assert.Equal(UnexpectedSignerError, verifySignature(&replayed, signer, "https://example.com/price", []byte("ab"), mockBlockTime))
+}
+
+func TestOracleContract_UnexpectedSigner(t *testing.T) {
+	assert := assert.New(t)
+	key, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	server := mockSignedServer(t, key)
+	defer server.Close()
+	defer monkey.UnpatchAll()
+
+	oracle, _ := mockOracleContract(t, mockOracleDB(), server, crypto.PubkeyToAddress(otherKey.PublicKey), storage.NewProposerWitness())
+	_, err := oracle.Get(server.URL+"/price", "")
+	assert.Equal(UnexpectedSignerError, err)
+}
+
+func TestOracleContract_ResponseTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	key, _ := crypto.GenerateKey()
+	server := mockSignedServer(t, key)
+	defer server.Close()
+	defer monkey.UnpatchAll()
+	config := DefaultConfig()
+	config.MaxResponseSize = 8
+	SetConfig(config)
+	defer SetConfig(DefaultConfig())
+
+	oracle, _ := mockOracleContract(t, mockOracleDB(), server, crypto.PubkeyToAddress(key.PublicKey), storage.NewProposerWitness())
+	_, err := oracle.Get(server.URL+"/price", "")
+	assert.Equal(ResponseTooLargeError, err)
+}
+
+func TestOracleExecute(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	key, _ := crypto.GenerateKey()
+	server := mockSignedServer(t, key)
+	defer server.Close()
+
+	oracle, bytesBuffer := mockOracleContract(t, mockOracleDB(), server, crypto.PubkeyToAddress(key.PublicKey), storage.NewProposerWitness())
+	input, _ := util.EncodeReturnValue(server.URL+"/price", "data.symbol")
+	ret, err := OracleExecute(oracle, mockGovernor, append(util.ExtractMethodHash(util.Hash([]byte("Get(string,string)"))), input...))
+	assert.Nil(err)
+	var result []byte
+	assert.Nil(util.ExtractParam(ret, &result))
+	assert.Equal("ETH", string(result))
+
+	input, _ = util.EncodeReturnValue(server.URL+"/price/echo", []byte(`{"value":[1,2]}`), "value")
+	ret, err = OracleExecute(oracle, mockGovernor, append(util.ExtractMethodHash(util.Hash([]byte("PostToBuffer(string,bytes,string)"))), input...))
+	assert.Nil(err)
+	var bufferAddr types.Address
+	assert.Nil(util.ExtractParam(ret, &bufferAddr))
+	assert.Equal(buffer.SystemBufferAddr, bufferAddr)
+	assert.Equal("[1,2]", bytesBuffer.String())
+
+	// governed methods
+	input, _ = util.EncodeReturnValue(server.URL+"/weather", types.Address{0x2})
+	_, err = OracleExecute(oracle, types.Address{0x2}, append(util.ExtractMethodHash(util.Hash([]byte("SetEndpoint(string,address)"))), input...))
+	assert.Equal(util.NotGovernorError, err)
+	_, err = OracleExecute(oracle, mockGovernor, append(util.ExtractMethodHash(util.Hash([]byte("SetEndpoint(string,address)"))), input...))
+	assert.Nil(err)
+	assert.Equal(2, len(oracle.Endpoints()))
+	input, _ = util.EncodeReturnValue(server.URL + "/weather")
+	_, err = OracleExecute(oracle, mockGovernor, append(util.ExtractMethodHash(util.Hash([]byte("RemoveEndpoint(string)"))), input...))
+	assert.Nil(err)
+	assert.Equal(1, len(oracle.Endpoints()))
+	input, _ = util.EncodeReturnValue(types.Address{0x2})
+	_, err = OracleExecute(oracle, mockGovernor, append(util.ExtractMethodHash(util.Hash([]byte("TransferGovernor(address)"))), input...))
+	assert.Nil(err)
+	assert.Equal(util.NotGovernorError, oracle.SetEndpoint(mockGovernor, Endpoint{Url: server.URL + "/weather"}))
+
+	_, err = OracleExecute(oracle, mockGovernor, []byte{0, 0, 0, 0})
+	assert.NotNil(err)
+}
+
+func TestOracleContract_Witness(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	key, _ := crypto.GenerateKey()
+	server := mockSignedServer(t, key)
+	db := mockOracleDB()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	proposerWitness := storage.NewProposerWitness()
+	oracle, _ := mockOracleContract(t, db, server, signer, proposerWitness)
+	ret, err := oracle.Get(server.URL+"/price", "data.symbol")
+	assert.Nil(err)
+	assert.Equal("ETH", string(ret))
+	data, err := proposerWitness.Encode()
+	assert.Nil(err)
+
+	// validators replay the response without accessing the endpoint
+	server.Close()
+	validatorWitness, err := storage.NewValidatorWitness(data)
+	assert.Nil(err)
+	oracle, _ = mockOracleContract(t, db, server, signer, validatorWitness)
+	ret, err = oracle.Get(server.URL+"/price", "data.symbol")
+	assert.Nil(err)
+	assert.Equal("ETH", string(ret))
+	assert.Nil(validatorWitness.Finish())
+
+	// the signature is verified by validators too
+	validatorWitness, _ = storage.NewValidatorWitness(data)
+	oracle, _ = mockOracleContract(t, db, server, types.Address{}, validatorWitness)
+	_, err = oracle.Get(server.URL+"/price", "data.symbol")
+	assert.Equal(UnexpectedSignerError, err)
+
+	// the freshness is checked with the block time of validators
+	validatorWitness, _ = storage.NewValidatorWitness(data)
+	oracle, _ = mockOracleContract(t, db, server, signer, validatorWitness)
+	oracle.blockTime = mockBlockTime + MaxResponseAge + 1
+	_, err = oracle.Get(server.URL+"/price", "data.symbol")
+	assert.Equal(StaleResponseError, err)
+
+	// the request fails without accessing the endpoint if there is no witness
+	oracle, _ = mockOracleContract(t, db, server, signer, nil)
+	_, err = oracle.Get(server.URL+"/price", "data.symbol")
+	assert.Equal(WitnessRequiredError, err)
+}
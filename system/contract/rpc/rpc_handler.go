@@ -1,71 +1,101 @@
 package rpc
 
 import (
-	"errors"
+	"encoding/binary"
 	"fmt"
 	"reflect"
 	"math/big"
+	"sort"
+	"strings"
 	"github.com/DSiSc/craft/log"
 	cutil "github.com/DSiSc/crypto-suite/util"
 	"github.com/DSiSc/evm-NG/system/contract/Interaction"
 	"github.com/DSiSc/evm-NG/system/contract/util"
-	wutils "github.com/DSiSc/wallet/utils"
 	wcmn "github.com/DSiSc/web3go/common"
 	"github.com/DSiSc/craft/rlp"
 	wtypes "github.com/DSiSc/wallet/core/types"
 	sutil "github.com/DSiSc/statedb-NG/util"
 	craft "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
 	//ctypes "github.com/DSiSc/craft/types"
 )
 
 var RpcContractAddr = cutil.HexToAddress("0000000000000000000000000000000000011101")
 
+var (
+	// RouteNotFoundError no rpc function is registered with the method selector
+	RouteNotFoundError = errors.New("routes not found")
+	// UnsupportedArgError the arg type of the rpc function can't be mapped to a solidity type
+	UnsupportedArgError = errors.New("unsupported arg type")
+	// InvalidRPCFuncError the rpc function can't be called by Handler
+	InvalidRPCFuncError = errors.New("invalid rpc function")
+	// SelectorCollisionError the method selector has been registered by another rpc function
+	SelectorCollisionError = errors.New("method selector collides with a registered route")
+	// FundsReceivedError the source transaction has been received
+	FundsReceivedError = errors.New("funds of the source transaction have been received")
+)
+
+const receivedFundsKey = "ReceiveFundsProcessedKey"
+
+// FundsForwardedEvent emitted when the funds are forwarded to the target chain
+var FundsForwardedEvent = util.MustNewEvent("FundsForwarded(string indexed chainFlag,string to,uint64 amount,string localTxHash,string targetTxHash)")
+
 // rpc routes
-var routes = map[string]*RPCFunc{
-	string(util.ExtractMethodHash(util.Hash([]byte("ForwardFunds(string,uint64,string,string)")))): NewRPCFunc(ForwardFunds),
-	string(util.ExtractMethodHash(util.Hash([]byte("GetTxState(string,uint64,string,string)")))): NewRPCFunc(GetTxState),
-	string(util.ExtractMethodHash(util.Hash([]byte("ReceiveFunds(address,uint64,string,uint64)")))): NewRPCFunc(ReceiveFunds),
+var routes = make(map[string]*RPCFunc)
+
+func init() {
+	builtins := map[string]interface{}{
+		"ForwardFunds": ForwardFunds,
+		"ReceiveFunds": ReceiveFunds,
+	}
+	for methodName, f := range builtins {
+		if err := Register(methodName, NewRPCFunc(f)); err != nil {
+			panic(err)
+		}
+	}
 }
 
 // 0 means failed, 1 means success
-func ForwardFunds(toAddr string, amount uint64, payload string, chainFlag string) (error, string, string, uint64) {
-	from, _ := Interaction.GetPubliceAcccount()
+func ForwardFunds(emitter util.EventEmitter, toAddr string, amount uint64, payload string, chainFlag string) (error, string, string, uint64) {
+	from, err := Interaction.GetPubliceAcccount()
+	if err != nil {
+		return err, "", "", 0
+	}
 	to := cutil.HexToAddress(toAddr)
 	localHash, targetHash, err := Interaction.CallCrossRawTransactionReq(from, to, amount, payload, chainFlag)
 	if err != nil {
 		return err, "", "", 0
 	}
 
-	localBytes := cutil.HashToBytes(localHash)
-	targetBytes := cutil.HashToBytes(targetHash)
-
-	return err, wcmn.BytesToHex(localBytes), wcmn.BytesToHex(targetBytes), 1
+	localHex := wcmn.BytesToHex(cutil.HashToBytes(localHash))
+	targetHex := wcmn.BytesToHex(cutil.HashToBytes(targetHash))
+	if err = FundsForwardedEvent.Emit(emitter, RpcContractAddr, chainFlag, toAddr, amount, localHex, targetHex); err != nil {
+		return err, "", "", 0
+	}
+	return nil, localHex, targetHex, 1
 }
 
-// GetCross Tx state
-func GetTxState(txHash string, amount uint64, tmp string, chainFlag string) (error, uint64){
-	//call the broadcast the tx
-	port := Interaction.CrossTargetChainPort(chainFlag)
-
-	web, err := wutils.NewWeb3("127.0.0.1", string(port), false)
+// Receipt funds, the source transaction must be included in the block identified by header, which has been
+// relayed to the header relay contract. index and proof are the merkle path of the transaction in the block.
+// The transaction must be sent to the bridge contract of the source chain recorded in the header relay contract.
+// The funds of a source transaction can only be received once.
+func ReceiveFunds(db *repository.Repository, to craft.Address, amount uint64, payload string, srcChainId uint64, header []byte, index uint64, proof []craft.Hash) (error, uint64){
+	//receive tx bytes, decode input
+	input := wcmn.HexToBytes(payload)
+	relay := Interaction.NewHeaderRelayContract(db)
+	srcHeader, err := relay.VerifyTransaction(header, input, index, proof)
 	if err != nil {
 		return err, 0
 	}
-
-	hash := cutil.HexToHash(txHash)
-	receipt, err := web.Eth.GetTransactionReceipt(wcmn.Hash(hash))
-	if err != nil || receipt == nil {
-		return err, 0
+	if srcHeader.ChainID != srcChainId {
+		return errors.New("source chain mismatch with the header"), 0
+	}
+	receivedKey := receivedFundsKeyOf(srcChainId, input)
+	if received, err := db.Get(receivedKey); err == nil && len(received) > 0 {
+		return FundsReceivedError, 0
 	}
 
-	status := uint64(receipt.Status.Int64())
-	return err, status
-}
-
-// Receipt funds
-func ReceiveFunds(to string, amount uint64, payload string, srcChainId uint64) (error, uint64){
-	//receive tx bytes, decode input
-	input := wcmn.HexToBytes(payload)
 	tx := new(craft.Transaction)
 	if err := rlp.DecodeBytes(input, tx); err != nil {
 
@@ -77,6 +107,9 @@ func ReceiveFunds(to string, amount uint64, payload string, srcChainId uint64) (
 		}
 		ethTx.SetTxData(&tx.Data)
 	}
+	if tx.Data.Recipient == nil || tx.Data.Amount == nil {
+		return errors.New("tx args not matched tx's"), 0
+	}
 
 	from_, err := wtypes.Sender(wtypes.NewEIP155Signer(big.NewInt(int64(srcChainId))), tx)
 	if err != nil {
@@ -84,48 +117,78 @@ func ReceiveFunds(to string, amount uint64, payload string, srcChainId uint64) (
 		return err, 0
 	}
 
-	contractAddr := "0x47c5e40890bce4a473a49d7501808b9633f29782"
+	bridge, err := relay.Bridge(srcChainId)
+	if err != nil {
+		return err, 0
+	}
+	contractAddr := sutil.AddressToHex(bridge)
 	targetToInput := wcmn.BytesToHex(tx.Data.Payload)
 	txToAddr := sutil.AddressToHex(*tx.Data.Recipient)
-	fromAddr := sutil.AddressToHex(craft.Address(from_))
-	txFromAddr := sutil.AddressToHex(*tx.Data.From)
+	toAddr := sutil.AddressToHex(to)
+	// the sender is recovered from the signature, the decoded From is only compared if the transaction carries it
+	fromMatched := tx.Data.From == nil || craft.Address(from_) == *tx.Data.From
 	//verify args
-	if amount != tx.Data.Amount.Uint64() || contractAddr != txToAddr || fromAddr != txFromAddr || to != targetToInput{
+	if amount != tx.Data.Amount.Uint64() || contractAddr != txToAddr || !fromMatched || toAddr != targetToInput{
 		return errors.New("tx args not matched tx's"), 0
 	}
+	if err = db.Put(receivedKey, []byte{1}); err != nil {
+		return err, 0
+	}
 
-	log.Info("ReceiveFunds_verify_success, targetToAddr=%s, amount=%d, srcChainId=%d", to, amount, srcChainId)
+	log.Info("ReceiveFunds_verify_success, targetToAddr=%s, amount=%d, srcChainId=%d", toAddr, amount, srcChainId)
 	return nil, 1
 }
 
-// Register register a rpc route
+// return the storage key recording the source transaction has been received
+func receivedFundsKeyOf(srcChainId uint64, tx []byte) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, srcChainId)
+	key = append(key, util.Hash(tx)...)
+	return util.Hash(append([]byte(receivedFundsKey), key...))
+}
+
+// Register register a rpc route, the route selector is computed from the canonical solidity signature of the function.
+// The function must return an error as its first value, and all its args and other return values must be abi
+// encodable, see util.TypeOf. SelectorCollisionError is returned if the selector has been registered.
 func Register(methodName string, f *RPCFunc) error {
-	paramStr := ""
-	for _, arg := range f.args {
-		switch arg.Kind() {
-		case reflect.Uint64:
-			paramStr += "uint64,"
-		case reflect.String:
-			paramStr += "string,"
-		case reflect.Slice:
-			if reflect.Uint8 != arg.Elem().Kind() {
-				return errors.New("unsupported arg type")
-			}
-		}
+	signature, err := f.Signature(methodName)
+	if err != nil {
+		return err
 	}
-	if len(paramStr) > 0 {
-		paramStr = paramStr[:len(paramStr)-1]
+	if err = f.validate(); err != nil {
+		return err
 	}
-	methodHash := util.Hash([]byte(methodName + "(" + paramStr + ")"))[:4]
-	routes[string(methodHash)] = f
+	methodHash := string(util.ExtractMethodHash(util.Hash([]byte(signature))))
+	if routes[methodHash] != nil {
+		return errors.Wrapf(SelectorCollisionError, "%s", signature)
+	}
+	f.name = methodName
+	routes[methodHash] = f
 	return nil
 }
 
-func Handler(input []byte) ([]byte, error) {
+// ABI return the abi metadata of the registered rpc routes
+func ABI() *util.ABI {
+	methods := make([]*util.Method, 0, len(routes))
+	for _, rpcFunc := range routes {
+		methods = append(methods, rpcFunc.method())
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Signature() < methods[j].Signature()
+	})
+	return &util.ABI{
+		Methods: methods,
+		Events:  []*util.Event{FundsForwardedEvent},
+	}
+}
+
+// Handler call the rpc function, db and emitter are passed to the function taking the state repository
+// and the event emitter as its leading arguments
+func Handler(db *repository.Repository, emitter util.EventEmitter, input []byte) ([]byte, error) {
 	method := util.ExtractMethodHash(input)
 	rpcFunc := routes[string(method)]
 	if rpcFunc == nil {
-		return nil, errors.New("routes not found")
+		return nil, RouteNotFoundError
 	}
 
 	args, err := inputParamsToArgs(rpcFunc, input[len(method):])
@@ -133,62 +196,147 @@ func Handler(input []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if rpcFunc.withEmitter {
+		args = append([]reflect.Value{reflect.ValueOf(emitter)}, args...)
+	}
+	if rpcFunc.withState {
+		args = append([]reflect.Value{reflect.ValueOf(db)}, args...)
+	}
+
 	log.Info("contract RPC method: %s", wcmn.BytesToHex(method))
 	returns := rpcFunc.f.Call(args)
 	return encodeResult(returns)
 }
 
-// Covert an http query to a list of properly typed values.
-// To be properly decoded the arg must be a concrete type from tendermint (if its an interface).
+// Covert the abi encoded input to a list of properly typed values.
 func inputParamsToArgs(rpcFunc *RPCFunc, input []byte) ([]reflect.Value, error) {
-	args := make([]interface{}, 0)
+	argTypes := make([]util.Type, 0, len(rpcFunc.args))
+	args := make([]interface{}, 0, len(rpcFunc.args))
 	for _, argT := range rpcFunc.args {
+		argType, err := util.TypeOf(argT)
+		if err != nil {
+			return nil, err
+		}
+		argTypes = append(argTypes, argType)
 		args = append(args, reflect.New(argT).Interface())
 	}
-	err := util.ExtractParam(input, args...)
+	err := util.DecodeArgs(argTypes, input, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	argVs := make([]reflect.Value, 0)
+	argVs := make([]reflect.Value, 0, len(args))
 	for _, arg := range args {
 		argVs = append(argVs, reflect.ValueOf(arg).Elem())
 	}
 	return argVs, nil
 }
 
-// NOTE: assume returns is result struct and error. If error is not nil, return it
+// NOTE: assume returns is error and result values. If error is not nil, return it
 func encodeResult(returns []reflect.Value) ([]byte, error) {
 	errV := returns[0]
 	if errV.Interface() != nil {
 		return nil, errors.New(fmt.Sprintf("%v", errV.Interface()))
 	}
 	returns = returns[1:]
-	rvs := make([]interface{}, 0)
+	retTypes := make([]util.Type, 0, len(returns))
+	rvs := make([]interface{}, 0, len(returns))
 	for _, rv := range returns {
-		// the result is a registered interface,
-		// we need a pointer to it so we can marshal with type byte
-		rvp := reflect.New(rv.Type())
-		rvp.Elem().Set(rv)
-		rvs = append(rvs, rvp.Elem().Interface())
+		retType, err := util.TypeOf(rv.Type())
+		if err != nil {
+			return nil, err
+		}
+		retTypes = append(retTypes, retType)
+		rvs = append(rvs, rv.Interface())
 	}
-	return util.EncodeReturnValue(rvs...)
+	return util.EncodeArgs(retTypes, rvs...)
 }
 
 // RPCFunc contains the introspected type information for a function
 type RPCFunc struct {
-	f       reflect.Value  // underlying rpc function
-	args    []reflect.Type // type of each function arg
-	returns []reflect.Type // type of each return arg
+	f           reflect.Value  // underlying rpc function
+	name        string         // method name of the registered route
+	args        []reflect.Type // type of each function arg
+	returns     []reflect.Type // type of each return arg
+	withState   bool           // whether the state repository is passed as the first arg
+	withEmitter bool           // whether the event emitter is passed after the state repository
 }
 
+var (
+	repositoryT = reflect.TypeOf(&repository.Repository{})
+	emitterT    = reflect.TypeOf(util.EventEmitter(nil))
+	errorT      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
 // NewRPCFunc create a new RPCFunc instance
 func NewRPCFunc(f interface{}) *RPCFunc {
+	args := funcArgTypes(f)
+	withState := len(args) > 0 && args[0] == repositoryT
+	if withState {
+		args = args[1:]
+	}
+	withEmitter := len(args) > 0 && args[0] == emitterT
+	if withEmitter {
+		args = args[1:]
+	}
 	return &RPCFunc{
-		f:       reflect.ValueOf(f),
-		args:    funcArgTypes(f),
-		returns: funcReturnTypes(f),
+		f:           reflect.ValueOf(f),
+		args:        args,
+		returns:     funcReturnTypes(f),
+		withState:   withState,
+		withEmitter: withEmitter,
+	}
+}
+
+// Signature return the canonical solidity signature of the function registered with methodName
+func (this *RPCFunc) Signature(methodName string) (string, error) {
+	argStrs := make([]string, 0, len(this.args))
+	for _, arg := range this.args {
+		argType, err := util.TypeOf(arg)
+		if err != nil {
+			return "", errors.Wrapf(UnsupportedArgError, "%v", arg)
+		}
+		argStrs = append(argStrs, argType.String())
 	}
+	return methodName + "(" + strings.Join(argStrs, ",") + ")", nil
+}
+
+// return the abi metadata of the registered function
+func (this *RPCFunc) method() *util.Method {
+	method := &util.Method{
+		Name:    this.name,
+		Inputs:  make([]util.Argument, 0, len(this.args)),
+		Outputs: make([]util.Argument, 0, len(this.returns)),
+	}
+	for _, arg := range this.args {
+		argType, _ := util.TypeOf(arg)
+		method.Inputs = append(method.Inputs, util.Argument{Type: argType})
+	}
+	for i, ret := range this.returns {
+		// the first return value is the error
+		if i == 0 {
+			continue
+		}
+		retType, _ := util.TypeOf(ret)
+		method.Outputs = append(method.Outputs, util.Argument{Type: retType})
+	}
+	return method
+}
+
+// check the function can be called by Handler
+func (this *RPCFunc) validate() error {
+	if this.f.Type().IsVariadic() {
+		return errors.Wrap(InvalidRPCFuncError, "variadic function")
+	}
+	if len(this.returns) == 0 || this.returns[0] != errorT {
+		return errors.Wrap(InvalidRPCFuncError, "the first return value must be an error")
+	}
+	for _, ret := range this.returns[1:] {
+		if _, err := util.TypeOf(ret); err != nil {
+			return errors.Wrapf(InvalidRPCFuncError, "unsupported return type %v", ret)
+		}
+	}
+	return nil
 }
 
 // return a function's argument types
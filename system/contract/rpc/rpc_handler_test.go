@@ -1,12 +1,22 @@
 package rpc
 
 import (
+	"crypto/ecdsa"
 	"fmt"
+	"github.com/DSiSc/craft/rlp"
+	craft "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/evm-NG/common"
 	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/system/contract/Interaction"
 	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	wcmn "github.com/DSiSc/web3go/common"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"math/big"
 	"reflect"
 	"testing"
 )
@@ -35,8 +45,18 @@ func init() {
 	})
 }
 
-func Method1(name string, age uint64) {
+func Method1(name string, age uint64) error {
+	return nil
+}
+
+type person struct {
+	Name string
+	Age  uint64
+	Tags [2][4]byte
+}
 
+func Method2(addr craft.Address, ok bool, val *big.Int, data []byte, hash [32]byte, ids []uint32, p person) (error, []byte) {
+	return nil, data
 }
 
 func TestRegister(t *testing.T) {
@@ -45,11 +65,54 @@ func TestRegister(t *testing.T) {
 	assert.Nil(err)
 	methodHash := util.Hash([]byte("Method1(string,uint64)"))[:4]
 	assert.NotNil(routes[string(methodHash)])
+	err = Register("Method1", NewRPCFunc(Method1))
+	assert.NotNil(err)
+	assert.Equal(SelectorCollisionError, errors.Cause(err))
 
 	optionFunc := util.ExtractMethodHash(util.Hash([]byte("ReceiveFunds(string, uint64)")))
 	fmt.Println(common.Bytes2Hex(optionFunc))
 }
 
+func TestRegister_Signature(t *testing.T) {
+	assert := assert.New(t)
+	signature, err := NewRPCFunc(Method2).Signature("Method2")
+	assert.Nil(err)
+	assert.Equal("Method2(address,bool,uint256,bytes,bytes32,uint32[],(string,uint64,bytes4[2]))", signature)
+	assert.Nil(Register("Method2", NewRPCFunc(Method2)))
+
+	data := []byte{0x1, 0x2}
+	input, _ := util.EncodeReturnValue(craft.Address{0x1}, true, big.NewInt(1), data, [32]byte{}, []uint32{1}, person{Name: "Tom"})
+	ret, err := Handler(nil, nil, append(util.Hash([]byte(signature))[:4], input...))
+	assert.Nil(err)
+	var retData []byte
+	assert.Nil(util.ExtractParam(ret, &retData))
+	assert.Equal(data, retData)
+
+	// builtin routes
+	for _, signature := range []string{
+		"ForwardFunds(string,uint64,string,string)",
+		"ReceiveFunds(address,uint64,string,uint64,bytes,uint64,bytes32[])",
+	} {
+		assert.NotNil(routes[string(util.Hash([]byte(signature))[:4])], signature)
+	}
+}
+
+func TestRegister_InvalidFunc(t *testing.T) {
+	assert := assert.New(t)
+	err := Register("NoError", NewRPCFunc(func(name string) string { return name }))
+	assert.Equal(InvalidRPCFuncError, errors.Cause(err))
+	err = Register("NoReturn", NewRPCFunc(func(name string) {}))
+	assert.Equal(InvalidRPCFuncError, errors.Cause(err))
+	err = Register("Variadic", NewRPCFunc(func(names ...string) error { return nil }))
+	assert.Equal(InvalidRPCFuncError, errors.Cause(err))
+	err = Register("BadReturn", NewRPCFunc(func() (error, map[string]string) { return nil, nil }))
+	assert.Equal(InvalidRPCFuncError, errors.Cause(err))
+	err = Register("BadArg", NewRPCFunc(func(m map[string]string) error { return nil }))
+	assert.Equal(UnsupportedArgError, errors.Cause(err))
+	_, err = Handler(nil, nil, []byte{0, 0, 0, 0})
+	assert.Equal(RouteNotFoundError, err)
+}
+
 func TestNewRPCFunc(t *testing.T) {
 	assert := assert.New(t)
 	f := func(name string, age uint64) (error, string) {
@@ -64,21 +127,21 @@ func TestNewRPCFunc(t *testing.T) {
 func TestHandler(t *testing.T) {
 	assert := assert.New(t)
 	input, _ := hexutil.Decode("0x6b59084d")
-	_, err := Handler(input)
+	_, err := Handler(nil, nil, input)
 	assert.Nil(err)
 }
 
 func TestHandler1(t *testing.T) {
 	assert := assert.New(t)
 	input, _ := hexutil.Decode("0x30e738a700000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000003546f6d0000000000000000000000000000000000000000000000000000000000")
-	_, err := Handler(input)
+	_, err := Handler(nil, nil, input)
 	assert.Nil(err)
 }
 
 func TestHandler2(t *testing.T) {
 	assert := assert.New(t)
 	input, _ := hexutil.Decode("0xfb61de2c0000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000007b0000000000000000000000000000000000000000000000000000000000000003546f6d0000000000000000000000000000000000000000000000000000000000")
-	_, err := Handler(input)
+	_, err := Handler(nil, nil, input)
 	assert.Nil(err)
 }
 
@@ -86,7 +149,7 @@ func TestHandler3(t *testing.T) {
 	assert := assert.New(t)
 	expectRet, _ := hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000007b000000000000000000000000000000000000000000000000000000000000000948656c6c6f20546f6d0000000000000000000000000000000000000000000000")
 	input, _ := hexutil.Decode("0x4a1607800000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000007b0000000000000000000000000000000000000000000000000000000000000003546f6d0000000000000000000000000000000000000000000000000000000000")
-	ret, err := Handler(input)
+	ret, err := Handler(nil, nil, input)
 	assert.Nil(err)
 	assert.Equal(expectRet, ret)
 }
@@ -95,7 +158,7 @@ func TestHandler4(t *testing.T) {
 	assert := assert.New(t)
 	expectRet, _ := hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000007b000000000000000000000000000000000000000000000000000000000000000948656c6c6f20546f6d0000000000000000000000000000000000000000000000")
 	input, _ := hexutil.Decode("0x4a1607800000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000007b0000000000000000000000000000000000000000000000000000000000000003546f6d0000000000000000000000000000000000000000000000000000000000")
-	ret, err := Handler(input)
+	ret, err := Handler(nil, nil, input)
 	assert.Nil(err)
 	assert.Equal(expectRet, ret)
 }
@@ -103,7 +166,272 @@ func TestHandler4(t *testing.T) {
 func TestHandler5(t *testing.T) {
 	assert := assert.New(t)
 	input, _ := hexutil.Decode("0xd85a9b800000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000007b0000000000000000000000000000000000000000000000000000000000000003546f6d0000000000000000000000000000000000000000000000000000000000")
-	_, err := Handler(input)
+	_, err := Handler(nil, nil, input)
 	assert.NotNil(err)
 	assert.Equal(fmt.Sprintf("%v", permDenyError), fmt.Sprintf("%v", err))
 }
+
+func mockCrossChain(t *testing.T) (*Interaction.MemChainClient, *Interaction.MemChainClient) {
+	localClient, targetClient := Interaction.NewMemChainClient(), Interaction.NewMemChainClient()
+	signer, err := Interaction.NewPrivateKeySigner("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Interaction.DefaultConfig()
+	config.LocalChain = "chainA"
+	config.Chains["chainA"] = Interaction.ChainInfo{ChainId: 1, BridgeAddr: craft.Address{0x1}, Client: localClient}
+	config.Chains["chainB"] = Interaction.ChainInfo{ChainId: 2, BridgeAddr: craft.Address{0x2}, Client: targetClient}
+	config.Signer = signer
+	if err := Interaction.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return localClient, targetClient
+}
+
+func mockCrossTransaction(t *testing.T, from, bridge craft.Address, amount int64, payload []byte) string {
+	tx := new(craft.Transaction)
+	tx.Data.From = &from
+	tx.Data.Recipient = &bridge
+	tx.Data.Price = big.NewInt(0)
+	tx.Data.Amount = big.NewInt(amount)
+	tx.Data.Payload = payload
+	tx.Data.V, tx.Data.R, tx.Data.S = big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	tx.Data.Hash = &craft.Hash{}
+	txBytes, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wcmn.BytesToHex(txBytes)
+}
+
+func TestForwardFunds(t *testing.T) {
+	assert := assert.New(t)
+	defer Interaction.SetConfig(Interaction.DefaultConfig())
+	localClient, targetClient := mockCrossChain(t)
+
+	logs := make([]*craft.Log, 0)
+	emitter := func(address craft.Address, topics []craft.Hash, data []byte) {
+		logs = append(logs, &craft.Log{Address: address, Topics: topics, Data: data})
+	}
+
+	payload := mockCrossTransaction(t, craft.Address{0x3}, craft.Address{0x1}, 10, []byte{})
+	err, localHash, targetHash, status := ForwardFunds(emitter, "0x0000000000000000000000000000000000000004", 10, payload, "chainB")
+	assert.Nil(err)
+	assert.Equal(uint64(1), status)
+	assert.Equal(1, len(localClient.Transactions()))
+	assert.Equal(1, len(targetClient.Transactions()))
+	assert.Equal(1, len(logs))
+	assert.Equal(RpcContractAddr, logs[0].Address)
+	assert.Equal(FundsForwardedEvent.Id(), logs[0].Topics[0])
+	assert.Equal(util.Hash([]byte("chainB")), logs[0].Topics[1][:])
+
+	assert.NotEqual(localHash, targetHash)
+
+	targetClient.SetFailure(errors.New("connection refused"))
+	err, _, _, status = ForwardFunds(emitter, "0x0000000000000000000000000000000000000004", 10, payload, "chainB")
+	assert.NotNil(err)
+	assert.Equal(uint64(0), status)
+	assert.Equal(1, len(logs))
+}
+
+func mockStateDB() *repository.Repository {
+	db := &repository.Repository{}
+	cache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return cache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		cache[string(key)] = value
+		return nil
+	})
+	return db
+}
+
+// record the validator and the bridge of the source chain in the header relay contract, the bridge address is
+// the one registered in the cross chain config by mockCrossChain
+func mockRelayValidator(t *testing.T, db *repository.Repository, chainId uint64) *ecdsa.PrivateKey {
+	key, _ := crypto.GenerateKey()
+	validators := map[uint64][]craft.Address{chainId: {crypto.PubkeyToAddress(key.PublicKey)}}
+	bridges := map[uint64]craft.Address{chainId: {byte(chainId)}}
+	if err := Interaction.SetupGenesis(db, craft.Address{0x9}, validators, bridges); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// relay the signed source chain header
+func relayHeader(t *testing.T, db *repository.Repository, key *ecdsa.PrivateKey, header *Interaction.RelayHeader) []byte {
+	headerBytes, _ := rlp.EncodeToBytes(header)
+	hash := header.Hash()
+	sig, _ := crypto.Sign(hash[:], key)
+	if _, err := Interaction.NewHeaderRelayContract(db).SubmitHeader(headerBytes, [][]byte{sig}); err != nil {
+		t.Fatal(err)
+	}
+	return headerBytes
+}
+
+// relay the source chain header including the transaction and another one, return the header and proof of the transaction
+func mockRelayedHeader(t *testing.T, db *repository.Repository, chainId uint64, tx []byte) ([]byte, []craft.Hash) {
+	key := mockRelayValidator(t, db, chainId)
+	sibling := Interaction.MerkleLeafHash([]byte("other tx"))
+	header := &Interaction.RelayHeader{ChainID: chainId, Height: 100}
+	header.TxRoot = Interaction.MerkleNodeHash(Interaction.MerkleLeafHash(tx), sibling)
+	return relayHeader(t, db, key, header), []craft.Hash{sibling}
+}
+
+func TestReceiveFunds(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer Interaction.SetConfig(Interaction.DefaultConfig())
+	mockCrossChain(t)
+	db := mockStateDB()
+
+	from, to := craft.Address{0x3}, craft.Address{0x4}
+	monkey.Patch(wtypes.Sender, func(signer wtypes.Signer, tx *craft.Transaction) (wtypes.Address, error) {
+		return wtypes.Address(*tx.Data.From), nil
+	})
+	payload := mockCrossTransaction(t, from, craft.Address{0x1}, 10, to[:])
+	header, proof := mockRelayedHeader(t, db, 1, wcmn.HexToBytes(payload))
+
+	// the transaction is not included in the relayed header
+	err, _ := ReceiveFunds(db, to, 10, payload, 1, header, 1, proof)
+	assert.Equal(Interaction.InvalidMerkleProofError, err)
+	otherPayload := mockCrossTransaction(t, from, craft.Address{0x1}, 11, to[:])
+	err, _ = ReceiveFunds(db, to, 11, otherPayload, 1, header, 0, proof)
+	assert.Equal(Interaction.InvalidMerkleProofError, err)
+	unrelayed, _ := rlp.EncodeToBytes(&Interaction.RelayHeader{ChainID: 1, Height: 101})
+	err, _ = ReceiveFunds(db, to, 10, payload, 1, unrelayed, 0, proof)
+	assert.Equal(Interaction.HeaderNotFoundError, err)
+
+	err, status := ReceiveFunds(db, to, 10, payload, 1, header, 0, proof)
+	assert.Nil(err)
+	assert.Equal(uint64(1), status)
+
+	// the funds can't be received again
+	err, status = ReceiveFunds(db, to, 10, payload, 1, header, 0, proof)
+	assert.Equal(FundsReceivedError, err)
+	assert.Equal(uint64(0), status)
+
+	// source chain mismatch with the header or the transaction is not sent to its bridge contract
+	err, _ = ReceiveFunds(db, to, 10, payload, 2, header, 0, proof)
+	assert.NotNil(err)
+	header, proof = mockRelayedHeader(t, db, 2, wcmn.HexToBytes(payload))
+	err, _ = ReceiveFunds(db, to, 10, payload, 2, header, 0, proof)
+	assert.NotNil(err)
+
+	// the bridge is taken from the contract state, not the node config
+	config := Interaction.GetConfig()
+	config.Chains["chainB"] = Interaction.ChainInfo{ChainId: 2, BridgeAddr: craft.Address{0x1}}
+	assert.Nil(Interaction.SetConfig(config))
+	err, _ = ReceiveFunds(db, to, 10, payload, 2, header, 0, proof)
+	assert.NotNil(err)
+	assert.Nil(Interaction.NewHeaderRelayContract(db).SetBridge(craft.Address{0x9}, 2, craft.Address{0x1}))
+	err, status = ReceiveFunds(db, to, 10, payload, 2, header, 0, proof)
+	assert.Nil(err)
+	assert.Equal(uint64(1), status)
+}
+
+func TestReceiveFunds_NoRecipient(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer Interaction.SetConfig(Interaction.DefaultConfig())
+	mockCrossChain(t)
+	db := mockStateDB()
+
+	sender, to := craft.Address{0x3}, craft.Address{0x4}
+	monkey.Patch(wtypes.Sender, func(signer wtypes.Signer, tx *craft.Transaction) (wtypes.Address, error) {
+		return wtypes.Address(sender), nil
+	})
+	tx := new(craft.Transaction)
+	tx.Data.Price = big.NewInt(0)
+	tx.Data.Amount = big.NewInt(10)
+	tx.Data.Payload = to[:]
+	tx.Data.V, tx.Data.R, tx.Data.S = big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	tx.Data.Hash = &craft.Hash{}
+	txBytes, _ := rlp.EncodeToBytes(tx)
+
+	header, proof := mockRelayedHeader(t, db, 1, txBytes)
+	err, _ := ReceiveFunds(db, to, 10, wcmn.BytesToHex(txBytes), 1, header, 0, proof)
+	assert.NotNil(err)
+}
+
+// signer recording the signed transactions
+type recordingSigner struct {
+	Interaction.Signer
+	txs []*craft.Transaction
+}
+
+func (this *recordingSigner) SignTx(tx *craft.Transaction, chainId *big.Int) (*craft.Transaction, error) {
+	this.txs = append(this.txs, tx)
+	return this.Signer.SignTx(tx, chainId)
+}
+
+// test the relayed transaction calls the registered ReceiveFunds route of the target chain
+func TestForwardFunds_ReceiveFunds(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer Interaction.SetConfig(Interaction.DefaultConfig())
+	localClient, _ := mockCrossChain(t)
+	localClient.SetChainId(1)
+	config := Interaction.GetConfig()
+	signer := &recordingSigner{Signer: config.Signer}
+	config.Signer = signer
+	assert.Nil(Interaction.SetConfig(config))
+	db := mockStateDB()
+	monkey.Patch(wtypes.Sender, func(signer wtypes.Signer, tx *craft.Transaction) (wtypes.Address, error) {
+		return wtypes.Address(*tx.Data.From), nil
+	})
+
+	to := craft.Address{0x4}
+	payload := mockCrossTransaction(t, craft.Address{0x3}, craft.Address{0x1}, 10, to[:])
+	err, _, _, status := ForwardFunds(nil, wcmn.BytesToHex(to[:]), 10, payload, "chainB")
+	assert.Nil(err)
+	assert.Equal(uint64(1), status)
+	relayTx := signer.txs[0]
+	assert.Equal(Interaction.ReceiveFundsMethod.Id(), relayTx.Data.Payload[:4])
+	assert.NotNil(routes[string(Interaction.ReceiveFundsMethod.Id())])
+
+	// the local header must be relayed to the target chain first
+	_, err = Handler(db, nil, relayTx.Data.Payload)
+	assert.NotNil(err)
+	key := mockRelayValidator(t, db, 1)
+	localHeader, err := localClient.Header(0)
+	assert.Nil(err)
+	relayHeader(t, db, key, localHeader)
+	ret, err := Handler(db, nil, relayTx.Data.Payload)
+	assert.Nil(err)
+	var received uint64
+	assert.Nil(util.ExtractParam(ret, &received))
+	assert.Equal(uint64(1), received)
+}
+
+func TestHandler_WithState(t *testing.T) {
+	assert := assert.New(t)
+	db := &repository.Repository{}
+	f := NewRPCFunc(func(stateDB *repository.Repository, name string) (error, bool) {
+		return nil, stateDB == db
+	})
+	assert.Equal(1, len(f.args))
+	assert.Nil(Register("WithState", f))
+	input, _ := util.EncodeReturnValue("Tom")
+	ret, err := Handler(db, nil, append(util.Hash([]byte("WithState(string)"))[:4], input...))
+	assert.Nil(err)
+	var same bool
+	assert.Nil(util.ExtractParam(ret, &same))
+	assert.True(same)
+}
+
+func TestABI(t *testing.T) {
+	assert := assert.New(t)
+	abi := ABI()
+	var forwardFunds *util.Method
+	for _, method := range abi.Methods {
+		if method.Name == "ForwardFunds" {
+			forwardFunds = method
+		}
+	}
+	assert.NotNil(forwardFunds)
+	assert.Equal("ForwardFunds(string,uint64,string,string)", forwardFunds.Signature())
+	assert.Equal(3, len(forwardFunds.Outputs))
+	assert.Equal(FundsForwardedEvent, abi.Event("FundsForwarded"))
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// blob store backend names
+const (
+	CosBackend   = "cos"
+	S3Backend    = "s3"
+	LocalBackend = "local"
+)
+
+var (
+	ObjectNotFoundError = errors.New("object not found")
+	ObjectTooLargeError = errors.New("object too large")
+	UnknownBackendError = errors.New("unknown storage backend")
+)
+
+// ResponseError the error response of the storage backend
+type ResponseError struct {
+	StatusCode int
+	Message    string
+}
+
+func (this *ResponseError) Error() string {
+	return this.Message
+}
+
+// BlobStore is the object storage backend used by the storage system contract.
+// A BlobStore instance is bound to one bucket.
+// The operations should be aborted once ctx is done.
+type BlobStore interface {
+	// Get return the content of the object, caller must close the returned reader
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Put upload the object, the content is read from r until EOF
+	Put(ctx context.Context, name string, r io.Reader) (*ObjectMeta, error)
+	// Head return the meta info of the object
+	Head(ctx context.Context, name string) (*ObjectMeta, error)
+	// Delete remove the object from the bucket
+	Delete(ctx context.Context, name string) error
+	// List return the meta info of the objects whose name start with prefix
+	List(ctx context.Context, prefix string) ([]*ObjectMeta, error)
+}
+
+// BackendBuilder build the BlobStore bound to the bucket identified by rawurl
+type BackendBuilder func(rawurl string, config Config) (BlobStore, error)
+
+// Config node configuration of the storage system contract
+type Config struct {
+	// Backend name of the blob store backend used by the storage contract
+	Backend string
+	// LocalDir root directory of the local backend, each bucket is a sub directory
+	LocalDir string
+	// Cos credential used by the cos backend, anonymous access if empty
+	Cos CosConfig
+	// S3 credential used by the s3 backend, anonymous access if empty
+	S3 S3Config
+	// Timeout deadline of a storage contract call including the retries, 0 means no deadline
+	Timeout time.Duration
+	// MaxRetries max retry times of the failed backend operation
+	MaxRetries int
+	// RetryBackoff wait time before the first retry, it is doubled for each following retry
+	RetryBackoff time.Duration
+}
+
+// CosConfig credential of tencent cloud object storage
+type CosConfig struct {
+	SecretID  string
+	SecretKey string
+}
+
+// S3Config credential of the s3 compatible object storage
+type S3Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+}
+
+// DefaultConfig return the default storage config, which uses the cos backend
+func DefaultConfig() Config {
+	return Config{
+		Backend:      CosBackend,
+		Timeout:      30 * time.Second,
+		MaxRetries:   2,
+		RetryBackoff: 200 * time.Millisecond,
+	}
+}
+
+var (
+	lock     sync.RWMutex
+	config   = DefaultConfig()
+	backends = map[string]BackendBuilder{
+		CosBackend:   newCosBlobStore,
+		S3Backend:    newS3BlobStore,
+		LocalBackend: newLocalBlobStore,
+	}
+)
+
+// SetConfig set the storage config of the node
+func SetConfig(c Config) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if backends[c.Backend] == nil {
+		return errors.Errorf("%v: %s", UnknownBackendError, c.Backend)
+	}
+	config = c
+	return nil
+}
+
+// GetConfig return the storage config of the node
+func GetConfig() Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// RegisterBackend register a new blob store backend
+func RegisterBackend(name string, builder BackendBuilder) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if backends[name] != nil {
+		return errors.Errorf("backend %s have been registered", name)
+	}
+	backends[name] = builder
+	return nil
+}
+
+// NewBlobStore build the BlobStore bound to the bucket identified by rawurl with specified backend,
+// the backend in node config is used if backend is empty.
+func NewBlobStore(backend, rawurl string) (BlobStore, error) {
+	lock.RLock()
+	c := config
+	if len(backend) == 0 {
+		backend = c.Backend
+	}
+	builder := backends[backend]
+	lock.RUnlock()
+	if builder == nil {
+		return nil, errors.Errorf("%v: %s", UnknownBackendError, backend)
+	}
+	return builder(rawurl, c)
+}
+
+// call f until it succeeds, the error is not retryable or the retry times run out
+func retry(ctx context.Context, config Config, f func() error) error {
+	backoff := config.RetryBackoff
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil || i >= config.MaxRetries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// only the transient errors are retryable
+func isRetryable(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *ResponseError:
+		return cause.StatusCode >= http.StatusInternalServerError || cause.StatusCode == http.StatusTooManyRequests
+	default:
+		switch cause {
+		case ObjectNotFoundError, ObjectTooLargeError, InvalidObjectNameError, context.Canceled, context.DeadlineExceeded:
+			return false
+		}
+		return true
+	}
+}
+
+// read all the data from r, return ObjectTooLargeError if the data size exceed maxSize
+func readAll(r io.Reader, maxSize uint64) ([]byte, error) {
+	if maxSize == 0 {
+		return ioutil.ReadAll(r)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) > maxSize {
+		return nil, ObjectTooLargeError
+	}
+	return data, nil
+}
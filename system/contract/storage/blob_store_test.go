@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetConfig(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+
+	assert.Equal(CosBackend, GetConfig().Backend)
+	err := SetConfig(Config{Backend: "unknown"})
+	assert.NotNil(err)
+	assert.Equal(CosBackend, GetConfig().Backend)
+
+	err = SetConfig(Config{Backend: LocalBackend, LocalDir: "/tmp"})
+	assert.Nil(err)
+	assert.Equal(LocalBackend, GetConfig().Backend)
+}
+
+func TestRegisterBackend(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+
+	mockStore := &localBlobStore{root: "/tmp"}
+	err := RegisterBackend("mock", func(rawurl string, config Config) (BlobStore, error) {
+		return mockStore, nil
+	})
+	assert.Nil(err)
+	err = RegisterBackend("mock", nil)
+	assert.NotNil(err)
+
+	assert.Nil(SetConfig(Config{Backend: "mock"}))
+	store, err := NewBlobStore("", rawUrl)
+	assert.Nil(err)
+	assert.Equal(mockStore, store)
+
+	store, err = NewBlobStore(CosBackend, rawUrl)
+	assert.Nil(err)
+	assert.IsType(&cosBlobStore{}, store)
+
+	_, err = NewBlobStore("unknown", rawUrl)
+	assert.NotNil(err)
+}
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	config := Config{MaxRetries: 2, RetryBackoff: time.Millisecond}
+
+	calls := 0
+	err := retry(context.Background(), config, func() error {
+		calls++
+		if calls < 3 {
+			return &ResponseError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(3, calls)
+
+	calls = 0
+	err = retry(context.Background(), config, func() error {
+		calls++
+		return &ResponseError{StatusCode: http.StatusInternalServerError}
+	})
+	assert.NotNil(err)
+	assert.Equal(3, calls)
+
+	calls = 0
+	err = retry(context.Background(), config, func() error {
+		calls++
+		return &ResponseError{StatusCode: http.StatusForbidden}
+	})
+	assert.NotNil(err)
+	assert.Equal(1, calls)
+
+	calls = 0
+	err = retry(context.Background(), config, func() error {
+		calls++
+		return errors.Wrap(InvalidObjectNameError, "../a")
+	})
+	assert.NotNil(err)
+	assert.Equal(1, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = retry(ctx, config, func() error {
+		calls++
+		return errors.New("connection reset")
+	})
+	assert.NotNil(err)
+	assert.Equal(1, calls)
+}
+
+func TestReadAll(t *testing.T) {
+	assert := assert.New(t)
+	data, err := readAll(strings.NewReader("Hello"), 5)
+	assert.Nil(err)
+	assert.Equal([]byte("Hello"), data)
+	_, err = readAll(strings.NewReader("Hello"), 4)
+	assert.Equal(ObjectTooLargeError, err)
+	data, err = readAll(strings.NewReader("Hello"), 0)
+	assert.Nil(err)
+	assert.Equal([]byte("Hello"), data)
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+//Cos response error
+type RespError struct {
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+	Resource  string `xml:"Resource"`
+	RequestId string `xml:"RequestId"`
+	TraceId   string `xml:"TraceId"`
+}
+
+// cosBlobStore is the BlobStore backed by tencent cloud object storage
+type cosBlobStore struct {
+	client *cos.Client
+}
+
+// create a cos BlobStore bound to the bucket url
+func newCosBlobStore(rawurl string, config Config) (BlobStore, error) {
+	client, err := buildCosClient(rawurl, config.Cos)
+	if err != nil {
+		return nil, err
+	}
+	return &cosBlobStore{client: client}, nil
+}
+
+func (this *cosBlobStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := this.client.Object.Get(ctx, name, nil)
+	if err != nil {
+		return nil, cosError(resp, err)
+	}
+	if err = checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (this *cosBlobStore) Put(ctx context.Context, name string, r io.Reader) (*ObjectMeta, error) {
+	resp, err := this.client.Object.Put(ctx, name, r, nil)
+	if err != nil {
+		return nil, cosError(resp, err)
+	}
+	defer resp.Body.Close()
+	if err = checkResponse(resp); err != nil {
+		return nil, err
+	}
+	objMeta := getObjectMeta(resp.Header)
+	objMeta.Name = name
+	return objMeta, nil
+}
+
+func (this *cosBlobStore) Head(ctx context.Context, name string) (*ObjectMeta, error) {
+	resp, err := this.client.Object.Head(ctx, name, nil)
+	if err != nil {
+		return nil, cosError(resp, err)
+	}
+	defer resp.Body.Close()
+	objMeta := getObjectMeta(resp.Header)
+	objMeta.Name = name
+	objMeta.Size, _ = strconv.ParseUint(resp.Header.Get("Content-Length"), 10, 64)
+	return objMeta, nil
+}
+
+func (this *cosBlobStore) Delete(ctx context.Context, name string) error {
+	resp, err := this.client.Object.Delete(ctx, name)
+	if err != nil {
+		return cosError(resp, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (this *cosBlobStore) List(ctx context.Context, prefix string) ([]*ObjectMeta, error) {
+	objMetas := make([]*ObjectMeta, 0)
+	opt := &cos.BucketGetOptions{Prefix: prefix}
+	for {
+		result, resp, err := this.client.Bucket.Get(ctx, opt)
+		if err != nil {
+			return nil, cosError(resp, err)
+		}
+		resp.Body.Close()
+		for _, obj := range result.Contents {
+			objMetas = append(objMetas, &ObjectMeta{
+				Name: obj.Key,
+				Size: uint64(obj.Size),
+				ETag: obj.ETag,
+			})
+		}
+		if !result.IsTruncated || len(result.NextMarker) == 0 {
+			return objMetas, nil
+		}
+		opt.Marker = result.NextMarker
+	}
+}
+
+// convert the cos sdk error, so that the failed request can be retried if it is a transient error
+func cosError(resp *cos.Response, err error) error {
+	if resp == nil || resp.Response == nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ObjectNotFoundError
+	}
+	return &ResponseError{
+		StatusCode: resp.StatusCode,
+		Message:    err.Error(),
+	}
+}
+
+// build cos client with specified url, requests are signed if the credential is configured
+func buildCosClient(rawurl string, config CosConfig) (*cos.Client, error) {
+	u, e := url.Parse(rawurl)
+	if e != nil {
+		return nil, e
+	}
+	b := &cos.BaseURL{BucketURL: u}
+	httpClient := &http.Client{}
+	if len(config.SecretID) > 0 {
+		httpClient.Transport = &cos.AuthorizationTransport{
+			SecretID:  config.SecretID,
+			SecretKey: config.SecretKey,
+		}
+	}
+	c := cos.NewClient(b, httpClient)
+	return c, nil
+}
+
+// extract object meta info from response header
+func getObjectMeta(header http.Header) *ObjectMeta {
+	return &ObjectMeta{
+		ETag:          header.Get("ETag"),
+		VersionId:     header.Get("x-cos-version-id"),
+		EncryptionAlg: header.Get("x-cos-server-side-encryption"),
+	}
+}
+
+// check response status
+func checkResponse(resp *cos.Response) (err error) {
+	if 200 != resp.StatusCode {
+		var respError RespError
+		if err1 := parseResp(resp.Body, xmlType, &respError); err1 != nil {
+			return err1
+		} else {
+			return &ResponseError{
+				StatusCode: resp.StatusCode,
+				Message:    fmt.Sprintf("response error, Code: %s, Message: %s, Resource: %s, RequestId: %s, TraceId: %s", respError.Code, respError.Message, respError.Resource, respError.RequestId, respError.TraceId),
+			}
+		}
+	} else {
+		return nil
+	}
+}
+
+const (
+	xmlType   = "xml"
+	jsonType  = "json"
+	bytesType = "bytes"
+)
+
+// parse response
+func parseResp(resp io.Reader, parseType string, v interface{}) error {
+	respBytes, err := ioutil.ReadAll(resp)
+	if err != nil {
+		return err
+	}
+	switch parseType {
+	case xmlType:
+		return xml.Unmarshal(respBytes, v)
+	case jsonType:
+		return json.Unmarshal(respBytes, v)
+	case bytesType:
+		srcV, dstV := reflect.ValueOf(v), reflect.ValueOf(&respBytes)
+		srcV.Elem().Set(dstV.Elem())
+		return nil
+	default:
+		return errors.New("unknown parse type")
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var InvalidObjectNameError = errors.New("invalid object name")
+
+// localBlobStore is the BlobStore backed by a local directory, which is used to test locally.
+// Objects of bucket `scheme://bucket/path` are stored in the directory `LocalDir/bucket/path`.
+type localBlobStore struct {
+	root string
+}
+
+// create a local BlobStore bound to the bucket url
+func newLocalBlobStore(rawurl string, config Config) (BlobStore, error) {
+	if len(config.LocalDir) == 0 {
+		return nil, errors.New("local storage directory is not configured")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	bucket := strings.Trim(u.Host+u.Path, "/")
+	if len(bucket) > 0 {
+		if err = checkObjectName(bucket); err != nil {
+			return nil, err
+		}
+	}
+	return &localBlobStore{root: filepath.Join(config.LocalDir, filepath.FromSlash(bucket))}, nil
+}
+
+func (this *localBlobStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := checkObjectName(name); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(this.objectPath(name))
+	if os.IsNotExist(err) {
+		return nil, ObjectNotFoundError
+	}
+	return file, err
+}
+
+func (this *localBlobStore) Put(ctx context.Context, name string, r io.Reader) (*ObjectMeta, error) {
+	if err := checkObjectName(name); err != nil {
+		return nil, err
+	}
+	objPath := this.objectPath(name)
+	if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
+		return nil, err
+	}
+
+	// write to a temp file first, so that the object is replaced atomically
+	tmpFile, err := ioutil.TempFile(filepath.Dir(objPath), ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile.Name())
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash), &contextReader{ctx: ctx, r: r})
+	if err1 := tmpFile.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmpFile.Name(), objPath); err != nil {
+		return nil, err
+	}
+	return &ObjectMeta{
+		Name: name,
+		Size: uint64(size),
+		ETag: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func (this *localBlobStore) Head(ctx context.Context, name string) (*ObjectMeta, error) {
+	body, err := this.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	hash := md5.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectMeta{
+		Name: name,
+		Size: uint64(size),
+		ETag: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func (this *localBlobStore) Delete(ctx context.Context, name string) error {
+	if err := checkObjectName(name); err != nil {
+		return err
+	}
+	err := os.Remove(this.objectPath(name))
+	if os.IsNotExist(err) {
+		return ObjectNotFoundError
+	}
+	return err
+}
+
+func (this *localBlobStore) List(ctx context.Context, prefix string) ([]*ObjectMeta, error) {
+	objMetas := make([]*ObjectMeta, 0)
+	err := filepath.Walk(this.root, func(filePath string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if os.IsNotExist(err) && filePath == this.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		relPath, err := filepath.Rel(this.root, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		if strings.HasPrefix(name, prefix) {
+			objMeta, err := this.Head(ctx, name)
+			if err != nil {
+				return err
+			}
+			objMetas = append(objMetas, objMeta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objMetas, nil
+}
+
+// contextReader stop reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (this *contextReader) Read(p []byte) (int, error) {
+	if err := this.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return this.r.Read(p)
+}
+
+// path of the object file
+func (this *localBlobStore) objectPath(name string) string {
+	return filepath.Join(this.root, filepath.FromSlash(name))
+}
+
+// object name must be a clean relative slash separated path, so it can't escape the bucket directory
+func checkObjectName(name string) error {
+	if len(name) == 0 || path.IsAbs(name) || path.Clean(name) != name || name == "." || name == ".." ||
+		strings.HasPrefix(name, "../") || strings.Contains(name, "\\") {
+		return errors.Wrap(InvalidObjectNameError, name)
+	}
+	return nil
+}
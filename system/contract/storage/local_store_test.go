@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mockLocalBlobStore(t *testing.T) (BlobStore, string) {
+	dir, err := ioutil.TempDir("", "blob-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := newLocalBlobStore("file://bucket", Config{LocalDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func TestNewLocalBlobStore(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newLocalBlobStore("file://bucket", Config{})
+	assert.NotNil(err)
+	_, err = newLocalBlobStore("file://bucket/../other", Config{LocalDir: "/tmp"})
+	assert.NotNil(err)
+	store, err := newLocalBlobStore("file://bucket/dir", Config{LocalDir: "/tmp"})
+	assert.Nil(err)
+	assert.Equal(filepath.Join("/tmp", "bucket", "dir"), store.(*localBlobStore).root)
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	assert := assert.New(t)
+	store, dir := mockLocalBlobStore(t)
+	defer os.RemoveAll(dir)
+
+	objs, err := store.List(context.Background(), "")
+	assert.Nil(err)
+	assert.Equal(0, len(objs))
+
+	objMeta, err := store.Put(context.Background(), "dir/hello.txt", strings.NewReader("hello"))
+	assert.Nil(err)
+	assert.Equal(uint64(5), objMeta.Size)
+	assert.Equal("5d41402abc4b2a76b9719d911017c592", objMeta.ETag)
+	_, err = store.Put(context.Background(), "world.txt", strings.NewReader("world"))
+	assert.Nil(err)
+
+	body, err := store.Get(context.Background(), "dir/hello.txt")
+	assert.Nil(err)
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal([]byte("hello"), data)
+
+	headMeta, err := store.Head(context.Background(), "dir/hello.txt")
+	assert.Nil(err)
+	assert.Equal(objMeta, headMeta)
+
+	objs, err = store.List(context.Background(), "dir/")
+	assert.Nil(err)
+	assert.Equal(1, len(objs))
+	assert.Equal("dir/hello.txt", objs[0].Name)
+	objs, err = store.List(context.Background(), "")
+	assert.Nil(err)
+	assert.Equal(2, len(objs))
+
+	assert.Nil(store.Delete(context.Background(), "dir/hello.txt"))
+	assert.Equal(ObjectNotFoundError, store.Delete(context.Background(), "dir/hello.txt"))
+	_, err = store.Get(context.Background(), "dir/hello.txt")
+	assert.Equal(ObjectNotFoundError, err)
+	_, err = store.Head(context.Background(), "dir/hello.txt")
+	assert.Equal(ObjectNotFoundError, err)
+}
+
+func TestCheckObjectName(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"a", "a/b.txt", "a..b"} {
+		assert.Nil(checkObjectName(name))
+	}
+	for _, name := range []string{"", ".", "..", "../a", "/a", "a/../../b", "a//b", "a/", "a\\b"} {
+		assert.NotNil(checkObjectName(name))
+	}
+}
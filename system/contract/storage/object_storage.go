@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/DSiSc/craft/types"
+	cutil "github.com/DSiSc/crypto-suite/util"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/constant"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/pkg/errors"
+	"io"
+)
+
+var ObjectStorageAddr = cutil.HexToAddress("0000000000000000000000000000000000011011")
+
+var ContentHashMismatchError = errors.New("object content hash mismatch")
+
+// max size of the object to get or put, it is a consensus limit so it doesn't come from the node config
+var maxObjectSize = params.SysObjectMaxSize
+
+var (
+	getObjectMethod     = util.MustNewMethod("GetObject(string url,string name)", "address")
+	getObjectHashMethod = util.MustNewMethod("GetObject(string url,string name,bytes32 hash)", "address")
+	putObjectMethod     = util.MustNewMethod("PutObject(string url,string name)", "string", "string", "string")
+	headObjectMethod    = util.MustNewMethod("HeadObject(string url,string name)", "uint64", "string", "string")
+	deleteObjectMethod  = util.MustNewMethod("DeleteObject(string url,string name)")
+	listObjectsMethod   = util.MustNewMethod("ListObjects(string url,string prefix)", "string[]")
+)
+
+var (
+	getObjectMethodHash     = string(getObjectMethod.Id())
+	getObjectHashMethodHash = string(getObjectHashMethod.Id())
+	putObjectMethodHash     = string(putObjectMethod.Id())
+	headObjectMethodHash    = string(headObjectMethod.Id())
+	deleteObjectMethodHash  = string(deleteObjectMethod.Id())
+	listObjectsMethodHash   = string(listObjectsMethod.Id())
+)
+
+var (
+	// ObjectPutEvent emitted when the object is uploaded to the storage backend
+	ObjectPutEvent = util.MustNewEvent("ObjectPut(string indexed url,string name,string etag,string versionId)")
+	// ObjectDeletedEvent emitted when the object is removed from the storage backend
+	ObjectDeletedEvent = util.MustNewEvent("ObjectDeleted(string indexed url,string name)")
+)
+
+// StorageABI abi metadata of the object storage contract and the cos contract
+var StorageABI = &util.ABI{
+	Methods: []*util.Method{
+		getObjectMethod, getObjectHashMethod, putObjectMethod, headObjectMethod, deleteObjectMethod, listObjectsMethod,
+	},
+	Events: []*util.Event{ObjectPutEvent, ObjectDeletedEvent},
+}
+
+// execute the object storage contract
+func StorageExecute(storage *ObjectStorageContract, input []byte) ([]byte, error) {
+	methodHash := util.ExtractMethodHash(input)
+	switch string(methodHash) {
+	case getObjectMethodHash:
+		rawUrl := new(string)
+		objName := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, objName)
+		if err != nil {
+			return nil, err
+		}
+		bufferAddr, err := storage.GetObject(*rawUrl, *objName)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(bufferAddr)
+	case getObjectHashMethodHash:
+		rawUrl := new(string)
+		objName := new(string)
+		expectedHash := new([util.HashLenght]byte)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, objName, expectedHash)
+		if err != nil {
+			return nil, err
+		}
+		bufferAddr, err := storage.GetVerifiedObject(*rawUrl, *objName, *expectedHash)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(bufferAddr)
+	case putObjectMethodHash:
+		rawUrl := new(string)
+		objName := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, objName)
+		if err != nil {
+			return nil, err
+		}
+		objMeta, err := storage.PutObject(*rawUrl, *objName)
+		if err != nil {
+			return nil, err
+		}
+		ret, err := util.EncodeReturnValue(objMeta.ETag, objMeta.VersionId, objMeta.EncryptionAlg)
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	case headObjectMethodHash:
+		rawUrl := new(string)
+		objName := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, objName)
+		if err != nil {
+			return nil, err
+		}
+		objMeta, err := storage.HeadObject(*rawUrl, *objName)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(objMeta.Size, objMeta.ETag, objMeta.VersionId)
+	case deleteObjectMethodHash:
+		rawUrl := new(string)
+		objName := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, objName)
+		if err != nil {
+			return nil, err
+		}
+		return nil, storage.DeleteObject(*rawUrl, *objName)
+	case listObjectsMethodHash:
+		rawUrl := new(string)
+		prefix := new(string)
+		err := util.ExtractParam(input[len(methodHash):], rawUrl, prefix)
+		if err != nil {
+			return nil, err
+		}
+		objMetas, err := storage.ListObjects(*rawUrl, *prefix)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(objMetas))
+		for _, objMeta := range objMetas {
+			names = append(names, objMeta.Name)
+		}
+		return util.EncodeReturnValue(names)
+	default:
+		return nil, errors.New("unknown method")
+	}
+}
+
+// ObjectMeta object meta info
+type ObjectMeta struct {
+	Name          string
+	Size          uint64
+	ETag          string
+	VersionId     string
+	EncryptionAlg string
+}
+
+// ObjectStorageContract object storage system contract, the objects are stored in the BlobStore backend
+type ObjectStorageContract struct {
+	ctx         context.Context
+	sysBufferRW *buffer.SystemBufferReadWriterCloser
+	backend     string
+	witness     *Witness
+	address     types.Address
+	emitter     util.EventEmitter
+	gasMeter    *util.GasMeter
+}
+
+// NewObjectStorageContract create a new instance using the backend in node config.
+// ctx: the backend operations are aborted once ctx is done
+// witness: objects fetched while executing the block, the backend is accessed directly if it is nil
+func NewObjectStorageContract(ctx context.Context, rw *buffer.SystemBufferReadWriterCloser, witness *Witness) *ObjectStorageContract {
+	return &ObjectStorageContract{
+		ctx:         ctx,
+		sysBufferRW: rw,
+		witness:     witness,
+		address:     ObjectStorageAddr,
+	}
+}
+
+// GetObject download an object from the storage backend to `sysBufferRW`
+func (this *ObjectStorageContract) GetObject(rawurl, name string) (types.Address, error) {
+	content, err := this.fetchObject(rawurl, name)
+	if err != nil {
+		return types.Address{}, err
+	}
+	if err = this.gasMeter.UseGas(uint64(len(content)) * params.SysObjectByteGas); err != nil {
+		return types.Address{}, err
+	}
+	return this.writeBuffer(content)
+}
+
+// GetVerifiedObject download an object to `sysBufferRW` if the hash of its content equals to expectedHash,
+// so all the nodes get the same object or fail in the same way.
+func (this *ObjectStorageContract) GetVerifiedObject(rawurl, name string, expectedHash [util.HashLenght]byte) (types.Address, error) {
+	content, err := this.fetchObject(rawurl, name)
+	if err != nil {
+		return types.Address{}, err
+	}
+	if !bytes.Equal(expectedHash[:], util.Hash(content)) {
+		return types.Address{}, ContentHashMismatchError
+	}
+	if err = this.gasMeter.UseGas(uint64(len(content)) * params.SysObjectByteGas); err != nil {
+		return types.Address{}, err
+	}
+	return this.writeBuffer(content)
+}
+
+// PutObject upload an object(stored in `sysBufferRW` from its read cursor) to the storage backend
+func (this *ObjectStorageContract) PutObject(rawurl, name string) (*ObjectMeta, error) {
+	// the buffer is read by validators too, so that they have the same buffer state as the proposer
+	payload, err := readAll(this.sysBufferRW, maxObjectSize)
+	if err != nil {
+		return nil, err
+	}
+	if err = this.gasMeter.UseGas(uint64(len(payload)) * params.SysObjectByteGas); err != nil {
+		return nil, err
+	}
+	ret, err := this.call(putOp, rawurl, name, func(ctx context.Context, store BlobStore) (interface{}, error) {
+		return store.Put(ctx, name, bytes.NewReader(payload))
+	})
+	if err != nil {
+		return nil, err
+	}
+	objMeta := new(ObjectMeta)
+	if err = rlp.DecodeBytes(ret, objMeta); err != nil {
+		return nil, err
+	}
+	return objMeta, ObjectPutEvent.Emit(this.emitter, this.address, rawurl, name, objMeta.ETag, objMeta.VersionId)
+}
+
+// HeadObject return the meta info of the object
+func (this *ObjectStorageContract) HeadObject(rawurl, name string) (*ObjectMeta, error) {
+	ret, err := this.call(headOp, rawurl, name, func(ctx context.Context, store BlobStore) (interface{}, error) {
+		return store.Head(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	objMeta := new(ObjectMeta)
+	return objMeta, rlp.DecodeBytes(ret, objMeta)
+}
+
+// DeleteObject remove the object from the storage backend
+func (this *ObjectStorageContract) DeleteObject(rawurl, name string) error {
+	_, err := this.call(deleteOp, rawurl, name, func(ctx context.Context, store BlobStore) (interface{}, error) {
+		return []byte{}, store.Delete(ctx, name)
+	})
+	if err != nil {
+		return err
+	}
+	return ObjectDeletedEvent.Emit(this.emitter, this.address, rawurl, name)
+}
+
+// ListObjects return the meta info of the objects whose name start with prefix
+func (this *ObjectStorageContract) ListObjects(rawurl, prefix string) ([]*ObjectMeta, error) {
+	ret, err := this.call(listOp, rawurl, prefix, func(ctx context.Context, store BlobStore) (interface{}, error) {
+		return store.List(ctx, prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+	objMetas := make([]*ObjectMeta, 0)
+	return objMetas, rlp.DecodeBytes(ret, &objMetas)
+}
+
+func (this *ObjectStorageContract) Address() types.Address {
+	return ObjectStorageAddr
+}
+
+// SetEventEmitter set the emitter of the storage events, no event is emitted if it is not set
+func (this *ObjectStorageContract) SetEventEmitter(emitter util.EventEmitter) {
+	this.emitter = emitter
+}
+
+// SetGasMeter set the meter charging the object bytes transferred, nothing is charged if it is not set
+func (this *ObjectStorageContract) SetGasMeter(gasMeter *util.GasMeter) {
+	this.gasMeter = gasMeter
+}
+
+// fetch the object content from the witness or the storage backend
+func (this *ObjectStorageContract) fetchObject(rawurl, name string) ([]byte, error) {
+	content, err := this.call(getOp, rawurl, name, func(ctx context.Context, store BlobStore) (interface{}, error) {
+		body, err := store.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return readAll(body, maxObjectSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the content replayed from the witness is checked too
+	if uint64(len(content)) > maxObjectSize {
+		return nil, ObjectTooLargeError
+	}
+	return content, nil
+}
+
+// call the storage backend operation through the witness if it is not nil,
+// the result is rlp encoded so that it can be recorded in the witness.
+// The operation is retried on transient errors until the call deadline in node config.
+func (this *ObjectStorageContract) call(op, rawurl, name string, callFunc func(ctx context.Context, store BlobStore) (interface{}, error)) ([]byte, error) {
+	encodedCall := func() ([]byte, error) {
+		config := GetConfig()
+		store, err := NewBlobStore(this.backend, rawurl)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := this.ctx
+		if config.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+			defer cancel()
+		}
+		var ret interface{}
+		err = retry(ctx, config, func() error {
+			var err error
+			ret, err = callFunc(ctx, store)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if content, ok := ret.([]byte); ok {
+			return content, nil
+		}
+		return rlp.EncodeToBytes(ret)
+	}
+	if this.witness == nil {
+		return encodedCall()
+	}
+	return this.witness.Call(op, rawurl, name, encodedCall)
+}
+
+// write the object content to `sysBufferRW`
+func (this *ObjectStorageContract) writeBuffer(content []byte) (types.Address, error) {
+	for len(content) > 0 {
+		size := len(content)
+		if size > constant.BufferMaxReadWriteSize {
+			size = constant.BufferMaxReadWriteSize
+		}
+		nw, err := this.sysBufferRW.Write(content[:size])
+		if err != nil {
+			return types.Address{}, err
+		}
+		if nw < size {
+			return types.Address{}, io.ErrShortWrite
+		}
+		content = content[size:]
+	}
+	return this.sysBufferRW.ContractAddress(), nil
+}
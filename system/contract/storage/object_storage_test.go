@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mockObjectStorageContract(witness *Witness) (*ObjectStorageContract, *bytes.Buffer) {
+	bytesBuffer := bytes.NewBufferString("")
+	sysBufferRW := &buffer.SystemBufferReadWriterCloser{}
+	monkey.PatchInstanceMethod(reflect.TypeOf(sysBufferRW), "Read", func(brw *buffer.SystemBufferReadWriterCloser, p []byte) (n int, err error) {
+		return bytesBuffer.Read(p)
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(sysBufferRW), "Write", func(brw *buffer.SystemBufferReadWriterCloser, p []byte) (n int, err error) {
+		return bytesBuffer.Write(p)
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(sysBufferRW), "ContractAddress", func(brw *buffer.SystemBufferReadWriterCloser) types.Address {
+		return buffer.SystemBufferAddr
+	})
+	return NewObjectStorageContract(context.Background(), sysBufferRW, witness), bytesBuffer
+}
+
+func TestStorageExecute(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "object-storage")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(SetConfig(Config{Backend: LocalBackend, LocalDir: dir}))
+	defer SetConfig(DefaultConfig())
+
+	storage, bytesBuffer := mockObjectStorageContract(nil)
+	assert.Equal(ObjectStorageAddr, storage.Address())
+	bytesBuffer.WriteString("Hello, World")
+
+	input, _ := util.EncodeReturnValue("file://bucket", objName)
+	ret, err := StorageExecute(storage, append(util.ExtractMethodHash(util.Hash([]byte("PutObject(string,string)"))), input...))
+	assert.Nil(err)
+	var etag, versionId, encryptionAlg string
+	assert.Nil(util.ExtractParam(ret, &etag, &versionId, &encryptionAlg))
+	assert.Equal("82bb413746aee42f89dea2b59614f9ef", etag)
+
+	ret, err = StorageExecute(storage, append(util.ExtractMethodHash(util.Hash([]byte("GetObject(string,string)"))), input...))
+	assert.Nil(err)
+	var bufferAddr types.Address
+	assert.Nil(util.ExtractParam(ret, &bufferAddr))
+	assert.Equal(buffer.SystemBufferAddr, bufferAddr)
+	assert.Equal("Hello, World", bytesBuffer.String())
+
+	ret, err = StorageExecute(storage, append(util.ExtractMethodHash(util.Hash([]byte("HeadObject(string,string)"))), input...))
+	assert.Nil(err)
+	var size uint64
+	assert.Nil(util.ExtractParam(ret, &size, &etag, &versionId))
+	assert.Equal(uint64(12), size)
+
+	listInput, _ := util.EncodeReturnValue("file://bucket", "hello")
+	ret, err = StorageExecute(storage, append(util.ExtractMethodHash(util.Hash([]byte("ListObjects(string,string)"))), listInput...))
+	assert.Nil(err)
+	var names []string
+	assert.Nil(util.ExtractParam(ret, &names))
+	assert.Equal([]string{objName}, names)
+
+	_, err = StorageExecute(storage, append(util.ExtractMethodHash(util.Hash([]byte("DeleteObject(string,string)"))), input...))
+	assert.Nil(err)
+	_, err = StorageExecute(storage, append(util.ExtractMethodHash(util.Hash([]byte("GetObject(string,string)"))), input...))
+	assert.Equal(ObjectNotFoundError, err)
+
+	_, err = StorageExecute(storage, util.ExtractMethodHash(util.Hash([]byte("Unknown()"))))
+	assert.NotNil(err)
+}
+
+func TestObjectStorageContract_Events(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "object-storage")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(SetConfig(Config{Backend: LocalBackend, LocalDir: dir}))
+	defer SetConfig(DefaultConfig())
+
+	storage, bytesBuffer := mockObjectStorageContract(nil)
+	logs := make([]*types.Log, 0)
+	storage.SetEventEmitter(func(address types.Address, topics []types.Hash, data []byte) {
+		logs = append(logs, &types.Log{Address: address, Topics: topics, Data: data})
+	})
+	bytesBuffer.WriteString("Hello, World")
+	objMeta, err := storage.PutObject("file://bucket", objName)
+	assert.Nil(err)
+	assert.Nil(storage.DeleteObject("file://bucket", objName))
+
+	assert.Equal(2, len(logs))
+	assert.Equal(ObjectStorageAddr, logs[0].Address)
+	assert.Equal(ObjectPutEvent.Id(), logs[0].Topics[0])
+	assert.Equal(util.Hash([]byte("file://bucket")), logs[0].Topics[1][:])
+	name, etag, versionId := new(string), new(string), new(string)
+	assert.Nil(util.ExtractParam(logs[0].Data, name, etag, versionId))
+	assert.Equal(objName, *name)
+	assert.Equal(objMeta.ETag, *etag)
+	assert.Equal(ObjectDeletedEvent.Id(), logs[1].Topics[0])
+
+	// events of the cos contract are attributed to the cos address
+	cos := NewTencentCosContract(context.Background(), nil, nil)
+	assert.Equal(TencentCosAddr, cos.address)
+}
+
+func TestObjectStorageContract_GetVerifiedObject(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "object-storage")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(SetConfig(Config{Backend: LocalBackend, LocalDir: dir}))
+	defer SetConfig(DefaultConfig())
+
+	proposerWitness := NewProposerWitness()
+	storage, bytesBuffer := mockObjectStorageContract(proposerWitness)
+	bytesBuffer.WriteString("Hello, World")
+	_, err = storage.PutObject("file://bucket", objName)
+	assert.Nil(err)
+
+	var expectedHash [util.HashLenght]byte
+	copy(expectedHash[:], util.Hash([]byte("Hello, World")))
+	input, _ := util.EncodeReturnValue("file://bucket", objName, expectedHash)
+	getMethod := util.ExtractMethodHash(util.Hash([]byte("GetObject(string,string,bytes32)")))
+	_, err = StorageExecute(storage, append(getMethod, input...))
+	assert.Nil(err)
+	assert.Equal("Hello, World", bytesBuffer.String())
+
+	bytesBuffer.Reset()
+	_, err = storage.GetVerifiedObject("file://bucket", objName, [util.HashLenght]byte{})
+	assert.Equal(ContentHashMismatchError, err)
+	assert.Equal(0, bytesBuffer.Len())
+
+	// validator replay the witness after the object has been changed
+	assert.Nil(os.RemoveAll(dir))
+	witnessData, err := proposerWitness.Encode()
+	assert.Nil(err)
+	validatorWitness, err := NewValidatorWitness(witnessData)
+	assert.Nil(err)
+	storage.witness = validatorWitness
+	objMeta, err := storage.PutObject("file://bucket", objName)
+	assert.Nil(err)
+	assert.Equal(uint64(12), objMeta.Size)
+	_, err = StorageExecute(storage, append(getMethod, input...))
+	assert.Nil(err)
+	assert.Equal("Hello, World", bytesBuffer.String())
+	_, err = storage.GetVerifiedObject("file://bucket", objName, [util.HashLenght]byte{})
+	assert.Equal(ContentHashMismatchError, err)
+	assert.Nil(validatorWitness.Finish())
+}
+
+func TestObjectStorageContract_GasMeter(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "object-storage")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(SetConfig(Config{Backend: LocalBackend, LocalDir: dir}))
+	defer SetConfig(DefaultConfig())
+
+	storage, bytesBuffer := mockObjectStorageContract(nil)
+	gasMeter := util.NewGasMeter(20 * params.SysObjectByteGas)
+	storage.SetGasMeter(gasMeter)
+	bytesBuffer.WriteString("Hello, World")
+	_, err = storage.PutObject("file://bucket", objName)
+	assert.Nil(err)
+	assert.Equal(8*params.SysObjectByteGas, gasMeter.Gas())
+
+	_, err = storage.GetObject("file://bucket", objName)
+	assert.Equal(util.OutOfGasError, err)
+	assert.Equal(0, bytesBuffer.Len())
+}
+
+func TestObjectStorageContract_Limits(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	defer SetConfig(DefaultConfig())
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/bucket/flaky":
+			if requests < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("Hello"))
+		case "/bucket/large":
+			w.Write(bytes.Repeat([]byte{0x01}, 16))
+		case "/bucket/slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("Hello"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	assert.Nil(SetConfig(Config{
+		Backend:      S3Backend,
+		Timeout:      100 * time.Millisecond,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}))
+	maxObjectSize = 8
+	defer func() { maxObjectSize = params.SysObjectMaxSize }()
+	bucketUrl := server.URL + "/bucket"
+
+	storage, bytesBuffer := mockObjectStorageContract(nil)
+	_, err := storage.GetObject(bucketUrl, "flaky")
+	assert.Nil(err)
+	assert.Equal(3, requests)
+	assert.Equal("Hello", bytesBuffer.String())
+
+	requests = 0
+	_, err = storage.GetObject(bucketUrl, "missing")
+	assert.Equal(ObjectNotFoundError, err)
+	assert.Equal(1, requests)
+
+	_, err = storage.GetObject(bucketUrl, "large")
+	assert.Equal(ObjectTooLargeError, err)
+
+	bytesBuffer.Reset()
+	bytesBuffer.Write(bytes.Repeat([]byte{0x01}, 16))
+	_, err = storage.PutObject(bucketUrl, "large")
+	assert.Equal(ObjectTooLargeError, err)
+
+	start := time.Now()
+	_, err = storage.GetObject(bucketUrl, "slow")
+	assert.NotNil(err)
+	assert.True(time.Since(start) < 200*time.Millisecond)
+
+	// the call is aborted once the contract context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	storage.ctx = ctx
+	cancel()
+	_, err = storage.GetObject(bucketUrl, "flaky")
+	assert.NotNil(err)
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion  = "us-east-1"
+	s3SignAlgorithm  = "AWS4-HMAC-SHA256"
+	s3SignedHeaders  = "host;x-amz-content-sha256;x-amz-date"
+	s3AmzDateFormat  = "20060102T150405Z"
+	s3DateFormat     = "20060102"
+	s3ServiceName    = "s3"
+	s3RequestTypeEnd = "aws4_request"
+)
+
+// used to get the request signing time
+var now = time.Now
+
+// s3 response error
+type s3RespError struct {
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+	Resource  string `xml:"Resource"`
+	RequestId string `xml:"RequestId"`
+}
+
+// s3 ListObjectsV2 result
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size uint64 `xml:"Size"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3BlobStore is the BlobStore backed by s3 compatible object storage.
+// Requests are signed with signature version 4 if the credential is configured.
+type s3BlobStore struct {
+	bucketURL *url.URL
+	config    S3Config
+	client    *http.Client
+}
+
+// create a s3 BlobStore bound to the bucket url, both virtual-hosted style
+// and path style bucket url are supported.
+func newS3BlobStore(rawurl string, config Config) (BlobStore, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return nil, errors.Errorf("invalid bucket url: %s", rawurl)
+	}
+	s3Config := config.S3
+	if len(s3Config.Region) == 0 {
+		s3Config.Region = s3DefaultRegion
+	}
+	return &s3BlobStore{
+		bucketURL: u,
+		config:    s3Config,
+		client:    &http.Client{},
+	}, nil
+}
+
+func (this *s3BlobStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := this.do(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (this *s3BlobStore) Put(ctx context.Context, name string, r io.Reader) (*ObjectMeta, error) {
+	// the payload must be read to compute the content length and hash
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := this.do(ctx, http.MethodPut, name, nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return &ObjectMeta{
+		Name:          name,
+		Size:          uint64(len(payload)),
+		ETag:          resp.Header.Get("ETag"),
+		VersionId:     resp.Header.Get("x-amz-version-id"),
+		EncryptionAlg: resp.Header.Get("x-amz-server-side-encryption"),
+	}, nil
+}
+
+func (this *s3BlobStore) Head(ctx context.Context, name string) (*ObjectMeta, error) {
+	resp, err := this.do(ctx, http.MethodHead, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	size, _ := strconv.ParseUint(resp.Header.Get("Content-Length"), 10, 64)
+	return &ObjectMeta{
+		Name:          name,
+		Size:          size,
+		ETag:          resp.Header.Get("ETag"),
+		VersionId:     resp.Header.Get("x-amz-version-id"),
+		EncryptionAlg: resp.Header.Get("x-amz-server-side-encryption"),
+	}, nil
+}
+
+func (this *s3BlobStore) Delete(ctx context.Context, name string) error {
+	resp, err := this.do(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (this *s3BlobStore) List(ctx context.Context, prefix string) ([]*ObjectMeta, error) {
+	objMetas := make([]*ObjectMeta, 0)
+	query := map[string]string{"list-type": "2", "prefix": prefix}
+	for {
+		resp, err := this.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = parseResp(resp.Body, xmlType, &result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range result.Contents {
+			objMetas = append(objMetas, &ObjectMeta{
+				Name: obj.Key,
+				Size: obj.Size,
+				ETag: obj.ETag,
+			})
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			return objMetas, nil
+		}
+		query["continuation-token"] = result.NextContinuationToken
+	}
+}
+
+// send the signed request, return an error if the response status is not 2xx
+func (this *s3BlobStore) do(ctx context.Context, method, name string, query map[string]string, payload []byte) (*http.Response, error) {
+	req, err := this.newRequest(method, name, query, payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := this.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ObjectNotFoundError
+	}
+	respErr := &ResponseError{StatusCode: resp.StatusCode}
+	var respError s3RespError
+	if err = parseResp(resp.Body, xmlType, &respError); err != nil {
+		respErr.Message = fmt.Sprintf("response error, Status: %s", resp.Status)
+	} else {
+		respErr.Message = fmt.Sprintf("response error, Code: %s, Message: %s, Resource: %s, RequestId: %s", respError.Code, respError.Message, respError.Resource, respError.RequestId)
+	}
+	return nil, respErr
+}
+
+// build the request of the object, name is empty for the bucket level request
+func (this *s3BlobStore) newRequest(method, name string, query map[string]string, payload []byte) (*http.Request, error) {
+	u := *this.bucketURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(payload))
+	if len(this.config.AccessKeyID) > 0 {
+		this.sign(req, payload, now().UTC())
+	}
+	return req, nil
+}
+
+// sign the request with signature version 4
+func (this *s3BlobStore) sign(req *http.Request, payload []byte, signTime time.Time) {
+	payloadHash := sha256Hex(payload)
+	amzDate := signTime.Format(s3AmzDateFormat)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		s3SignedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := signTime.Format(s3DateFormat)
+	scope := strings.Join([]string{date, this.config.Region, s3ServiceName, s3RequestTypeEnd}, "/")
+	stringToSign := strings.Join([]string{s3SignAlgorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+this.config.SecretAccessKey), []byte(date))
+	for _, part := range []string{this.config.Region, s3ServiceName, s3RequestTypeEnd} {
+		key = hmacSHA256(key, []byte(part))
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgorithm, this.config.AccessKeyID, scope, s3SignedHeaders, signature))
+}
+
+// build the canonical query string, keys are sorted and values are escaped
+func canonicalQuery(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(query[key], true))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uri encode the string as required by signature version 4
+func s3Escape(s string, encodeSlash bool) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -36,13 +36,11 @@ func mockTencentCosContract() *TencentCosContract {
 	monkey.PatchInstanceMethod(reflect.TypeOf(sysBufferRW), "ContractAddress", func(brw *buffer.SystemBufferReadWriterCloser) types.Address {
 		return buffer.SystemBufferAddr
 	})
-	return &TencentCosContract{
-		sysBufferRW: sysBufferRW,
-	}
+	return NewTencentCosContract(context.Background(), sysBufferRW, nil)
 }
 
 func mockClient() *cos.Client {
-	client, _ := buildCosClient(rawUrl)
+	client, _ := buildCosClient(rawUrl, CosConfig{})
 	return client
 }
 
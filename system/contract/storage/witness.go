@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// witness modes
+const (
+	// ProposerMode access the storage backend and record the results in the witness
+	ProposerMode byte = iota
+	// ValidatorMode replay the results recorded in the witness, the storage backend is never accessed
+	ValidatorMode
+)
+
+var (
+	WitnessMissingError  = errors.New("object is missing in storage witness")
+	WitnessMismatchError = errors.New("object mismatch with storage witness")
+	WitnessUnusedError   = errors.New("storage witness is not fully used")
+)
+
+// storage operations recorded in witness
+const (
+	getOp    = "get"
+	putOp    = "put"
+	headOp   = "head"
+	deleteOp = "delete"
+	listOp   = "list"
+)
+
+// WitnessEntry result of an off-chain operation while executing the block
+type WitnessEntry struct {
+	Op      string
+	Url     string
+	Name    string
+	Content []byte
+	// Error the reason of fetch failure, empty if the object is fetched successfully
+	Error string
+}
+
+// Witness carries the off-chain operation results of the proposer along with the block, so that the validators
+// execute the block with the same objects instead of accessing the storage backend again at a different time.
+type Witness struct {
+	lock    sync.Mutex
+	mode    byte
+	entries []*WitnessEntry
+	cursor  int
+}
+
+// NewProposerWitness create an empty witness used by the block proposer
+func NewProposerWitness() *Witness {
+	return &Witness{
+		mode:    ProposerMode,
+		entries: make([]*WitnessEntry, 0),
+	}
+}
+
+// NewValidatorWitness create a witness from the encoded witness travelling with the block
+func NewValidatorWitness(data []byte) (*Witness, error) {
+	entries := make([]*WitnessEntry, 0)
+	if len(data) > 0 {
+		if err := rlp.DecodeBytes(data, &entries); err != nil {
+			return nil, err
+		}
+	}
+	return &Witness{
+		mode:    ValidatorMode,
+		entries: entries,
+	}, nil
+}
+
+// Mode return the mode of the witness
+func (this *Witness) Mode() byte {
+	return this.mode
+}
+
+// Encode encode the recorded results, the encoded witness should be packed into the block
+func (this *Witness) Encode() ([]byte, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return rlp.EncodeToBytes(this.entries)
+}
+
+// Finish check all the results in witness have been used, validator should reject the block if not.
+func (this *Witness) Finish() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.mode == ValidatorMode && this.cursor != len(this.entries) {
+		return WitnessUnusedError
+	}
+	return nil
+}
+
+// Call call the off-chain operation through the witness, the operations are called in the same order by
+// proposer and validators. op, url and name identify the operation, callFunc is only called in ProposerMode.
+func (this *Witness) Call(op, url, name string, callFunc func() ([]byte, error)) ([]byte, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.mode == ValidatorMode {
+		if this.cursor >= len(this.entries) {
+			return nil, WitnessMissingError
+		}
+		entry := this.entries[this.cursor]
+		if entry.Op != op || entry.Url != url || entry.Name != name {
+			return nil, WitnessMismatchError
+		}
+		this.cursor++
+		if len(entry.Error) > 0 {
+			return nil, errors.New(entry.Error)
+		}
+		return entry.Content, nil
+	}
+
+	// failures are recorded too, so that validators fail in the same way
+	content, err := callFunc()
+	entry := &WitnessEntry{
+		Op:      op,
+		Url:     url,
+		Name:    name,
+		Content: content,
+	}
+	if err != nil {
+		entry.Content, entry.Error = []byte{}, err.Error()
+	}
+	this.entries = append(this.entries, entry)
+	return content, err
+}
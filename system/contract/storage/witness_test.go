@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWitness(t *testing.T) {
+	assert := assert.New(t)
+	proposer := NewProposerWitness()
+	assert.Equal(ProposerMode, proposer.Mode())
+
+	content, err := proposer.Call(getOp, rawUrl, objName, func() ([]byte, error) {
+		return []byte("Hello"), nil
+	})
+	assert.Nil(err)
+	assert.Equal([]byte("Hello"), content)
+	_, err = proposer.Call(getOp, rawUrl, "missing", func() ([]byte, error) {
+		return nil, ObjectNotFoundError
+	})
+	assert.Equal(ObjectNotFoundError, err)
+	assert.Nil(proposer.Finish())
+
+	data, err := proposer.Encode()
+	assert.Nil(err)
+	validator, err := NewValidatorWitness(data)
+	assert.Nil(err)
+	assert.Equal(ValidatorMode, validator.Mode())
+	assert.Equal(WitnessUnusedError, validator.Finish())
+
+	failedCall := func() ([]byte, error) {
+		return nil, errors.New("validator should not access the backend")
+	}
+	_, err = validator.Call(getOp, rawUrl, "other", failedCall)
+	assert.Equal(WitnessMismatchError, err)
+	content, err = validator.Call(getOp, rawUrl, objName, failedCall)
+	assert.Nil(err)
+	assert.Equal([]byte("Hello"), content)
+	_, err = validator.Call(getOp, rawUrl, "missing", failedCall)
+	assert.EqualError(err, ObjectNotFoundError.Error())
+	_, err = validator.Call(getOp, rawUrl, objName, failedCall)
+	assert.Equal(WitnessMissingError, err)
+	assert.Nil(validator.Finish())
+
+	_, err = NewValidatorWitness([]byte{0x01})
+	assert.NotNil(err)
+}
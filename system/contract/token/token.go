@@ -0,0 +1,400 @@
+package token
+
+import (
+	"github.com/DSiSc/craft/types"
+	cutil "github.com/DSiSc/crypto-suite/util"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/common/rlp"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+var TokenAddr = cutil.HexToAddress("0000000000000000000000000000000000010111")
+
+const (
+	tokenBalanceKey     = "TokenBalanceKey"
+	tokenAllowanceKey   = "TokenAllowanceKey"
+	tokenTotalSupplyKey = "TokenTotalSupplyKey"
+	tokenMetadataKey    = "TokenMetadataKey"
+)
+
+var (
+	nameMethod         = util.MustNewMethod("name()", "string")
+	symbolMethod       = util.MustNewMethod("symbol()", "string")
+	decimalsMethod     = util.MustNewMethod("decimals()", "uint8")
+	totalSupplyMethod  = util.MustNewMethod("totalSupply()", "uint256")
+	balanceOfMethod    = util.MustNewMethod("balanceOf(address owner)", "uint256")
+	transferMethod     = util.MustNewMethod("transfer(address to,uint256 value)", "bool")
+	allowanceMethod    = util.MustNewMethod("allowance(address owner,address spender)", "uint256")
+	approveMethod      = util.MustNewMethod("approve(address spender,uint256 value)", "bool")
+	transferFromMethod = util.MustNewMethod("transferFrom(address from,address to,uint256 value)", "bool")
+	mintMethod         = util.MustNewMethod("mint(address to,uint256 value)", "bool")
+	governorMethod     = util.MustNewMethod("governor()", "address")
+	transferGovernor   = util.MustNewMethod("transferGovernor(address governor)")
+)
+
+var (
+	nameMethodHash         = string(nameMethod.Id())
+	symbolMethodHash       = string(symbolMethod.Id())
+	decimalsMethodHash     = string(decimalsMethod.Id())
+	totalSupplyMethodHash  = string(totalSupplyMethod.Id())
+	balanceOfMethodHash    = string(balanceOfMethod.Id())
+	transferMethodHash     = string(transferMethod.Id())
+	allowanceMethodHash    = string(allowanceMethod.Id())
+	approveMethodHash      = string(approveMethod.Id())
+	transferFromMethodHash = string(transferFromMethod.Id())
+	mintMethodHash         = string(mintMethod.Id())
+	governorMethodHash     = string(governorMethod.Id())
+	transferGovernorHash   = string(transferGovernor.Id())
+)
+
+var (
+	// TransferEvent emitted when the tokens are moved, minted tokens are transferred from the zero address
+	TransferEvent = util.MustNewEvent("Transfer(address indexed from,address indexed to,uint256 value)")
+	// ApprovalEvent emitted when the allowance of the spender is set by the owner
+	ApprovalEvent = util.MustNewEvent("Approval(address indexed owner,address indexed spender,uint256 value)")
+)
+
+// TokenABI abi metadata of the native token contract, it is compatible with ERC-20
+var TokenABI = &util.ABI{
+	Methods: []*util.Method{
+		nameMethod, symbolMethod, decimalsMethod, totalSupplyMethod, balanceOfMethod,
+		transferMethod, allowanceMethod, approveMethod, transferFromMethod, mintMethod,
+		governorMethod, transferGovernor,
+	},
+	Events: []*util.Event{TransferEvent, ApprovalEvent},
+}
+
+var (
+	InsufficientBalanceError   = errors.New("transfer amount exceeds balance")
+	InsufficientAllowanceError = errors.New("transfer amount exceeds allowance")
+	ZeroAddressError           = errors.New("transfer to the zero address")
+	SupplyOverflowError        = errors.New("total supply overflow")
+)
+
+// IsViewMethod check the method called with input doesn't modify the state
+func IsViewMethod(input []byte) bool {
+	switch string(util.ExtractMethodHash(input)) {
+	case nameMethodHash, symbolMethodHash, decimalsMethodHash, totalSupplyMethodHash, balanceOfMethodHash,
+		allowanceMethodHash, governorMethodHash:
+		return true
+	default:
+		return false
+	}
+}
+
+// execute the native token contract, caller is the address calling the contract
+func TokenExecute(token *TokenContract, caller types.Address, input []byte) ([]byte, error) {
+	methodHash := util.ExtractMethodHash(input)
+	switch string(methodHash) {
+	case nameMethodHash:
+		return util.EncodeReturnValue(token.Metadata().Name)
+	case symbolMethodHash:
+		return util.EncodeReturnValue(token.Metadata().Symbol)
+	case decimalsMethodHash:
+		return util.EncodeReturnValue(token.Metadata().Decimals)
+	case totalSupplyMethodHash:
+		totalSupply, err := token.TotalSupply()
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(totalSupply)
+	case balanceOfMethodHash:
+		var owner types.Address
+		err := util.ExtractParam(input[len(methodHash):], &owner)
+		if err != nil {
+			return nil, err
+		}
+		balance, err := token.BalanceOf(owner)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(balance)
+	case transferMethodHash:
+		var to types.Address
+		value := new(big.Int)
+		err := util.ExtractParam(input[len(methodHash):], &to, value)
+		if err != nil {
+			return nil, err
+		}
+		if err = token.Transfer(caller, to, value); err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(true)
+	case allowanceMethodHash:
+		var owner, spender types.Address
+		err := util.ExtractParam(input[len(methodHash):], &owner, &spender)
+		if err != nil {
+			return nil, err
+		}
+		allowance, err := token.Allowance(owner, spender)
+		if err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(allowance)
+	case approveMethodHash:
+		var spender types.Address
+		value := new(big.Int)
+		err := util.ExtractParam(input[len(methodHash):], &spender, value)
+		if err != nil {
+			return nil, err
+		}
+		if err = token.Approve(caller, spender, value); err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(true)
+	case transferFromMethodHash:
+		var from, to types.Address
+		value := new(big.Int)
+		err := util.ExtractParam(input[len(methodHash):], &from, &to, value)
+		if err != nil {
+			return nil, err
+		}
+		if err = token.TransferFrom(caller, from, to, value); err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(true)
+	case mintMethodHash:
+		var to types.Address
+		value := new(big.Int)
+		err := util.ExtractParam(input[len(methodHash):], &to, value)
+		if err != nil {
+			return nil, err
+		}
+		if err = token.Mint(caller, to, value); err != nil {
+			return nil, err
+		}
+		return util.EncodeReturnValue(true)
+	case governorMethodHash:
+		governor, ok := util.NewGovernor(token.db, TokenAddr).Address()
+		if !ok {
+			return nil, util.GovernorNotDefinedError
+		}
+		return util.EncodeReturnValue(governor)
+	case transferGovernorHash:
+		var governor types.Address
+		err := util.ExtractParam(input[len(methodHash):], &governor)
+		if err != nil {
+			return nil, err
+		}
+		return nil, util.NewGovernor(token.db, TokenAddr).Transfer(caller, governor)
+	default:
+		return nil, errors.New("unknown method")
+	}
+}
+
+// Metadata the name, symbol and decimals of the native token
+type Metadata struct {
+	Name     string
+	Symbol   string
+	Decimals uint8
+}
+
+// DefaultMetadata return the metadata of the token whose metadata isn't set at genesis
+func DefaultMetadata() Metadata {
+	return Metadata{
+		Name:     "Native Token",
+		Symbol:   "NATIVE",
+		Decimals: 18,
+	}
+}
+
+// SetupGenesis record the governor, which is the only account allowed to mint tokens, and the token metadata
+// in the genesis state
+func SetupGenesis(db *repository.Repository, governor types.Address, metadata Metadata) error {
+	if err := util.NewGovernor(db, TokenAddr).Set(governor); err != nil {
+		return err
+	}
+	val, err := rlp.EncodeToBytes(&metadata)
+	if err != nil {
+		return err
+	}
+	return db.Put(util.Hash([]byte(tokenMetadataKey)), val)
+}
+
+// TokenContract the native token system contract, it behaves as an ERC-20 token without interpreting the bytecode.
+// The balances and allowances are stored in the state repository, and each write is charged like SSTORE.
+type TokenContract struct {
+	db       *repository.Repository
+	emitter  util.EventEmitter
+	gasMeter *util.GasMeter
+}
+
+// NewTokenContract create a new instance.
+// emitter: emitter of the Transfer and Approval events, no event is emitted if it is nil
+func NewTokenContract(db *repository.Repository, emitter util.EventEmitter) *TokenContract {
+	return &TokenContract{
+		db:      db,
+		emitter: emitter,
+	}
+}
+
+// SetGasMeter set the meter charging the storage writes, nothing is charged if it is not set
+func (this *TokenContract) SetGasMeter(gasMeter *util.GasMeter) {
+	this.gasMeter = gasMeter
+}
+
+// TotalSupply return the amount of the minted tokens
+func (this *TokenContract) TotalSupply() (*big.Int, error) {
+	return this.getValue(this.totalSupplyKey())
+}
+
+// BalanceOf return the balance of the owner
+func (this *TokenContract) BalanceOf(owner types.Address) (*big.Int, error) {
+	return this.getValue(this.balanceKey(owner))
+}
+
+// Metadata return the token metadata recorded in the contract state
+func (this *TokenContract) Metadata() Metadata {
+	val, err := this.db.Get(util.Hash([]byte(tokenMetadataKey)))
+	if err != nil || len(val) == 0 {
+		return DefaultMetadata()
+	}
+	metadata := Metadata{}
+	if err = rlp.DecodeBytes(val, &metadata); err != nil {
+		return DefaultMetadata()
+	}
+	return metadata
+}
+
+// Allowance return the amount the spender is still allowed to transfer from the owner
+func (this *TokenContract) Allowance(owner, spender types.Address) (*big.Int, error) {
+	return this.getValue(this.allowanceKey(owner, spender))
+}
+
+// Transfer move value tokens from the caller to the receiver
+func (this *TokenContract) Transfer(caller, to types.Address, value *big.Int) error {
+	return this.transfer(caller, to, value)
+}
+
+// Approve set the amount the spender is allowed to transfer from the caller
+func (this *TokenContract) Approve(caller, spender types.Address, value *big.Int) error {
+	if spender == (types.Address{}) {
+		return ZeroAddressError
+	}
+	if err := this.putValue(this.allowanceKey(caller, spender), value); err != nil {
+		return err
+	}
+	return ApprovalEvent.Emit(this.emitter, TokenAddr, caller, spender, value)
+}
+
+// TransferFrom move value tokens from the owner to the receiver using the allowance of the caller,
+// the allowance of max uint256 is never decreased.
+func (this *TokenContract) TransferFrom(caller, from, to types.Address, value *big.Int) error {
+	allowance, err := this.Allowance(from, caller)
+	if err != nil {
+		return err
+	}
+	if allowance.Cmp(value) < 0 {
+		return InsufficientAllowanceError
+	}
+	if allowance.Cmp(math.MaxBig256) != 0 {
+		if err := this.putValue(this.allowanceKey(from, caller), new(big.Int).Sub(allowance, value)); err != nil {
+			return err
+		}
+	}
+	return this.transfer(from, to, value)
+}
+
+// Mint create value tokens for the receiver, only the governor recorded in the contract state can mint tokens
+func (this *TokenContract) Mint(caller, to types.Address, value *big.Int) error {
+	if err := util.NewGovernor(this.db, TokenAddr).Check(caller); err != nil {
+		return err
+	}
+	if to == (types.Address{}) {
+		return ZeroAddressError
+	}
+	totalSupply, err := this.TotalSupply()
+	if err != nil {
+		return err
+	}
+	totalSupply = new(big.Int).Add(totalSupply, value)
+	if totalSupply.Cmp(math.MaxBig256) > 0 {
+		return SupplyOverflowError
+	}
+	if err = this.putValue(this.totalSupplyKey(), totalSupply); err != nil {
+		return err
+	}
+	toBalance, err := this.BalanceOf(to)
+	if err != nil {
+		return err
+	}
+	if err = this.putValue(this.balanceKey(to), new(big.Int).Add(toBalance, value)); err != nil {
+		return err
+	}
+	return TransferEvent.Emit(this.emitter, TokenAddr, types.Address{}, to, value)
+}
+
+func (this *TokenContract) Address() types.Address {
+	return TokenAddr
+}
+
+// move value tokens and emit the Transfer event
+func (this *TokenContract) transfer(from, to types.Address, value *big.Int) error {
+	if to == (types.Address{}) {
+		return ZeroAddressError
+	}
+	fromBalance, err := this.BalanceOf(from)
+	if err != nil {
+		return err
+	}
+	if fromBalance.Cmp(value) < 0 {
+		return InsufficientBalanceError
+	}
+	if err = this.putValue(this.balanceKey(from), new(big.Int).Sub(fromBalance, value)); err != nil {
+		return err
+	}
+	// the total supply never exceeds max uint256, so the receiver balance never overflows
+	toBalance, err := this.BalanceOf(to)
+	if err != nil {
+		return err
+	}
+	if err = this.putValue(this.balanceKey(to), new(big.Int).Add(toBalance, value)); err != nil {
+		return err
+	}
+	return TransferEvent.Emit(this.emitter, TokenAddr, from, to, value)
+}
+
+// return the value stored with key, zero if it is not found
+func (this *TokenContract) getValue(key []byte) (*big.Int, error) {
+	val, err := this.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(val), nil
+}
+
+// store the value with key, it is charged like SSTORE: setting a zero slot to non-zero costs SstoreSetGas,
+// and any other write costs SstoreResetGas
+func (this *TokenContract) putValue(key []byte, value *big.Int) error {
+	current, err := this.getValue(key)
+	if err != nil {
+		return err
+	}
+	gas := params.SstoreResetGas
+	if current.Sign() == 0 && value.Sign() != 0 {
+		gas = params.SstoreSetGas
+	}
+	if err = this.gasMeter.UseGas(gas); err != nil {
+		return err
+	}
+	return this.db.Put(key, value.Bytes())
+}
+
+// return the storage key of the balance
+func (this *TokenContract) balanceKey(owner types.Address) []byte {
+	return util.Hash(append([]byte(tokenBalanceKey), owner[:]...))
+}
+
+// return the storage key of the allowance
+func (this *TokenContract) allowanceKey(owner, spender types.Address) []byte {
+	return util.Hash(append(append([]byte(tokenAllowanceKey), owner[:]...), spender[:]...))
+}
+
+// return the storage key of the total supply
+func (this *TokenContract) totalSupplyKey() []byte {
+	return util.Hash([]byte(tokenTotalSupplyKey))
+}
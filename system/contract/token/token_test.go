@@ -0,0 +1,249 @@
+package token
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/util"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+var (
+	mockGovernor = types.Address{0x1}
+	mockAlice    = types.Address{0x2}
+	mockBob      = types.Address{0x3}
+)
+
+func mockTokenContract() (*TokenContract, *[]*types.Log) {
+	db := &repository.Repository{}
+	cache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return cache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		cache[string(key)] = value
+		return nil
+	})
+	logs := make([]*types.Log, 0)
+	emitter := func(address types.Address, topics []types.Hash, data []byte) {
+		logs = append(logs, &types.Log{Address: address, Topics: topics, Data: data})
+	}
+	return NewTokenContract(db, emitter), &logs
+}
+
+// return the token value, the repository errors are not expected by the tests
+func value(v *big.Int, err error) *big.Int {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// record the governor and metadata in the genesis state
+func mockGenesis(t *testing.T, token *TokenContract, metadata Metadata) {
+	if err := SetupGenesis(token.db, mockGovernor, metadata); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenContract_Mint(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	token, logs := mockTokenContract()
+	assert.Equal(TokenAddr, token.Address())
+
+	assert.Equal(util.GovernorNotDefinedError, token.Mint(mockGovernor, mockAlice, big.NewInt(100)))
+	mockGenesis(t, token, DefaultMetadata())
+	assert.Equal(util.NotGovernorError, token.Mint(mockAlice, mockAlice, big.NewInt(100)))
+	assert.Equal(ZeroAddressError, token.Mint(mockGovernor, types.Address{}, big.NewInt(100)))
+
+	assert.Nil(token.Mint(mockGovernor, mockAlice, big.NewInt(100)))
+	assert.Equal(big.NewInt(100), value(token.TotalSupply()))
+	assert.Equal(big.NewInt(100), value(token.BalanceOf(mockAlice)))
+	assert.Equal(1, len(*logs))
+	assert.Equal(TransferEvent.Id(), (*logs)[0].Topics[0])
+	assert.Equal(types.Hash{}, (*logs)[0].Topics[1])
+
+	assert.Equal(SupplyOverflowError, token.Mint(mockGovernor, mockBob, math.MaxBig256))
+	assert.Equal(big.NewInt(100), value(token.TotalSupply()))
+}
+
+func TestTokenContract_Transfer(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	token, logs := mockTokenContract()
+	mockGenesis(t, token, DefaultMetadata())
+	assert.Nil(token.Mint(mockGovernor, mockAlice, big.NewInt(100)))
+
+	assert.Nil(token.Transfer(mockAlice, mockBob, big.NewInt(30)))
+	assert.Equal(big.NewInt(70), value(token.BalanceOf(mockAlice)))
+	assert.Equal(big.NewInt(30), value(token.BalanceOf(mockBob)))
+	assert.Equal(2, len(*logs))
+
+	// transfer to self keeps the balance
+	assert.Nil(token.Transfer(mockAlice, mockAlice, big.NewInt(70)))
+	assert.Equal(big.NewInt(70), value(token.BalanceOf(mockAlice)))
+
+	assert.Equal(InsufficientBalanceError, token.Transfer(mockAlice, mockBob, big.NewInt(71)))
+	assert.Equal(ZeroAddressError, token.Transfer(mockAlice, types.Address{}, big.NewInt(1)))
+	assert.Equal(big.NewInt(100), value(token.TotalSupply()))
+}
+
+func TestTokenContract_TransferFrom(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	token, logs := mockTokenContract()
+	mockGenesis(t, token, DefaultMetadata())
+	assert.Nil(token.Mint(mockGovernor, mockAlice, big.NewInt(100)))
+
+	assert.Nil(token.Approve(mockAlice, mockBob, big.NewInt(50)))
+	assert.Equal(big.NewInt(50), value(token.Allowance(mockAlice, mockBob)))
+	assert.Equal(ApprovalEvent.Id(), (*logs)[1].Topics[0])
+
+	assert.Nil(token.TransferFrom(mockBob, mockAlice, mockGovernor, big.NewInt(20)))
+	assert.Equal(big.NewInt(30), value(token.Allowance(mockAlice, mockBob)))
+	assert.Equal(big.NewInt(80), value(token.BalanceOf(mockAlice)))
+	assert.Equal(big.NewInt(20), value(token.BalanceOf(mockGovernor)))
+	assert.Equal(InsufficientAllowanceError, token.TransferFrom(mockBob, mockAlice, mockGovernor, big.NewInt(31)))
+
+	// the infinite allowance is never decreased
+	assert.Nil(token.Approve(mockAlice, mockBob, math.MaxBig256))
+	assert.Nil(token.TransferFrom(mockBob, mockAlice, mockBob, big.NewInt(80)))
+	assert.Equal(math.MaxBig256, value(token.Allowance(mockAlice, mockBob)))
+	assert.Equal(InsufficientBalanceError, token.TransferFrom(mockBob, mockAlice, mockBob, big.NewInt(1)))
+}
+
+func TestTokenExecute(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	token, _ := mockTokenContract()
+	assert.Equal(DefaultMetadata(), token.Metadata())
+	mockGenesis(t, token, Metadata{Name: "Test Token", Symbol: "TT", Decimals: 8})
+
+	ret, err := TokenExecute(token, mockAlice, util.Hash([]byte("symbol()"))[:4])
+	assert.Nil(err)
+	symbol := new(string)
+	assert.Nil(util.ExtractParam(ret, symbol))
+	assert.Equal("TT", *symbol)
+
+	ret, err = TokenExecute(token, mockAlice, util.Hash([]byte("decimals()"))[:4])
+	assert.Nil(err)
+	var decimals uint8
+	assert.Nil(util.ExtractParam(ret, &decimals))
+	assert.Equal(uint8(8), decimals)
+
+	input, _ := util.EncodeReturnValue(mockAlice, big.NewInt(100))
+	_, err = TokenExecute(token, mockAlice, append(util.Hash([]byte("mint(address,uint256)"))[:4], input...))
+	assert.Equal(util.NotGovernorError, err)
+	ret, err = TokenExecute(token, mockGovernor, append(util.Hash([]byte("mint(address,uint256)"))[:4], input...))
+	assert.Nil(err)
+	var ok bool
+	assert.Nil(util.ExtractParam(ret, &ok))
+	assert.True(ok)
+
+	input, _ = util.EncodeReturnValue(mockBob, big.NewInt(40))
+	_, err = TokenExecute(token, mockAlice, append(util.Hash([]byte("transfer(address,uint256)"))[:4], input...))
+	assert.Nil(err)
+	_, err = TokenExecute(token, mockBob, append(util.Hash([]byte("approve(address,uint256)"))[:4], input...))
+	assert.Nil(err)
+	input, _ = util.EncodeReturnValue(mockBob, mockBob, big.NewInt(10))
+	_, err = TokenExecute(token, mockBob, append(util.Hash([]byte("transferFrom(address,address,uint256)"))[:4], input...))
+	assert.Nil(err)
+
+	input, _ = util.EncodeReturnValue(mockBob)
+	ret, err = TokenExecute(token, mockAlice, append(util.Hash([]byte("balanceOf(address)"))[:4], input...))
+	assert.Nil(err)
+	balance := new(big.Int)
+	assert.Nil(util.ExtractParam(ret, balance))
+	assert.Equal(big.NewInt(40), balance)
+
+	input, _ = util.EncodeReturnValue(mockBob, mockBob)
+	ret, err = TokenExecute(token, mockAlice, append(util.Hash([]byte("allowance(address,address)"))[:4], input...))
+	assert.Nil(err)
+	allowance := new(big.Int)
+	assert.Nil(util.ExtractParam(ret, allowance))
+	assert.Equal(big.NewInt(30), allowance)
+
+	ret, err = TokenExecute(token, mockAlice, util.Hash([]byte("totalSupply()"))[:4])
+	assert.Nil(err)
+	totalSupply := new(big.Int)
+	assert.Nil(util.ExtractParam(ret, totalSupply))
+	assert.Equal(big.NewInt(100), totalSupply)
+
+	_, err = TokenExecute(token, mockAlice, util.Hash([]byte("unknown()"))[:4])
+	assert.NotNil(err)
+
+	// the governor is transferred by the governor
+	input, _ = util.EncodeReturnValue(mockAlice)
+	transferGovernor := append(util.Hash([]byte("transferGovernor(address)"))[:4], input...)
+	_, err = TokenExecute(token, mockAlice, transferGovernor)
+	assert.Equal(util.NotGovernorError, err)
+	_, err = TokenExecute(token, mockGovernor, transferGovernor)
+	assert.Nil(err)
+	ret, err = TokenExecute(token, mockBob, util.Hash([]byte("governor()"))[:4])
+	assert.Nil(err)
+	var governor types.Address
+	assert.Nil(util.ExtractParam(ret, &governor))
+	assert.Equal(mockAlice, governor)
+}
+
+func TestTokenContract_GasMeter(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	token, _ := mockTokenContract()
+	mockGenesis(t, token, DefaultMetadata())
+	gasMeter := util.NewGasMeter(100000)
+	token.SetGasMeter(gasMeter)
+
+	// the total supply and the balance are set from zero
+	assert.Nil(token.Mint(mockGovernor, mockAlice, big.NewInt(100)))
+	assert.Equal(100000-2*params.SstoreSetGas, gasMeter.Gas())
+
+	// the sender balance is reset and the receiver balance is set from zero
+	assert.Nil(token.Transfer(mockAlice, mockBob, big.NewInt(30)))
+	assert.Equal(100000-3*params.SstoreSetGas-params.SstoreResetGas, gasMeter.Gas())
+
+	// both balances are reset
+	assert.Nil(token.Transfer(mockAlice, mockBob, big.NewInt(10)))
+	assert.Equal(100000-3*params.SstoreSetGas-3*params.SstoreResetGas, gasMeter.Gas())
+
+	assert.Nil(token.Approve(mockAlice, mockBob, big.NewInt(10)))
+	assert.Equal(params.SstoreResetGas, gasMeter.Gas())
+	assert.Equal(util.OutOfGasError, token.Approve(mockAlice, mockGovernor, big.NewInt(10)))
+}
+
+func TestTokenContract_Errors(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	token, _ := mockTokenContract()
+	assert.Equal(ZeroAddressError, token.Approve(mockAlice, types.Address{}, big.NewInt(10)))
+
+	_, err := TokenExecute(token, mockBob, util.Hash([]byte("governor()"))[:4])
+	assert.Equal(util.GovernorNotDefinedError, err)
+
+	// the repository errors are returned instead of the zero balance
+	readError := errors.New("read error")
+	monkey.PatchInstanceMethod(reflect.TypeOf(token.db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return nil, readError
+	})
+	_, err = token.BalanceOf(mockAlice)
+	assert.Equal(readError, err)
+	assert.Equal(readError, token.Transfer(mockAlice, mockBob, big.NewInt(1)))
+	input, _ := util.EncodeReturnValue(mockAlice)
+	_, err = TokenExecute(token, mockBob, append(util.Hash([]byte("balanceOf(address)"))[:4], input...))
+	assert.Equal(readError, err)
+}
+
+func TestIsViewMethod(t *testing.T) {
+	assert := assert.New(t)
+	input, _ := util.EncodeReturnValue(mockBob, big.NewInt(40))
+	assert.True(IsViewMethod(util.Hash([]byte("totalSupply()"))[:4]))
+	assert.False(IsViewMethod(append(util.Hash([]byte("transfer(address,uint256)"))[:4], input...)))
+	assert.False(IsViewMethod(nil))
+}
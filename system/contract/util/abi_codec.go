@@ -0,0 +1,521 @@
+package util
+
+import (
+	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/constant"
+	"github.com/pkg/errors"
+	"math/big"
+	"reflect"
+)
+
+var (
+	ShortInputError      = errors.New("input data too short")
+	InvalidOffsetError   = errors.New("invalid data offset")
+	ValueOutOfRangeError = errors.New("value out of range")
+	InvalidPaddingError  = errors.New("invalid value padding")
+	ArgCountError        = errors.New("argument count mismatch")
+	NilValueError        = errors.New("nil value")
+)
+
+// EncodeArgs encode the values as the abi tuple made up of the specified types
+func EncodeArgs(argTypes []Type, values ...interface{}) ([]byte, error) {
+	if len(argTypes) != len(values) {
+		return nil, ArgCountError
+	}
+	rvs := make([]reflect.Value, 0, len(values))
+	for _, value := range values {
+		rvs = append(rvs, reflect.ValueOf(value))
+	}
+	return encodeTuple(argTypes, rvs)
+}
+
+// DecodeArgs decode the abi tuple made up of the specified types into args, each arg must be a non-nil pointer
+func DecodeArgs(argTypes []Type, input []byte, args ...interface{}) error {
+	if len(argTypes) != len(args) {
+		return ArgCountError
+	}
+	rvs := make([]reflect.Value, 0, len(args))
+	for _, arg := range args {
+		rv := reflect.ValueOf(arg)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return InvalidUnmarshalError
+		}
+		rvs = append(rvs, rv.Elem())
+	}
+	d := &decoder{remain: len(input)}
+	return d.decodeTuple(argTypes, input, rvs)
+}
+
+// decoder decodes the abi data. Each word of the canonical encoding is read once, so the words
+// read in total never exceed the input. The offsets pointing many values at the same data,
+// which decode the small input into huge values, are rejected once the input is used up.
+type decoder struct {
+	remain int // bytes of the input not read yet
+}
+
+// consume n bytes of the input
+func (d *decoder) consume(n int) error {
+	if n > d.remain {
+		return InvalidOffsetError
+	}
+	d.remain -= n
+	return nil
+}
+
+// encode the values as tuple, dynamic values are appended to the tail part
+func encodeTuple(argTypes []Type, values []reflect.Value) ([]byte, error) {
+	headSize := 0
+	for _, argType := range argTypes {
+		headSize += argType.headSize()
+	}
+	head, tail := make([]byte, 0, headSize), make([]byte, 0)
+	for i, argType := range argTypes {
+		enc, err := encodeValue(argType, values[i])
+		if err != nil {
+			return nil, err
+		}
+		if argType.isDynamic() {
+			head = append(head, encodeUint(uint64(headSize+len(tail)))...)
+			tail = append(tail, enc...)
+		} else {
+			head = append(head, enc...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+// encode a single value with the specified abi type
+func encodeValue(t Type, v reflect.Value) ([]byte, error) {
+	v, err := indirect(v)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Kind {
+	case IntTy, UintTy:
+		val, err := toBig(v)
+		if err != nil {
+			return nil, err
+		}
+		if !inRange(t, val) {
+			return nil, ValueOutOfRangeError
+		}
+		return math.PaddedBigBytes(math.U256(new(big.Int).Set(val)), constant.EvmWordSize), nil
+	case BoolTy:
+		if v.Kind() != reflect.Bool {
+			return nil, UnSupportedTypeError
+		}
+		if v.Bool() {
+			return encodeUint(1), nil
+		}
+		return encodeUint(0), nil
+	case AddressTy:
+		if !isByteArray(v.Type()) || v.Len() != 20 {
+			return nil, UnSupportedTypeError
+		}
+		return common.LeftPadBytes(byteArray(v), constant.EvmWordSize), nil
+	case FixedBytesTy:
+		if !isByteArray(v.Type()) && !isByteSlice(v.Type()) {
+			return nil, UnSupportedTypeError
+		}
+		if v.Len() != t.Size {
+			return nil, ValueOutOfRangeError
+		}
+		return common.RightPadBytes(byteArray(v), constant.EvmWordSize), nil
+	case BytesTy, StringTy:
+		switch {
+		case v.Kind() == reflect.String:
+			return encodeString(v.String()), nil
+		case isByteSlice(v.Type()) || isByteArray(v.Type()):
+			return encodeBytes(byteArray(v)), nil
+		default:
+			return nil, UnSupportedTypeError
+		}
+	case SliceTy:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, UnSupportedTypeError
+		}
+		enc, err := encodeTuple(repeatType(*t.Elem, v.Len()), elements(v))
+		if err != nil {
+			return nil, err
+		}
+		return append(encodeUint(uint64(v.Len())), enc...), nil
+	case ArrayTy:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, UnSupportedTypeError
+		}
+		if v.Len() != t.Size {
+			return nil, ValueOutOfRangeError
+		}
+		return encodeTuple(repeatType(*t.Elem, t.Size), elements(v))
+	case TupleTy:
+		if v.Kind() != reflect.Struct {
+			return nil, UnSupportedTypeError
+		}
+		fields := exportedFields(v)
+		if len(fields) != len(t.Components) {
+			return nil, ArgCountError
+		}
+		return encodeTuple(t.Components, fields)
+	default:
+		return nil, UnSupportedTypeError
+	}
+}
+
+// decode the tuple made up of the specified types into targets
+func (d *decoder) decodeTuple(argTypes []Type, input []byte, targets []reflect.Value) error {
+	offset := 0
+	for i, argType := range argTypes {
+		if argType.isDynamic() {
+			word, err := readWord(input, offset)
+			if err != nil {
+				return err
+			}
+			pos, err := readOffset(word, len(input))
+			if err != nil {
+				return err
+			}
+			if err := d.consume(constant.EvmWordSize); err != nil {
+				return err
+			}
+			if err := d.decodeValue(argType, input[pos:], targets[i]); err != nil {
+				return err
+			}
+		} else {
+			if offset > len(input) {
+				return ShortInputError
+			}
+			if err := d.decodeValue(argType, input[offset:], targets[i]); err != nil {
+				return err
+			}
+		}
+		offset += argType.headSize()
+	}
+	return nil
+}
+
+// decode a single value with the specified abi type into target
+func (d *decoder) decodeValue(t Type, input []byte, target reflect.Value) error {
+	if !target.CanSet() {
+		return InvalidUnmarshalError
+	}
+	switch {
+	case target.Kind() == reflect.Interface:
+		val := reflect.New(t.goType()).Elem()
+		if err := d.decodeValue(t, input, val); err != nil {
+			return err
+		}
+		target.Set(val)
+		return nil
+	case target.Kind() == reflect.Ptr && target.Type() != bigPtrT:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return d.decodeValue(t, input, target.Elem())
+	}
+
+	switch t.Kind {
+	case IntTy, UintTy:
+		word, err := d.readWord(input)
+		if err != nil {
+			return err
+		}
+		val := new(big.Int).SetBytes(word)
+		if t.Kind == IntTy {
+			val = math.S256(val)
+		}
+		if !inRange(t, val) {
+			return InvalidPaddingError
+		}
+		return setBig(target, val)
+	case BoolTy:
+		word, err := d.readWord(input)
+		if err != nil {
+			return err
+		}
+		if !allZero(word[:constant.EvmWordSize-1]) || word[constant.EvmWordSize-1] > 1 {
+			return InvalidPaddingError
+		}
+		if target.Kind() != reflect.Bool {
+			return UnSupportedTypeError
+		}
+		target.SetBool(word[constant.EvmWordSize-1] == 1)
+		return nil
+	case AddressTy:
+		word, err := d.readWord(input)
+		if err != nil {
+			return err
+		}
+		if !allZero(word[:constant.AddressOffset]) {
+			return InvalidPaddingError
+		}
+		if !isByteArray(target.Type()) || target.Len() != 20 {
+			return UnSupportedTypeError
+		}
+		reflect.Copy(target, reflect.ValueOf(word[constant.AddressOffset:]))
+		return nil
+	case FixedBytesTy:
+		word, err := d.readWord(input)
+		if err != nil {
+			return err
+		}
+		if !allZero(word[t.Size:]) {
+			return InvalidPaddingError
+		}
+		return setBytes(target, word[:t.Size], t.Size)
+	case BytesTy, StringTy:
+		size, err := readLength(input, 1)
+		if err != nil {
+			return err
+		}
+		if err = d.consume(constant.EvmWordSize + size); err != nil {
+			return err
+		}
+		data := input[constant.EvmWordSize : constant.EvmWordSize+size]
+		if target.Kind() == reflect.String {
+			target.SetString(string(data))
+			return nil
+		}
+		return setBytes(target, data, -1)
+	case SliceTy:
+		size, err := readLength(input, t.Elem.headSize())
+		if err != nil {
+			return err
+		}
+		// the elements of zero size, such as the empty tuples, are not read from the input
+		if t.Elem.headSize() == 0 {
+			err = d.consume(constant.EvmWordSize + size)
+		} else {
+			err = d.consume(constant.EvmWordSize)
+		}
+		if err != nil {
+			return err
+		}
+		switch target.Kind() {
+		case reflect.Slice:
+			target.Set(reflect.MakeSlice(target.Type(), size, size))
+		case reflect.Array:
+			if target.Len() != size {
+				return ValueOutOfRangeError
+			}
+		default:
+			return UnSupportedTypeError
+		}
+		return d.decodeTuple(repeatType(*t.Elem, size), input[constant.EvmWordSize:], elements(target))
+	case ArrayTy:
+		switch target.Kind() {
+		case reflect.Slice:
+			target.Set(reflect.MakeSlice(target.Type(), t.Size, t.Size))
+		case reflect.Array:
+			if target.Len() != t.Size {
+				return ValueOutOfRangeError
+			}
+		default:
+			return UnSupportedTypeError
+		}
+		return d.decodeTuple(repeatType(*t.Elem, t.Size), input, elements(target))
+	case TupleTy:
+		if target.Kind() != reflect.Struct {
+			return UnSupportedTypeError
+		}
+		fields := exportedFields(target)
+		if len(fields) != len(t.Components) {
+			return ArgCountError
+		}
+		return d.decodeTuple(t.Components, input, fields)
+	default:
+		return UnSupportedTypeError
+	}
+}
+
+// read the 32 bytes word at the specified offset
+func readWord(input []byte, offset int) ([]byte, error) {
+	if offset < 0 || offset+constant.EvmWordSize > len(input) {
+		return nil, ShortInputError
+	}
+	return input[offset : offset+constant.EvmWordSize], nil
+}
+
+// read the 32 bytes word at the start of the input
+func (d *decoder) readWord(input []byte) ([]byte, error) {
+	word, err := readWord(input, 0)
+	if err != nil {
+		return nil, err
+	}
+	return word, d.consume(constant.EvmWordSize)
+}
+
+// read the offset of dynamic data, the offset must point into the input
+func readOffset(word []byte, inputLen int) (int, error) {
+	offset := new(big.Int).SetBytes(word)
+	if !offset.IsInt64() || offset.Int64() > int64(inputLen) {
+		return 0, InvalidOffsetError
+	}
+	return int(offset.Int64()), nil
+}
+
+// read the length prefix of dynamic data, elemSize is the size of each element in bytes
+func readLength(input []byte, elemSize int) (int, error) {
+	word, err := readWord(input, 0)
+	if err != nil {
+		return 0, err
+	}
+	if elemSize <= 0 {
+		elemSize = 1
+	}
+	size := new(big.Int).SetBytes(word)
+	remain := int64(len(input) - constant.EvmWordSize)
+	if !size.IsInt64() || size.Int64() > remain/int64(elemSize) {
+		return 0, ShortInputError
+	}
+	return int(size.Int64()), nil
+}
+
+// check whether the value can be represented by the integer type
+func inRange(t Type, val *big.Int) bool {
+	if t.Kind == UintTy {
+		return val.Sign() >= 0 && val.BitLen() <= t.Size
+	}
+	bound := new(big.Int).Lsh(common.Big1, uint(t.Size-1))
+	return val.Cmp(bound) < 0 && val.Cmp(new(big.Int).Neg(bound)) >= 0
+}
+
+// convert the integer value to big.Int
+func toBig(v reflect.Value) (*big.Int, error) {
+	switch {
+	case v.Type() == bigPtrT:
+		if v.IsNil() {
+			return nil, NilValueError
+		}
+		return v.Interface().(*big.Int), nil
+	case v.Type() == bigT:
+		val := v.Interface().(big.Int)
+		return &val, nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(v.Uint()), nil
+	default:
+		return nil, UnSupportedTypeError
+	}
+}
+
+// set the integer value to target
+func setBig(target reflect.Value, val *big.Int) error {
+	switch {
+	case target.Type() == bigPtrT:
+		target.Set(reflect.ValueOf(new(big.Int).Set(val)))
+		return nil
+	case target.Type() == bigT:
+		target.Addr().Interface().(*big.Int).Set(val)
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !val.IsInt64() || target.OverflowInt(val.Int64()) {
+			return ValueOutOfRangeError
+		}
+		target.SetInt(val.Int64())
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !val.IsUint64() || target.OverflowUint(val.Uint64()) {
+			return ValueOutOfRangeError
+		}
+		target.SetUint(val.Uint64())
+		return nil
+	default:
+		return UnSupportedTypeError
+	}
+}
+
+// set the bytes to the target byte slice or byte array, size < 0 means any size is acceptable
+func setBytes(target reflect.Value, data []byte, size int) error {
+	switch {
+	case isByteSlice(target.Type()):
+		target.SetBytes(common.CopyBytes(data))
+		return nil
+	case isByteArray(target.Type()) && (size < 0 || target.Len() == size) && target.Len() >= len(data):
+		reflect.Copy(target, reflect.ValueOf(data))
+		return nil
+	default:
+		return UnSupportedTypeError
+	}
+}
+
+// dereference pointers and interfaces, *big.Int is kept as it is
+func indirect(v reflect.Value) (reflect.Value, error) {
+	for v.IsValid() && (v.Kind() == reflect.Interface || (v.Kind() == reflect.Ptr && v.Type() != bigPtrT)) {
+		if v.IsNil() {
+			return v, NilValueError
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return v, NilValueError
+	}
+	return v, nil
+}
+
+// exported fields of a struct value
+func exportedFields(v reflect.Value) []reflect.Value {
+	fields := make([]reflect.Value, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		if len(v.Type().Field(i).PkgPath) > 0 {
+			continue
+		}
+		fields = append(fields, v.Field(i))
+	}
+	return fields
+}
+
+// elements of a slice or array value
+func elements(v reflect.Value) []reflect.Value {
+	elems := make([]reflect.Value, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elems = append(elems, v.Index(i))
+	}
+	return elems
+}
+
+// build a type list containing n elements of type t
+func repeatType(t Type, n int) []Type {
+	argTypes := make([]Type, n)
+	for i := range argTypes {
+		argTypes[i] = t
+	}
+	return argTypes
+}
+
+// copy the content of a byte array/slice value
+func byteArray(v reflect.Value) []byte {
+	if v.Kind() == reflect.Slice {
+		return v.Bytes()
+	}
+	data := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(data), v)
+	return data
+}
+
+func isByteSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+func isByteArray(t reflect.Type) bool {
+	return t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8
+}
+
+// encode the integer as a 32 bytes word
+func encodeUint(val uint64) []byte {
+	return math.PaddedBigBytes(new(big.Int).SetUint64(val), constant.EvmWordSize)
+}
+
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,346 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+// max number of the indexed event arguments, topic 0 is the event id
+const maxIndexedArgs = 3
+
+var InvalidSignatureError = errors.New("invalid abi signature")
+
+// Argument the named argument of the abi method or event
+type Argument struct {
+	Name    string
+	Type    Type
+	Indexed bool // only used by event arguments
+}
+
+// Method the abi metadata of the system contract method
+type Method struct {
+	Name    string
+	Inputs  []Argument
+	Outputs []Argument
+}
+
+// NewMethod parse the method from its signature, such as `Read(uint64 offset,uint64 size)`, the argument names
+// are optional. outputs are the abi types of the return values.
+func NewMethod(signature string, outputs ...string) (*Method, error) {
+	name, inputs, err := parseSignature(signature, false)
+	if err != nil {
+		return nil, err
+	}
+	method := &Method{
+		Name:    name,
+		Inputs:  inputs,
+		Outputs: make([]Argument, 0, len(outputs)),
+	}
+	for _, output := range outputs {
+		outputType, err := NewType(output)
+		if err != nil {
+			return nil, err
+		}
+		method.Outputs = append(method.Outputs, Argument{Type: outputType})
+	}
+	return method, nil
+}
+
+// MustNewMethod is like NewMethod but panics if the signature is invalid
+func MustNewMethod(signature string, outputs ...string) *Method {
+	method, err := NewMethod(signature, outputs...)
+	if err != nil {
+		panic(err)
+	}
+	return method
+}
+
+// Signature return the canonical signature of the method, such as `Read(uint64,uint64)`
+func (this *Method) Signature() string {
+	return canonicalSignature(this.Name, this.Inputs)
+}
+
+// Id return the method hash used to select the method
+func (this *Method) Id() []byte {
+	return ExtractMethodHash(Hash([]byte(this.Signature())))
+}
+
+// Pack encode the values as the input calling the method, which is the method hash followed by the abi encoded values
+func (this *Method) Pack(values ...interface{}) ([]byte, error) {
+	if len(values) != len(this.Inputs) {
+		return nil, ArgCountError
+	}
+	inputTypes := make([]Type, 0, len(this.Inputs))
+	for _, input := range this.Inputs {
+		inputTypes = append(inputTypes, input.Type)
+	}
+	data, err := EncodeArgs(inputTypes, values...)
+	if err != nil {
+		return nil, err
+	}
+	return append(this.Id(), data...), nil
+}
+
+// Event the abi metadata of the solidity event emitted by the system contract
+type Event struct {
+	Name   string
+	Inputs []Argument
+}
+
+// NewEvent parse the event from its signature, such as `Written(address indexed owner,uint64 size)`.
+// Only value types, string and bytes can be indexed.
+func NewEvent(signature string) (*Event, error) {
+	name, inputs, err := parseSignature(signature, true)
+	if err != nil {
+		return nil, err
+	}
+	indexed := 0
+	for _, input := range inputs {
+		if !input.Indexed {
+			continue
+		}
+		indexed++
+		if input.Type.Kind == SliceTy || input.Type.Kind == ArrayTy || input.Type.Kind == TupleTy {
+			return nil, errors.Errorf("%v: composite type can't be indexed: %s", InvalidSignatureError, signature)
+		}
+	}
+	if indexed > maxIndexedArgs {
+		return nil, errors.Errorf("%v: too many indexed arguments: %s", InvalidSignatureError, signature)
+	}
+	return &Event{
+		Name:   name,
+		Inputs: inputs,
+	}, nil
+}
+
+// MustNewEvent is like NewEvent but panics if the signature is invalid
+func MustNewEvent(signature string) *Event {
+	event, err := NewEvent(signature)
+	if err != nil {
+		panic(err)
+	}
+	return event
+}
+
+// Signature return the canonical signature of the event, such as `Written(address,uint64)`
+func (this *Event) Signature() string {
+	return canonicalSignature(this.Name, this.Inputs)
+}
+
+// Id return the event id, which is the first topic of the log
+func (this *Event) Id() types.Hash {
+	var id types.Hash
+	copy(id[:], Hash([]byte(this.Signature())))
+	return id
+}
+
+// Pack encode the values as the log topics and data in the same way as solidity. The indexed values are the topics,
+// string and bytes are indexed by their keccak256 hash. The other values are abi encoded as the data.
+func (this *Event) Pack(values ...interface{}) ([]types.Hash, []byte, error) {
+	if len(values) != len(this.Inputs) {
+		return nil, nil, ArgCountError
+	}
+	topics := []types.Hash{this.Id()}
+	dataTypes := make([]Type, 0, len(values))
+	dataValues := make([]interface{}, 0, len(values))
+	for i, input := range this.Inputs {
+		if !input.Indexed {
+			dataTypes = append(dataTypes, input.Type)
+			dataValues = append(dataValues, values[i])
+			continue
+		}
+		topic, err := indexedTopic(input.Type, values[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		topics = append(topics, topic)
+	}
+	data, err := EncodeArgs(dataTypes, dataValues...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return topics, data, nil
+}
+
+// EventEmitter add the log to the state, the log is attributed to the system contract at address
+type EventEmitter func(address types.Address, topics []types.Hash, data []byte)
+
+// Emit pack the values and emit the event log through emitter, nothing is emitted if emitter is nil
+func (this *Event) Emit(emitter EventEmitter, address types.Address, values ...interface{}) error {
+	if emitter == nil {
+		return nil
+	}
+	topics, data, err := this.Pack(values...)
+	if err != nil {
+		return err
+	}
+	emitter(address, topics, data)
+	return nil
+}
+
+// ABI the abi metadata of the system contract, it is marshaled as the solidity json abi
+type ABI struct {
+	Methods []*Method
+	Events  []*Event
+}
+
+// Event return the event with the specified name, nil if it is not found
+func (this *ABI) Event(name string) *Event {
+	for _, event := range this.Events {
+		if event.Name == name {
+			return event
+		}
+	}
+	return nil
+}
+
+// json representation of the abi argument
+type jsonArgument struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Indexed    *bool          `json:"indexed,omitempty"`
+	Components []jsonArgument `json:"components,omitempty"`
+}
+
+// json representation of the abi method or event
+type jsonEntry struct {
+	Type      string         `json:"type"`
+	Name      string         `json:"name"`
+	Inputs    []jsonArgument `json:"inputs"`
+	Outputs   []jsonArgument `json:"outputs,omitempty"`
+	Anonymous *bool          `json:"anonymous,omitempty"`
+}
+
+// MarshalJSON marshal the abi metadata as the solidity json abi
+func (this *ABI) MarshalJSON() ([]byte, error) {
+	entries := make([]jsonEntry, 0, len(this.Methods)+len(this.Events))
+	for _, method := range this.Methods {
+		entries = append(entries, jsonEntry{
+			Type:    "function",
+			Name:    method.Name,
+			Inputs:  toJsonArguments(method.Inputs, false),
+			Outputs: toJsonArguments(method.Outputs, false),
+		})
+	}
+	for _, event := range this.Events {
+		anonymous := false
+		entries = append(entries, jsonEntry{
+			Type:      "event",
+			Name:      event.Name,
+			Inputs:    toJsonArguments(event.Inputs, true),
+			Anonymous: &anonymous,
+		})
+	}
+	return json.Marshal(entries)
+}
+
+// parse the signature like `name(type [indexed] [argName],...)`
+func parseSignature(signature string, isEvent bool) (string, []Argument, error) {
+	signature = strings.TrimSpace(signature)
+	start := strings.Index(signature, "(")
+	if start <= 0 || !strings.HasSuffix(signature, ")") {
+		return "", nil, errors.Errorf("%v: %s", InvalidSignatureError, signature)
+	}
+	argStrs, err := splitTupleComponents(signature[start+1 : len(signature)-1])
+	if err != nil {
+		return "", nil, errors.Errorf("%v: %s", InvalidSignatureError, signature)
+	}
+	args := make([]Argument, 0, len(argStrs))
+	for _, argStr := range argStrs {
+		fields := strings.Fields(argStr)
+		if len(fields) == 0 {
+			return "", nil, errors.Errorf("%v: %s", InvalidSignatureError, signature)
+		}
+		argType, err := NewType(fields[0])
+		if err != nil {
+			return "", nil, err
+		}
+		arg := Argument{Type: argType}
+		fields = fields[1:]
+		if isEvent && len(fields) > 0 && fields[0] == "indexed" {
+			arg.Indexed = true
+			fields = fields[1:]
+		}
+		switch len(fields) {
+		case 0:
+		case 1:
+			arg.Name = fields[0]
+		default:
+			return "", nil, errors.Errorf("%v: %s", InvalidSignatureError, signature)
+		}
+		args = append(args, arg)
+	}
+	return strings.TrimSpace(signature[:start]), args, nil
+}
+
+// return the canonical signature made up of the argument types
+func canonicalSignature(name string, args []Argument) string {
+	argStrs := make([]string, 0, len(args))
+	for _, arg := range args {
+		argStrs = append(argStrs, arg.Type.String())
+	}
+	return name + "(" + strings.Join(argStrs, ",") + ")"
+}
+
+// encode the indexed value as topic
+func indexedTopic(t Type, value interface{}) (types.Hash, error) {
+	var topic types.Hash
+	switch t.Kind {
+	case StringTy, BytesTy:
+		rv := reflect.ValueOf(value)
+		switch {
+		case rv.Kind() == reflect.String:
+			copy(topic[:], Hash([]byte(rv.String())))
+		case rv.IsValid() && isByteSlice(rv.Type()):
+			copy(topic[:], Hash(rv.Bytes()))
+		default:
+			return topic, errors.Errorf("%v: %T", UnSupportedTypeError, value)
+		}
+	default:
+		encoded, err := EncodeArgs([]Type{t}, value)
+		if err != nil {
+			return topic, err
+		}
+		copy(topic[:], encoded)
+	}
+	return topic, nil
+}
+
+// convert the arguments to json representation
+func toJsonArguments(args []Argument, isEvent bool) []jsonArgument {
+	jsonArgs := make([]jsonArgument, 0, len(args))
+	for _, arg := range args {
+		jsonArg := toJsonArgument(arg.Name, arg.Type)
+		if isEvent {
+			indexed := arg.Indexed
+			jsonArg.Indexed = &indexed
+		}
+		jsonArgs = append(jsonArgs, jsonArg)
+	}
+	return jsonArgs
+}
+
+// convert the type to json representation, tuples are represented by `tuple` with components
+func toJsonArgument(name string, t Type) jsonArgument {
+	suffix := ""
+	for t.Kind == SliceTy || t.Kind == ArrayTy {
+		if t.Kind == SliceTy {
+			suffix = "[]" + suffix
+		} else {
+			suffix = fmt.Sprintf("[%d]", t.Size) + suffix
+		}
+		t = *t.Elem
+	}
+	if t.Kind != TupleTy {
+		return jsonArgument{Name: name, Type: t.String() + suffix}
+	}
+	components := make([]jsonArgument, 0, len(t.Components))
+	for _, component := range t.Components {
+		components = append(components, toJsonArgument("", component))
+	}
+	return jsonArgument{Name: name, Type: "tuple" + suffix, Components: components}
+}
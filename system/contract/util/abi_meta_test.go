@@ -0,0 +1,118 @@
+package util
+
+import (
+	"encoding/json"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewMethod(t *testing.T) {
+	assert := assert.New(t)
+	method, err := NewMethod("Read(uint64 offset, uint64 size)", "bytes")
+	assert.Nil(err)
+	assert.Equal("Read", method.Name)
+	assert.Equal("offset", method.Inputs[0].Name)
+	assert.Equal("Read(uint64,uint64)", method.Signature())
+	assert.Equal(ExtractMethodHash(Hash([]byte("Read(uint64,uint64)"))), method.Id())
+	assert.Equal(1, len(method.Outputs))
+
+	_, err = NewMethod("Read(uint64 indexed offset)")
+	assert.NotNil(err)
+	_, err = NewMethod("Read")
+	assert.NotNil(err)
+	_, err = NewMethod("Read(uint7)")
+	assert.NotNil(err)
+}
+
+func TestMethod_Pack(t *testing.T) {
+	assert := assert.New(t)
+	method := MustNewMethod("Write(uint64 offset,bytes data)")
+	input, err := method.Pack(uint64(5), []byte("Hello"))
+	assert.Nil(err)
+	assert.Equal(method.Id(), input[:4])
+	var (
+		offset uint64
+		data   []byte
+	)
+	assert.Nil(ExtractParam(input[4:], &offset, &data))
+	assert.Equal(uint64(5), offset)
+	assert.Equal([]byte("Hello"), data)
+
+	_, err = method.Pack(uint64(5))
+	assert.Equal(ArgCountError, err)
+}
+
+func TestNewEvent(t *testing.T) {
+	assert := assert.New(t)
+	event, err := NewEvent("Transfer(address indexed from,address indexed to,uint256 value)")
+	assert.Nil(err)
+	assert.Equal("Transfer(address,address,uint256)", event.Signature())
+	assert.True(event.Inputs[0].Indexed)
+	assert.False(event.Inputs[2].Indexed)
+	// keccak256("Transfer(address,address,uint256)")
+	id := event.Id()
+	assert.Equal("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", hexutil.Encode(id[:]))
+
+	_, err = NewEvent("E(uint8 indexed a,uint8 indexed b,uint8 indexed c,uint8 indexed d)")
+	assert.NotNil(err)
+	_, err = NewEvent("E(uint8[] indexed a)")
+	assert.NotNil(err)
+}
+
+func TestEvent_Pack(t *testing.T) {
+	assert := assert.New(t)
+	event := MustNewEvent("Written(address indexed owner,string indexed name,uint64 size,bytes data)")
+	topics, data, err := event.Pack(types.Address{0x1}, "hello", uint64(2), []byte{0x1, 0x2})
+	assert.Nil(err)
+	assert.Equal(3, len(topics))
+	assert.Equal(event.Id(), topics[0])
+	assert.Equal(byte(0x1), topics[1][12])
+	assert.Equal(Hash([]byte("hello")), topics[2][:])
+
+	var size uint64
+	payload := make([]byte, 0)
+	assert.Nil(ExtractParam(data, &size, &payload))
+	assert.Equal(uint64(2), size)
+	assert.Equal([]byte{0x1, 0x2}, payload)
+
+	_, _, err = event.Pack(types.Address{0x1})
+	assert.Equal(ArgCountError, err)
+	_, _, err = event.Pack(types.Address{0x1}, 1, uint64(2), []byte{})
+	assert.NotNil(err)
+}
+
+func TestEvent_Emit(t *testing.T) {
+	assert := assert.New(t)
+	event := MustNewEvent("Closed(uint64 indexed handle)")
+	var logs []*types.Log
+	emitter := func(address types.Address, topics []types.Hash, data []byte) {
+		logs = append(logs, &types.Log{Address: address, Topics: topics, Data: data})
+	}
+	assert.Nil(event.Emit(emitter, types.Address{0x2}, uint64(1)))
+	assert.Equal(1, len(logs))
+	assert.Equal(types.Address{0x2}, logs[0].Address)
+	assert.Equal(byte(1), logs[0].Topics[1][31])
+	assert.Equal(0, len(logs[0].Data))
+
+	// no emitter
+	assert.Nil(event.Emit(nil, types.Address{0x2}, uint64(1)))
+}
+
+func TestABI_MarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+	abi := &ABI{
+		Methods: []*Method{MustNewMethod("Get(string key,(uint64,bytes)[] items)", "address")},
+		Events:  []*Event{MustNewEvent("Put(string indexed key,uint64 size)")},
+	}
+	data, err := json.Marshal(abi)
+	assert.Nil(err)
+	expected := `[
+		{"type":"function","name":"Get","inputs":[{"name":"key","type":"string"},{"name":"items","type":"tuple[]","components":[{"name":"","type":"uint64"},{"name":"","type":"bytes"}]}],"outputs":[{"name":"","type":"address"}]},
+		{"type":"event","name":"Put","inputs":[{"name":"key","type":"string","indexed":true},{"name":"size","type":"uint64","indexed":false}],"anonymous":false}
+	]`
+	assert.JSONEq(expected, string(data))
+	assert.NotNil(abi.Event("Put"))
+	assert.Nil(abi.Event("Get"))
+}
@@ -0,0 +1,271 @@
+package util
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewType(t *testing.T) {
+	assert := assert.New(t)
+	typeStrs := []string{
+		"uint8", "uint256", "int16", "int256", "bool", "address", "bytes1", "bytes32", "bytes", "string",
+		"uint256[]", "bytes32[2]", "string[][3]", "(address,string)", "(uint64,(bool,bytes)[])[2]", "()",
+	}
+	for _, typeStr := range typeStrs {
+		typ, err := NewType(typeStr)
+		assert.Nil(err)
+		assert.Equal(typeStr, typ.String())
+	}
+
+	typ, err := NewType("uint")
+	assert.Nil(err)
+	assert.Equal("uint256", typ.String())
+	typ, err = NewType("int")
+	assert.Nil(err)
+	assert.Equal("int256", typ.String())
+
+	for _, typeStr := range []string{"uint7", "uint264", "bytes33", "bytes0", "foo", "uint256[0]", "(uint256", "[]"} {
+		_, err := NewType(typeStr)
+		assert.NotNil(err)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	assert := assert.New(t)
+	type tuple struct {
+		Name    string
+		Balance *big.Int
+		Tags    [][4]byte
+		private uint64
+	}
+	values := []interface{}{
+		uint8(0), uint64(0), int32(0), int(0), true, "", types.Address{}, [32]byte{},
+		new(big.Int), &[2]uint16{}, tuple{}, &[]types.Address{},
+	}
+	expects := []string{
+		"uint8", "uint64", "int32", "int64", "bool", "string", "address", "bytes32",
+		"uint256", "uint16[2]", "(string,uint256,bytes4[])", "address[]",
+	}
+	for i, value := range values {
+		typ, err := TypeOf(reflect.TypeOf(value))
+		assert.Nil(err)
+		assert.Equal(expects[i], typ.String())
+	}
+	_, err := TypeOf(reflect.TypeOf(map[string]string{}))
+	assert.Equal(UnSupportedTypeError, err)
+}
+
+func TestEncodeArgs(t *testing.T) {
+	assert := assert.New(t)
+	argTypes := mustTypes("uint256", "uint32[]", "bytes10", "bytes")
+	expect, _ := hexutil.Decode("0x" +
+		"0000000000000000000000000000000000000000000000000000000000000123" +
+		"0000000000000000000000000000000000000000000000000000000000000080" +
+		"3132333435363738393000000000000000000000000000000000000000000000" +
+		"00000000000000000000000000000000000000000000000000000000000000e0" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000456" +
+		"0000000000000000000000000000000000000000000000000000000000000789" +
+		"000000000000000000000000000000000000000000000000000000000000000d" +
+		"48656c6c6f2c20776f726c642100000000000000000000000000000000000000")
+	bytes10 := [10]byte{}
+	copy(bytes10[:], "1234567890")
+	ret, err := EncodeArgs(argTypes, big.NewInt(0x123), []uint32{0x456, 0x789}, bytes10, []byte("Hello, world!"))
+	assert.Nil(err)
+	assert.Equal(expect, ret)
+
+	var (
+		arg1 = new(big.Int)
+		arg2 []uint32
+		arg3 [10]byte
+		arg4 string
+	)
+	err = DecodeArgs(argTypes, ret, arg1, &arg2, &arg3, &arg4)
+	assert.Nil(err)
+	assert.Equal(big.NewInt(0x123), arg1)
+	assert.Equal([]uint32{0x456, 0x789}, arg2)
+	assert.Equal(bytes10, arg3)
+	assert.Equal("Hello, world!", arg4)
+}
+
+func TestEncodeArgs1(t *testing.T) {
+	assert := assert.New(t)
+	argTypes := mustTypes("uint256[][]", "string[]")
+	expect, _ := hexutil.Decode("0x" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000140" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"00000000000000000000000000000000000000000000000000000000000000e0" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"6f6e650000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"74776f0000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"7468726565000000000000000000000000000000000000000000000000000000")
+	ret, err := EncodeArgs(argTypes, [][]uint64{{1, 2}, {3}}, []string{"one", "two", "three"})
+	assert.Nil(err)
+	assert.Equal(expect, ret)
+
+	var (
+		arg1 [][]uint64
+		arg2 []string
+	)
+	err = DecodeArgs(argTypes, ret, &arg1, &arg2)
+	assert.Nil(err)
+	assert.Equal([][]uint64{{1, 2}, {3}}, arg1)
+	assert.Equal([]string{"one", "two", "three"}, arg2)
+}
+
+func TestEncodeArgs2(t *testing.T) {
+	assert := assert.New(t)
+	type record struct {
+		Owner  types.Address
+		Amount int64
+		Memo   string
+		Valid  bool
+	}
+	argTypes := mustTypes("(address,int64,string,bool)[2]", "int8")
+	records := [2]record{
+		{Owner: types.Address{0x01}, Amount: -1, Memo: "a", Valid: true},
+		{Owner: types.Address{0x02}, Amount: 100, Memo: strings.Repeat("b", 40)},
+	}
+	ret, err := EncodeArgs(argTypes, records, int8(-128))
+	assert.Nil(err)
+
+	var (
+		arg1 [2]record
+		arg2 int8
+	)
+	err = DecodeArgs(argTypes, ret, &arg1, &arg2)
+	assert.Nil(err)
+	assert.Equal(records, arg1)
+	assert.Equal(int8(-128), arg2)
+
+	var generic interface{}
+	err = DecodeArgs(mustTypes("(address,int64,string,bool)[2]"), ret, &generic)
+	assert.Nil(err)
+	assert.Equal(2, reflect.ValueOf(generic).Len())
+}
+
+func TestEncodeArgs3(t *testing.T) {
+	assert := assert.New(t)
+	_, err := EncodeArgs(mustTypes("uint8"), uint64(256))
+	assert.Equal(ValueOutOfRangeError, err)
+	_, err = EncodeArgs(mustTypes("uint256"), big.NewInt(-1))
+	assert.Equal(ValueOutOfRangeError, err)
+	_, err = EncodeArgs(mustTypes("bytes4"), []byte{0x01})
+	assert.Equal(ValueOutOfRangeError, err)
+	_, err = EncodeArgs(mustTypes("uint256[2]"), []uint64{1})
+	assert.Equal(ValueOutOfRangeError, err)
+	_, err = EncodeArgs(mustTypes("bool"), "true")
+	assert.Equal(UnSupportedTypeError, err)
+	_, err = EncodeArgs(mustTypes("bool", "bool"), true)
+	assert.Equal(ArgCountError, err)
+}
+
+func TestDecodeArgs(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		str   string
+		num   uint8
+		flag  bool
+		addr  types.Address
+		bytes []byte
+	)
+	// short input
+	err := DecodeArgs(mustTypes("uint64"), make([]byte, 31), &num)
+	assert.Equal(ShortInputError, err)
+
+	// offset out of range
+	input, _ := hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000100")
+	err = DecodeArgs(mustTypes("string"), input, &str)
+	assert.Equal(InvalidOffsetError, err)
+
+	// length out of range
+	input, _ = hexutil.Decode("0x00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000100")
+	err = DecodeArgs(mustTypes("bytes"), input, &bytes)
+	assert.Equal(ShortInputError, err)
+
+	// huge array length
+	input, _ = hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000020ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	var nums []uint64
+	err = DecodeArgs(mustTypes("uint64[]"), input, &nums)
+	assert.Equal(ShortInputError, err)
+
+	// dirty padding
+	input, _ = hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000100")
+	err = DecodeArgs(mustTypes("uint8"), input, &num)
+	assert.Equal(InvalidPaddingError, err)
+	input, _ = hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000002")
+	err = DecodeArgs(mustTypes("bool"), input, &flag)
+	assert.Equal(InvalidPaddingError, err)
+	input, _ = hexutil.Decode("0x0100000000000000000000000000000000000000000000000000000000000001")
+	err = DecodeArgs(mustTypes("address"), input, &addr)
+	assert.Equal(InvalidPaddingError, err)
+
+	// target too small
+	input, _ = hexutil.Decode("0x0000000000000000000000000000000000000000000000000000000000000100")
+	err = DecodeArgs(mustTypes("uint256"), input, &num)
+	assert.Equal(ValueOutOfRangeError, err)
+
+	// invalid target
+	err = DecodeArgs(mustTypes("uint256"), input, num)
+	assert.Equal(InvalidUnmarshalError, err)
+
+	// the elements share the same data
+	input, _ = hexutil.Decode("0x" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000007")
+	var nested [][]uint64
+	err = DecodeArgs(mustTypes("uint256[][]"), input, &nested)
+	assert.Equal(InvalidOffsetError, err)
+}
+
+func mustTypes(typeStrs ...string) []Type {
+	argTypes := make([]Type, 0, len(typeStrs))
+	for _, typeStr := range typeStrs {
+		argType, err := NewType(typeStr)
+		if err != nil {
+			panic(err)
+		}
+		argTypes = append(argTypes, argType)
+	}
+	return argTypes
+}
+
+func TestDecodeArgs_GoInt(t *testing.T) {
+	assert := assert.New(t)
+	// go int and uint round trip through the types derived from them
+	var (
+		num  int
+		unum uint
+	)
+	intType, _ := TypeOf(reflect.TypeOf(num))
+	uintType, _ := TypeOf(reflect.TypeOf(unum))
+	input, err := EncodeArgs([]Type{intType, uintType}, -42, uint(math.MaxUint64))
+	assert.Nil(err)
+	assert.Nil(DecodeArgs([]Type{intType, uintType}, input, &num, &unum))
+	assert.Equal(-42, num)
+	assert.Equal(uint(math.MaxUint64), unum)
+}
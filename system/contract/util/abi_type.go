@@ -0,0 +1,355 @@
+package util
+
+import (
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/constant"
+	"github.com/pkg/errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// abi type kinds
+const (
+	IntTy byte = iota
+	UintTy
+	BoolTy
+	AddressTy
+	FixedBytesTy
+	BytesTy
+	StringTy
+	SliceTy
+	ArrayTy
+	TupleTy
+)
+
+var InvalidTypeError = errors.New("invalid abi type")
+
+var (
+	addressT = reflect.TypeOf(types.Address{})
+	bigT     = reflect.TypeOf(big.Int{})
+	bigPtrT  = reflect.TypeOf(&big.Int{})
+)
+
+// Type is the solidity abi type of a contract argument or return value
+type Type struct {
+	Kind       byte
+	Size       int    // bit size of intN/uintN, byte size of bytesN, length of T[N]
+	Elem       *Type  // element type of T[] and T[N]
+	Components []Type // component types of a tuple
+}
+
+// NewType parse the solidity abi type from its string representation, such as
+// `uint256`, `bytes32[]`, `(address,string)[2]`
+func NewType(t string) (Type, error) {
+	t = strings.TrimSpace(t)
+	if strings.HasSuffix(t, "]") {
+		start := strings.LastIndex(t, "[")
+		if start <= 0 {
+			return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+		}
+		elem, err := NewType(t[:start])
+		if err != nil {
+			return Type{}, err
+		}
+		lenStr := t[start+1 : len(t)-1]
+		if len(lenStr) == 0 {
+			return Type{Kind: SliceTy, Elem: &elem}, nil
+		}
+		size, err := strconv.Atoi(lenStr)
+		if err != nil || size <= 0 {
+			return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+		}
+		return Type{Kind: ArrayTy, Size: size, Elem: &elem}, nil
+	}
+
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") {
+		compStrs, err := splitTupleComponents(t[1 : len(t)-1])
+		if err != nil {
+			return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+		}
+		components := make([]Type, 0, len(compStrs))
+		for _, compStr := range compStrs {
+			component, err := NewType(compStr)
+			if err != nil {
+				return Type{}, err
+			}
+			components = append(components, component)
+		}
+		return Type{Kind: TupleTy, Components: components}, nil
+	}
+
+	switch {
+	case t == "bool":
+		return Type{Kind: BoolTy}, nil
+	case t == "address":
+		return Type{Kind: AddressTy}, nil
+	case t == "string":
+		return Type{Kind: StringTy}, nil
+	case t == "bytes":
+		return Type{Kind: BytesTy}, nil
+	case t == "byte":
+		return Type{Kind: FixedBytesTy, Size: 1}, nil
+	case strings.HasPrefix(t, "bytes"):
+		size, err := strconv.Atoi(t[len("bytes"):])
+		if err != nil || size <= 0 || size > constant.EvmWordSize {
+			return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+		}
+		return Type{Kind: FixedBytesTy, Size: size}, nil
+	case strings.HasPrefix(t, "uint"):
+		size, err := parseIntSize(t[len("uint"):])
+		if err != nil {
+			return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+		}
+		return Type{Kind: UintTy, Size: size}, nil
+	case strings.HasPrefix(t, "int"):
+		size, err := parseIntSize(t[len("int"):])
+		if err != nil {
+			return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+		}
+		return Type{Kind: IntTy, Size: size}, nil
+	default:
+		return Type{}, errors.Errorf("%v: %s", InvalidTypeError, t)
+	}
+}
+
+// TypeOf return the abi type corresponding to the go type.
+// uintN/intN map to uintN/intN, uint/int map to uint64/int64, *big.Int maps to uint256,
+// types.Address maps to address, [N]byte maps to bytesN, []byte maps to bytes,
+// structs map to tuples made up of their exported fields.
+func TypeOf(rt reflect.Type) (Type, error) {
+	switch rt {
+	case addressT:
+		return Type{Kind: AddressTy}, nil
+	case bigT, bigPtrT:
+		return Type{Kind: UintTy, Size: 256}, nil
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		return Type{Kind: BoolTy}, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Type{Kind: UintTy, Size: rt.Bits()}, nil
+	case reflect.Uint:
+		// uint is 64 bits wide on the supported platforms
+		return Type{Kind: UintTy, Size: 64}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Type{Kind: IntTy, Size: rt.Bits()}, nil
+	case reflect.Int:
+		return Type{Kind: IntTy, Size: 64}, nil
+	case reflect.String:
+		return Type{Kind: StringTy}, nil
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return Type{Kind: BytesTy}, nil
+		}
+		elem, err := TypeOf(rt.Elem())
+		if err != nil {
+			return Type{}, err
+		}
+		return Type{Kind: SliceTy, Elem: &elem}, nil
+	case reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 && rt.Len() > 0 && rt.Len() <= constant.EvmWordSize {
+			return Type{Kind: FixedBytesTy, Size: rt.Len()}, nil
+		}
+		if rt.Len() == 0 {
+			return Type{}, UnSupportedTypeError
+		}
+		elem, err := TypeOf(rt.Elem())
+		if err != nil {
+			return Type{}, err
+		}
+		return Type{Kind: ArrayTy, Size: rt.Len(), Elem: &elem}, nil
+	case reflect.Struct:
+		components := make([]Type, 0, rt.NumField())
+		for i := 0; i < rt.NumField(); i++ {
+			if len(rt.Field(i).PkgPath) > 0 {
+				// unexported field
+				continue
+			}
+			component, err := TypeOf(rt.Field(i).Type)
+			if err != nil {
+				return Type{}, err
+			}
+			components = append(components, component)
+		}
+		return Type{Kind: TupleTy, Components: components}, nil
+	case reflect.Ptr:
+		return TypeOf(rt.Elem())
+	default:
+		return Type{}, UnSupportedTypeError
+	}
+}
+
+// String return the canonical representation of the type, which is used to compute the method hash
+func (t Type) String() string {
+	switch t.Kind {
+	case IntTy:
+		return fmt.Sprintf("int%d", t.Size)
+	case UintTy:
+		return fmt.Sprintf("uint%d", t.Size)
+	case BoolTy:
+		return "bool"
+	case AddressTy:
+		return "address"
+	case FixedBytesTy:
+		return fmt.Sprintf("bytes%d", t.Size)
+	case BytesTy:
+		return "bytes"
+	case StringTy:
+		return "string"
+	case SliceTy:
+		return t.Elem.String() + "[]"
+	case ArrayTy:
+		return fmt.Sprintf("%s[%d]", t.Elem.String(), t.Size)
+	case TupleTy:
+		compStrs := make([]string, 0, len(t.Components))
+		for _, component := range t.Components {
+			compStrs = append(compStrs, component.String())
+		}
+		return "(" + strings.Join(compStrs, ",") + ")"
+	default:
+		return "unknown"
+	}
+}
+
+// isDynamic check whether the type is encoded in the tail part
+func (t Type) isDynamic() bool {
+	switch t.Kind {
+	case BytesTy, StringTy, SliceTy:
+		return true
+	case ArrayTy:
+		return t.Elem.isDynamic()
+	case TupleTy:
+		for _, component := range t.Components {
+			if component.isDynamic() {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// headSize return the size of the type in the head part
+func (t Type) headSize() int {
+	if t.isDynamic() {
+		return constant.EvmWordSize
+	}
+	switch t.Kind {
+	case ArrayTy:
+		return t.Size * t.Elem.headSize()
+	case TupleTy:
+		size := 0
+		for _, component := range t.Components {
+			size += component.headSize()
+		}
+		return size
+	default:
+		return constant.EvmWordSize
+	}
+}
+
+// goType return the natural go type used to hold the decoded value
+func (t Type) goType() reflect.Type {
+	switch t.Kind {
+	case IntTy:
+		switch t.Size {
+		case 8:
+			return reflect.TypeOf(int8(0))
+		case 16:
+			return reflect.TypeOf(int16(0))
+		case 32:
+			return reflect.TypeOf(int32(0))
+		case 64:
+			return reflect.TypeOf(int64(0))
+		default:
+			return bigPtrT
+		}
+	case UintTy:
+		switch t.Size {
+		case 8:
+			return reflect.TypeOf(uint8(0))
+		case 16:
+			return reflect.TypeOf(uint16(0))
+		case 32:
+			return reflect.TypeOf(uint32(0))
+		case 64:
+			return reflect.TypeOf(uint64(0))
+		default:
+			return bigPtrT
+		}
+	case BoolTy:
+		return reflect.TypeOf(false)
+	case AddressTy:
+		return addressT
+	case FixedBytesTy:
+		return reflect.ArrayOf(t.Size, reflect.TypeOf(byte(0)))
+	case BytesTy:
+		return reflect.TypeOf([]byte{})
+	case StringTy:
+		return reflect.TypeOf("")
+	case SliceTy:
+		return reflect.SliceOf(t.Elem.goType())
+	case ArrayTy:
+		return reflect.ArrayOf(t.Size, t.Elem.goType())
+	case TupleTy:
+		fields := make([]reflect.StructField, 0, len(t.Components))
+		for i, component := range t.Components {
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("Field%d", i),
+				Type: component.goType(),
+			})
+		}
+		return reflect.StructOf(fields)
+	default:
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+}
+
+// parse the bit size of intN/uintN, empty size means 256
+func parseIntSize(sizeStr string) (int, error) {
+	if len(sizeStr) == 0 {
+		return 256, nil
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil {
+		return 0, err
+	}
+	if size <= 0 || size > 256 || size%8 != 0 {
+		return 0, InvalidTypeError
+	}
+	return size, nil
+}
+
+// split the tuple component string by the top level commas
+func splitTupleComponents(s string) ([]string, error) {
+	if len(strings.TrimSpace(s)) == 0 {
+		return []string{}, nil
+	}
+	components := make([]string, 0)
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, InvalidTypeError
+			}
+		case ',':
+			if depth == 0 {
+				components = append(components, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, InvalidTypeError
+	}
+	return append(components, s[start:]), nil
+}
@@ -127,3 +127,13 @@ func TestEncodeReturnValue4(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(expect, retB)
 }
+
+func TestExtractParam4(t *testing.T) {
+	assert := assert.New(t)
+	arg1 := new(string)
+	input, _ := hexutil.Decode("0x939531c000000000000000000000000000000000000000000000000000000000000000")
+	methodHash := ExtractMethodHash(input[:2])
+	assert.Equal(input[:2], methodHash)
+	err := ExtractParam(input[4:], arg1)
+	assert.Equal(ShortInputError, err)
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"github.com/pkg/errors"
+)
+
+var OutOfGasError = errors.New("out of gas")
+
+// GasMeter meters the gas used by the system contract while it executes, such as the gas of the
+// data written to the state, which is not known before the execution. The nil meter charges nothing.
+type GasMeter struct {
+	gas uint64
+}
+
+// NewGasMeter create the meter with the gas available to the system contract call
+func NewGasMeter(gas uint64) *GasMeter {
+	return &GasMeter{gas: gas}
+}
+
+// Gas return the gas left
+func (this *GasMeter) Gas() uint64 {
+	if this == nil {
+		return 0
+	}
+	return this.gas
+}
+
+// UseGas use the gas, all the gas left is used up if it is not enough
+func (this *GasMeter) UseGas(gas uint64) error {
+	if this == nil {
+		return nil
+	}
+	if this.gas < gas {
+		this.gas = 0
+		return OutOfGasError
+	}
+	this.gas -= gas
+	return nil
+}
+
+// RefundGas return the gas not used, such as the gas left by a call, to the meter
+func (this *GasMeter) RefundGas(gas uint64) {
+	if this == nil {
+		return
+	}
+	this.gas += gas
+}
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGasMeter(t *testing.T) {
+	assert := assert.New(t)
+	meter := NewGasMeter(100)
+	assert.Nil(meter.UseGas(60))
+	assert.Equal(uint64(40), meter.Gas())
+	meter.RefundGas(10)
+	assert.Equal(uint64(50), meter.Gas())
+	assert.Equal(OutOfGasError, meter.UseGas(51))
+	assert.Equal(uint64(0), meter.Gas())
+
+	var nilMeter *GasMeter
+	assert.Nil(nilMeter.UseGas(1))
+	assert.Equal(uint64(0), nilMeter.Gas())
+}
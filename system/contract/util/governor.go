@@ -0,0 +1,64 @@
+package util
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+const governorKey = "SystemContractGovernorKey"
+
+var (
+	GovernorNotDefinedError = errors.New("governor is not defined")
+	NotGovernorError        = errors.New("caller is not the governor")
+)
+
+// Governor the governor of a system contract, it is the only account allowed to change the contract settings.
+// The governor is recorded in the contract state, it is set at genesis and then transferred by the governor.
+type Governor struct {
+	db  *repository.Repository
+	key []byte
+}
+
+// NewGovernor create the governor of the system contract with the specified address
+func NewGovernor(db *repository.Repository, contract types.Address) *Governor {
+	return &Governor{
+		db:  db,
+		key: Hash(append([]byte(governorKey), contract[:]...)),
+	}
+}
+
+// Address return the address of the governor, ok is false if the governor is not defined
+func (this *Governor) Address() (governor types.Address, ok bool) {
+	val, err := this.db.Get(this.key)
+	if err != nil || len(val) != len(governor) {
+		return types.Address{}, false
+	}
+	copy(governor[:], val)
+	return governor, true
+}
+
+// Set set the governor without checking the caller, it is used to initialize the genesis state
+func (this *Governor) Set(governor types.Address) error {
+	return this.db.Put(this.key, governor[:])
+}
+
+// Check check the caller is the governor
+func (this *Governor) Check(caller types.Address) error {
+	governor, ok := this.Address()
+	if !ok {
+		return GovernorNotDefinedError
+	}
+	if caller != governor {
+		return NotGovernorError
+	}
+	return nil
+}
+
+// Transfer transfer the governance to the new governor, only the current governor can transfer it
+func (this *Governor) Transfer(caller, governor types.Address) error {
+	if err := this.Check(caller); err != nil {
+		return err
+	}
+	return this.Set(governor)
+}
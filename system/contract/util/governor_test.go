@@ -0,0 +1,52 @@
+package util
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func mockGovernorDB() *repository.Repository {
+	db := &repository.Repository{}
+	cache := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Get", func(chain *repository.Repository, key []byte) ([]byte, error) {
+		return cache[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(db), "Put", func(chain *repository.Repository, key []byte, value []byte) error {
+		cache[string(key)] = value
+		return nil
+	})
+	return db
+}
+
+func TestGovernor(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	db := mockGovernorDB()
+	alice, bob := types.Address{0x1}, types.Address{0x2}
+	governor := NewGovernor(db, types.Address{0xa})
+
+	_, ok := governor.Address()
+	assert.False(ok)
+	assert.Equal(GovernorNotDefinedError, governor.Check(alice))
+	assert.Equal(GovernorNotDefinedError, governor.Transfer(alice, bob))
+
+	assert.Nil(governor.Set(alice))
+	addr, ok := governor.Address()
+	assert.True(ok)
+	assert.Equal(alice, addr)
+	assert.Nil(governor.Check(alice))
+	assert.Equal(NotGovernorError, governor.Check(bob))
+
+	assert.Equal(NotGovernorError, governor.Transfer(bob, bob))
+	assert.Nil(governor.Transfer(alice, bob))
+	assert.Equal(NotGovernorError, governor.Check(alice))
+	assert.Nil(governor.Check(bob))
+
+	// governors of the contracts are independent
+	_, ok = NewGovernor(db, types.Address{0xb}).Address()
+	assert.False(ok)
+}
@@ -1,42 +1,197 @@
 package evm
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/Interaction"
+	"github.com/DSiSc/evm-NG/system/contract/async"
 	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/oracle"
 	"github.com/DSiSc/evm-NG/system/contract/rpc"
 	"github.com/DSiSc/evm-NG/system/contract/storage"
+	"github.com/DSiSc/evm-NG/system/contract/token"
+	sysutil "github.com/DSiSc/evm-NG/system/contract/util"
+	"math/big"
 )
 
-// SysContractExecutionFunc system contract execute function
-type SysContractExecutionFunc func(interpreter *EVM, contract ContractRef, input []byte) ([]byte, error)
+// SysContractExecutionFunc system contract execute function, the gas used during the execution is charged from gas
+type SysContractExecutionFunc func(interpreter *EVM, contract ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error)
+
+// SysContractGasFunc return the gas charged before executing the system contract with input
+type SysContractGasFunc func(input []byte) uint64
+
+// SysContractViewFunc check the method of the system contract called with input doesn't modify the state
+type SysContractViewFunc func(input []byte) bool
 
 // system call routes
 var routes = make(map[types.Address]SysContractExecutionFunc)
 
+// gas charged by the system contracts on top of params.SysContractCallGas
+var gasFuncs = make(map[types.Address]SysContractGasFunc)
+
+// view methods of the system contracts, the contracts without view function can't be called statically
+var viewFuncs = make(map[types.Address]SysContractViewFunc)
+
+// method hash of the solidity revert reason `Error(string)`
+var revertReasonMethodHash = sysutil.ExtractMethodHash(sysutil.Hash([]byte("Error(string)")))
+
+// defaultRevertReason is the revert reason of the errors not in revertReasons
+const defaultRevertReason = "system contract execution failed"
+
+// revertReasons are the errors forwarded as the revert reason of the failed system contract calls.
+// They are matched by message, since the errors replayed from the storage witness lose their identity.
+var revertReasons = makeRevertReasons(
+	errors.New("unknown method"),
+	ErrOutOfGas, ErrDepth, ErrInsufficientBalance, errExecutionReverted, errSysContractValue,
+	context.DeadlineExceeded, context.Canceled,
+	sysutil.ShortInputError, sysutil.InvalidOffsetError, sysutil.ValueOutOfRangeError, sysutil.InvalidPaddingError,
+	sysutil.ArgCountError, sysutil.NilValueError, sysutil.UnSupportedTypeError, sysutil.InvalidUnmarshalError,
+	sysutil.GovernorNotDefinedError, sysutil.NotGovernorError,
+	buffer.InvalidHandleError, buffer.InvalidPositionError,
+	storage.ObjectNotFoundError, storage.ObjectTooLargeError, storage.UnknownBackendError, storage.InvalidObjectNameError,
+	storage.ContentHashMismatchError, storage.WitnessMissingError, storage.WitnessMismatchError, storage.WitnessUnusedError,
+	oracle.InvalidJsonPathError, oracle.JsonPathNotFoundError, oracle.NotWhitelistedError, oracle.InvalidSignatureError,
+	oracle.ResponseTooLargeError, oracle.MissingSignatureError, oracle.UnexpectedSignerError, oracle.InvalidStatusCodeError,
+	oracle.InvalidTimestampError, oracle.StaleResponseError, oracle.EndpointNotFoundError, oracle.WitnessRequiredError,
+	Interaction.RecordNotFoundError, Interaction.RecordExistError, Interaction.TransactionNotFoundError,
+	Interaction.HeaderNotFoundError, Interaction.HeaderConflictError, Interaction.InsufficientQuorumError,
+	Interaction.InvalidMerkleProofError, Interaction.HeaderMismatchError, Interaction.NoValidatorsDefinedError,
+	Interaction.UnknownChainError, Interaction.ProofNotSupportedError, Interaction.BridgeNotDefinedError,
+	async.RequestNotFoundError, async.RequestFulfilledError, async.PermissionDeniedError, async.FulfillerNotDefinedError,
+	token.InsufficientBalanceError, token.InsufficientAllowanceError, token.ZeroAddressError,
+	token.SupplyOverflowError,
+	rpc.RouteNotFoundError, rpc.UnsupportedArgError, rpc.FundsReceivedError,
+)
+
+func makeRevertReasons(errs ...error) map[string]bool {
+	reasons := make(map[string]bool, len(errs))
+	for _, err := range errs {
+		reasons[err.Error()] = true
+	}
+	return reasons
+}
+
 func init() {
-	routes[buffer.SystemBufferAddr] = func(execEvm *EVM, contract ContractRef, input []byte) ([]byte, error) {
-		systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB)
+	routes[buffer.SystemBufferAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		systemBuffer := openSystemBuffer(execEvm, caller.Address())
+		systemBuffer.SetEventEmitter(execEvm.EmitLog)
+		systemBuffer.SetGasMeter(gas)
 		return buffer.BufferExecute(systemBuffer, input)
 	}
+	viewFuncs[buffer.SystemBufferAddr] = buffer.IsViewMethod
 
-	routes[storage.TencentCosAddr] = func(execEvm *EVM, caller ContractRef, input []byte) ([]byte, error) {
-		systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB)
+	routes[storage.TencentCosAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		systemBuffer := openSystemBuffer(execEvm, caller.Address())
+		systemBuffer.SetGasMeter(gas)
 		systemBufferReadWriter := buffer.NewSystemBufferReadWriterCloser(systemBuffer)
-		tencentCos := storage.NewTencentCosContract(systemBufferReadWriter)
+		tencentCos := storage.NewTencentCosContract(execEvm.AbortContext(), systemBufferReadWriter, execEvm.StorageWitness)
+		tencentCos.SetEventEmitter(execEvm.EmitLog)
+		tencentCos.SetGasMeter(gas)
 		return storage.CosExecute(tencentCos, input)
 	}
 
-	routes[rpc.RpcContractAddr] = func(execEvm *EVM, caller ContractRef, input []byte) ([]byte, error) {
-		return rpc.Handler(input)
+	routes[storage.ObjectStorageAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		systemBuffer := openSystemBuffer(execEvm, caller.Address())
+		systemBuffer.SetGasMeter(gas)
+		systemBufferReadWriter := buffer.NewSystemBufferReadWriterCloser(systemBuffer)
+		objectStorage := storage.NewObjectStorageContract(execEvm.AbortContext(), systemBufferReadWriter, execEvm.StorageWitness)
+		objectStorage.SetEventEmitter(execEvm.EmitLog)
+		objectStorage.SetGasMeter(gas)
+		return storage.StorageExecute(objectStorage, input)
+	}
+
+	routes[oracle.OracleAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		systemBuffer := openSystemBuffer(execEvm, caller.Address())
+		systemBuffer.SetGasMeter(gas)
+		systemBufferReadWriter := buffer.NewSystemBufferReadWriterCloser(systemBuffer)
+		oracleContract := oracle.NewOracleContract(execEvm.AbortContext(), execEvm.StateDB, execEvm.Time.Uint64(), systemBufferReadWriter, execEvm.StorageWitness)
+		return oracle.OracleExecute(oracleContract, caller.Address(), input)
+	}
+
+	routes[Interaction.CrossChainAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		crossChain := Interaction.NewCrossChainContract(execEvm.StateDB, execEvm.BlockNumber.Uint64(), execEvm.StorageWitness)
+		crossChain.SetEventEmitter(execEvm.EmitLog)
+		return Interaction.CrossChainExecute(crossChain, caller.Address(), input)
+	}
+	viewFuncs[Interaction.CrossChainAddr] = Interaction.IsCrossChainViewMethod
+
+	routes[Interaction.HeaderRelayAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		headerRelay := Interaction.NewHeaderRelayContract(execEvm.StateDB)
+		return Interaction.HeaderRelayExecute(headerRelay, caller.Address(), input)
+	}
+	viewFuncs[Interaction.HeaderRelayAddr] = Interaction.IsHeaderRelayViewMethod
+
+	routes[async.AsyncRequestAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		asyncRequest := async.NewAsyncRequestContract(execEvm.StateDB, execEvm.BlockNumber.Uint64(), execEvm.EmitLog)
+		return async.AsyncExecute(asyncRequest, caller.Address(), input, gas, func(to types.Address, callbackInput []byte, callbackGas uint64) (uint64, error) {
+			_, leftOver, err := execEvm.Call(AccountRef(async.AsyncRequestAddr), to, callbackInput, callbackGas, big.NewInt(0))
+			return leftOver, err
+		})
+	}
+	gasFuncs[async.AsyncRequestAddr] = async.RequiredGas
+	viewFuncs[async.AsyncRequestAddr] = async.IsViewMethod
+
+	routes[token.TokenAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		nativeToken := token.NewTokenContract(execEvm.StateDB, execEvm.EmitLog)
+		nativeToken.SetGasMeter(gas)
+		return token.TokenExecute(nativeToken, caller.Address(), input)
+	}
+	viewFuncs[token.TokenAddr] = token.IsViewMethod
+
+	routes[rpc.RpcContractAddr] = func(execEvm *EVM, caller ContractRef, input []byte, gas *sysutil.GasMeter) ([]byte, error) {
+		return rpc.Handler(execEvm.StateDB, execEvm.EmitLog, input)
 	}
 }
 
-//IsSystemContract check the contract with specified address is system contract
+// IsSystemContract check the contract with specified address is system contract
 func IsSystemContract(addr types.Address) bool {
 	return routes[addr] != nil
 }
 
+// SysContractRequiredGas return the gas charged for calling the system contract with input
+func SysContractRequiredGas(addr types.Address, input []byte) uint64 {
+	gas := params.SysContractCallGas
+	if gasFunc := gasFuncs[addr]; gasFunc != nil {
+		if contractGas, overflow := math.SafeAdd(gas, gasFunc(input)); !overflow {
+			return contractGas
+		}
+		return math.MaxUint64
+	}
+	return gas
+}
+
+// IsSysContractViewMethod check the method of the system contract called with input doesn't modify the state
+func IsSysContractViewMethod(addr types.Address, input []byte) bool {
+	viewFunc := viewFuncs[addr]
+	return viewFunc != nil && viewFunc(input)
+}
+
 // GetSystemContractExecFunc get system contract execution function by address
 func GetSystemContractExecFunc(addr types.Address) SysContractExecutionFunc {
 	return routes[addr]
 }
+
+// open the default system buffer owned by the caller, all the buffers of the caller will be released when the transaction ends
+func openSystemBuffer(execEvm *EVM, owner types.Address) *buffer.SystemBufferContract {
+	systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB, owner, buffer.DefaultHandle)
+	execEvm.RegisterTxEndHook(fmt.Sprintf("buffer-%x", owner), systemBuffer.Release)
+	return systemBuffer
+}
+
+// encode the error as solidity revert reason. Only the known errors are forwarded, the others,
+// such as the errors from remote services containing the request id, revert with the default reason.
+func encodeRevertReason(err error) []byte {
+	reasonStr := defaultRevertReason
+	if revertReasons[err.Error()] {
+		reasonStr = err.Error()
+	}
+	reason, encodeErr := sysutil.EncodeReturnValue(reasonStr)
+	if encodeErr != nil {
+		return nil
+	}
+	return append(append([]byte{}, revertReasonMethodHash...), reason...)
+}